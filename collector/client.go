@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+const (
+	defaultAuthCheckInterval = time.Minute
+	defaultAuthRebuildAfter  = 3
+)
+
+// buildClient returns a client whose credentials can be reloaded without
+// restarting the collector. Token files, the in-cluster projected
+// ServiceAccount token among them, are re-read by client-go as they rotate;
+// a token or certificate written into the kubeconfig itself is only picked
+// up again when the returned transport is rebuilt. Requests are limited to
+// qps, with bursts up to burst, client-side. A kubeContext other than ""
+// selects that context of the kubeconfig instead of its current one.
+func buildClient(kubeconfigPath, kubeContext string, qps float32, burst int) (kubernetes.Interface, *reloadingTransport, error) {
+	config, err := loadConfig(kubeconfigPath, kubeContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.QPS, config.Burst = qps, burst
+	rt, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client transport: %w", err)
+	}
+	transport := &reloadingTransport{kubeconfig: kubeconfigPath, kubeContext: kubeContext, rt: rt}
+	client, err := kubernetes.NewForConfigAndClient(config, &http.Client{Transport: transport, Timeout: config.Timeout})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, transport, nil
+}
+
+func loadConfig(kubeconfigPath, kubeContext string) (*rest.Config, error) {
+	var config *rest.Config
+	var err error
+	if kubeContext != "" {
+		// A named context is always in a kubeconfig: --kubeconfig, else
+		// $KUBECONFIG, else ~/.kube/config.
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = kubeconfigPath
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+			&clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
+	} else if kubeconfigPath != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	} else if k := os.Getenv("KUBECONFIG"); k != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", k)
+	} else {
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			config, err = clientcmd.BuildConfigFromFlags("", os.Getenv("HOME")+"/.kube/config")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig error: %w", err)
+	}
+	return config, nil
+}
+
+// reloadingTransport carries every request of the client, through a
+// transport that rebuild replaces with one built from freshly loaded
+// credentials. Watches already open keep the old transport until they
+// reconnect.
+type reloadingTransport struct {
+	kubeconfig  string
+	kubeContext string
+
+	mu sync.RWMutex
+	rt http.RoundTripper
+}
+
+func (t *reloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	rt := t.rt
+	t.mu.RUnlock()
+	return rt.RoundTrip(req)
+}
+
+func (t *reloadingTransport) rebuild() error {
+	config, err := loadConfig(t.kubeconfig, t.kubeContext)
+	if err != nil {
+		return err
+	}
+	rt, err := rest.TransportFor(config)
+	if err != nil {
+		return fmt.Errorf("client transport: %w", err)
+	}
+	t.mu.Lock()
+	old := t.rt
+	t.rt = rt
+	t.mu.Unlock()
+	utilnet.CloseIdleConnectionsFor(old)
+	return nil
+}
+
+// checkAuth asks the API server for its version every interval. Watches on
+// rejected credentials can go quiet rather than fail, so a 401 or 403 here
+// is the first sign: each one is recorded as a ClientAuthError meta event,
+// and after rebuildAfter in a row the client's transport is rebuilt from
+// freshly loaded credentials. Other failures are left to the watchers'
+// reconnects and the health probes.
+func checkAuth(ctx context.Context, client kubernetes.Interface, transport *reloadingTransport, e emitter.Emitter, log *slog.Logger, interval time.Duration, rebuildAfter int) {
+	log = log.With("component", "auth_check")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := client.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+		if err == nil {
+			if failures > 0 {
+				log.Info("credentials accepted again", "after_failures", failures)
+			}
+			failures = 0
+			continue
+		}
+		if !apierrors.IsUnauthorized(err) && !apierrors.IsForbidden(err) {
+			continue
+		}
+		failures++
+		payload := map[string]interface{}{
+			"error":                err.Error(),
+			"consecutive_failures": failures,
+			"client_rebuilt":       false,
+		}
+		var status apierrors.APIStatus
+		if errors.As(err, &status) {
+			payload["status_code"] = status.Status().Code
+		}
+		log.Error("credentials rejected", "failures", failures, "err", err)
+		if failures%rebuildAfter == 0 {
+			if err := transport.rebuild(); err != nil {
+				log.Error("client rebuild failed", "err", err)
+				payload["rebuild_error"] = err.Error()
+			} else {
+				log.Warn("client rebuilt with reloaded credentials")
+				payload["client_rebuilt"] = true
+			}
+		}
+		e.EmitMeta(emitter.CausalEvent{
+			ID:        emitter.NewID(),
+			Timestamp: time.Now(),
+			EventType: "ClientAuthError",
+			Payload:   payload,
+		})
+	}
+}
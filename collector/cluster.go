@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/watcher"
+)
+
+// clusterRetryInterval is how long a cluster that failed its startup checks
+// waits before they are run again.
+const clusterRetryInterval = time.Minute
+
+// cluster is one of the clusters the collector watches: one per --contexts
+// entry, else the single cluster of the kubeconfig's current context or
+// the in-cluster configuration. Each gets its own client, watchers and
+// checkpoint, and emits through emit, which tags its records with name.
+type cluster struct {
+	name       string // the kubeconfig context; "" without --contexts
+	client     kubernetes.Interface
+	transport  *reloadingTransport
+	emit       emitter.Emitter
+	checkpoint *watcher.Checkpoint
+	watchers   []runner
+	log        *slog.Logger
+}
+
+// buildClusters builds a client per context, or for the default
+// configuration if there are none. A context missing from the kubeconfig
+// is an error: it is a typo, not an outage.
+func buildClusters(cfg *Config, log *slog.Logger) ([]*cluster, error) {
+	contexts := cfg.contexts
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+	var clusters []*cluster
+	for _, name := range contexts {
+		client, transport, err := buildClient(cfg.Kubeconfig, name, float32(cfg.KubeQPS), cfg.KubeBurst)
+		if err != nil {
+			if name != "" {
+				return nil, fmt.Errorf("context %s: %w", name, err)
+			}
+			return nil, err
+		}
+		c := &cluster{name: name, client: client, transport: transport, log: log}
+		if name != "" {
+			c.log = log.With("cluster", name)
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+// useEmitter routes the cluster's records into the shared emitter e,
+// tagged with the cluster's name if it has one.
+func (c *cluster) useEmitter(e emitter.Emitter) {
+	c.emit = e
+	if c.name != "" {
+		c.emit = emitter.NewClusterEmitter(e, c.name)
+	}
+}
+
+// listener passes fn the events of this cluster only, for listeners on the
+// shared emitter that keep per-cluster state, such as OOMs per node.
+func (c *cluster) listener(fn func(emitter.CausalEvent)) func(emitter.CausalEvent) {
+	return func(event emitter.CausalEvent) {
+		if event.Cluster == c.name {
+			fn(event)
+		}
+	}
+}
+
+// preflight runs the RBAC preflight against the cluster and validates the
+// selectors in every watched namespace. An RBAC failure is only logged if
+// ignoreRBAC is set.
+func (c *cluster) preflight(ctx context.Context, namespaces []string, f preflightFeatures, podSel, objSel watcher.Selectors, ignoreRBAC bool) error {
+	if err := preflightRBAC(ctx, c.client, namespaces, f, c.log); err != nil {
+		if !ignoreRBAC {
+			return fmt.Errorf("RBAC preflight failed, not starting (--ignore-rbac-preflight to start anyway): %w", err)
+		}
+		c.log.Warn("RBAC preflight failed, starting anyway", "err", err)
+	}
+	if podSel == (watcher.Selectors{}) {
+		return nil
+	}
+	for _, ns := range namespaces {
+		if err := watcher.ValidateSelectors(ctx, c.client, ns, podSel, objSel); err != nil {
+			return fmt.Errorf("invalid selector in namespace %q: %w", ns, err)
+		}
+	}
+	return nil
+}
+
+// runClusters runs each cluster independently until ctx is cancelled.
+// start is called once check has passed, and runs the cluster's watchers;
+// check is retried every clusterRetryInterval until it does, so a cluster
+// unreachable when the collector starts joins once it is back. A cluster
+// whose check or watchers fail does not stop the others: the failure is
+// reported as a ClusterFailed meta event, and a cluster whose watchers
+// failed stays stopped until the collector restarts.
+func runClusters(ctx context.Context, clusters []*cluster, check, start func(context.Context, *cluster) error) {
+	var wg sync.WaitGroup
+	for _, c := range clusters {
+		wg.Go(func() {
+			for {
+				err := check(ctx, c)
+				if err == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				reportClusterFailure(c, "preflight", err, clusterRetryInterval)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(clusterRetryInterval):
+				}
+			}
+			c.log.Info("cluster started")
+			if err := start(ctx, c); err != nil {
+				reportClusterFailure(c, "watch", err, 0)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// reportClusterFailure records that a cluster failed at stage, to be
+// retried after retryIn, or not at all if it is 0.
+func reportClusterFailure(c *cluster, stage string, err error, retryIn time.Duration) {
+	payload := map[string]interface{}{
+		"cluster":          c.name,
+		"stage":            stage,
+		"error":            err.Error(),
+		"retrying":         retryIn > 0,
+		"retry_in_seconds": retryIn.Seconds(),
+	}
+	if retryIn > 0 {
+		c.log.Error("cluster failed, retrying", "stage", stage, "retry_in", retryIn, "err", err)
+	} else {
+		c.log.Error("cluster failed, its watchers are stopped", "stage", stage, "err", err)
+	}
+	c.emit.EmitMeta(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "ClusterFailed",
+		Payload:   payload,
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// containerRef is what the API said about a container ID while it knew it.
+type containerRef struct {
+	pod       string
+	namespace string
+	podUID    types.UID
+	container string
+	image     string
+	imageID   string
+	// reason is the container's termination reason, once the API reported
+	// it terminated.
+	reason   string
+	lastSeen time.Time
+}
+
+type podRef struct {
+	name      string
+	namespace string
+	lastSeen  time.Time
+}
+
+// containerIndex maps the container IDs of the node's pods, current and
+// previous instances alike, to their pods, and remembers them for the
+// retention after the API stops listing them: kernel records outlive the
+// LastTerminationState that names a container ID, and the pod itself.
+type containerIndex struct {
+	retention time.Duration
+
+	mu         sync.Mutex
+	containers map[string]*containerRef // container ID, runtime prefix stripped
+	pods       map[types.UID]*podRef
+}
+
+func newContainerIndex(retention time.Duration) *containerIndex {
+	return &containerIndex{
+		retention:  retention,
+		containers: map[string]*containerRef{},
+		pods:       map[types.UID]*podRef{},
+	}
+}
+
+// observe records the container IDs in pod's statuses.
+func (x *containerIndex) observe(pod *corev1.Pod) {
+	now := time.Now()
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.pods[pod.UID] = &podRef{name: pod.Name, namespace: pod.Namespace, lastSeen: now}
+	statuses := append(append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...), pod.Status.EphemeralContainerStatuses...)
+	for _, cs := range statuses {
+		ref := containerRef{
+			pod:       pod.Name,
+			namespace: pod.Namespace,
+			podUID:    pod.UID,
+			container: cs.Name,
+			image:     cs.Image,
+			imageID:   cs.ImageID,
+			lastSeen:  now,
+		}
+		if id := stripRuntime(cs.ContainerID); id != "" {
+			current := ref
+			if t := cs.State.Terminated; t != nil {
+				current.reason = t.Reason
+			}
+			x.containers[id] = &current
+		}
+		if t := cs.LastTerminationState.Terminated; t != nil {
+			if id := stripRuntime(t.ContainerID); id != "" {
+				previous := ref
+				previous.reason = t.Reason
+				// The image the previous instance ran is not reported; keep
+				// what was recorded while it ran.
+				if known, ok := x.containers[id]; ok {
+					previous.image, previous.imageID = known.image, known.imageID
+				}
+				x.containers[id] = &previous
+			}
+		}
+	}
+}
+
+// lookup returns what is known of containerID, else of the pod with podUID.
+func (x *containerIndex) lookup(containerID, podUID string) (*containerRef, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if ref, ok := x.containers[containerID]; ok && containerID != "" {
+		c := *ref
+		return &c, true
+	}
+	if p, ok := x.pods[types.UID(podUID)]; ok {
+		return &containerRef{pod: p.name, namespace: p.namespace, podUID: types.UID(podUID)}, true
+	}
+	return nil, false
+}
+
+// prune forgets what the API has not mentioned for the retention.
+func (x *containerIndex) prune() {
+	cutoff := time.Now().Add(-x.retention)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for id, ref := range x.containers {
+		if ref.lastSeen.Before(cutoff) {
+			delete(x.containers, id)
+		}
+	}
+	for uid, p := range x.pods {
+		if p.lastSeen.Before(cutoff) {
+			delete(x.pods, uid)
+		}
+	}
+}
+
+// stripRuntime drops the runtime prefix of a status's containerID, such as
+// containerd://, leaving the ID the runtime names its cgroup after.
+func stripRuntime(containerID string) string {
+	if _, id, ok := strings.Cut(containerID, "://"); ok {
+		return id
+	}
+	return containerID
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// kmsgRecord is one record of the kernel log as /dev/kmsg returns it:
+// "priority,sequence,microseconds,flags;message", followed by dictionary
+// lines starting with a space, which are dropped.
+type kmsgRecord struct {
+	seq     uint64
+	uptime  time.Duration // since boot
+	message string
+}
+
+func parseKmsgRecord(raw string) (kmsgRecord, error) {
+	header, message, ok := strings.Cut(raw, ";")
+	if !ok {
+		return kmsgRecord{}, fmt.Errorf("no ';' in kmsg record %q", raw)
+	}
+	fields := strings.Split(header, ",")
+	if len(fields) < 3 {
+		return kmsgRecord{}, fmt.Errorf("short kmsg header %q", header)
+	}
+	seq, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return kmsgRecord{}, fmt.Errorf("kmsg sequence %q: %w", fields[1], err)
+	}
+	usec, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return kmsgRecord{}, fmt.Errorf("kmsg timestamp %q: %w", fields[2], err)
+	}
+	message, _, _ = strings.Cut(message, "\n")
+	return kmsgRecord{seq: seq, uptime: time.Duration(usec) * time.Microsecond, message: message}, nil
+}
+
+// readKmsg reads records from the kernel log at path, the oldest the ring
+// buffer still holds first, then new ones as they are logged, until ctx is
+// cancelled. Each read of /dev/kmsg returns exactly one record. Records
+// overwritten before they were read are reported through overrun, and
+// reading carries on with the oldest left.
+func readKmsg(ctx context.Context, path string, handle func(kmsgRecord), overrun func()) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open kernel log: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+	buf := make([]byte, 8192) // the kernel's record limit is below this
+	for {
+		n, err := f.Read(buf)
+		switch {
+		case errors.Is(err, syscall.EPIPE):
+			overrun()
+			continue
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			return fmt.Errorf("read kernel log: %w", err)
+		}
+		rec, err := parseKmsgRecord(string(buf[:n]))
+		if err != nil {
+			continue // not a record; nothing to correlate
+		}
+		handle(rec)
+	}
+}
+
+// bootTime estimates when the node booted, to turn kernel timestamps into
+// wall-clock time. The kernel clock stops during suspend, which nodes do
+// not do.
+func bootTime() (time.Time, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("empty /proc/uptime")
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse /proc/uptime: %w", err)
+	}
+	return time.Now().Add(-time.Duration(secs * float64(time.Second))), nil
+}
+
+// bootID identifies the current boot: kernel sequence numbers start over
+// with each one.
+func bootID() (string, error) {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+var (
+	// oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=...,
+	// oom_memcg=/kubepods.slice/...,task_memcg=/kubepods.slice/...,task=stress,pid=1234,uid=0
+	oomKillSummary = regexp.MustCompile(`^oom-kill:(.*)$`)
+	// Before Linux 4.19: Task in /kubepods/burstable/pod<uid>/<id> killed as
+	// a result of limit of /kubepods/burstable/pod<uid>
+	oomTaskIn = regexp.MustCompile(`^Task in (\S+) killed as a result of limit of (\S+)`)
+	// Memory cgroup out of memory: Killed process 1234 (stress) total-vm:8400kB,
+	// anon-rss:262144kB, file-rss:1024kB, shmem-rss:0kB, UID:0 pgtables:600kB oom_score_adj:984
+	oomKilled    = regexp.MustCompile(`(?:^|: )Killed process (\d+) \(([^)]*)\)(.*)$`)
+	oomKilledKB  = regexp.MustCompile(`([a-z-]+):(\d+)kB`)
+	oomScoreAdj  = regexp.MustCompile(`oom_score_adj:(-?\d+)`)
+	oomKilledUID = regexp.MustCompile(`UID:(\d+)`)
+
+	// The container ID ends a container's cgroup path: cri-containerd-<id>.scope,
+	// crio-<id>.scope and docker-<id>.scope with the systemd driver, <id>
+	// with cgroupfs.
+	cgroupContainerID = regexp.MustCompile(`([0-9a-f]{64})(?:\.scope)?$`)
+	// The pod's cgroup is pod<uid>, its dashes underscores with the systemd
+	// driver.
+	cgroupPodUID = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// kernelOOM is one OOM kill as the kernel logged it, over several records:
+// a summary of the cgroup it was charged to, then the killed process.
+type kernelOOM struct {
+	seq        uint64 // of the Killed process record
+	uptime     time.Duration
+	pid        int
+	process    string
+	uid        int
+	constraint string // CONSTRAINT_MEMCG for a cgroup limit, CONSTRAINT_NONE for the node out of memory
+	oomMemcg   string // the cgroup whose limit was hit
+	taskMemcg  string // the killed process's cgroup
+	memoryKB   map[string]int64
+	scoreAdj   *int
+	message    string
+}
+
+func (o *kernelOOM) containerID() string {
+	if m := cgroupContainerID.FindStringSubmatch(o.taskMemcg); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func (o *kernelOOM) podUID() string {
+	if m := cgroupPodUID.FindStringSubmatch(o.taskMemcg); m != nil {
+		return strings.ReplaceAll(m[1], "_", "-")
+	}
+	return ""
+}
+
+// oomParser assembles kernelOOMs from kernel log records. The cgroup
+// summary comes just before the Killed process record of the same kill; a
+// summary left without one, the kill having gone to another process, is
+// replaced by the next.
+type oomParser struct {
+	pending *kernelOOM
+}
+
+// feed takes the next record, returning the kill it completes, if any.
+func (p *oomParser) feed(rec kmsgRecord) *kernelOOM {
+	msg := rec.message
+	if m := oomKillSummary.FindStringSubmatch(msg); m != nil {
+		o := &kernelOOM{}
+		for _, kv := range strings.Split(m[1], ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			switch k {
+			case "constraint":
+				o.constraint = v
+			case "oom_memcg":
+				o.oomMemcg = v
+			case "task_memcg":
+				o.taskMemcg = v
+			case "task":
+				o.process = v
+			case "pid":
+				o.pid, _ = strconv.Atoi(v)
+			case "uid":
+				o.uid, _ = strconv.Atoi(v)
+			}
+		}
+		p.pending = o
+		return nil
+	}
+	if m := oomTaskIn.FindStringSubmatch(msg); m != nil {
+		p.pending = &kernelOOM{constraint: "CONSTRAINT_MEMCG", taskMemcg: m[1], oomMemcg: m[2]}
+		return nil
+	}
+	m := oomKilled.FindStringSubmatch(msg)
+	if m == nil {
+		return nil
+	}
+	pid, _ := strconv.Atoi(m[1])
+	o := p.pending
+	p.pending = nil
+	if o == nil || (o.pid != 0 && o.pid != pid) {
+		o = &kernelOOM{}
+	}
+	if o.constraint == "" {
+		o.constraint = "CONSTRAINT_NONE"
+		if strings.HasPrefix(msg, "Memory cgroup out of memory") {
+			o.constraint = "CONSTRAINT_MEMCG"
+		}
+	}
+	o.seq, o.uptime, o.pid, o.process, o.message = rec.seq, rec.uptime, pid, m[2], msg
+	o.memoryKB = map[string]int64{}
+	for _, kb := range oomKilledKB.FindAllStringSubmatch(m[3], -1) {
+		o.memoryKB[kb[1]], _ = strconv.ParseInt(kb[2], 10, 64)
+	}
+	if s := oomScoreAdj.FindStringSubmatch(m[3]); s != nil {
+		adj, _ := strconv.Atoi(s[1])
+		o.scoreAdj = &adj
+	}
+	if u := oomKilledUID.FindStringSubmatch(m[3]); u != nil {
+		o.uid, _ = strconv.Atoi(u[1])
+	}
+	return o
+}
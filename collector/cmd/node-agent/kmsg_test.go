@@ -0,0 +1,241 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseKmsgRecord(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		raw  string
+		want kmsgRecord
+		err  string
+	}{
+		{
+			name: "record",
+			raw:  "6,1834,95323419,-;oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,task=stress,pid=4321,uid=0",
+			want: kmsgRecord{seq: 1834, uptime: 95323419 * time.Microsecond, message: "oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,task=stress,pid=4321,uid=0"},
+		},
+		{
+			name: "dictionary lines dropped",
+			raw:  "3,1835,95323507,-;Memory cgroup out of memory: Killed process 4321 (stress)\n SUBSYSTEM=memory\n DEVICE=+memory:oom\n",
+			want: kmsgRecord{seq: 1835, uptime: 95323507 * time.Microsecond, message: "Memory cgroup out of memory: Killed process 4321 (stress)"},
+		},
+		{
+			name: "continuation flag and caller field",
+			raw:  "4,77,1200,c,caller=T4321;Tasks state (memory values in pages):",
+			want: kmsgRecord{seq: 77, uptime: 1200 * time.Microsecond, message: "Tasks state (memory values in pages):"},
+		},
+		{name: "no separator", raw: "6,1834,95323419,-", err: "no ';'"},
+		{name: "short header", raw: "6,1834;message", err: "short kmsg header"},
+		{name: "bad sequence", raw: "6,x,95323419,-;message", err: "kmsg sequence"},
+		{name: "bad timestamp", raw: "6,1834,-x,-;message", err: "kmsg timestamp"},
+	} {
+		got, err := parseKmsgRecord(tc.raw)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: err = %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %+v, %v, want %+v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+const (
+	testContainerID = "8e2f4c1d9a7b6e5f0c3d2a1b4e7f6a9d8c5b2e1f0a3d6c9b8e7f4a1d2c5b8e0f"
+	testPodUID      = "2f1e9c7a-3b4d-4c5e-9f6a-7b8c9d0e1f2a"
+)
+
+// systemdPod is a pod's cgroup with the systemd driver, its UID's dashes
+// underscores.
+const systemdPod = "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod2f1e9c7a_3b4d_4c5e_9f6a_7b8c9d0e1f2a.slice"
+
+// cgroupfsPod is the same pod's cgroup with the cgroupfs driver.
+const cgroupfsPod = "/kubepods/burstable/pod" + testPodUID
+
+func intPtr(v int) *int { return &v }
+
+// Kernel logs of a container OOM kill in each format the parser reads,
+// lines as dmesg shows them after the kmsg header.
+func TestOOMParser(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		lines    []string
+		want     kernelOOM
+		noPod    bool // the kill cannot be tied to a container
+		memoryKB map[string]int64
+	}{
+		{
+			name: "4.19+, systemd driver, containerd",
+			lines: []string{
+				"stress invoked oom-killer: gfp_mask=0xcc0(GFP_KERNEL), order=0, oom_score_adj=984",
+				"oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=cri-containerd-" + testContainerID + ".scope,mems_allowed=0," +
+					"oom_memcg=" + systemdPod + "/cri-containerd-" + testContainerID + ".scope," +
+					"task_memcg=" + systemdPod + "/cri-containerd-" + testContainerID + ".scope,task=stress,pid=4321,uid=0",
+				"Memory cgroup out of memory: Killed process 4321 (stress) total-vm:264404kB, anon-rss:262144kB, file-rss:1024kB, shmem-rss:0kB, UID:0 pgtables:600kB oom_score_adj:984",
+			},
+			want: kernelOOM{
+				pid: 4321, process: "stress", constraint: "CONSTRAINT_MEMCG", scoreAdj: intPtr(984),
+				oomMemcg:  systemdPod + "/cri-containerd-" + testContainerID + ".scope",
+				taskMemcg: systemdPod + "/cri-containerd-" + testContainerID + ".scope",
+			},
+			memoryKB: map[string]int64{"total-vm": 264404, "anon-rss": 262144, "file-rss": 1024, "shmem-rss": 0, "pgtables": 600},
+		},
+		{
+			name: "4.19+, systemd driver, CRI-O, pod limit hit",
+			lines: []string{
+				"oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=crio-" + testContainerID + ".scope,mems_allowed=0," +
+					"oom_memcg=" + systemdPod + ",task_memcg=" + systemdPod + "/crio-" + testContainerID + ".scope,task=java,pid=777,uid=1000",
+				"Memory cgroup out of memory: Killed process 777 (java) total-vm:4194304kB, anon-rss:1048576kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:2400kB oom_score_adj:-997",
+			},
+			want: kernelOOM{
+				pid: 777, process: "java", uid: 1000, constraint: "CONSTRAINT_MEMCG", scoreAdj: intPtr(-997),
+				oomMemcg: systemdPod, taskMemcg: systemdPod + "/crio-" + testContainerID + ".scope",
+			},
+		},
+		{
+			name: "4.19+, systemd driver, Docker, node out of memory",
+			lines: []string{
+				"oom-kill:constraint=CONSTRAINT_NONE,nodemask=(null),cpuset=/,mems_allowed=0,global_oom," +
+					"task_memcg=" + systemdPod + "/docker-" + testContainerID + ".scope,task=node,pid=31337,uid=1001",
+				"Out of memory: Killed process 31337 (node) total-vm:1203944kB, anon-rss:716028kB, file-rss:0kB, shmem-rss:0kB, UID:1001 pgtables:1880kB oom_score_adj:1000",
+			},
+			want: kernelOOM{
+				pid: 31337, process: "node", uid: 1001, constraint: "CONSTRAINT_NONE", scoreAdj: intPtr(1000),
+				taskMemcg: systemdPod + "/docker-" + testContainerID + ".scope",
+			},
+		},
+		{
+			name: "4.19+, cgroupfs driver",
+			lines: []string{
+				"oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=" + testContainerID + ",mems_allowed=0," +
+					"oom_memcg=" + cgroupfsPod + "/" + testContainerID + ",task_memcg=" + cgroupfsPod + "/" + testContainerID + ",task=python3,pid=88,uid=0",
+				"Memory cgroup out of memory: Killed process 88 (python3) total-vm:512000kB, anon-rss:131072kB, file-rss:2048kB, shmem-rss:4kB, UID:0 pgtables:300kB oom_score_adj:999",
+			},
+			want: kernelOOM{
+				pid: 88, process: "python3", constraint: "CONSTRAINT_MEMCG", scoreAdj: intPtr(999),
+				oomMemcg: cgroupfsPod + "/" + testContainerID, taskMemcg: cgroupfsPod + "/" + testContainerID,
+			},
+		},
+		{
+			name: "before 4.19, cgroupfs driver",
+			lines: []string{
+				"Task in " + cgroupfsPod + "/" + testContainerID + " killed as a result of limit of " + cgroupfsPod + "/" + testContainerID,
+				"memory: usage 262144kB, limit 262144kB, failcnt 71",
+				"Memory cgroup out of memory: Kill process 4321 (stress) score 1984 or sacrifice child",
+				"Killed process 4321 (stress) total-vm:264404kB, anon-rss:262144kB, file-rss:1024kB, shmem-rss:0kB",
+			},
+			want: kernelOOM{
+				pid: 4321, process: "stress", constraint: "CONSTRAINT_MEMCG",
+				oomMemcg: cgroupfsPod + "/" + testContainerID, taskMemcg: cgroupfsPod + "/" + testContainerID,
+			},
+		},
+		{
+			name: "before 4.19, systemd driver",
+			lines: []string{
+				"Task in " + systemdPod + "/docker-" + testContainerID + ".scope killed as a result of limit of " + systemdPod,
+				"Memory cgroup out of memory: Kill process 4321 (stress) score 1984 or sacrifice child",
+				"Killed process 4321 (stress) total-vm:264404kB, anon-rss:262144kB, file-rss:1024kB, shmem-rss:0kB",
+			},
+			want: kernelOOM{
+				pid: 4321, process: "stress", constraint: "CONSTRAINT_MEMCG",
+				oomMemcg: systemdPod, taskMemcg: systemdPod + "/docker-" + testContainerID + ".scope",
+			},
+		},
+		{
+			name: "summary of another process",
+			lines: []string{
+				"oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,task_memcg=" + cgroupfsPod + "/" + testContainerID + ",task=stress,pid=1,uid=0",
+				"Memory cgroup out of memory: Killed process 2 (worker) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:40kB oom_score_adj:0",
+			},
+			want:  kernelOOM{pid: 2, process: "worker", constraint: "CONSTRAINT_MEMCG", scoreAdj: intPtr(0)},
+			noPod: true,
+		},
+		{
+			name: "outside any pod",
+			lines: []string{
+				"oom-kill:constraint=CONSTRAINT_NONE,nodemask=(null),cpuset=/,mems_allowed=0,global_oom,task_memcg=/system.slice/kubelet.service,task=kubelet,pid=612,uid=0",
+				"Out of memory: Killed process 612 (kubelet) total-vm:2048000kB, anon-rss:180000kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:900kB oom_score_adj:-999",
+			},
+			want:  kernelOOM{pid: 612, process: "kubelet", constraint: "CONSTRAINT_NONE", scoreAdj: intPtr(-999), taskMemcg: "/system.slice/kubelet.service"},
+			noPod: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var p oomParser
+			var got []*kernelOOM
+			for i, line := range tc.lines {
+				rec, err := parseKmsgRecord("3," + strconv.Itoa(100+i) + ",95323419,-;" + line)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if o := p.feed(rec); o != nil {
+					got = append(got, o)
+				}
+			}
+			if len(got) != 1 {
+				t.Fatalf("parsed %d kills, want 1", len(got))
+			}
+			o := got[0]
+			last := tc.lines[len(tc.lines)-1]
+			if o.seq != uint64(100+len(tc.lines)-1) || o.message != last {
+				t.Errorf("kill taken from record %d %q, want the last", o.seq, o.message)
+			}
+			if o.pid != tc.want.pid || o.process != tc.want.process || o.uid != tc.want.uid || o.constraint != tc.want.constraint {
+				t.Errorf("kill of %d (%s) uid %d %s, want %d (%s) uid %d %s",
+					o.pid, o.process, o.uid, o.constraint, tc.want.pid, tc.want.process, tc.want.uid, tc.want.constraint)
+			}
+			if o.oomMemcg != tc.want.oomMemcg || o.taskMemcg != tc.want.taskMemcg {
+				t.Errorf("cgroups %q, %q, want %q, %q", o.oomMemcg, o.taskMemcg, tc.want.oomMemcg, tc.want.taskMemcg)
+			}
+			if !reflect.DeepEqual(o.scoreAdj, tc.want.scoreAdj) {
+				t.Errorf("oom_score_adj = %v, want %v", o.scoreAdj, tc.want.scoreAdj)
+			}
+			if tc.memoryKB != nil && !reflect.DeepEqual(o.memoryKB, tc.memoryKB) {
+				t.Errorf("memory = %v, want %v", o.memoryKB, tc.memoryKB)
+			}
+			wantID, wantUID := testContainerID, testPodUID
+			if tc.noPod {
+				wantID, wantUID = "", ""
+			}
+			if o.containerID() != wantID || o.podUID() != wantUID {
+				t.Errorf("container %q of pod %q, want %q of %q", o.containerID(), o.podUID(), wantID, wantUID)
+			}
+		})
+	}
+}
+
+// Records between the summary and the kill, and kills following each
+// other, are each parsed on their own.
+func TestOOMParserSequence(t *testing.T) {
+	var p oomParser
+	var kills []int
+	for i, line := range []string{
+		"oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,task_memcg=" + cgroupfsPod + "/" + testContainerID + ",task=a,pid=10,uid=0",
+		"Memory cgroup out of memory: Killed process 10 (a) total-vm:1kB, anon-rss:1kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:1kB oom_score_adj:0",
+		"oom_reaper: reaped process 10 (a), now anon-rss:0kB, file-rss:0kB, shmem-rss:0kB",
+		"oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,task_memcg=" + cgroupfsPod + "/" + testContainerID + ",task=b,pid=11,uid=0",
+		"Memory cgroup out of memory: Killed process 11 (b) total-vm:1kB, anon-rss:1kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:1kB oom_score_adj:0",
+	} {
+		rec, err := parseKmsgRecord("3," + strconv.Itoa(i) + ",1,-;" + line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o := p.feed(rec); o != nil {
+			if o.containerID() != testContainerID {
+				t.Errorf("kill of %d without its container", o.pid)
+			}
+			kills = append(kills, o.pid)
+		}
+	}
+	if !reflect.DeepEqual(kills, []int{10, 11}) {
+		t.Fatalf("kills = %v, want [10 11]", kills)
+	}
+}
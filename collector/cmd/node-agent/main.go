@@ -0,0 +1,357 @@
+// Command node-agent reads the kernel log of the node it runs on for OOM
+// kills and emits each as a KernelOOMEvidence event, correlated to the pod
+// and container through the container ID in the killed process's cgroup.
+// The API's LastTerminationState is gone once a container restarts twice
+// or its pod is deleted, and with it the OOMKilled reason; the kernel's
+// record stays in its ring buffer, and the agent reports even the kills
+// the API never attributed, such as a process other than a container's
+// main one.
+//
+// It runs as a DaemonSet, privileged to read /dev/kmsg, with NODE_NAME set
+// from spec.nodeName, and writes through the collector's emitters:
+//
+//	node-agent --emitter kafka --kafka-brokers kafka:9092 --state-file /var/lib/oma/kmsg.state
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// refreshInterval is how often the containers of the pods still listed are
+// marked seen again, and the rest pruned past their retention.
+const refreshInterval = 10 * time.Minute
+
+func main() {
+	kubeconfig := flag.String("kubeconfig", "", "Path to kubeconfig (default: in-cluster)")
+	nodeName := flag.String("node-name", os.Getenv("NODE_NAME"), "Node the agent runs on, whose pods are correlated (default: $NODE_NAME)")
+	kmsgPath := flag.String("kmsg-path", "/dev/kmsg", "Kernel log device")
+	emitterKind := flag.String("emitter", "json", "Event sink: json or kafka")
+	outputDir := flag.String("output", "./output", "Directory for JSONL output (with --emitter=json)")
+	kafkaBrokers := flag.String("kafka-brokers", "", "Comma-separated Kafka bootstrap brokers (with --emitter=kafka)")
+	kafkaTopic := flag.String("kafka-topic", "oma-causal-events", "Kafka topic for events (with --emitter=kafka)")
+	kafkaQueue := flag.Int("kafka-queue-size", 10000, "Records buffered while Kafka is unavailable before dropping")
+	tlsCAFile := flag.String("tls-ca-file", "", "PEM CAs verifying the Kafka brokers (default: system roots)")
+	tlsCertFile := flag.String("tls-cert-file", "", "PEM client certificate presented to Kafka brokers")
+	tlsKeyFile := flag.String("tls-key-file", "", "PEM key of --tls-cert-file")
+	tlsServerName := flag.String("tls-server-name", "", "Name the Kafka brokers' certificates are verified against (default: the broker host)")
+	tlsInsecure := flag.Bool("tls-insecure", false, "Do not verify the Kafka brokers' certificates; for testing only")
+	stateFile := flag.String("state-file", "", "File recording the last kernel log record handled, so a restarted agent does not report the kills still in the ring buffer again; keep it on the host (default: report them again)")
+	retention := flag.Duration("container-retention", 24*time.Hour, "How long a container ID stays correlatable after the API last listed it")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	flag.Parse()
+
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --log-level %q (want debug, info, warn or error)\n", *logLevel)
+		os.Exit(2)
+	}
+	log := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: lvl})).With("component", "node_agent")
+	if *nodeName == "" {
+		log.Error("--node-name or NODE_NAME is required")
+		os.Exit(1)
+	}
+	if *retention <= 0 {
+		log.Error("--container-retention must be positive", "value", *retention)
+		os.Exit(1)
+	}
+
+	var emit emitter.Emitter
+	var err error
+	switch *emitterKind {
+	case "json":
+		emit, err = emitter.NewJSONEmitter(*outputDir, emitter.JSONOptions{}, log)
+	case "kafka":
+		var tlsConf *tls.Config
+		tlsOpts := emitter.TLSOptions{
+			CAFile:     *tlsCAFile,
+			CertFile:   *tlsCertFile,
+			KeyFile:    *tlsKeyFile,
+			ServerName: *tlsServerName,
+			Insecure:   *tlsInsecure,
+		}
+		if tlsOpts.Enabled() {
+			if tlsConf, err = tlsOpts.ClientConfig(); err != nil {
+				log.Error("invalid Kafka TLS configuration", "err", err)
+				os.Exit(1)
+			}
+		}
+		emit, err = emitter.NewKafkaEmitter(strings.Split(*kafkaBrokers, ","), *kafkaTopic, *kafkaQueue, tlsConf, log)
+	default:
+		err = fmt.Errorf("unknown emitter %q (want json or kafka)", *emitterKind)
+	}
+	if err != nil {
+		log.Error("failed to create emitter", "err", err)
+		os.Exit(1)
+	}
+	defer emit.Close()
+
+	boot, err := bootTime()
+	if err != nil {
+		log.Error("failed to read uptime", "err", err)
+		os.Exit(1)
+	}
+	boots, err := bootID()
+	if err != nil {
+		log.Error("failed to read boot ID", "err", err)
+		os.Exit(1)
+	}
+	state, err := loadState(*stateFile, boots)
+	if err != nil {
+		log.Error("failed to load state", "err", err)
+		os.Exit(1)
+	}
+
+	config, err := clientConfig(*kubeconfig)
+	if err != nil {
+		log.Error("failed to build Kubernetes client", "err", err)
+		os.Exit(1)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Error("failed to build Kubernetes client", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	index := newContainerIndex(*retention)
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.FieldSelector = "spec.nodeName=" + *nodeName }))
+	podInformer := factory.Core().V1().Pods().Informer()
+	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { observePod(index, obj) },
+		UpdateFunc: func(_, obj interface{}) { observePod(index, obj) },
+	})
+	factory.Start(ctx.Done())
+	// Kills already in the ring buffer are correlated against the pods
+	// listed now, so list them first.
+	if !cache.WaitForCacheSync(ctx.Done(), podInformer.HasSynced) {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, obj := range podInformer.GetStore().List() {
+				observePod(index, obj)
+			}
+			index.prune()
+		}
+	}()
+
+	agent := &agent{
+		node:     *nodeName,
+		bootID:   boots,
+		bootTime: boot,
+		index:    index,
+		state:    state,
+		emitter:  emit,
+		log:      log,
+	}
+	log.Info("reading kernel log", "path", *kmsgPath, "node", *nodeName, "boot_id", boots, "resume_after_seq", state.Seq)
+	if err := readKmsg(ctx, *kmsgPath, agent.handle, agent.overrun); err != nil {
+		log.Error("kernel log reader stopped", "err", err)
+		emit.Close()
+		os.Exit(1)
+	}
+	log.Info("shutting down")
+}
+
+func observePod(index *containerIndex, obj interface{}) {
+	if pod, ok := obj.(*corev1.Pod); ok {
+		index.observe(pod)
+	}
+}
+
+func clientConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig == "" {
+		kubeconfig = os.Getenv("KUBECONFIG")
+	}
+	if kubeconfig == "" {
+		return rest.InClusterConfig()
+	}
+	return clientcmd.BuildConfigFromFlags("", kubeconfig)
+}
+
+// agent turns the kernel's OOM kills into KernelOOMEvidence events.
+type agent struct {
+	node     string
+	bootID   string
+	bootTime time.Time
+	index    *containerIndex
+	parser   oomParser
+	state    *kmsgState
+	emitter  emitter.Emitter
+	log      *slog.Logger
+}
+
+func (a *agent) handle(rec kmsgRecord) {
+	oom := a.parser.feed(rec)
+	if oom == nil || oom.seq <= a.state.Seq {
+		return
+	}
+	a.emit(oom)
+	a.state.Seq = oom.seq
+	if err := a.state.save(); err != nil {
+		a.log.Error("failed to save state", "err", err)
+	}
+}
+
+func (a *agent) emit(oom *kernelOOM) {
+	containerID, podUID := oom.containerID(), oom.podUID()
+	killedAt := a.bootTime.Add(oom.uptime)
+	payload := map[string]interface{}{
+		"source":          "kmsg",
+		"boot_id":         a.bootID,
+		"kernel_seq":      oom.seq,
+		"killed_at":       killedAt,
+		"uptime_seconds":  oom.uptime.Seconds(),
+		"pid":             oom.pid,
+		"process":         oom.process,
+		"uid":             oom.uid,
+		"constraint":      oom.constraint,
+		"cgroup_limit":    oom.constraint == "CONSTRAINT_MEMCG",
+		"oom_memcg":       oom.oomMemcg,
+		"task_memcg":      oom.taskMemcg,
+		"container_id":    containerID,
+		"container_name":  nil,
+		"image":           nil,
+		"image_id":        nil,
+		"api_reason":      nil,
+		"correlated":      false,
+		"total_vm_bytes":  nil,
+		"anon_rss_bytes":  nil,
+		"file_rss_bytes":  nil,
+		"shmem_rss_bytes": nil,
+		"oom_score_adj":   nil,
+		"kernel_message":  oom.message,
+	}
+	for key, field := range map[string]string{"total-vm": "total_vm_bytes", "anon-rss": "anon_rss_bytes", "file-rss": "file_rss_bytes", "shmem-rss": "shmem_rss_bytes"} {
+		if kb, ok := oom.memoryKB[key]; ok {
+			payload[field] = kb * 1024
+		}
+	}
+	if oom.scoreAdj != nil {
+		payload["oom_score_adj"] = *oom.scoreAdj
+	}
+
+	event := emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "KernelOOMEvidence",
+		PatternID: patterns.PatternOOMKill,
+		NodeName:  a.node,
+		PodUID:    podUID,
+		Payload:   payload,
+	}
+	if ref, ok := a.index.lookup(containerID, podUID); ok {
+		event.PodName, event.Namespace, event.PodUID = ref.pod, ref.namespace, string(ref.podUID)
+		payload["correlated"] = true
+		if ref.container != "" {
+			payload["container_name"] = ref.container
+			payload["image"] = ref.image
+			payload["image_id"] = ref.imageID
+		}
+		if ref.reason != "" {
+			payload["api_reason"] = ref.reason
+		}
+	}
+	a.emitter.Emit(event)
+	a.log.Info("KernelOOMEvidence", "pod", event.PodName, "namespace", event.Namespace,
+		"container_id", containerID, "process", oom.process, "pid", oom.pid, "seq", oom.seq)
+}
+
+func (a *agent) overrun() {
+	a.log.Warn("kernel log records overwritten before they were read; OOM kills among them are lost")
+	a.emitter.EmitMeta(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "CollectorError",
+		NodeName:  a.node,
+		Payload: map[string]interface{}{
+			"watcher":   "node_agent",
+			"operation": "read_kmsg",
+			"object":    a.node,
+			"error":     "kernel log records overwritten before they were read",
+		},
+	})
+}
+
+// kmsgState is the last kernel log record the agent handled, in the boot
+// it was handled in.
+type kmsgState struct {
+	BootID string `json:"boot_id"`
+	Seq    uint64 `json:"seq"`
+
+	path string
+}
+
+// loadState reads path, starting over when the node has rebooted since it
+// was written. An empty path keeps no state.
+func loadState(path, bootID string) (*kmsgState, error) {
+	s := &kmsgState{BootID: bootID, path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved kmsgState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if saved.BootID == bootID {
+		s.Seq = saved.Seq
+	}
+	return s, nil
+}
+
+func (s *kmsgState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,247 @@
+// Command query filters recorded events and snapshots by time window and
+// subject, for reconstructing an incident from the JSONL output without
+// loading it into SQLite. Arguments are output directories, whose
+// events and snapshots files (rotated ones included) are all read, or
+// individual files.
+//
+//	query --since 2026-03-01T12:00:00Z --until 2026-03-01T12:30:00Z --pod api-7d9f output/
+//	query --since 2h --event-type OOMKill --format json output/events.jsonl
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// filter selects records. Empty fields match everything.
+type filter struct {
+	since, until time.Time
+	namespace    string
+	pod          string
+	node         string
+	eventType    string
+	pattern      string
+}
+
+// record is one matching event or snapshot, kept with its original line so
+// JSON output reproduces it exactly.
+type record struct {
+	kind string // "event" or "snapshot"
+	// occurred is when an event happened, or a snapshot was taken. Records
+	// are selected, ordered and printed by it: events from different
+	// watchers, or observed late after a --resume, are recorded in another
+	// order than they happened in.
+	occurred  time.Time
+	eventType string // the trigger event of a snapshot
+	patternID string
+	namespace string
+	pod       string
+	node      string
+	raw       json.RawMessage
+}
+
+func main() {
+	var f filter
+	since := flag.String("since", "", "Only records of what happened at or after this time: RFC 3339, or a duration before now such as 2h")
+	until := flag.String("until", "", "Only records of what happened before this time: RFC 3339, or a duration before now such as 30m")
+	flag.StringVar(&f.namespace, "namespace", "", "Only records in this namespace")
+	flag.StringVar(&f.pod, "pod", "", "Only records about this pod: events naming it and its snapshots")
+	flag.StringVar(&f.node, "node", "", "Only records about this node: events naming it and snapshots of pods on it")
+	flag.StringVar(&f.eventType, "event-type", "", "Only events of this type and snapshots it triggered")
+	flag.StringVar(&f.pattern, "pattern", "", "Only events attributed to this pattern ID, e.g. P001; snapshots carry no pattern and are left out")
+	records := flag.String("records", "all", "Records to read: events, snapshots or all")
+	format := flag.String("format", "table", "Output format: table, or json for the matching records as JSONL")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] output-dir|file.jsonl[.gz]...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	now := time.Now()
+	var err error
+	if f.since, err = parseTime(*since, now); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --since: %v\n", err)
+		os.Exit(2)
+	}
+	if f.until, err = parseTime(*until, now); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --until: %v\n", err)
+		os.Exit(2)
+	}
+	if *records != "all" && *records != "events" && *records != "snapshots" {
+		fmt.Fprintf(os.Stderr, "Invalid --records %q (want events, snapshots or all)\n", *records)
+		os.Exit(2)
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --format %q (want table or json)\n", *format)
+		os.Exit(2)
+	}
+
+	paths, err := expand(flag.Args(), *records)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	var matched []record
+	for _, path := range paths {
+		recs, err := readRecords(path, f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		matched = append(matched, recs...)
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].occurred.Before(matched[j].occurred) })
+
+	if *format == "json" {
+		w := bufio.NewWriter(os.Stdout)
+		for _, r := range matched {
+			w.Write(r.raw)
+			w.WriteByte('\n')
+		}
+		w.Flush()
+		return
+	}
+	printTable(os.Stdout, matched)
+	fmt.Fprintf(os.Stderr, "[query] %d record(s) from %d file(s)\n", len(matched), len(paths))
+}
+
+// parseTime reads an RFC 3339 time, or a duration counted back from now.
+// An empty value is the zero time, no bound.
+func parseTime(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", v)
+	}
+	return now.Add(-d), nil
+}
+
+// expand replaces each output directory among args with the events and
+// snapshots files in it, rotated files first. Meta files hold no cluster
+// records and are never read.
+func expand(args []string, records string) ([]string, error) {
+	var streams []string
+	if records != "snapshots" {
+		streams = append(streams, "events")
+	}
+	if records != "events" {
+		streams = append(streams, "snapshots")
+	}
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		for _, stream := range streams {
+			// The rotated-file suffix sorts chronologically.
+			rotated, _ := filepath.Glob(filepath.Join(arg, stream+"-*.jsonl*"))
+			sort.Strings(rotated)
+			paths = append(paths, rotated...)
+			if active := filepath.Join(arg, stream+".jsonl"); fileExists(active) {
+				paths = append(paths, active)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// readRecords returns the records of one JSONL file, gzip-compressed or
+// not, that f selects. Meta events are never selected.
+func readRecords(path string, f filter) ([]record, error) {
+	recs, err := emitter.ReadJSONL(path, func(r emitter.Record) bool {
+		rec, ok := recordOf(r)
+		return ok && f.matches(rec)
+	}, func(line int, err error) {
+		fmt.Fprintf(os.Stderr, "[query] %s:%d: skipping malformed line: %v\n", path, line, err)
+	})
+	out := make([]record, 0, len(recs))
+	for _, r := range recs {
+		rec, _ := recordOf(r)
+		rec.raw = r.Raw
+		out = append(out, rec)
+	}
+	return out, err
+}
+
+// recordOf returns what query selects and prints an event or snapshot by.
+// Meta events have no record.
+func recordOf(r emitter.Record) (record, bool) {
+	switch r.Stream {
+	case "events":
+		ev := r.Event
+		rec := record{kind: "event", occurred: ev.OccurredAt, eventType: ev.EventType, patternID: ev.PatternID,
+			namespace: ev.Namespace, pod: ev.PodName, node: ev.NodeName}
+		if rec.occurred.IsZero() {
+			rec.occurred = ev.Timestamp // recorded before occurred_at
+		}
+		return rec, true
+	case "snapshots":
+		snap := r.Snapshot
+		rec := record{kind: "snapshot", occurred: snap.Timestamp, eventType: snap.TriggerEvent, namespace: snap.Namespace}
+		if snap.ObjectKind == "Pod" {
+			rec.pod = snap.ObjectName
+			rec.node, _ = snap.State["node_name"].(string)
+		}
+		return rec, true
+	}
+	return record{}, false // meta
+}
+
+func (f filter) matches(r record) bool {
+	switch {
+	case !f.since.IsZero() && r.occurred.Before(f.since),
+		!f.until.IsZero() && !r.occurred.Before(f.until),
+		f.namespace != "" && r.namespace != f.namespace,
+		f.pod != "" && r.pod != f.pod,
+		f.node != "" && r.node != f.node,
+		f.eventType != "" && r.eventType != f.eventType,
+		f.pattern != "" && r.patternID != f.pattern:
+		return false
+	}
+	return true
+}
+
+func printTable(w io.Writer, records []record) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tRECORD\tEVENT TYPE\tPATTERN\tNAMESPACE\tPOD\tNODE")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.occurred.UTC().Format(time.RFC3339Nano), r.kind, r.eventType, dash(r.patternID), dash(r.namespace), dash(r.pod), dash(r.node))
+	}
+	tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
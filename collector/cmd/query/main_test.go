@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+var queryTime = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func writeEvents(t *testing.T, events ...emitter.CausalEvent) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// An event observed after the window, as after a --resume, that happened
+// inside it is selected, and records are printed in the order they
+// happened in, by the time they happened.
+func TestQuerySelectsAndPrintsByOccurrence(t *testing.T) {
+	path := writeEvents(t,
+		emitter.CausalEvent{ID: "late", EventType: "OOMKill", Timestamp: queryTime.Add(10 * time.Minute), OccurredAt: queryTime.Add(-5 * time.Minute)},
+		emitter.CausalEvent{ID: "first", EventType: "ConfigMapChanged", Timestamp: queryTime.Add(-2 * time.Minute), OccurredAt: queryTime.Add(-8 * time.Minute)},
+		emitter.CausalEvent{ID: "after", EventType: "OOMKill", Timestamp: queryTime.Add(time.Minute), OccurredAt: queryTime.Add(time.Minute)},
+		emitter.CausalEvent{ID: "legacy", EventType: "NodeMemoryPressure", Timestamp: queryTime.Add(-9 * time.Minute)},
+	)
+	recs, err := readRecords(path, filter{since: queryTime.Add(-10 * time.Minute), until: queryTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].occurred.Before(recs[j].occurred) })
+
+	var out bytes.Buffer
+	printTable(&out, recs)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+	want := []string{
+		"2026-03-01T11:51:00Z  event   NodeMemoryPressure",
+		"2026-03-01T11:52:00Z  event   ConfigMapChanged",
+		"2026-03-01T11:55:00Z  event   OOMKill",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("printed:\n%s", out.String())
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w) {
+			t.Errorf("line %d = %q, want it to start %q", i, lines[i], w)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Command replay re-runs the pattern matcher over recorded events.jsonl
+// files, so patterns can be developed and regression-tested without a live
+// cluster.
+//
+//	replay --speed 0 output/events.jsonl output/events-*.jsonl.gz
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+func main() {
+	speed := flag.Float64("speed", 0, "Replay speed: 1 honours recorded inter-event delays, 10 is ten times faster, 0 runs as fast as possible")
+	partials := flag.Bool("partial-chains", false, "Also print the partial matches that expired with a required step missing")
+	patternsDir := flag.String("patterns-dir", "", "Directory of YAML/JSON pattern definitions added to the built-in patterns; same ID replaces a built-in")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] events.jsonl[.gz]...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || *speed < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *patternsDir != "" {
+		loaded, err := patterns.LoadDir(*patternsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --patterns-dir: %v\n", err)
+			os.Exit(1)
+		}
+		patterns.Register(loaded...)
+		fmt.Printf("[replay] loaded %d pattern(s) from %s\n", len(loaded), *patternsDir)
+	}
+
+	var events []emitter.CausalEvent
+	for _, path := range flag.Args() {
+		evs, err := readEvents(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		events = append(events, evs...)
+	}
+	// Rotated files and concurrent watchers both leave the record slightly
+	// out of order; the matcher needs timestamp order.
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	fmt.Printf("[replay] %d events from %d file(s), speed=%g\n", len(events), flag.NArg(), *speed)
+	if len(events) == 0 {
+		return
+	}
+
+	chains, expired := 0, 0
+	matcher := patterns.NewMatcher(patterns.AllPatterns, func(chain patterns.CausalChain) {
+		chains++
+		printChain(chain)
+	})
+	if *partials {
+		matcher.OnPartial(func(chain patterns.CausalChain) {
+			expired++
+			printChain(chain)
+		})
+	}
+	for i, event := range events {
+		if i > 0 {
+			prev := events[i-1].Timestamp
+			if *speed > 0 && event.Timestamp.After(prev) {
+				time.Sleep(time.Duration(float64(event.Timestamp.Sub(prev)) / *speed))
+			}
+			tick(matcher, prev, event.Timestamp)
+		}
+		matcher.Feed(event)
+	}
+	// Close every window still open at the end of the recording.
+	last := events[len(events)-1].Timestamp
+	tick(matcher, last, last.Add(longestWindow(patterns.AllPatterns)+patterns.AbsenceGrace))
+	fmt.Printf("[replay] %d chain(s) detected\n", chains)
+	if *partials {
+		fmt.Printf("[replay] %d partial chain(s) expired\n", expired)
+	}
+}
+
+// readEvents loads the causal events of one JSONL file, gzip-compressed
+// or not. The CausalChainDetected and PartialChainExpired records of the
+// live matcher are skipped; replay derives its own chains.
+func readEvents(path string) ([]emitter.CausalEvent, error) {
+	recs, err := emitter.ReadJSONL(path, func(r emitter.Record) bool {
+		t := r.Event.EventType
+		return t != "" && t != "CausalChainDetected" && t != "PartialChainExpired"
+	}, func(line int, err error) {
+		fmt.Fprintf(os.Stderr, "[replay] %s:%d: skipping malformed line: %v\n", path, line, err)
+	})
+	events := make([]emitter.CausalEvent, 0, len(recs))
+	for _, r := range recs {
+		events = append(events, r.Event)
+	}
+	return events, err
+}
+
+// tickInterval matches the live collector's matcher.Run interval, so
+// windows resolve, and chains complete, at the times they would have live.
+const tickInterval = 5 * time.Second
+
+// tick advances the matcher's clock from one instant to another in
+// tickInterval steps.
+func tick(m *patterns.Matcher, from, to time.Time) {
+	for t := from.Truncate(tickInterval).Add(tickInterval); t.Before(to); t = t.Add(tickInterval) {
+		m.Advance(t)
+	}
+}
+
+func longestWindow(all map[string]patterns.CausalPattern) time.Duration {
+	var longest time.Duration
+	for _, p := range all {
+		for _, s := range p.Steps {
+			longest = max(longest, time.Duration(s.WindowSecs)*time.Second)
+		}
+	}
+	return longest
+}
+
+func printChain(c patterns.CausalChain) {
+	fmt.Println("----------------------------------------")
+	if c.Partial {
+		fmt.Print("PARTIAL ")
+	}
+	fmt.Printf("%s %s  trigger=%s pod=%s ns=%s node=%s confidence=%.2f\n",
+		c.PatternID, c.PatternName, c.Trigger.EventType, c.Trigger.PodName, c.Trigger.Namespace, c.Trigger.NodeName, c.Confidence)
+	fmt.Printf("  %s → %s (%s)\n",
+		c.StartedAt.UTC().Format(time.RFC3339), c.CompletedAt.UTC().Format(time.RFC3339), c.CompletedAt.Sub(c.StartedAt).Round(time.Second))
+	for _, s := range c.Steps {
+		offset := ""
+		if s.Event != nil {
+			offset = fmt.Sprintf("%+.0fs", s.Event.Timestamp.Sub(c.Trigger.Timestamp).Seconds())
+		}
+		fmt.Printf("  %-11s %-24s %-8s %s\n", s.Role, s.EventType, s.Status, offset)
+	}
+}
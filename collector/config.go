@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/health"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+	"github.com/opscart/k8s-causal-memory/collector/watcher"
+)
+
+// Config is the collector's configuration, one field per flag, the sink
+// options kept in the emitter package's own option types. parseConfig
+// fills it in once; resolve then checks it and derives what the wiring
+// needs from it.
+type Config struct {
+	ConfigFile string
+
+	// Clusters and what is watched in them.
+	Kubeconfig           string
+	Contexts             string
+	Namespace            string
+	NamespaceSelector    string
+	LabelSelector        string
+	FieldSelector        string
+	ContainerImageFilter string
+	ContainerNameFilter  string
+	KubeQPS              float64
+	KubeBurst            int
+	APICallQPS           float64
+	APICallBurst         int
+	APICallTimeout       time.Duration
+
+	// Sinks.
+	Emitters       []string
+	EmitterQueue   int
+	OutputDir      string
+	JSON           emitter.JSONOptions
+	Archive        emitter.S3ArchiveOptions
+	KafkaBrokers   string
+	KafkaTopic     string
+	KafkaQueue     int
+	DBPath         string
+	SQLiteQueue    int
+	RingSize       int
+	RingAddr       string
+	StdoutFormat   string
+	GRPCAddr       string
+	GRPCQueue      int
+	TLS            emitter.TLSOptions
+	Shed           emitter.ShedOptions
+	RedactRules    []string
+	RedactSalt     string
+	EnabledEvents  string
+	DisabledEvents string
+
+	// Watchers.
+	NodeCacheTTL        time.Duration
+	EnableSampling      bool
+	SamplingInterval    time.Duration
+	SamplingDepth       int
+	CrashLoopQuiet      time.Duration
+	MinRestarts         int
+	TerminationHistory  int
+	CascadeWindow       time.Duration
+	ReconcileInterval   time.Duration
+	SnapshotTriggers    string
+	SnapshotFirstSeen   bool
+	TrackImages         bool
+	NodeProxy           bool
+	RecommendVPA        bool
+	VPAHeadroom         float64
+	CaptureLogs         bool
+	LogTailLines        int
+	StormWindow         time.Duration
+	StormThreshold      int
+	RiskThreshold       float64
+	OvercommitThreshold float64
+	NodePodMemory       bool
+	OvercommitInterval  time.Duration
+	DrainThreshold      int
+	TrafficLossGrace    time.Duration
+	LagThreshold        time.Duration
+	PVCPendingThreshold time.Duration
+	LargeConfigMap      int
+	CaptureDiffs        bool
+	RedactPattern       string
+	SecretHashKey       string
+
+	// Pattern detection.
+	CorrelationWindow time.Duration
+	Windows           *patterns.NamespaceWindows
+	EmitPartials      bool
+	PatternsDir       string
+	ChainsAddr        string
+	ChainStoreSize    int
+	OTLPEndpoint      string
+	OTLPInsecure      bool
+
+	// The process.
+	MetricsAddr         string
+	HealthAddr          string
+	DisconnectThreshold time.Duration
+	LeaderElect         bool
+	LeaseNamespace      string
+	LeaseName           string
+	AuthCheckInterval   time.Duration
+	AuthRebuildAfter    int
+	ShutdownTimeout     time.Duration
+	IgnoreRBAC          bool
+	Resume              bool
+	LogLevel            string
+	LogFormat           string
+
+	// Derived by resolve.
+	contexts         []string
+	namespaces       []string // a single "" watches all of them
+	podSel, objSel   watcher.Selectors
+	nsSel            watcher.Selectors
+	snapshotTriggers watcher.SnapshotTriggers
+	containerFilter  *watcher.ContainerFilter
+	redact           *regexp.Regexp // nil disables ConfigMap diff redaction
+}
+
+// newConfig returns a Config holding the defaults, its fields bound to the
+// flags it defines in fs.
+func newConfig(fs *flag.FlagSet) *Config {
+	c := &Config{Windows: patterns.NewNamespaceWindows()}
+	fs.StringVar(&c.ConfigFile, "config", "", "YAML or JSON file of flag values keyed by flag name; flags on the command line, then "+envPrefix+"* environment variables such as "+envName("log-level")+", take precedence")
+	fs.StringVar(&c.Kubeconfig, "kubeconfig", "", "Path to kubeconfig")
+	fs.StringVar(&c.Contexts, "contexts", "", "Comma-separated kubeconfig contexts to watch at once, each cluster with watchers of its own, into one stream whose records name their context in a cluster field (default: the current context only)")
+	fs.StringVar(&c.Namespace, "namespace", "", "Comma-separated namespaces to watch (default: all)")
+	fs.StringVar(&c.NamespaceSelector, "namespace-label-selector", "", "Watch the namespaces matching this label selector, e.g. oma-collect=true, starting and stopping their watchers as namespaces come and go (instead of --namespace)")
+	fs.StringVar(&c.OutputDir, "output", "./output", "Directory for JSONL output")
+	fs.StringVar(&c.LabelSelector, "label-selector", "", "Label selector applied to pod, configmap and workload (Deployment, StatefulSet, DaemonSet, ReplicaSet) watches")
+	fs.StringVar(&c.FieldSelector, "field-selector", "", "Field selector applied to pod watches (e.g. status.phase!=Running)")
+	fs.StringVar(&c.ContainerImageFilter, "container-image-filter", "", "Regexp of container images whose terminations, OOMKills and crash loops are reported; other containers, such as sidecars, are skipped")
+	fs.StringVar(&c.ContainerNameFilter, "container-name-filter", "", "Regexp of container names whose terminations, OOMKills and crash loops are reported; other containers, such as sidecars, are skipped")
+	fs.Func("emitter", "Event sink: json, kafka, sqlite, ring or stdout (default json). Repeatable: every sink receives every record", func(kind string) error {
+		if slices.Contains(c.Emitters, kind) {
+			return fmt.Errorf("%s given twice", kind)
+		}
+		c.Emitters = append(c.Emitters, kind)
+		return nil
+	})
+	fs.IntVar(&c.EmitterQueue, "emitter-queue-size", 10000, "Records buffered per sink before dropping (with more than one --emitter)")
+	fs.StringVar(&c.KafkaBrokers, "kafka-brokers", "", "Comma-separated Kafka bootstrap brokers (with --emitter=kafka)")
+	fs.StringVar(&c.KafkaTopic, "kafka-topic", "oma-causal-events", "Kafka topic for events and snapshots (with --emitter=kafka)")
+	fs.IntVar(&c.KafkaQueue, "kafka-queue-size", 10000, "Records buffered while Kafka is unavailable before dropping")
+	fs.StringVar(&c.DBPath, "db-path", "./output/events.db", "SQLite database file (with --emitter=sqlite)")
+	fs.IntVar(&c.SQLiteQueue, "sqlite-queue-size", 10000, "Records buffered for the SQLite writer before dropping (with --emitter=sqlite)")
+	fs.IntVar(&c.Shed.HighWater, "shed-high-water", 0, "Emit queue depth at which ContainerTerminated and CrashLoopBackOff events are sampled, and the rest dropped, until the queue drains below it; 0 disables the queue")
+	fs.IntVar(&c.Shed.QueueSize, "shed-queue-size", 10000, "Records the emit queue holds before watchers wait for room (with --shed-high-water)")
+	fs.Float64Var(&c.Shed.SampleRate, "shed-sample-rate", emitter.DefaultShedSampleRate, "Fraction of sampled event types kept above the high-water mark (with --shed-high-water)")
+	fs.IntVar(&c.RingSize, "ring-size", emitter.DefaultRingSize, "Most recent events kept in memory (with --emitter=ring)")
+	fs.StringVar(&c.RingAddr, "ring-addr", ":9104", "Address serving the kept events as JSON on /events, filtered by ?type=, namespace=, since= and limit= (with --emitter=ring)")
+	fs.StringVar(&c.StdoutFormat, "stdout-format", emitter.StdoutJSONL, "Record format on stdout: jsonl, one JSON record per line; pretty, indented JSON; or compact, a one-line summary. Colored on a terminal unless NO_COLOR is set (with --emitter=stdout)")
+	fs.StringVar(&c.ChainsAddr, "chains-addr", "", "Address serving the causal chains detected since start as JSON on /chains, filtered by ?pattern=, namespace=, since=, until= and limit=, and one chain on /chains/{id}, e.g. :9105 (default: disabled)")
+	fs.IntVar(&c.ChainStoreSize, "chain-store-size", patterns.DefaultChainStoreSize, "Most recent causal chains kept for /chains (with --chains-addr)")
+	fs.StringVar(&c.GRPCAddr, "grpc-addr", "", "Address for the gRPC CausalStream server, e.g. :9103 (default: disabled)")
+	fs.IntVar(&c.GRPCQueue, "grpc-queue-size", 1000, "Records buffered per gRPC subscriber before dropping")
+	fs.StringVar(&c.TLS.CAFile, "tls-ca-file", "", "PEM CAs verifying the Kafka brokers, and the gRPC subscribers' client certificates, which are then required (default: system roots, no client certificates)")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert-file", "", "PEM certificate presented to Kafka brokers and served by the gRPC server, which then serves TLS")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key-file", "", "PEM key of --tls-cert-file")
+	fs.StringVar(&c.TLS.ServerName, "tls-server-name", "", "Name the Kafka brokers' certificates are verified against (default: the broker host)")
+	fs.BoolVar(&c.TLS.Insecure, "tls-insecure", false, "Do not verify the Kafka brokers' certificates; for testing only")
+	fs.DurationVar(&c.JSON.FlushInterval, "flush-interval", emitter.DefaultJSONFlushInterval, "Maximum time a record stays buffered before it is written (with --emitter=json)")
+	fs.IntVar(&c.JSON.BufferSize, "buffer-size", emitter.DefaultJSONBufferSize, "Write buffer per output file in bytes; negative writes every record through (with --emitter=json)")
+	fs.IntVar(&c.JSON.RetryBuffer, "write-retry-buffer", emitter.DefaultJSONRetryBuffer, "Records held in memory per output file while writing it fails, written once it recovers; the oldest are dropped past it (with --emitter=json)")
+	fs.Int64Var(&c.JSON.MaxFileSize, "max-file-size", 0, "Rotate an output file before it exceeds this many bytes; 0 disables (with --emitter=json)")
+	fs.DurationVar(&c.JSON.MaxFileAge, "max-file-age", 0, "Rotate an output file once it is this old; 0 disables (with --emitter=json)")
+	fs.IntVar(&c.JSON.MaxBackups, "max-backups", 0, "Gzip-compressed rotated files kept per output file; 0 keeps all (with --emitter=json)")
+	fs.StringVar(&c.Archive.Bucket, "archive-s3-bucket", "", "Upload rotated output files to this S3 bucket, credentials from the default AWS chain: AWS_* environment variables, shared config, IRSA or instance metadata. They need s3:PutObject on the prefix; with s3:GetObject and s3:ListBucket too, files already archived are not uploaded again (with --emitter=json and rotation)")
+	fs.StringVar(&c.Archive.Prefix, "archive-s3-prefix", "", "Key prefix of archived files, followed by YYYY/MM/DD/ (with --archive-s3-bucket)")
+	fs.StringVar(&c.Archive.Region, "archive-s3-region", os.Getenv("AWS_REGION"), "Region of the archive bucket (with --archive-s3-bucket)")
+	fs.StringVar(&c.Archive.Endpoint, "archive-s3-endpoint", "", "Endpoint of an S3-compatible store such as MinIO, instead of AWS (with --archive-s3-bucket)")
+	fs.BoolVar(&c.Archive.DeleteLocal, "archive-delete-local", false, "Delete a rotated file once it is archived (with --archive-s3-bucket)")
+	fs.BoolVar(&c.JSON.DryRun, "dry-run", false, "Pretty-print events and snapshots to stdout instead of writing output files (with --emitter=json)")
+	fs.Float64Var(&c.KubeQPS, "kube-api-qps", 50, "Requests per second the collector's Kubernetes client may make, watches and lists included")
+	fs.IntVar(&c.KubeBurst, "kube-api-burst", 100, "Requests the Kubernetes client may make at once above --kube-api-qps")
+	fs.Float64Var(&c.APICallQPS, "api-call-qps", watcher.DefaultAPICallQPS, "Requests per second for the Gets made while handling an event, such as a node snapshot, which fall back to cached data when throttled; 0 disables the limit")
+	fs.IntVar(&c.APICallBurst, "api-call-burst", watcher.DefaultAPICallBurst, "Per-event Gets that may be made at once above --api-call-qps")
+	fs.DurationVar(&c.APICallTimeout, "api-call-timeout", watcher.DefaultAPICallTimeout, "How long a per-event Get may wait for its turn and its answer before cached data is used (with --api-call-qps)")
+	fs.DurationVar(&c.NodeCacheTTL, "node-cache-ttl", watcher.DefaultNodeCacheTTL, "Age after which a cached node is re-fetched for snapshots")
+	fs.BoolVar(&c.EnableSampling, "enable-metrics-sampling", false, "Sample container memory usage from metrics.k8s.io and attach the recent trajectory to OOMKill events")
+	fs.DurationVar(&c.SamplingInterval, "metrics-sampling-interval", watcher.DefaultSamplingInterval, "Interval between memory usage samples (with --enable-metrics-sampling)")
+	fs.IntVar(&c.SamplingDepth, "metrics-sampling-depth", watcher.DefaultSamplingDepth, "Memory usage samples kept per container (with --enable-metrics-sampling)")
+	fs.DurationVar(&c.CrashLoopQuiet, "crashloop-quiet-interval", watcher.DefaultCrashLoopQuietInterval, "How long a container stuck in CrashLoopBackOff goes unreported while its restart count stays the same")
+	fs.IntVar(&c.MinRestarts, "min-restart-count", 0, "Emit ContainerTerminated and CrashLoopBackOff only for containers restarted at least this many times; OOMKill is always emitted")
+	fs.IntVar(&c.TerminationHistory, "termination-history-depth", watcher.DefaultTerminationHistory, "Terminations kept per container and attached to OOMKill and ContainerTerminated events as recent_terminations; 0 disables")
+	fs.DurationVar(&c.CascadeWindow, "pod-cascade-window", watcher.DefaultCascadeWindow, "Window after a pod's first container termination within which its other containers' terminations join the same incident, and PodOOMCascade is emitted if the first was an OOMKill; 0 disables")
+	fs.DurationVar(&c.ReconcileInterval, "pod-reconcile-interval", watcher.DefaultReconcileInterval, "Interval between lists of the watched pods that emit a PodDisappeared snapshot for each pod gone without its deletion having been observed; 0 disables")
+	fs.StringVar(&c.SnapshotTriggers, "snapshot-triggers", watcher.DefaultSnapshotTriggers, "Comma-separated events that also snapshot the state of the pod or node they concern at that moment: PodDeleted (deleted or evicted), OOMKill, CrashLoopBackOff, NodeMemoryPressure")
+	fs.BoolVar(&c.SnapshotFirstSeen, "snapshot-on-first-seen", false, "Emit a FirstObserved snapshot of each pod's images, resources, volumes and config references the first time it is seen")
+	fs.BoolVar(&c.TrackImages, "track-image-digests", false, "Emit ImageDigestChanged when a workload's container first runs a new image digest, and attach the previous digest to its terminations")
+	fs.BoolVar(&c.NodeProxy, "node-proxy", false, "Read an OOMKilled container's cgroup memory limit and working set from its kubelet through the API server's node proxy")
+	fs.BoolVar(&c.RecommendVPA, "vpa-recommendations", false, "Emit VPARecommendation with a suggested memory limit for containers OOMKilled repeatedly (needs --termination-history-depth)")
+	fs.Float64Var(&c.VPAHeadroom, "vpa-headroom-factor", watcher.DefaultVPAHeadroom, "Factor applied to a container's peak sampled memory usage for the suggested limit (with --vpa-recommendations)")
+	fs.BoolVar(&c.CaptureLogs, "capture-logs", false, "Attach the last log lines of a terminated container to its OOMKill or ContainerTerminated event")
+	fs.IntVar(&c.LogTailLines, "log-tail-lines", watcher.DefaultLogTailLines, "Log lines captured per terminated container (with --capture-logs)")
+	fs.StringVar(&c.OTLPEndpoint, "otlp-endpoint", "", "OTLP/gRPC collector address, e.g. otel-collector:4317, to export detected causal chains as traces (default: disabled)")
+	fs.BoolVar(&c.OTLPInsecure, "otlp-insecure", false, "Connect to --otlp-endpoint without TLS")
+	fs.DurationVar(&c.StormWindow, "oom-storm-window", watcher.DefaultOOMStormWindow, "Sliding window over which OOMKills on one node are counted toward a NodeOOMStorm")
+	fs.IntVar(&c.StormThreshold, "oom-storm-threshold", watcher.DefaultOOMStormThreshold, "OOMKills on one node within --oom-storm-window that make a NodeOOMStorm; 0 disables")
+	fs.Float64Var(&c.RiskThreshold, "oom-risk-threshold", watcher.DefaultOOMRiskThreshold, "oom_risk from 0 to 1 at which a running pod on a node entering MemoryPressure is reported as HighOOMRisk; 0 disables")
+	fs.Float64Var(&c.OvercommitThreshold, "node-overcommit-threshold", 0, "Ratio of a node's pod memory requests to its allocatable memory, e.g. 0.9, at which NodeMemoryOvercommit is emitted; needs to watch every pod in the cluster. 0 disables")
+	fs.BoolVar(&c.NodePodMemory, "node-pod-memory", false, "Add to node snapshots, an OOMKill's node_state among them, the count of pods on the node, the sums of their memory requests and limits, and those over its allocatable memory; needs to watch every pod in the cluster")
+	fs.DurationVar(&c.OvercommitInterval, "node-overcommit-interval", watcher.DefaultOvercommitInterval, "Interval between node memory commitment checks (with --node-overcommit-threshold)")
+	fs.IntVar(&c.DrainThreshold, "endpoints-drained-threshold", 0, "Ready endpoints a Service may drop to before EndpointsDrained is emitted; 0 reports only Services left with none")
+	fs.DurationVar(&c.TrafficLossGrace, "traffic-loss-grace", watcher.DefaultTrafficLossGrace, "How long a Service may stay without ready endpoints after draining before TrafficLoss is emitted")
+	fs.DurationVar(&c.LagThreshold, "lag-threshold", watcher.DefaultLagThreshold, "Observation lag, from a change to its emit, above which HighCollectorLag is reported; 0 disables")
+	fs.DurationVar(&c.PVCPendingThreshold, "pvc-pending-threshold", watcher.DefaultPVCPendingThreshold, "Time a PersistentVolumeClaim may stay Pending before PVCStuckPending is emitted")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", "", "Address for the Prometheus /metrics endpoint, e.g. :9102 (default: disabled)")
+	fs.StringVar(&c.HealthAddr, "health-addr", "", "Address for the /healthz and /readyz probe endpoints, e.g. :8081 (default: disabled)")
+	fs.DurationVar(&c.DisconnectThreshold, "health-disconnect-threshold", health.DefaultDisconnectThreshold, "How long every watch may be disconnected before /healthz fails (with --health-addr)")
+	fs.IntVar(&c.LargeConfigMap, "large-configmap-bytes", watcher.DefaultLargeConfigMapBytes, "ConfigMap content size from which its hash is computed incrementally and its events marked large_configmap; 0 disables")
+	fs.BoolVar(&c.CaptureDiffs, "capture-configmap-diffs", false, "Include old and new values of changed ConfigMap keys in ConfigMapChanged events")
+	fs.StringVar(&c.RedactPattern, "configmap-redact-pattern", watcher.DefaultRedactPattern, "Regexp of ConfigMap keys whose values are redacted in captured diffs")
+	fs.Func("redact", "Redact matching payload and snapshot values: a JSON path such as $.labels.team ($.node_state.* for every key below), or a regexp matched against key names at any depth. Repeatable", func(rule string) error {
+		c.RedactRules = append(c.RedactRules, rule)
+		return nil
+	})
+	fs.StringVar(&c.EnabledEvents, "enabled-events", "", "Comma-separated event types written to the sinks, e.g. OOMKill,ConfigMapChanged; OOMKill and meta events are always written. Pattern detection still sees every event (default: all)")
+	fs.StringVar(&c.DisabledEvents, "disabled-events", "", "Comma-separated event types, meta events and OOMKill included, never written to the sinks")
+	fs.StringVar(&c.RedactSalt, "redact-salt", "", "Replace redacted values with a salted SHA-256 hash instead of [REDACTED], so equal values stay correlatable (with --redact)")
+	fs.StringVar(&c.SecretHashKey, "secret-hash-key", "", "Key of the HMAC-SHA256 content hashes in SecretChanged events, so they compare across restarts and replicas; anyone holding it can check guessed values against them (default: --redact-salt, else a random key per process, so hashes compare within one run only)")
+	fs.DurationVar(&c.CorrelationWindow, "correlation-window", patterns.DefaultCorrelationWindow, "How far apart two events on the same pod, object or node may be and still share a correlation_id")
+	fs.Func("namespace-window", "Override a pattern step's window for the chains triggered in one namespace, as NAMESPACE:PATTERN/EVENT_TYPE=DURATION, e.g. batch:P002/PodNotRestarted=15m, or its OOMKill evidence window, as NAMESPACE:evidence=DURATION. Repeatable", c.Windows.Set)
+	fs.BoolVar(&c.EmitPartials, "emit-partial-chains", false, "Emit PartialChainExpired when a pattern's trigger fired but a required later step never came within its window")
+	fs.StringVar(&c.PatternsDir, "patterns-dir", "", "Directory of YAML/JSON pattern definitions added to the built-in patterns; same ID replaces a built-in")
+	fs.BoolVar(&c.LeaderElect, "leader-elect", false, "Run watchers only while holding a Lease, so several replicas can run for availability without duplicating events")
+	fs.StringVar(&c.LeaseNamespace, "leader-elect-namespace", "default", "Namespace of the leader election Lease (with --leader-elect)")
+	fs.StringVar(&c.LeaseName, "leader-elect-lease-name", "k8s-causal-memory-collector", "Name of the leader election Lease (with --leader-elect)")
+	fs.DurationVar(&c.AuthCheckInterval, "auth-check-interval", defaultAuthCheckInterval, "Interval between checks that the API server still accepts the collector's credentials; 0 disables")
+	fs.IntVar(&c.AuthRebuildAfter, "auth-rebuild-after", defaultAuthRebuildAfter, "Consecutive rejected credential checks after which the client is rebuilt from reloaded credentials (with --auth-check-interval)")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "How long to wait on shutdown for watchers to finish in-flight events before closing the emitter anyway")
+	fs.BoolVar(&c.IgnoreRBAC, "ignore-rbac-preflight", false, "Start even if the startup RBAC check finds permissions missing; the watchers lacking them fail on their own")
+	fs.BoolVar(&c.Resume, "resume", false, "Resume watches from resourceVersions checkpointed in the output directory")
+	fs.StringVar(&c.LogLevel, "log-level", "info", "Operational log level: debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", "text", "Operational log format: text or json. Logs go to stderr, never to the event output")
+	return c
+}
+
+// parseConfig parses args into a new Config, then fills in what they left
+// unset from the environment and the config file, as applyConfig does. It
+// returns the config file read, "" if none.
+func parseConfig(fs *flag.FlagSet, args []string) (*Config, string, error) {
+	c := newConfig(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	path, err := applyConfig(fs, "config")
+	return c, path, err
+}
+
+// resolve checks the flags that only make sense together and parses the
+// selectors, filters and lists the watchers take. It returns the first
+// problem found.
+func (c *Config) resolve() error {
+	if c.KubeQPS <= 0 || c.KubeBurst < 1 || (c.APICallQPS > 0 && c.APICallBurst < 1) {
+		return errors.New("--kube-api-qps must be positive and --kube-api-burst and --api-call-burst at least 1")
+	}
+	if c.AuthRebuildAfter < 1 {
+		return errors.New("--auth-rebuild-after must be at least 1")
+	}
+	if c.RecommendVPA && (c.TerminationHistory <= 0 || c.VPAHeadroom < 1) {
+		return errors.New("--vpa-recommendations counts OOMKills in the termination history and suggests limits above peak usage; it needs --termination-history-depth above 0 and --vpa-headroom-factor of at least 1")
+	}
+	if c.JSON.DryRun && c.Resume {
+		return errors.New("--resume reads and writes a checkpoint in the output directory; it cannot be combined with --dry-run")
+	}
+	c.contexts = splitList(c.Contexts)
+	if len(c.contexts) > 1 && c.LeaderElect {
+		return errors.New("--leader-elect holds a Lease in one cluster; it cannot be combined with more than one of --contexts")
+	}
+	if len(c.Emitters) == 0 {
+		c.Emitters = []string{"json"}
+	}
+	if c.JSON.DryRun && slices.Contains(c.Emitters, "stdout") {
+		return errors.New("--dry-run and --emitter=stdout both write records to stdout; use one of them")
+	}
+	if c.Archive.Bucket != "" && (!slices.Contains(c.Emitters, "json") || c.JSON.DryRun) {
+		return errors.New("--archive-s3-bucket archives the files of --emitter=json and cannot be used without them")
+	}
+
+	// Field selectors are resource-specific and every useful one
+	// (status.phase, spec.nodeName) exists on pods only, so configmap and
+	// workload watches are scoped by the label selector alone. The other
+	// objects, Secrets, claims, Services, Ingresses, EndpointSlices, HPAs
+	// and Jobs, rarely carry the labels of the pods they concern and are
+	// watched unscoped, lest the selector hide what happens to the
+	// selected pods.
+	var err error
+	if c.podSel, err = watcher.ParseSelectors(c.LabelSelector, c.FieldSelector); err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+	c.objSel = watcher.Selectors{Label: c.podSel.Label}
+	if c.snapshotTriggers, err = watcher.ParseSnapshotTriggers(splitList(c.SnapshotTriggers)); err != nil {
+		return fmt.Errorf("invalid --snapshot-triggers: %w", err)
+	}
+	if c.containerFilter, err = watcher.ParseContainerFilter(c.ContainerImageFilter, c.ContainerNameFilter); err != nil {
+		return fmt.Errorf("invalid container filter: %w", err)
+	}
+	c.redact = nil // an empty pattern disables redaction
+	if c.RedactPattern != "" {
+		if c.redact, err = regexp.Compile(c.RedactPattern); err != nil {
+			return fmt.Errorf("invalid --configmap-redact-pattern: %w", err)
+		}
+	}
+	if c.NamespaceSelector != "" && c.Namespace != "" {
+		return errors.New("--namespace and --namespace-label-selector are mutually exclusive")
+	}
+	if c.nsSel, err = watcher.ParseSelectors(c.NamespaceSelector, ""); err != nil {
+		return fmt.Errorf("invalid --namespace-label-selector: %w", err)
+	}
+	c.namespaces = parseNamespaces(c.Namespace)
+	return nil
+}
+
+// features are the optional features whose permissions the RBAC preflight
+// checks. Namespaces found through the selector are only known once
+// watched, so their permissions are checked cluster-wide.
+func (c *Config) features() preflightFeatures {
+	return preflightFeatures{
+		captureLogs:    c.CaptureLogs,
+		nodeProxy:      c.NodeProxy,
+		sampling:       c.EnableSampling,
+		leaderElect:    c.LeaderElect,
+		leaseNamespace: c.LeaseNamespace,
+		namespaceWatch: c.nsSel.Label != "",
+		allPods:        c.OvercommitThreshold > 0 || c.NodePodMemory,
+	}
+}
+
+// doctor is what "collector doctor" checks for this configuration: the
+// clusters, the directories the sinks write to and the addresses served.
+func (c *Config) doctor() doctorOptions {
+	var outputDirs []string
+	if slices.Contains(c.Emitters, "json") && !c.JSON.DryRun {
+		outputDirs = append(outputDirs, c.OutputDir)
+	}
+	if slices.Contains(c.Emitters, "sqlite") {
+		outputDirs = append(outputDirs, filepath.Dir(c.DBPath))
+	}
+	addrs := map[string]string{}
+	for name, addr := range map[string]string{
+		"metrics-addr": c.MetricsAddr,
+		"health-addr":  c.HealthAddr,
+		"grpc-addr":    c.GRPCAddr,
+		"chains-addr":  c.ChainsAddr,
+	} {
+		if addr != "" {
+			addrs[name] = addr
+		}
+	}
+	if slices.Contains(c.Emitters, "ring") {
+		addrs["ring-addr"] = c.RingAddr
+	}
+	return doctorOptions{
+		kubeconfig: c.Kubeconfig,
+		contexts:   c.contexts,
+		qps:        float32(c.KubeQPS),
+		burst:      c.KubeBurst,
+		namespaces: c.namespaces,
+		features:   c.features(),
+		podSel:     c.podSel,
+		objSel:     c.objSel,
+		outputDirs: outputDirs,
+		addrs:      addrs,
+	}
+}
+
+// envPrefix starts the environment variable of every flag: --log-level is
+// read from OMA_LOG_LEVEL.
+const envPrefix = "OMA_"
+
+// envName is the environment variable of the named flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyConfig fills in the flags of fs not given on the command line, from
+// their environment variables and then from the YAML or JSON config file
+// named by the config flag, so precedence runs flags, environment, file,
+// defaults. The file is a map from flag names to values, which keeps every
+// flag, present and future, configurable without a second list of them:
+//
+//	namespace: prod,staging
+//	emitter: [json, kafka]
+//	lag-threshold: 45s
+//
+// A list sets a repeatable flag once per element; an environment variable
+// sets it once. Keys naming no flag, and values a flag rejects, are all
+// reported in the returned error. It returns the config file read, "" if
+// none.
+func applyConfig(fs *flag.FlagSet, configFlag string) (string, error) {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] {
+			return
+		}
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", envName(f.Name), err))
+		}
+		given[f.Name] = true
+	})
+	if err := errors.Join(errs...); err != nil {
+		return "", err
+	}
+
+	path := fs.Lookup(configFlag).Value.String()
+	if path == "" {
+		return "", nil
+	}
+	values, err := readConfig(path)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		f := fs.Lookup(key)
+		switch {
+		case f == nil:
+			errs = append(errs, fmt.Errorf("%s: unknown key %q", path, key))
+			continue
+		case key == configFlag:
+			errs = append(errs, fmt.Errorf("%s: %q cannot be set from the config file", path, key))
+			continue
+		case given[key]:
+			continue
+		}
+		elems, isList := values[key].([]interface{})
+		if !isList {
+			elems = []interface{}{values[key]}
+		}
+		for _, elem := range elems {
+			s, err := configScalar(elem)
+			if err == nil {
+				err = fs.Set(key, s)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", path, key, err))
+				break
+			}
+		}
+	}
+	return path, errors.Join(errs...)
+}
+
+// readConfig decodes a config file, keeping numbers as written so that
+// large integers do not turn into floats.
+func readConfig(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// YAML is a superset of JSON, so one decoder serves both.
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := map[string]interface{}{}
+	if len(bytes.TrimSpace(data)) == 0 || string(bytes.TrimSpace(data)) == "null" {
+		return values, nil // an empty file
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("%s: must map flag names to values: %w", path, err)
+	}
+	return values, nil
+}
+
+func configScalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number, bool:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", errors.New("no value")
+	default:
+		return "", fmt.Errorf("must be a string, number, boolean or list of them, got %T", v)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFlags is a small flag set of the shapes main defines: strings,
+// durations, booleans and a repeatable flag.
+type testFlags struct {
+	fs                        *flag.FlagSet
+	namespace, output, logLvl *string
+	lagThreshold              *string
+	captureDiffs              *bool
+	emitters                  []string
+}
+
+func newTestFlags() *testFlags {
+	f := &testFlags{fs: flag.NewFlagSet("collector", flag.ContinueOnError)}
+	f.fs.SetOutput(io.Discard)
+	f.fs.String("config", "", "")
+	f.namespace = f.fs.String("namespace", "", "")
+	f.output = f.fs.String("output", "./output", "")
+	f.logLvl = f.fs.String("log-level", "info", "")
+	f.lagThreshold = f.fs.String("lag-threshold", "30s", "")
+	f.captureDiffs = f.fs.Bool("capture-configmap-diffs", false, "")
+	f.fs.Func("emitter", "", func(s string) error {
+		f.emitters = append(f.emitters, s)
+		return nil
+	})
+	return f
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "collector.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+namespace: from-file
+output: /var/lib/oma
+log-level: warn
+capture-configmap-diffs: true
+emitter: [json, kafka]
+`)
+	t.Setenv("OMA_LOG_LEVEL", "debug")
+	t.Setenv("OMA_NAMESPACE", "from-env")
+
+	f := newTestFlags()
+	if err := f.fs.Parse([]string{"--config", path, "--namespace", "from-flag"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := applyConfig(f.fs, "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != path {
+		t.Errorf("config file = %q, want %q", got, path)
+	}
+	for _, tc := range []struct{ name, got, want string }{
+		{"namespace (flag over env and file)", *f.namespace, "from-flag"},
+		{"log-level (env over file)", *f.logLvl, "debug"},
+		{"output (file over default)", *f.output, "/var/lib/oma"},
+		{"lag-threshold (default)", *f.lagThreshold, "30s"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+	if !*f.captureDiffs {
+		t.Error("capture-configmap-diffs not set from the file")
+	}
+	if !slices.Equal(f.emitters, []string{"json", "kafka"}) {
+		t.Errorf("emitter = %q, want one Set per list element", f.emitters)
+	}
+}
+
+// The environment sets a repeatable flag once, and then the file's list
+// does not add to it.
+func TestApplyConfigEnvReplacesFileList(t *testing.T) {
+	path := writeConfig(t, "emitter: [json, kafka]\n")
+	t.Setenv("OMA_EMITTER", "stdout")
+	f := newTestFlags()
+	f.fs.Parse([]string{"--config", path})
+	if _, err := applyConfig(f.fs, "config"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(f.emitters, []string{"stdout"}) {
+		t.Errorf("emitter = %q, want [stdout]", f.emitters)
+	}
+}
+
+func TestApplyConfigReportsEveryBadKey(t *testing.T) {
+	path := writeConfig(t, `
+namespaces: prod
+log_level: debug
+config: other.yaml
+capture-configmap-diffs: maybe
+output: {dir: /tmp}
+`)
+	f := newTestFlags()
+	f.fs.Parse([]string{"--config", path})
+	_, err := applyConfig(f.fs, "config")
+	if err == nil {
+		t.Fatal("bad config accepted")
+	}
+	for _, want := range []string{
+		`unknown key "namespaces"`,
+		`unknown key "log_level"`,
+		`"config" cannot be set from the config file`,
+		"capture-configmap-diffs:",
+		"output: must be a string, number, boolean or list of them",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestApplyConfigBadEnvValue(t *testing.T) {
+	t.Setenv("OMA_CAPTURE_CONFIGMAP_DIFFS", "yes please")
+	f := newTestFlags()
+	f.fs.Parse(nil)
+	if _, err := applyConfig(f.fs, "config"); err == nil || !strings.Contains(err.Error(), "OMA_CAPTURE_CONFIGMAP_DIFFS") {
+		t.Fatalf("err = %v, want it to name the variable", err)
+	}
+}
+
+func TestApplyConfigWithoutFile(t *testing.T) {
+	f := newTestFlags()
+	f.fs.Parse(nil)
+	if got, err := applyConfig(f.fs, "config"); got != "" || err != nil {
+		t.Fatalf("applyConfig = %q, %v", got, err)
+	}
+	if *f.output != "./output" {
+		t.Errorf("output = %q, want the default", *f.output)
+	}
+}
+
+func TestApplyConfigEmptyAndJSONFiles(t *testing.T) {
+	for _, content := range []string{"", "# nothing yet\n"} {
+		f := newTestFlags()
+		f.fs.Parse([]string{"--config", writeConfig(t, content)})
+		if _, err := applyConfig(f.fs, "config"); err != nil {
+			t.Errorf("file %q: %v", content, err)
+		}
+	}
+	f := newTestFlags()
+	f.fs.Parse([]string{"--config", writeConfig(t, `{"namespace": "prod", "lag-threshold": "45s"}`)})
+	if _, err := applyConfig(f.fs, "config"); err != nil {
+		t.Fatal(err)
+	}
+	if *f.namespace != "prod" || *f.lagThreshold != "45s" {
+		t.Errorf("namespace %q lag-threshold %q", *f.namespace, *f.lagThreshold)
+	}
+}
+
+func testConfig(t *testing.T, args ...string) *Config {
+	t.Helper()
+	fs := flag.NewFlagSet("collector", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg, _, err := parseConfig(fs, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// parseConfig fills the typed fields from the collector's own flags, with
+// the precedence applyConfig gives them.
+func TestParseConfigTyped(t *testing.T) {
+	path := writeConfig(t, `
+namespace: from-file
+lag-threshold: 45s
+max-file-size: 10485760
+shed-high-water: 500
+tls-insecure: true
+emitter: [json, ring]
+namespace-window: [batch:P002/PodNotRestarted=15m]
+`)
+	t.Setenv("OMA_SHED_SAMPLE_RATE", "0.25")
+	cfg := testConfig(t, "--config", path, "--namespace", "from-flag")
+
+	if cfg.ConfigFile != path || cfg.Namespace != "from-flag" {
+		t.Errorf("config %q namespace %q", cfg.ConfigFile, cfg.Namespace)
+	}
+	if cfg.LagThreshold != 45*time.Second || cfg.JSON.MaxFileSize != 10<<20 || cfg.Shed.HighWater != 500 || cfg.Shed.SampleRate != 0.25 || !cfg.TLS.Insecure {
+		t.Errorf("lag-threshold %v max-file-size %d shed-high-water %d shed-sample-rate %v tls-insecure %v",
+			cfg.LagThreshold, cfg.JSON.MaxFileSize, cfg.Shed.HighWater, cfg.Shed.SampleRate, cfg.TLS.Insecure)
+	}
+	if !slices.Equal(cfg.Emitters, []string{"json", "ring"}) {
+		t.Errorf("emitter = %q", cfg.Emitters)
+	}
+	if cfg.OutputDir != "./output" || cfg.KubeQPS != 50 || cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("defaults: output %q kube-api-qps %v shutdown-timeout %v", cfg.OutputDir, cfg.KubeQPS, cfg.ShutdownTimeout)
+	}
+	if err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.namespaces, []string{"from-flag"}) {
+		t.Errorf("namespaces = %q", cfg.namespaces)
+	}
+}
+
+func TestConfigResolve(t *testing.T) {
+	cfg := testConfig(t, "--label-selector", "app=api", "--field-selector", "spec.nodeName=node-1", "--configmap-redact-pattern", "")
+	if err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.Emitters, []string{"json"}) || !slices.Equal(cfg.namespaces, []string{""}) {
+		t.Errorf("emitters %q namespaces %q, want json over all namespaces", cfg.Emitters, cfg.namespaces)
+	}
+	if cfg.objSel.Label != "app=api" || cfg.objSel.Field != "" || cfg.podSel.Field != "spec.nodeName=node-1" {
+		t.Errorf("pod selectors %+v object selectors %+v", cfg.podSel, cfg.objSel)
+	}
+	if cfg.redact != nil {
+		t.Errorf("an empty --configmap-redact-pattern redacts %v", cfg.redact)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--kube-api-burst", "0"}, "--kube-api-burst"},
+		{[]string{"--auth-rebuild-after", "0"}, "--auth-rebuild-after"},
+		{[]string{"--vpa-recommendations", "--termination-history-depth", "0"}, "--termination-history-depth"},
+		{[]string{"--dry-run", "--resume"}, "--resume"},
+		{[]string{"--contexts", "a,b", "--leader-elect"}, "--leader-elect"},
+		{[]string{"--dry-run", "--emitter", "stdout"}, "--emitter=stdout"},
+		{[]string{"--emitter", "kafka", "--archive-s3-bucket", "oma"}, "--archive-s3-bucket"},
+		{[]string{"--label-selector", "app in"}, "invalid selector"},
+		{[]string{"--snapshot-triggers", "Sometimes"}, "--snapshot-triggers"},
+		{[]string{"--container-name-filter", "("}, "container filter"},
+		{[]string{"--configmap-redact-pattern", "("}, "--configmap-redact-pattern"},
+		{[]string{"--namespace", "prod", "--namespace-label-selector", "oma=true"}, "mutually exclusive"},
+	} {
+		err := testConfig(t, tc.args...).resolve()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = %v, want it to mention %s", tc.args, err, tc.want)
+		}
+	}
+}
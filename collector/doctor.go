@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/watcher"
+)
+
+// doctorTimeout bounds the API calls of each cluster's checks, so that an
+// unreachable API server fails its check instead of hanging the doctor.
+const doctorTimeout = 30 * time.Second
+
+// doctorCheck is one row of the doctor's report.
+type doctorCheck struct {
+	name   string
+	ok     bool
+	detail string
+}
+
+// doctorOptions is what the doctor checks, taken from the same flags the
+// collector would start with.
+type doctorOptions struct {
+	kubeconfig string
+	contexts   []string
+	qps        float32
+	burst      int
+	namespaces []string
+	features   preflightFeatures
+	podSel     watcher.Selectors
+	objSel     watcher.Selectors
+	outputDirs []string          // directories the sinks write to
+	addrs      map[string]string // flag name → address to bind
+}
+
+// runDoctor checks, without starting a watch, what a run with the same
+// flags would fail on first: that each cluster's kubeconfig resolves and
+// its API server answers, that the collector may make every call its
+// enabled watchers need, that the selectors are valid, that the output
+// directories are writable and that the endpoints can bind. It writes one
+// row per check to w and reports whether all of them passed.
+func runDoctor(ctx context.Context, w io.Writer, opts doctorOptions) bool {
+	var checks []doctorCheck
+	contexts := opts.contexts
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+	for _, name := range contexts {
+		checks = append(checks, doctorCluster(ctx, name, opts)...)
+	}
+	for _, dir := range opts.outputDirs {
+		checks = append(checks, doctorOutputDir(dir))
+	}
+	for _, flagName := range slices.Sorted(maps.Keys(opts.addrs)) {
+		checks = append(checks, doctorBind(flagName, opts.addrs[flagName]))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tRESULT\tDETAIL")
+	failed := 0
+	for _, c := range checks {
+		result := "PASS"
+		if !c.ok {
+			result = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.name, result, c.detail)
+	}
+	tw.Flush()
+	if failed > 0 {
+		fmt.Fprintf(w, "\n%d of %d checks failed\n", failed, len(checks))
+		return false
+	}
+	fmt.Fprintf(w, "\nall %d checks passed\n", len(checks))
+	return true
+}
+
+// doctorCluster checks one cluster: its kubeconfig, its API server, the
+// collector's permissions in it and the selectors. Once a check fails the
+// ones depending on it are not run.
+func doctorCluster(ctx context.Context, kubeContext string, opts doctorOptions) []doctorCheck {
+	prefix := ""
+	if kubeContext != "" {
+		prefix = kubeContext + ": "
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+
+	config, err := loadConfig(opts.kubeconfig, kubeContext)
+	if err != nil {
+		return []doctorCheck{{prefix + "kubeconfig", false, err.Error()}}
+	}
+	checks := []doctorCheck{{prefix + "kubeconfig", true, config.Host}}
+	client, _, err := buildClient(opts.kubeconfig, kubeContext, opts.qps, opts.burst)
+	if err != nil {
+		return append(checks, doctorCheck{prefix + "client", false, err.Error()})
+	}
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return append(checks, doctorCheck{prefix + "server version", false, err.Error()})
+	}
+	checks = append(checks, doctorCheck{prefix + "server version", true, version.GitVersion})
+
+	perms := requiredPermissions(opts.namespaces, opts.features)
+	missing, err := checkPermissions(ctx, client, perms)
+	switch {
+	case err != nil:
+		checks = append(checks, doctorCheck{prefix + "permissions", false, err.Error()})
+	case len(missing) == 0:
+		checks = append(checks, doctorCheck{prefix + "permissions", true, fmt.Sprintf("%d checked", len(perms))})
+	default:
+		for _, r := range rules(missing) {
+			checks = append(checks, doctorCheck{prefix + "permissions", false, "add to " + r.role() + ": " + r.String()})
+		}
+	}
+
+	if opts.podSel != (watcher.Selectors{}) {
+		for _, ns := range opts.namespaces {
+			name := prefix + "selectors"
+			if ns != "" {
+				name += " in " + ns
+			}
+			if err := watcher.ValidateSelectors(ctx, client, ns, opts.podSel, opts.objSel); err != nil {
+				checks = append(checks, doctorCheck{name, false, err.Error()})
+			} else {
+				checks = append(checks, doctorCheck{name, true, ""})
+			}
+		}
+	}
+	return checks
+}
+
+// doctorOutputDir checks that dir exists, or can be created, and that a
+// file can be written in it.
+func doctorOutputDir(dir string) doctorCheck {
+	name := "output " + dir
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return doctorCheck{name, false, err.Error()}
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return doctorCheck{name, false, err.Error()}
+	}
+	_, err = f.WriteString("ok\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	os.Remove(f.Name())
+	if err != nil {
+		return doctorCheck{name, false, err.Error()}
+	}
+	abs, _ := filepath.Abs(dir)
+	return doctorCheck{name, true, "writable: " + abs}
+}
+
+// doctorBind checks that addr, the address of the named flag, can be
+// listened on: not in use, and a port the collector may bind.
+func doctorBind(flagName, addr string) doctorCheck {
+	name := "--" + flagName
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return doctorCheck{name, false, err.Error()}
+	}
+	l.Close()
+	return doctorCheck{name, true, "can bind " + addr}
+}
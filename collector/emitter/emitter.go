@@ -0,0 +1,115 @@
+package emitter
+
+import (
+	"sync"
+	"time"
+)
+
+// CausalEvent and Snapshot carry SchemaVersion and CollectorVersion; both
+// are filled in by the emitter, watchers leave them empty.
+//
+// An event has three times. Timestamp is when the collector observed the
+// change, the clock the pattern matcher runs on. OccurredAt is when the
+// change happened, by the time the source object records for it: a
+// container's finishedAt, a condition's lastTransitionTime, an Event's
+// last occurrence. Watchers set it where there is one; the emitter falls
+// back to Timestamp. EmittedAt is when the emitter took the event, set by
+// the emitter. Watchers run concurrently and observe changes late by
+// different amounts, so neither Timestamp nor EmittedAt orders an effect
+// after its cause: to reconstruct what happened, sort by OccurredAt.
+type CausalEvent struct {
+	ID               string    `json:"id"`
+	SchemaVersion    string    `json:"schema_version"`
+	CollectorVersion string    `json:"collector_version"`
+	Timestamp        time.Time `json:"timestamp"`
+	OccurredAt       time.Time `json:"occurred_at"`
+	EmittedAt        time.Time `json:"emitted_at"`
+	EventType        string    `json:"event_type"`
+	PatternID        string    `json:"pattern_id,omitempty"`
+	PodName          string    `json:"pod_name,omitempty"`
+	Namespace        string    `json:"namespace,omitempty"`
+	NodeName         string    `json:"node_name,omitempty"`
+	PodUID           string    `json:"pod_uid,omitempty"`
+	// Cluster is the kubeconfig context of the cluster the event came from,
+	// when the collector watches more than one; see ClusterEmitter.
+	Cluster string `json:"cluster,omitempty"`
+	// CorrelationID is shared by the events of one incident; see
+	// Correlator.
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+	Payload       map[string]interface{} `json:"payload"`
+}
+
+type Snapshot struct {
+	ID               string                 `json:"id"`
+	SchemaVersion    string                 `json:"schema_version"`
+	CollectorVersion string                 `json:"collector_version"`
+	Timestamp        time.Time              `json:"timestamp"`
+	ObjectKind       string                 `json:"object_kind"`
+	ObjectName       string                 `json:"object_name"`
+	Namespace        string                 `json:"namespace,omitempty"`
+	TriggerEvent     string                 `json:"trigger_event"`
+	Cluster          string                 `json:"cluster,omitempty"`
+	State            map[string]interface{} `json:"state"`
+}
+
+// Emitter is a sink for causal events and snapshots. Implementations must
+// be safe for concurrent use: every watcher goroutine emits directly.
+//
+// EmitMeta records events about the collector itself (CollectorError,
+// WatchReconnected) rather than the cluster. They are kept apart from the
+// causal record and never reach pattern matching, but tell a reader when
+// the collector was degraded and a missing link may be a blind spot.
+type Emitter interface {
+	Emit(event CausalEvent)
+	EmitSnapshot(snapshot Snapshot)
+	EmitMeta(event CausalEvent)
+	Close()
+}
+
+// Correlator groups the events of one incident, such as node memory
+// pressure followed by OOMKills and evictions on that node, under a shared
+// CorrelationID that it sets on each event before the event is emitted.
+type Correlator interface {
+	Correlate(event *CausalEvent)
+}
+
+// Observer wraps an Emitter and hands every event to listeners after the
+// wrapped emitter has accepted it. Meta events are not observed. Listeners run on the emitting goroutine
+// and may call Emit themselves.
+type Observer struct {
+	Emitter
+	mu         sync.RWMutex
+	listeners  []func(CausalEvent)
+	correlator Correlator
+}
+
+func NewObserver(inner Emitter) *Observer {
+	return &Observer{Emitter: inner}
+}
+
+func (o *Observer) AddListener(fn func(CausalEvent)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.listeners = append(o.listeners, fn)
+}
+
+// UseCorrelator sets the CorrelationID of every event through c, unless
+// the event already has one, before the event is emitted and observed.
+func (o *Observer) UseCorrelator(c Correlator) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.correlator = c
+}
+
+func (o *Observer) Emit(event CausalEvent) {
+	o.mu.RLock()
+	listeners, correlator := o.listeners, o.correlator
+	o.mu.RUnlock()
+	if correlator != nil && event.CorrelationID == "" {
+		correlator.Correlate(&event)
+	}
+	o.Emitter.Emit(event)
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
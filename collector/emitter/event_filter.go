@@ -0,0 +1,56 @@
+package emitter
+
+import (
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// AlwaysEnabledEvent is emitted even when an enabled list leaves it out:
+// an OOMKill is what every team investigates.
+const AlwaysEnabledEvent = "OOMKill"
+
+// EventFilter wraps an Emitter and drops the events whose type is not
+// enabled before they reach it, so a team interested only in OOMKills or
+// only in config drift gets a stream of just that, without every watcher
+// growing a flag of its own. With an enabled list, only the types in it
+// and OOMKill pass; types in the disabled list never pass. Meta events
+// pass unless their type is disabled, and snapshots always pass. Dropped
+// events are counted in suppressed_events_total.
+//
+// The EventFilter sits in front of the sinks only: listeners on an
+// Observer wrapping it, the pattern matcher among them, see every event,
+// so a chain is detected even if the events it is made of are not kept.
+type EventFilter struct {
+	Emitter
+	enabled  map[string]bool // nil enables every type
+	disabled map[string]bool
+}
+
+func NewEventFilter(inner Emitter, enabled, disabled []string) *EventFilter {
+	f := &EventFilter{Emitter: inner, disabled: map[string]bool{}}
+	if len(enabled) > 0 {
+		f.enabled = map[string]bool{AlwaysEnabledEvent: true}
+		for _, t := range enabled {
+			f.enabled[t] = true
+		}
+	}
+	for _, t := range disabled {
+		f.disabled[t] = true
+	}
+	return f
+}
+
+func (f *EventFilter) Emit(event CausalEvent) {
+	if f.disabled[event.EventType] || (f.enabled != nil && !f.enabled[event.EventType]) {
+		metrics.SuppressedEvents.WithLabelValues(event.EventType).Inc()
+		return
+	}
+	f.Emitter.Emit(event)
+}
+
+func (f *EventFilter) EmitMeta(event CausalEvent) {
+	if f.disabled[event.EventType] {
+		metrics.SuppressedEvents.WithLabelValues(event.EventType).Inc()
+		return
+	}
+	f.Emitter.EmitMeta(event)
+}
@@ -0,0 +1,288 @@
+package emitter
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+	"github.com/opscart/k8s-causal-memory/collector/streampb"
+)
+
+// GRPCEmitter fans records out to a durable inner Emitter and to live
+// CausalStream subscribers. The inner emitter always gets the record first;
+// subscribers are best effort.
+//
+// Each subscriber has its own bounded queue drained by its Subscribe
+// stream. A subscriber that falls behind loses records (counted per
+// subscriber and reported on every Record it does receive) instead of
+// blocking the watch loops or other subscribers. Meta events go to the inner
+// emitter only.
+type GRPCEmitter struct {
+	streampb.UnimplementedCausalStreamServer
+
+	inner     Emitter
+	server    *grpc.Server
+	queueSize int
+	log       *slog.Logger
+
+	mu     sync.RWMutex // guards subs and closed against concurrent fan-out
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+type subscriber struct {
+	eventTypes map[string]bool
+	namespaces map[string]bool
+	snapshots  bool
+	queue      chan *streampb.Record
+	dropped    atomic.Uint64
+}
+
+const grpcCloseTimeout = 5 * time.Second
+
+// NewGRPCEmitter serves CausalStream on addr, over TLS if tlsConf is not
+// nil.
+func NewGRPCEmitter(inner Emitter, addr string, queueSize int, tlsConf *tls.Config, log *slog.Logger) (*GRPCEmitter, error) {
+	if queueSize <= 0 {
+		return nil, fmt.Errorf("grpc queue size must be positive, got %d", queueSize)
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("grpc listen on %s failed: %w", addr, err)
+	}
+	var opts []grpc.ServerOption
+	if tlsConf != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConf)))
+	}
+	g := &GRPCEmitter{
+		inner:     inner,
+		server:    grpc.NewServer(opts...),
+		queueSize: queueSize,
+		log:       log.With("component", "grpc_emitter"),
+		subs:      map[*subscriber]struct{}{},
+	}
+	streampb.RegisterCausalStreamServer(g.server, g)
+	go func() {
+		if err := g.server.Serve(lis); err != nil {
+			g.log.Error("server stopped", "err", err)
+		}
+	}()
+	g.log.Info("serving CausalStream", "addr", lis.Addr().String(), "queue", queueSize,
+		"tls", tlsConf != nil, "client_certs", tlsConf != nil && tlsConf.ClientAuth == tls.RequireAndVerifyClientCert)
+	return g, nil
+}
+
+func (g *GRPCEmitter) Emit(event CausalEvent) {
+	g.inner.Emit(event)
+	event.stamp()
+	var rec *streampb.Record // built on first match, shared by subscribers
+	g.fanOut(func(s *subscriber) *streampb.Record {
+		if !s.wantsEvent(event) {
+			return nil
+		}
+		if rec == nil {
+			rec = &streampb.Record{Record: &streampb.Record_Event{Event: g.eventProto(event)}}
+		}
+		return rec
+	})
+}
+
+func (g *GRPCEmitter) EmitSnapshot(snapshot Snapshot) {
+	g.inner.EmitSnapshot(snapshot)
+	snapshot.stamp()
+	var rec *streampb.Record
+	g.fanOut(func(s *subscriber) *streampb.Record {
+		if !s.wantsSnapshot(snapshot) {
+			return nil
+		}
+		if rec == nil {
+			rec = &streampb.Record{Record: &streampb.Record_Snapshot{Snapshot: g.snapshotProto(snapshot)}}
+		}
+		return rec
+	})
+}
+
+func (g *GRPCEmitter) EmitMeta(event CausalEvent) {
+	g.inner.EmitMeta(event)
+}
+
+// fanOut offers the record pick returns to every subscriber, skipping those
+// for which it returns nil. It never blocks.
+func (g *GRPCEmitter) fanOut(pick func(*subscriber) *streampb.Record) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.closed {
+		return
+	}
+	for s := range g.subs {
+		rec := pick(s)
+		if rec == nil {
+			continue
+		}
+		select {
+		case s.queue <- rec:
+		default:
+			metrics.StreamRecordsDropped.Inc()
+			if n := s.dropped.Add(1); n == 1 || n%100 == 0 {
+				g.log.Warn("backpressure: subscriber behind, records dropped", "dropped", n)
+			}
+		}
+	}
+}
+
+// Subscribe implements streampb.CausalStreamServer. It streams until the
+// client goes away or the emitter is closed.
+func (g *GRPCEmitter) Subscribe(req *streampb.SubscribeRequest, stream streampb.CausalStream_SubscribeServer) error {
+	s := &subscriber{
+		eventTypes: stringSet(req.GetEventTypes()),
+		namespaces: stringSet(req.GetNamespaces()),
+		snapshots:  req.GetIncludeSnapshots(),
+		queue:      make(chan *streampb.Record, g.queueSize),
+	}
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	g.subs[s] = struct{}{}
+	metrics.StreamSubscribers.Set(float64(len(g.subs)))
+	g.mu.Unlock()
+	g.log.Info("subscriber connected",
+		"event_types", req.GetEventTypes(), "namespaces", req.GetNamespaces(), "snapshots", s.snapshots)
+
+	defer func() {
+		g.mu.Lock()
+		if _, ok := g.subs[s]; ok {
+			delete(g.subs, s)
+			metrics.StreamSubscribers.Set(float64(len(g.subs)))
+		}
+		g.mu.Unlock()
+		g.log.Info("subscriber disconnected", "dropped", s.dropped.Load())
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case rec, ok := <-s.queue:
+			if !ok {
+				return nil
+			}
+			// rec is shared with other subscribers; dropped is ours.
+			out := &streampb.Record{Record: rec.Record, Dropped: s.dropped.Load()}
+			if err := stream.Send(out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Close ends every subscription once its queue is drained, stops the
+// server, then closes the inner emitter.
+func (g *GRPCEmitter) Close() {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return
+	}
+	g.closed = true
+	for s := range g.subs {
+		close(s.queue)
+	}
+	g.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		g.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(grpcCloseTimeout):
+		g.server.Stop()
+	}
+	g.log.Info("closed")
+	g.inner.Close()
+}
+
+func (s *subscriber) wantsEvent(event CausalEvent) bool {
+	if len(s.eventTypes) > 0 && !s.eventTypes[event.EventType] {
+		return false
+	}
+	return len(s.namespaces) == 0 || s.namespaces[event.Namespace]
+}
+
+func (s *subscriber) wantsSnapshot(snapshot Snapshot) bool {
+	return s.snapshots && (len(s.namespaces) == 0 || s.namespaces[snapshot.Namespace])
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func (g *GRPCEmitter) eventProto(event CausalEvent) *streampb.CausalEvent {
+	return &streampb.CausalEvent{
+		Id:               event.ID,
+		SchemaVersion:    event.SchemaVersion,
+		CollectorVersion: event.CollectorVersion,
+		Timestamp:        timestamppb.New(event.Timestamp),
+		OccurredAt:       timestamppb.New(event.OccurredAt),
+		EmittedAt:        timestamppb.New(event.EmittedAt),
+		EventType:        event.EventType,
+		PatternId:        event.PatternID,
+		PodName:          event.PodName,
+		Namespace:        event.Namespace,
+		NodeName:         event.NodeName,
+		PodUid:           event.PodUID,
+		CorrelationId:    event.CorrelationID,
+		Cluster:          event.Cluster,
+		Payload:          g.toStruct(event.Payload),
+	}
+}
+
+func (g *GRPCEmitter) snapshotProto(snapshot Snapshot) *streampb.Snapshot {
+	return &streampb.Snapshot{
+		Id:               snapshot.ID,
+		SchemaVersion:    snapshot.SchemaVersion,
+		CollectorVersion: snapshot.CollectorVersion,
+		Timestamp:        timestamppb.New(snapshot.Timestamp),
+		ObjectKind:       snapshot.ObjectKind,
+		ObjectName:       snapshot.ObjectName,
+		Namespace:        snapshot.Namespace,
+		TriggerEvent:     snapshot.TriggerEvent,
+		Cluster:          snapshot.Cluster,
+		State:            g.toStruct(snapshot.State),
+	}
+}
+
+// toStruct converts a payload through its JSON encoding, so the Struct has
+// exactly the keys and value shapes written to events.jsonl (times as
+// RFC 3339 strings, node snapshots as objects).
+func (g *GRPCEmitter) toStruct(m map[string]interface{}) *structpb.Struct {
+	s := &structpb.Struct{}
+	data, err := json.Marshal(m)
+	if err == nil {
+		err = s.UnmarshalJSON(data)
+	}
+	if err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		g.log.Error("payload conversion failed", "err", err)
+		return &structpb.Struct{}
+	}
+	return s
+}
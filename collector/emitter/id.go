@@ -0,0 +1,10 @@
+package emitter
+
+import "github.com/google/uuid"
+
+// NewID returns a random (version 4) UUID for an event or snapshot.
+// IDs must stay unique across watchers, replicas and restarts; a nanosecond
+// timestamp does not, because bursts of events share a clock tick.
+func NewID() string {
+	return uuid.NewString()
+}
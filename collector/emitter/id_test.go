@@ -0,0 +1,37 @@
+package emitter
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewIDUniqueUnderConcurrency(t *testing.T) {
+	const goroutines, perGoroutine = 100, 100
+	ids := make(chan string, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Go(func() {
+			for range perGoroutine {
+				ids <- NewID()
+			}
+		})
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool, goroutines*perGoroutine)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate ID %s", id)
+		}
+		seen[id] = true
+		if u, err := uuid.Parse(id); err != nil || u.Version() != 4 {
+			t.Fatalf("ID %q is not a version 4 UUID (%v)", id, err)
+		}
+	}
+	if len(seen) != goroutines*perGoroutine {
+		t.Fatalf("got %d IDs, want %d", len(seen), goroutines*perGoroutine)
+	}
+}
@@ -1,89 +1,296 @@
 package emitter
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"sync"
 	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
 )
 
-type CausalEvent struct {
-	ID        string                 `json:"id"`
-	Timestamp time.Time              `json:"timestamp"`
-	EventType string                 `json:"event_type"`
-	PatternID string                 `json:"pattern_id,omitempty"`
-	PodName   string                 `json:"pod_name,omitempty"`
-	Namespace string                 `json:"namespace,omitempty"`
-	NodeName  string                 `json:"node_name,omitempty"`
-	PodUID    string                 `json:"pod_uid,omitempty"`
-	Payload   map[string]interface{} `json:"payload"`
-}
+// JSONOptions tunes JSONEmitter buffering and rotation. The zero value
+// uses the defaults and never rotates.
+type JSONOptions struct {
+	// BufferSize is the per-file write buffer in bytes. A negative value
+	// disables buffering and flushes after every record.
+	BufferSize int
+	// FlushInterval bounds how long a record can sit in the buffer before
+	// it reaches the file.
+	FlushInterval time.Duration
+
+	// MaxFileSize rotates a file before a record would take it past this
+	// many bytes. Zero disables size-based rotation.
+	MaxFileSize int64
+	// MaxFileAge rotates a file once it is this old, measured from the
+	// created_at of its header. Zero disables age-based rotation.
+	MaxFileAge time.Duration
+	// RetryBuffer is how many records per file are held in memory while
+	// its writes fail, to be written once they succeed again; past it the
+	// oldest are dropped. Zero uses DefaultJSONRetryBuffer.
+	RetryBuffer int
 
-type Snapshot struct {
-	ID           string                 `json:"id"`
-	Timestamp    time.Time              `json:"timestamp"`
-	ObjectKind   string                 `json:"object_kind"`
-	ObjectName   string                 `json:"object_name"`
-	Namespace    string                 `json:"namespace,omitempty"`
-	TriggerEvent string                 `json:"trigger_event"`
-	State        map[string]interface{} `json:"state"`
+	// MaxBackups is how many gzip-compressed rotated files to keep per
+	// stream. Zero keeps all of them.
+	MaxBackups int
+	// Archive uploads each rotated file once it is compressed; nil keeps
+	// rotated files local only. JSONEmitter.Close closes it.
+	Archive *S3Archiver
+
+	// DryRun pretty-prints records to DryRunOutput (stdout if nil) instead
+	// of writing files; no file or directory is created.
+	DryRun       bool
+	DryRunOutput io.Writer
 }
 
+const (
+	DefaultJSONBufferSize    = 64 * 1024
+	DefaultJSONFlushInterval = time.Second
+	DefaultJSONRetryBuffer   = 10000
+)
+
+// JSONEmitter appends events, snapshots and meta events to JSONL files.
+// Records are buffered in memory and written out by a background flusher,
+// so a burst of events (an OOM cascade across a node) costs a handful of
+// large writes instead of one syscall per record. Files rotate by size or
+// age into gzip-compressed backups. A file that cannot be written, on a
+// full disk say, holds its recent records in memory and is retried with
+// backoff; they are written once it recovers. Close flushes and fsyncs
+// every file.
 type JSONEmitter struct {
 	mu           sync.Mutex
-	eventsFile   *os.File
-	snapshotFile *os.File
+	events       *jsonlStream
+	snapshots    *jsonlStream
+	meta         *jsonlStream
+	writeThrough bool
+	compress     sync.WaitGroup
+	dryRun       io.Writer // non-nil in dry-run mode; streams are then nil
+	closed       bool      // records from a watcher abandoned at shutdown are dropped
+	archive      *S3Archiver
+	log          *slog.Logger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
 }
 
-func NewJSONEmitter(outputDir string) (*JSONEmitter, error) {
+func NewJSONEmitter(outputDir string, opts JSONOptions, log *slog.Logger) (*JSONEmitter, error) {
+	log = log.With("component", "emitter")
+	if opts.DryRun {
+		out := opts.DryRunOutput
+		if out == nil {
+			out = os.Stdout
+		}
+		log.Info("dry run: nothing is written", "output", outputDir)
+		return &JSONEmitter{dryRun: out, log: log}, nil
+	}
+	if opts.BufferSize == 0 {
+		opts.BufferSize = DefaultJSONBufferSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultJSONFlushInterval
+	}
+	if opts.RetryBuffer <= 0 {
+		opts.RetryBuffer = DefaultJSONRetryBuffer
+	}
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create output dir: %w", err)
 	}
-	eventsFile, err := os.OpenFile(outputDir+"/events.jsonl", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
+	e := &JSONEmitter{
+		writeThrough: opts.BufferSize < 0,
+		archive:      opts.Archive,
+		log:          log,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	var err error
+	if e.events, err = openStream(outputDir, "events", opts, &e.compress, log); err != nil {
 		return nil, fmt.Errorf("failed to open events file: %w", err)
 	}
-	snapshotFile, err := os.OpenFile(outputDir+"/snapshots.jsonl", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		eventsFile.Close()
+	if e.snapshots, err = openStream(outputDir, "snapshots", opts, &e.compress, log); err != nil {
+		e.events.close()
 		return nil, fmt.Errorf("failed to open snapshots file: %w", err)
 	}
-	fmt.Printf("[emitter] events    → %s/events.jsonl\n", outputDir)
-	fmt.Printf("[emitter] snapshots → %s/snapshots.jsonl\n", outputDir)
-	return &JSONEmitter{eventsFile: eventsFile, snapshotFile: snapshotFile}, nil
+	if e.meta, err = openStream(outputDir, "meta", opts, &e.compress, log); err != nil {
+		e.events.close()
+		e.snapshots.close()
+		return nil, fmt.Errorf("failed to open meta file: %w", err)
+	}
+	for _, s := range []*jsonlStream{e.events, e.snapshots, e.meta} {
+		s.reportErr = e.reportStream
+	}
+	go e.flushLoop(opts.FlushInterval)
+	log.Info("writing",
+		"events", e.events.path(),
+		"snapshots", e.snapshots.path(),
+		"meta", e.meta.path(),
+	)
+	if opts.MaxFileSize > 0 || opts.MaxFileAge > 0 {
+		log.Info("rotation enabled", "max_size", opts.MaxFileSize, "max_age", opts.MaxFileAge, "max_backups", opts.MaxBackups)
+	}
+	return e, nil
 }
 
 func (e *JSONEmitter) Emit(event CausalEvent) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	event.stamp()
 	data, err := json.Marshal(event)
 	if err != nil {
-		fmt.Printf("[emitter] ERROR: %v\n", err)
+		metrics.EmitterWriteErrors.Inc()
+		e.log.Error("marshal failed", "err", err)
 		return
 	}
-	e.eventsFile.Write(append(data, '\n'))
-	fmt.Printf("[emitter] %-22s pattern=%-5s pod=%s\n", event.EventType, event.PatternID, event.PodName)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dryRun != nil {
+		e.print("event", data)
+		return
+	}
+	if e.closed {
+		e.log.Warn("event emitted after Close, dropped", "event_type", event.EventType)
+		return
+	}
+	e.events.write(data, e.writeThrough)
+	metrics.EventsEmitted.WithLabelValues(event.EventType).Inc()
+	e.log.Debug("event", "event_type", event.EventType, "pattern", event.PatternID, "pod", event.PodName)
 }
 
 func (e *JSONEmitter) EmitSnapshot(snapshot Snapshot) {
+	snapshot.stamp()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		e.log.Error("marshal failed", "err", err)
+		return
+	}
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	data, err := json.Marshal(snapshot)
+	if e.dryRun != nil {
+		e.print("snapshot", data)
+		return
+	}
+	if e.closed {
+		e.log.Warn("snapshot emitted after Close, dropped", "kind", snapshot.ObjectKind)
+		return
+	}
+	e.snapshots.write(data, e.writeThrough)
+	metrics.SnapshotsEmitted.WithLabelValues(snapshot.ObjectKind).Inc()
+	e.log.Debug("snapshot", "kind", snapshot.ObjectKind, "name", snapshot.ObjectName, "trigger", snapshot.TriggerEvent)
+}
+
+func (e *JSONEmitter) EmitMeta(event CausalEvent) {
+	event.stamp()
+	data, err := json.Marshal(event)
 	if err != nil {
-		fmt.Printf("[emitter] ERROR: %v\n", err)
+		metrics.EmitterWriteErrors.Inc()
+		e.log.Error("marshal failed", "err", err)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dryRun != nil {
+		e.print("meta", data)
+		return
+	}
+	if e.closed {
+		e.log.Warn("meta emitted after Close, dropped", "event_type", event.EventType)
+		return
+	}
+	e.meta.write(data, e.writeThrough)
+	e.log.Debug("meta", "event_type", event.EventType)
+}
+
+// reportStream writes a stream's CollectorError or EmitterRecovered to the
+// meta file, or to stderr while that is not written either. Caller holds
+// e.mu.
+func (e *JSONEmitter) reportStream(event CausalEvent) {
+	event.stamp()
+	data, err := json.Marshal(event)
+	if err != nil {
+		e.log.Error("marshal failed", "err", err)
+		return
+	}
+	if e.meta.failing == nil {
+		e.meta.write(data, e.writeThrough)
+	}
+	if e.meta.failing != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", data)
+	}
+}
+
+// print writes one record indented under a "--- <kind>" separator. Caller
+// holds e.mu so records from concurrent watchers do not interleave.
+func (e *JSONEmitter) print(kind string, data []byte) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		buf.Reset()
+		buf.Write(data)
+	}
+	fmt.Fprintf(e.dryRun, "--- %s\n%s\n", kind, buf.Bytes())
+}
+
+// Flush writes buffered records to the files without fsyncing them,
+// rotates files that have aged out while idle, and retries failing files
+// whose backoff has passed.
+func (e *JSONEmitter) Flush() {
+	if e.dryRun != nil {
 		return
 	}
-	e.snapshotFile.Write(append(data, '\n'))
-	fmt.Printf("[emitter] snapshot  %-12s name=%s trigger=%s\n", snapshot.ObjectKind, snapshot.ObjectName, snapshot.TriggerEvent)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	for _, s := range []*jsonlStream{e.events, e.snapshots, e.meta} {
+		if s.failing != nil {
+			s.recover(now)
+			continue
+		}
+		if s.due(0) {
+			s.rotate()
+		}
+		s.flush()
+	}
+}
+
+// stopFlusher stops the background flusher and waits for it to return.
+// Records buffered since its last flush stay buffered, for Close to write.
+func (e *JSONEmitter) stopFlusher() {
+	e.stopOnce.Do(func() { close(e.stop) })
+	<-e.done
+}
+
+func (e *JSONEmitter) flushLoop(interval time.Duration) {
+	defer close(e.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-t.C:
+			e.Flush()
+		}
+	}
 }
 
+// Close stops the flusher, then flushes and fsyncs all files under the
+// lock, so anything emitted before Close returns is on disk. It waits for
+// in-flight compression of rotated files, then stops archiving them. In
+// dry-run mode it does nothing.
 func (e *JSONEmitter) Close() {
+	if e.dryRun != nil {
+		return
+	}
+	e.stopFlusher()
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.eventsFile.Sync()
-	e.eventsFile.Close()
-	e.snapshotFile.Sync()
-	e.snapshotFile.Close()
-	fmt.Println("[emitter] Closed.")
+	e.events.close()
+	e.snapshots.close()
+	e.meta.close()
+	e.closed = true
+	e.compress.Wait()
+	e.archive.Close()
+	e.log.Info("closed")
 }
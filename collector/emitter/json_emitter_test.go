@@ -0,0 +1,211 @@
+package emitter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/health"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// readRecords parses every line of a JSONL file, failing the test on one
+// that is not a JSON object, and returns the records after the header.
+func readRecords(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []map[string]interface{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		var r map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("%s line %d does not parse: %v: %q", filepath.Base(path), n, err, sc.Text())
+		}
+		if n == 1 {
+			if r["record"] != "header" {
+				t.Fatalf("%s starts with %v, not a header", filepath.Base(path), r)
+			}
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// The flusher is stopped while watchers are in the middle of a burst: what
+// it never got to flush, and what is emitted after it is gone, must still
+// reach the file through Close.
+func TestJSONEmitterFlusherStoppedMidBatchDropsNothing(t *testing.T) {
+	dir := t.TempDir()
+	e, err := NewJSONEmitter(dir, JSONOptions{BufferSize: 512, FlushInterval: time.Millisecond}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const watchers, perWatcher = 8, 500
+	half := make(chan struct{})
+	var emitted sync.WaitGroup
+	var wg sync.WaitGroup
+	emitted.Add(watchers)
+	for w := range watchers {
+		wg.Go(func() {
+			for i := range perWatcher {
+				if i == perWatcher/2 {
+					emitted.Done()
+					<-half
+				}
+				e.Emit(CausalEvent{ID: fmt.Sprintf("w%d-%d", w, i), Timestamp: time.Now(), EventType: "OOMKill"})
+			}
+		})
+	}
+	emitted.Wait()
+	e.stopFlusher()
+	close(half)
+	wg.Wait()
+	e.Close()
+
+	records := readRecords(t, filepath.Join(dir, "events.jsonl"))
+	seen := map[string]bool{}
+	for _, r := range records {
+		seen[r["id"].(string)] = true
+	}
+	if len(records) != watchers*perWatcher || len(seen) != watchers*perWatcher {
+		t.Fatalf("got %d records, %d distinct, want %d", len(records), len(seen), watchers*perWatcher)
+	}
+}
+
+func TestJSONEmitterCloseIsDurableWithoutFlusher(t *testing.T) {
+	dir := t.TempDir()
+	// An hour-long interval: the flusher never runs, only Close writes.
+	e, err := NewJSONEmitter(dir, JSONOptions{FlushInterval: time.Hour}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Emit(CausalEvent{ID: "e1", Timestamp: time.Now(), EventType: "OOMKill"})
+	e.EmitSnapshot(Snapshot{ObjectKind: "Pod", ObjectName: "api"})
+	if got := readRecords(t, filepath.Join(dir, "events.jsonl")); len(got) != 0 {
+		t.Fatalf("%d records written before a flush, want them buffered", len(got))
+	}
+	e.Close()
+	if got := readRecords(t, filepath.Join(dir, "events.jsonl")); len(got) != 1 || got[0]["id"] != "e1" {
+		t.Fatalf("events after Close = %v", got)
+	}
+	if got := readRecords(t, filepath.Join(dir, "snapshots.jsonl")); len(got) != 1 {
+		t.Fatalf("got %d snapshots after Close, want 1", len(got))
+	}
+}
+
+// errWriter fails every write with err, as a full disk does.
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func emitIDs(e *JSONEmitter, ids ...string) {
+	for _, id := range ids {
+		e.Emit(CausalEvent{ID: id, Timestamp: time.Now(), EventType: "OOMKill"})
+	}
+}
+
+// While the events file cannot be written the emitter holds the most
+// recent RetryBuffer records, reports the failure once and is not ready;
+// when writes work again it replays them and reports the recovery.
+func TestJSONEmitterHoldsRecordsWhileWritesFail(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	e, err := NewJSONEmitter(dir, JSONOptions{RetryBuffer: 5, FlushInterval: time.Hour}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	emitIDs(e, "e1")
+	e.Flush()
+
+	e.mu.Lock()
+	e.events.w = bufio.NewWriter(errWriter{syscall.ENOSPC})
+	e.mu.Unlock()
+	emitIDs(e, "e2", "e3", "e4", "e5", "e6", "e7", "e8")
+	e.Flush()
+	emitIDs(e, "e9", "e10", "e11")
+	e.Flush() // the retry is not due yet
+
+	meta := readRecords(t, filepath.Join(dir, "meta.jsonl"))
+	if len(meta) != 1 || meta[0]["event_type"] != "CollectorError" {
+		t.Fatalf("meta records = %v, want one CollectorError", meta)
+	}
+	p := meta[0]["payload"].(map[string]interface{})
+	if p["disk_full"] != true || p["operation"] != "write events" || p["held_records"] != 7.0 {
+		t.Errorf("CollectorError payload = %v", p)
+	}
+	st := health.Check(time.Minute)
+	if st.Ready || st.Outputs[path] == "" {
+		t.Errorf("ready = %v with output errors %v, want %s failing", st.Ready, st.Outputs, path)
+	}
+	if got := recordIDs(t, path); !slices.Equal(got, []string{"e1"}) {
+		t.Fatalf("records written while failing: %v", got)
+	}
+
+	// The next attempt reopens the file, past the bad writer.
+	e.mu.Lock()
+	e.events.retryAt = time.Time{}
+	e.mu.Unlock()
+	e.Flush()
+	emitIDs(e, "e12")
+	e.Flush()
+
+	if got, want := recordIDs(t, path), []string{"e1", "e7", "e8", "e9", "e10", "e11", "e12"}; !slices.Equal(got, want) {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+	meta = readRecords(t, filepath.Join(dir, "meta.jsonl"))
+	if len(meta) != 2 || meta[1]["event_type"] != "EmitterRecovered" {
+		t.Fatalf("meta records = %v, want CollectorError then EmitterRecovered", meta)
+	}
+	p = meta[1]["payload"].(map[string]interface{})
+	if p["replayed_records"] != 5.0 || p["dropped_records"] != 5.0 || p["stream"] != "events" {
+		t.Errorf("EmitterRecovered payload = %v", p)
+	}
+	if st := health.Check(time.Minute); st.Outputs[path] != "" {
+		t.Errorf("output still failing after recovery: %v", st.Outputs)
+	}
+}
+
+// Close does not wait out the backoff: it makes a last attempt to write
+// what a failing file holds.
+func TestJSONEmitterCloseWhileFailing(t *testing.T) {
+	dir := t.TempDir()
+	e, err := NewJSONEmitter(dir, JSONOptions{FlushInterval: time.Hour}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitIDs(e, "e1")
+	e.Flush()
+	e.mu.Lock()
+	e.events.w = bufio.NewWriter(errWriter{errors.New("input/output error")})
+	e.mu.Unlock()
+	emitIDs(e, "e2", "e3")
+	e.Flush()
+	// Close reopens the file for a last attempt, which succeeds here.
+	e.Close()
+	if got := recordIDs(t, filepath.Join(dir, "events.jsonl")); !slices.Equal(got, []string{"e1", "e2", "e3"}) {
+		t.Fatalf("records after Close = %v", got)
+	}
+}
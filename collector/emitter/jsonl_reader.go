@@ -0,0 +1,93 @@
+package emitter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Record is one line read back from a JSONL file the JSON emitter wrote.
+// Event is set for events and meta events, Snapshot for snapshots, as the
+// file's Stream says; Raw is the line as written.
+type Record struct {
+	Stream   string // "events", "snapshots" or "meta"
+	Event    CausalEvent
+	Snapshot Snapshot
+	Raw      json.RawMessage
+}
+
+// ReadJSONL returns the records of one JSONL file, gzip-compressed (.gz)
+// or not, that keep selects; a nil keep selects them all. Headers are not
+// records. The stream is taken from the file's header, or from its name
+// if it has none. Lines that do not parse are skipped and reported to
+// malformed, if set, with their line number.
+func ReadJSONL(path string, keep func(Record) bool, malformed func(line int, err error)) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	stream := streamOf(path)
+	var out []Record
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // payloads carry node snapshots
+	for line := 1; sc.Scan(); line++ {
+		var h Header
+		if err := json.Unmarshal(sc.Bytes(), &h); err != nil {
+			report(malformed, line, err)
+			continue
+		}
+		if h.Record == "header" {
+			stream = h.Stream
+			continue
+		}
+		rec := Record{Stream: stream}
+		if stream == "snapshots" {
+			err = json.Unmarshal(sc.Bytes(), &rec.Snapshot)
+		} else {
+			err = json.Unmarshal(sc.Bytes(), &rec.Event)
+		}
+		if err != nil {
+			report(malformed, line, err)
+			continue
+		}
+		if keep != nil && !keep(rec) {
+			continue
+		}
+		rec.Raw = append(json.RawMessage(nil), sc.Bytes()...)
+		out = append(out, rec)
+	}
+	return out, sc.Err()
+}
+
+// streamOf names the stream of a file without a header by the name the
+// JSON emitter gives it: events.jsonl, snapshots-<time>.jsonl.gz and so on.
+func streamOf(path string) string {
+	base := filepath.Base(path)
+	for _, stream := range []string{"snapshots", "meta"} {
+		if strings.HasPrefix(base, stream) {
+			return stream
+		}
+	}
+	return "events"
+}
+
+func report(malformed func(int, error), line int, err error) {
+	if malformed != nil {
+		malformed(line, err)
+	}
+}
@@ -0,0 +1,104 @@
+package emitter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// What the JSON emitter writes reads back record for record, each as the
+// stream its file's header names.
+func TestReadJSONLReadsWhatTheEmitterWrote(t *testing.T) {
+	dir := t.TempDir()
+	e, err := NewJSONEmitter(dir, JSONOptions{}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Emit(CausalEvent{ID: "e1", Timestamp: time.Now(), EventType: "OOMKill"})
+	e.EmitSnapshot(Snapshot{ID: "s1", Timestamp: time.Now(), ObjectKind: "Pod", ObjectName: "api", TriggerEvent: "OOMKill"})
+	e.EmitMeta(CausalEvent{ID: "m1", Timestamp: time.Now(), EventType: "CollectorStarted"})
+	e.Close()
+
+	for _, tc := range []struct{ file, stream, id string }{
+		{"events.jsonl", "events", "e1"},
+		{"snapshots.jsonl", "snapshots", "s1"},
+		{"meta.jsonl", "meta", "m1"},
+	} {
+		recs, err := ReadJSONL(filepath.Join(dir, tc.file), nil, func(line int, err error) {
+			t.Errorf("%s:%d: %v", tc.file, line, err)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(recs) != 1 {
+			t.Fatalf("%s: read %d records, want 1", tc.file, len(recs))
+		}
+		r := recs[0]
+		id := r.Event.ID
+		if tc.stream == "snapshots" {
+			id = r.Snapshot.ID
+		}
+		if r.Stream != tc.stream || id != tc.id {
+			t.Errorf("%s: read %s record %q, want %s record %q", tc.file, r.Stream, id, tc.stream, tc.id)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(r.Raw, &fields); err != nil || fields["id"] != tc.id {
+			t.Errorf("%s: raw line %s is not the record", tc.file, r.Raw)
+		}
+	}
+}
+
+// A compressed file without a header is read as the stream its name
+// says; keep selects records and malformed lines are reported, not fatal.
+func TestReadJSONLFiltersAndReportsMalformedLines(t *testing.T) {
+	var lines bytes.Buffer
+	for _, s := range []Snapshot{
+		{ID: "s1", ObjectKind: "Pod", ObjectName: "api"},
+		{ID: "s2", ObjectKind: "Node", ObjectName: "node-1"},
+	} {
+		data, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines.Write(append(data, '\n'))
+	}
+	lines.WriteString("{\"id\":\"cut\n")
+	lines.WriteString(`{"id":"s3","object_kind":"Pod","object_name":"web"}` + "\n")
+
+	path := filepath.Join(t.TempDir(), "snapshots-20260301T120000.000Z.jsonl.gz")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(lines.Bytes())
+	zw.Close()
+	if err := os.WriteFile(path, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var bad []int
+	recs, err := ReadJSONL(path, func(r Record) bool {
+		return r.Snapshot.ObjectKind == "Pod"
+	}, func(line int, err error) {
+		bad = append(bad, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, r := range recs {
+		if r.Stream != "snapshots" {
+			t.Errorf("record %s read as %s", r.Snapshot.ID, r.Stream)
+		}
+		ids = append(ids, r.Snapshot.ID)
+	}
+	if want := []string{"s1", "s3"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("read %v, want %v", ids, want)
+	}
+	if want := []int{3}; !reflect.DeepEqual(bad, want) {
+		t.Errorf("malformed lines %v, want %v", bad, want)
+	}
+}
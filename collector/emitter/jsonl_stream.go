@@ -0,0 +1,488 @@
+package emitter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/health"
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// rotatedTimeFormat is the suffix of rotated files:
+// events-20260301T120000.000Z.jsonl.gz. It sorts chronologically.
+const rotatedTimeFormat = "20060102T150405.000Z"
+
+// jsonlStream is one buffered, rotating JSONL file. It is not safe for
+// concurrent use; JSONEmitter serialises access with its mutex.
+type jsonlStream struct {
+	dir      string
+	name     string // "events", "snapshots", "meta"
+	opts     JSONOptions
+	file     *os.File
+	w        *bufio.Writer
+	size     int64
+	openedAt time.Time
+
+	// pending holds the records not known to be on disk: those buffered
+	// since the last flush and, while writes fail, every record since, up
+	// to RetryBuffer of the most recent. flushed is the file size at the
+	// last flush; dropped and droppedBytes count the records pending lost
+	// to the RetryBuffer limit.
+	pending      [][]byte
+	flushed      int64
+	dropped      int
+	droppedBytes int64
+
+	// failing is the write error the stream is failing with, nil while it
+	// writes. It reopens the file and writes pending at retryAt, backing
+	// off while that fails.
+	failing   error
+	failedAt  time.Time
+	retryAt   time.Time
+	backoff   time.Duration
+	reportErr func(CausalEvent) // records the stream's failure and recovery
+
+	// compress tracks background compression of rotated files so Close
+	// can wait for it.
+	compress *sync.WaitGroup
+	log      *slog.Logger
+}
+
+// Bounds of the backoff between attempts to write again to a failing file.
+const (
+	writeRetryMin = time.Second
+	writeRetryMax = time.Minute
+)
+
+func openStream(dir, name string, opts JSONOptions, compress *sync.WaitGroup, log *slog.Logger) (*jsonlStream, error) {
+	s := &jsonlStream{dir: dir, name: name, opts: opts, compress: compress, log: log.With("stream", name)}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	// Rotated files a previous run did not get to compress or upload.
+	leftovers, _ := filepath.Glob(filepath.Join(dir, name+"-*.jsonl"))
+	for _, path := range leftovers {
+		s.compressRotated(path)
+	}
+	compressed, _ := filepath.Glob(filepath.Join(dir, name+"-*.jsonl.gz"))
+	for _, path := range compressed {
+		opts.Archive.Archive(path)
+	}
+	return s, nil
+}
+
+func (s *jsonlStream) path() string {
+	return filepath.Join(s.dir, s.name+".jsonl")
+}
+
+// open opens the active file for appending. A new or empty file gets a
+// Header as its first line; an existing stream is continued, once a record
+// a crash left half-written is cut off, and its age is taken from its
+// header.
+func (s *jsonlStream) open() error {
+	n, err := repairTail(s.path())
+	if err != nil {
+		return fmt.Errorf("failed to repair: %w", err)
+	}
+	if n > 0 {
+		s.log.Warn("truncated partial record", "bytes", n)
+	}
+	f, err := os.OpenFile(s.path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.w = bufio.NewWriterSize(f, max(s.opts.BufferSize, 0))
+	s.size = info.Size()
+	s.flushed = s.size
+	s.openedAt = time.Now()
+	if s.size == 0 {
+		data, err := json.Marshal(newHeader(s.name))
+		if err == nil {
+			_, err = f.Write(append(data, '\n'))
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		s.size = int64(len(data) + 1)
+		s.flushed = s.size
+	} else if created, ok := headerTime(s.path()); ok {
+		s.openedAt = created
+	}
+	return nil
+}
+
+// repairTailChunk is how much of the file repairTail reads at a time,
+// backwards from its end, looking for the last newline.
+const repairTailChunk = 64 * 1024
+
+// repairTail makes path end on a record boundary again after the process
+// was killed mid-write: whatever follows the last newline is truncated,
+// and the number of bytes removed returned. If those bytes happen to be a
+// complete record that only lost its newline, the newline is added
+// instead. A missing file needs no repair.
+func repairTail(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	end := size // the offset just past the last newline
+	buf := make([]byte, repairTailChunk)
+	for end > 0 {
+		off := max(end-repairTailChunk, 0)
+		chunk := buf[:end-off]
+		if _, err := f.ReadAt(chunk, off); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			end = off + int64(i) + 1
+			break
+		}
+		end = off
+	}
+	if end == size {
+		return 0, nil
+	}
+	tail := make([]byte, size-end)
+	if _, err := f.ReadAt(tail, end); err != nil {
+		return 0, err
+	}
+	if json.Valid(tail) {
+		_, err := f.WriteAt([]byte{'\n'}, size)
+		return 0, err
+	}
+	if err := f.Truncate(end); err != nil {
+		return 0, err
+	}
+	return size - end, f.Sync()
+}
+
+func headerTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return time.Time{}, false
+	}
+	var h Header
+	if json.Unmarshal(line, &h) != nil || h.Record != "header" {
+		return time.Time{}, false
+	}
+	return h.CreatedAt, true
+}
+
+// write appends one record, rotating first if it would push the file past
+// MaxFileSize or the file is older than MaxFileAge. While the stream is
+// failing the record is held until it writes again.
+func (s *jsonlStream) write(data []byte, writeThrough bool) {
+	line := append(data, '\n')
+	if s.failing == nil && s.due(int64(len(line))) {
+		s.rotate()
+	}
+	if s.failing != nil {
+		s.hold(line)
+		return
+	}
+	n, err := s.w.Write(line)
+	s.size += int64(n)
+	s.pending = append(s.pending, line)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	if writeThrough {
+		s.flush()
+	}
+}
+
+func (s *jsonlStream) due(incoming int64) bool {
+	if s.opts.MaxFileSize > 0 && s.size+incoming > s.opts.MaxFileSize && s.size > 0 {
+		return true
+	}
+	return s.opts.MaxFileAge > 0 && time.Since(s.openedAt) >= s.opts.MaxFileAge
+}
+
+func (s *jsonlStream) flush() {
+	if s.failing != nil {
+		return
+	}
+	if err := s.w.Flush(); err != nil {
+		s.fail(err)
+		return
+	}
+	s.pending = nil
+	s.flushed = s.size
+}
+
+// hold adds a record to pending while the stream is failing, dropping the
+// oldest past RetryBuffer.
+func (s *jsonlStream) hold(line []byte) {
+	s.pending = append(s.pending, line)
+	for len(s.pending) > s.opts.RetryBuffer {
+		metrics.EmitterWriteErrors.Inc()
+		s.dropped++
+		s.droppedBytes += int64(len(s.pending[0]))
+		s.pending = s.pending[1:]
+	}
+}
+
+// fail puts the stream into its failing state: bufio errors are sticky,
+// so nothing more is written until the file is reopened. The failure is
+// reported once, as a CollectorError, and the collector is not ready until
+// the stream recovers.
+func (s *jsonlStream) fail(err error) {
+	if s.failing != nil {
+		return
+	}
+	metrics.EmitterWriteErrors.Inc()
+	s.failing = err
+	s.failedAt = time.Now()
+	s.backoff = writeRetryMin
+	s.retryAt = s.failedAt.Add(s.backoff)
+	s.log.Error("write failed, holding records until writes recover", "err", err, "held", len(s.pending))
+	health.OutputFailed(s.path(), err)
+	s.reportErr(CausalEvent{
+		ID:        NewID(),
+		Timestamp: s.failedAt,
+		EventType: "CollectorError",
+		Payload: map[string]interface{}{
+			"watcher":      "emitter",
+			"operation":    "write " + s.name,
+			"object":       s.path(),
+			"error":        err.Error(),
+			"disk_full":    errors.Is(err, syscall.ENOSPC),
+			"held_records": len(s.pending),
+		},
+	})
+}
+
+// recover reopens the file of a failing stream and writes the records
+// held since, unless its next attempt is not due before now. The records
+// of the failed flush that reached the file stay there; the record the
+// failure cut short is truncated by open and written again.
+func (s *jsonlStream) recover(now time.Time) {
+	if s.failing == nil || now.Before(s.retryAt) {
+		return
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	flushed := s.flushed
+	if err := s.open(); err != nil {
+		s.retryLater(now, err)
+		return
+	}
+	// open continued the file where the failure left it; whatever grew
+	// past flushed is the oldest pending records, less those dropped.
+	written := s.size - flushed - s.droppedBytes
+	s.droppedBytes = 0
+	for len(s.pending) > 0 && int64(len(s.pending[0])) <= written {
+		written -= int64(len(s.pending[0]))
+		s.pending = s.pending[1:]
+	}
+	replayed := len(s.pending)
+	for _, line := range s.pending {
+		n, err := s.w.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			break
+		}
+	}
+	if err := s.w.Flush(); err != nil {
+		s.retryLater(now, err)
+		return
+	}
+	failed, dropped, down := s.failing, s.dropped, now.Sub(s.failedAt)
+	s.failing = nil
+	s.pending = nil
+	s.flushed = s.size
+	s.dropped = 0
+	s.log.Info("writes recovered", "replayed", replayed, "dropped", dropped, "failed_for", down)
+	health.OutputRecovered(s.path())
+	s.reportErr(CausalEvent{
+		ID:        NewID(),
+		Timestamp: now,
+		EventType: "EmitterRecovered",
+		Payload: map[string]interface{}{
+			"stream":           s.name,
+			"object":           s.path(),
+			"error":            failed.Error(),
+			"failed_seconds":   down.Seconds(),
+			"replayed_records": replayed,
+			"dropped_records":  dropped,
+		},
+	})
+}
+
+// retryLater backs off the next attempt to write a failing stream again.
+func (s *jsonlStream) retryLater(now time.Time, err error) {
+	s.backoff = min(s.backoff*2, writeRetryMax)
+	s.retryAt = now.Add(s.backoff)
+	s.log.Warn("write still failing", "err", err, "held", len(s.pending), "dropped", s.dropped, "retry_in", s.backoff)
+	health.OutputFailed(s.path(), err)
+}
+
+// rotate moves the active file aside and starts a fresh one. The active
+// path always holds a complete file: the old one is flushed and fsynced
+// before the rename, and rename is atomic, so a crash leaves either the
+// old file in place or a rotated file plus a new (or not yet created)
+// active file. Compression happens in the background on the rotated copy.
+func (s *jsonlStream) rotate() {
+	s.flush()
+	if s.failing != nil {
+		return // continued in place once the stream recovers
+	}
+	s.file.Sync()
+	s.file.Close()
+	rotated := s.rotatedPath(time.Now())
+	if err := os.Rename(s.path(), rotated); err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		s.log.Error("rotation failed, continuing in place", "err", err)
+		rotated = ""
+	}
+	if err := s.open(); err != nil {
+		// Nothing to write to until the stream recovers.
+		s.file = nil
+		s.fail(fmt.Errorf("reopen after rotation failed: %w", err))
+		return
+	}
+	if rotated != "" {
+		s.log.Info("rotated", "to", filepath.Base(rotated))
+		s.compressRotated(rotated)
+	}
+}
+
+// rotatedPath names a rotated file after t, bumping t by a millisecond
+// while a rotated file (compressed or not) already has that name, so two
+// rotations in quick succession never overwrite each other.
+func (s *jsonlStream) rotatedPath(t time.Time) string {
+	for {
+		path := filepath.Join(s.dir, fmt.Sprintf("%s-%s.jsonl", s.name, t.UTC().Format(rotatedTimeFormat)))
+		_, errPlain := os.Stat(path)
+		_, errGz := os.Stat(path + ".gz")
+		if os.IsNotExist(errPlain) && os.IsNotExist(errGz) {
+			return path
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func (s *jsonlStream) compressRotated(path string) {
+	s.compress.Add(1)
+	go func() {
+		defer s.compress.Done()
+		if err := gzipFile(path); err != nil {
+			metrics.EmitterWriteErrors.Inc()
+			s.log.Error("compress failed", "file", filepath.Base(path), "err", err)
+			return
+		}
+		s.opts.Archive.Archive(path + ".gz")
+		s.prune()
+	}()
+}
+
+// gzipFile compresses path to path.gz via a temp file and removes path only
+// once the archive is complete and fsynced.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := path + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune keeps the MaxBackups newest compressed files of this stream, and
+// any older ones still waiting to be archived.
+func (s *jsonlStream) prune() {
+	if s.opts.MaxBackups <= 0 {
+		return
+	}
+	backups, _ := filepath.Glob(filepath.Join(s.dir, s.name+"-*.jsonl.gz"))
+	if len(backups) <= s.opts.MaxBackups {
+		return
+	}
+	sort.Strings(backups) // timestamp suffix sorts oldest first
+	for _, old := range backups[:len(backups)-s.opts.MaxBackups] {
+		if s.opts.Archive.Pending(old) {
+			continue
+		}
+		if err := os.Remove(old); err == nil {
+			s.log.Info("pruned", "file", strings.TrimPrefix(old, s.dir+string(filepath.Separator)))
+		}
+	}
+}
+
+// close flushes and fsyncs the file. A failing stream gets a last attempt
+// to write its held records; those it cannot write are lost.
+func (s *jsonlStream) close() {
+	if s.failing != nil {
+		s.retryAt = time.Time{}
+		s.recover(time.Now())
+	}
+	if s.failing != nil {
+		metrics.EmitterWriteErrors.Add(float64(len(s.pending)))
+		s.log.Error("closing with records unwritten", "records", len(s.pending), "err", s.failing)
+	} else {
+		s.flush()
+	}
+	if s.file != nil {
+		s.file.Sync()
+		s.file.Close()
+	}
+}
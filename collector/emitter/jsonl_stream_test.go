@@ -0,0 +1,98 @@
+package emitter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeEvents runs a JSONEmitter over dir for the given event IDs and
+// closes it, as one run of the collector would.
+func writeEvents(t *testing.T, dir string, ids ...string) {
+	t.Helper()
+	e, err := NewJSONEmitter(dir, JSONOptions{}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		e.Emit(CausalEvent{ID: id, Timestamp: time.Now(), EventType: "OOMKill"})
+	}
+	e.Close()
+}
+
+func appendTo(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func recordIDs(t *testing.T, path string) []string {
+	t.Helper()
+	var ids []string
+	for _, r := range readRecords(t, path) {
+		ids = append(ids, r["id"].(string))
+	}
+	return ids
+}
+
+// A SIGKILL mid-write leaves part of a record after the last newline:
+// reopening cuts it off, and the next run's records follow on lines of
+// their own.
+func TestJSONEmitterRepairsPartialRecordOnOpen(t *testing.T) {
+	for _, tc := range []struct {
+		name, tail string
+		want       []string
+	}{
+		{"partial record", `{"record":"event","id":"lost","event_type":"OOMK`, []string{"e1", "e2", "e3"}},
+		{"partial record past a read chunk", `{"record":"event","id":"lost","payload":"` + strings.Repeat("x", 3*repairTailChunk), []string{"e1", "e2", "e3"}},
+		{"complete record without its newline", `{"record":"event","id":"kept"}`, []string{"e1", "e2", "kept", "e3"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "events.jsonl")
+			writeEvents(t, dir, "e1", "e2")
+			appendTo(t, path, tc.tail)
+
+			writeEvents(t, dir, "e3")
+			got := recordIDs(t, path)
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Fatalf("records = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRepairTail(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	if n, err := repairTail(path); n != 0 || err != nil {
+		t.Fatalf("missing file: repairTail = %d, %v", n, err)
+	}
+
+	// No newline at all: the whole file is one partial record.
+	partial := `{"record":"header","stre`
+	os.WriteFile(path, []byte(partial), 0644)
+	if n, err := repairTail(path); n != int64(len(partial)) || err != nil {
+		t.Fatalf("repairTail = %d, %v, want %d", n, err, len(partial))
+	}
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Fatalf("file is %d bytes, want empty", info.Size())
+	}
+
+	whole := "{\"a\":1}\n{\"b\":2}\n"
+	os.WriteFile(path, []byte(whole), 0644)
+	if n, err := repairTail(path); n != 0 || err != nil {
+		t.Fatalf("intact file: repairTail = %d, %v", n, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != whole {
+		t.Fatalf("intact file changed to %q", data)
+	}
+}
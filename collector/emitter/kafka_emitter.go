@@ -0,0 +1,241 @@
+package emitter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// KafkaEmitter publishes events and snapshots to a Kafka topic, one JSON
+// record per message. Events are keyed by pod UID so that every record for
+// a pod lands on the same partition and stays ordered.
+//
+// Emit never blocks the watch loops: records go into a bounded queue that a
+// single goroutine drains. While brokers are unavailable the queue fills;
+// once full, new records are dropped and counted (see Dropped) rather than
+// stalling the collector.
+type KafkaEmitter struct {
+	writer *kafka.Writer
+	queue  chan kafka.Message
+	log    *slog.Logger
+
+	mu      sync.RWMutex // guards closed against concurrent enqueue
+	closed  bool
+	ctx     context.Context // cancelled when Close gives up on draining
+	cancel  context.CancelFunc
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+const (
+	kafkaMaxBatch     = 100
+	kafkaCloseTimeout = 10 * time.Second
+)
+
+// NewKafkaEmitter produces to topic on brokers, over TLS if tlsConf is not
+// nil.
+func NewKafkaEmitter(brokers []string, topic string, queueSize int, tlsConf *tls.Config, log *slog.Logger) (*KafkaEmitter, error) {
+	if len(brokers) == 0 || brokers[0] == "" {
+		return nil, fmt.Errorf("kafka emitter requires at least one broker")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("kafka emitter requires a topic")
+	}
+	if queueSize <= 0 {
+		return nil, fmt.Errorf("kafka queue size must be positive, got %d", queueSize)
+	}
+	var transport kafka.RoundTripper
+	if tlsConf != nil {
+		transport = &kafka.Transport{TLS: tlsConf}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	k := &KafkaEmitter{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireOne,
+			BatchTimeout: 50 * time.Millisecond,
+			// Retries happen in run() so a failed batch is never discarded
+			// by the writer itself.
+			MaxAttempts: 1,
+			Transport:   transport,
+		},
+		queue:  make(chan kafka.Message, queueSize),
+		log:    log.With("component", "kafka_emitter"),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go k.run()
+	k.log.Info("producing", "brokers", strings.Join(brokers, ","), "topic", topic, "queue", queueSize, "tls", tlsConf != nil)
+	return k, nil
+}
+
+func (k *KafkaEmitter) Emit(event CausalEvent) {
+	event.stamp()
+	data, err := json.Marshal(event)
+	if err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		k.log.Error("marshal failed", "err", err)
+		return
+	}
+	key := event.PodUID
+	switch {
+	case key != "":
+	case event.NodeName != "":
+		key = event.NodeName
+	case event.Namespace != "":
+		key = event.Namespace
+	default:
+		key = event.ID
+	}
+	if k.enqueue(key, "event", data) {
+		metrics.EventsEmitted.WithLabelValues(event.EventType).Inc()
+		k.log.Debug("event", "event_type", event.EventType, "pattern", event.PatternID, "pod", event.PodName)
+	}
+}
+
+func (k *KafkaEmitter) EmitSnapshot(snapshot Snapshot) {
+	snapshot.stamp()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		k.log.Error("marshal failed", "err", err)
+		return
+	}
+	key := snapshot.Namespace + "/" + snapshot.ObjectName
+	if uid, ok := snapshot.State["uid"].(string); ok && uid != "" {
+		key = uid
+	}
+	if k.enqueue(key, "snapshot", data) {
+		metrics.SnapshotsEmitted.WithLabelValues(snapshot.ObjectKind).Inc()
+		k.log.Debug("snapshot", "kind", snapshot.ObjectKind, "name", snapshot.ObjectName, "trigger", snapshot.TriggerEvent)
+	}
+}
+
+// EmitMeta publishes collector meta events to the same topic, marked by the
+// "meta" record header.
+func (k *KafkaEmitter) EmitMeta(event CausalEvent) {
+	event.stamp()
+	data, err := json.Marshal(event)
+	if err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		k.log.Error("marshal failed", "err", err)
+		return
+	}
+	if k.enqueue(event.ID, "meta", data) {
+		k.log.Debug("meta", "event_type", event.EventType)
+	}
+}
+
+// Dropped reports how many records were discarded because the queue was full.
+func (k *KafkaEmitter) Dropped() uint64 {
+	return k.dropped.Load()
+}
+
+func (k *KafkaEmitter) enqueue(key, record string, value []byte) bool {
+	msg := kafka.Message{
+		Key:   []byte(key),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "oma-record", Value: []byte(record)},
+			{Key: "oma-schema", Value: []byte(SchemaVersion)},
+		},
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.closed {
+		return false
+	}
+	select {
+	case k.queue <- msg:
+		return true
+	default:
+		if n := k.dropped.Add(1); n == 1 || n%100 == 0 {
+			k.log.Warn("backpressure: queue full, records dropped", "dropped", n)
+		}
+		return false
+	}
+}
+
+// run drains the queue in batches. A failed batch is retried with capped
+// exponential backoff; delivery is at-least-once, so a batch that partially
+// succeeded before an error may be delivered twice.
+func (k *KafkaEmitter) run() {
+	defer close(k.done)
+	batch := make([]kafka.Message, 0, kafkaMaxBatch)
+	for msg := range k.queue {
+		batch = append(batch[:0], msg)
+	drain:
+		for len(batch) < kafkaMaxBatch {
+			select {
+			case m, ok := <-k.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, m)
+			default:
+				break drain
+			}
+		}
+		if !k.write(batch) {
+			return
+		}
+	}
+}
+
+func (k *KafkaEmitter) write(batch []kafka.Message) bool {
+	backoff := time.Second
+	for {
+		err := k.writer.WriteMessages(k.ctx, batch...)
+		if err == nil {
+			return true
+		}
+		metrics.EmitterWriteErrors.Inc()
+		k.log.Warn("write failed, retrying", "queued", len(k.queue), "backoff", backoff, "err", err)
+		select {
+		case <-k.ctx.Done():
+			lost := len(batch) + len(k.queue)
+			k.log.Error("giving up on shutdown, records not delivered", "lost", lost)
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// Close stops accepting records, gives the queue kafkaCloseTimeout to
+// drain, then closes the writer.
+func (k *KafkaEmitter) Close() {
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return
+	}
+	k.closed = true
+	close(k.queue)
+	k.mu.Unlock()
+
+	select {
+	case <-k.done:
+	case <-time.After(kafkaCloseTimeout):
+		k.cancel()
+		<-k.done
+	}
+	k.cancel()
+	if err := k.writer.Close(); err != nil {
+		k.log.Error("close failed", "err", err)
+	}
+	k.log.Info("closed", "dropped", k.Dropped())
+}
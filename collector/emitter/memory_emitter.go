@@ -0,0 +1,87 @@
+package emitter
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryEmitter keeps every record in memory, in emit order, for tests and
+// for programs embedding the watchers that consume records themselves.
+// Records are stamped as the file sinks stamp them. It never drops a
+// record and never frees one before Reset, so it suits bounded runs only.
+type MemoryEmitter struct {
+	mu        sync.Mutex
+	events    []CausalEvent
+	snapshots []Snapshot
+	meta      []CausalEvent
+	closed    bool
+}
+
+func NewMemoryEmitter() *MemoryEmitter {
+	return &MemoryEmitter{}
+}
+
+func (m *MemoryEmitter) Emit(event CausalEvent) {
+	event.stamp()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+}
+
+func (m *MemoryEmitter) EmitSnapshot(snapshot Snapshot) {
+	snapshot.stamp()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots = append(m.snapshots, snapshot)
+}
+
+func (m *MemoryEmitter) EmitMeta(event CausalEvent) {
+	event.stamp()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.meta = append(m.meta, event)
+}
+
+// Events returns a copy of the events emitted so far. Payloads are shared
+// with the emitter, as with every sink: callers must not modify them.
+func (m *MemoryEmitter) Events() []CausalEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.events)
+}
+
+// Snapshots returns a copy of the snapshots emitted so far.
+func (m *MemoryEmitter) Snapshots() []Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.snapshots)
+}
+
+// MetaEvents returns a copy of the meta events emitted so far.
+func (m *MemoryEmitter) MetaEvents() []CausalEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.meta)
+}
+
+// Reset forgets every record, so the emitter can be reused.
+func (m *MemoryEmitter) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events, m.snapshots, m.meta = nil, nil, nil
+}
+
+// Close only marks the emitter closed; the records stay readable.
+func (m *MemoryEmitter) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+}
+
+// Closed reports whether Close has been called, which a program that hands
+// the emitter to a shutdown path can check.
+func (m *MemoryEmitter) Closed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
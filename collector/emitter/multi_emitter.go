@@ -0,0 +1,172 @@
+package emitter
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// MultiEmitter fans every record out to several sinks, e.g. JSONL for the
+// archive and Kafka for live consumers. Each sink gets its own bounded
+// queue drained by its own goroutine, so records reach a sink in the order
+// they were emitted, and a sink that is slow or stuck only fills its own
+// queue: a full queue drops that sink's records and counts them (see
+// Dropped), the other sinks carry on. A sink that panics on a record loses
+// that record only.
+type MultiEmitter struct {
+	sinks []*fanoutSink
+	log   *slog.Logger
+}
+
+// NamedEmitter is one sink of a MultiEmitter; the name appears in its logs.
+type NamedEmitter struct {
+	Name string
+	Emitter
+}
+
+type fanoutSink struct {
+	name    string
+	inner   Emitter
+	queue   chan fanoutRecord
+	log     *slog.Logger
+	mu      sync.RWMutex // guards closed against concurrent enqueue
+	closed  bool
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+type fanoutKind int
+
+const (
+	fanoutEvent fanoutKind = iota
+	fanoutSnapshot
+	fanoutMeta
+)
+
+type fanoutRecord struct {
+	kind     fanoutKind
+	event    CausalEvent
+	snapshot Snapshot
+}
+
+func NewMultiEmitter(sinks []NamedEmitter, queueSize int, log *slog.Logger) (*MultiEmitter, error) {
+	if queueSize <= 0 {
+		return nil, fmt.Errorf("emitter queue size must be positive, got %d", queueSize)
+	}
+	m := &MultiEmitter{log: log.With("component", "multi_emitter")}
+	for _, s := range sinks {
+		fs := &fanoutSink{
+			name:  s.Name,
+			inner: s.Emitter,
+			queue: make(chan fanoutRecord, queueSize),
+			log:   m.log.With("sink", s.Name),
+			done:  make(chan struct{}),
+		}
+		go fs.run()
+		m.sinks = append(m.sinks, fs)
+	}
+	m.log.Info("fanning out", "sinks", len(sinks), "queue", queueSize)
+	return m, nil
+}
+
+func (m *MultiEmitter) Emit(event CausalEvent) {
+	m.enqueue(fanoutRecord{kind: fanoutEvent, event: event})
+}
+
+func (m *MultiEmitter) EmitSnapshot(snapshot Snapshot) {
+	m.enqueue(fanoutRecord{kind: fanoutSnapshot, snapshot: snapshot})
+}
+
+func (m *MultiEmitter) EmitMeta(event CausalEvent) {
+	m.enqueue(fanoutRecord{kind: fanoutMeta, event: event})
+}
+
+func (m *MultiEmitter) enqueue(rec fanoutRecord) {
+	for _, s := range m.sinks {
+		s.enqueue(rec)
+	}
+}
+
+// Dropped reports, per sink name, how many records were discarded because
+// the sink's queue was full.
+func (m *MultiEmitter) Dropped() map[string]uint64 {
+	out := make(map[string]uint64, len(m.sinks))
+	for _, s := range m.sinks {
+		out[s.name] = s.dropped.Load()
+	}
+	return out
+}
+
+// Close stops accepting records, lets every sink drain its queue, and
+// closes the sinks, all of them in parallel.
+func (m *MultiEmitter) Close() {
+	var wg sync.WaitGroup
+	for _, s := range m.sinks {
+		wg.Go(s.close)
+	}
+	wg.Wait()
+}
+
+func (s *fanoutSink) enqueue(rec fanoutRecord) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- rec:
+	default:
+		if n := s.dropped.Add(1); n == 1 || n%100 == 0 {
+			s.log.Warn("backpressure: queue full, records dropped", "dropped", n)
+		}
+	}
+}
+
+func (s *fanoutSink) run() {
+	defer close(s.done)
+	for rec := range s.queue {
+		s.deliver(rec)
+	}
+}
+
+func (s *fanoutSink) deliver(rec fanoutRecord) {
+	defer func() {
+		if r := recover(); r != nil {
+			metrics.EmitterWriteErrors.Inc()
+			s.log.Error("sink panicked, record lost", "panic", r)
+		}
+	}()
+	switch rec.kind {
+	case fanoutEvent:
+		s.inner.Emit(rec.event)
+	case fanoutSnapshot:
+		s.inner.EmitSnapshot(rec.snapshot)
+	case fanoutMeta:
+		s.inner.EmitMeta(rec.event)
+	}
+}
+
+func (s *fanoutSink) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.done
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.Error("sink panicked on close", "panic", r)
+		}
+	}()
+	s.inner.Close()
+	if n := s.dropped.Load(); n > 0 {
+		s.log.Warn("closed with records dropped", "dropped", n)
+	}
+}
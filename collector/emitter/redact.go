@@ -0,0 +1,155 @@
+package emitter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces a redacted value when no salt is configured.
+const RedactedValue = "[REDACTED]"
+
+// Redactor wraps an Emitter and redacts values in event payloads and
+// snapshot state before they reach it, so key names, labels and references
+// that carry internal hostnames or customer identifiers never land in a
+// shared sink. Meta events are redacted too.
+//
+// Each rule is either a JSON path into the payload or state, starting with
+// "$." and with "*" matching any key in a segment ($.labels.team,
+// $.node_state.*), or a regexp matched against key names at any depth
+// ((?i)customer). A matched value is replaced whole, nested maps and lists
+// included, with RedactedValue, or with "sha256:<hex>" of the value keyed by
+// the salt when one is given, so equal values can still be correlated.
+// Lists are transparent to paths: $.stale_pods matches the list, and a rule
+// below it applies to every element.
+//
+// Payloads are normalised through their JSON encoding first, so values held
+// as structs in process (node_state) are redacted like any other map. The
+// Redactor sits in front of the sinks only; listeners on an Observer
+// wrapping it see the events as the watchers built them.
+type Redactor struct {
+	Emitter
+	paths [][]string
+	keys  []*regexp.Regexp
+	salt  []byte
+}
+
+// NewRedactor compiles rules. An empty salt replaces values with
+// RedactedValue.
+func NewRedactor(inner Emitter, rules []string, salt string) (*Redactor, error) {
+	r := &Redactor{Emitter: inner}
+	if salt != "" {
+		r.salt = []byte(salt)
+	}
+	for _, rule := range rules {
+		if path, ok := strings.CutPrefix(rule, "$."); ok {
+			segments := strings.Split(path, ".")
+			for _, s := range segments {
+				if s == "" {
+					return nil, fmt.Errorf("redact rule %q: empty path segment", rule)
+				}
+			}
+			r.paths = append(r.paths, segments)
+			continue
+		}
+		re, err := regexp.Compile(rule)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %q: %w", rule, err)
+		}
+		r.keys = append(r.keys, re)
+	}
+	return r, nil
+}
+
+func (r *Redactor) Emit(event CausalEvent) {
+	event.Payload = r.redact(event.Payload)
+	r.Emitter.Emit(event)
+}
+
+func (r *Redactor) EmitSnapshot(snapshot Snapshot) {
+	snapshot.State = r.redact(snapshot.State)
+	r.Emitter.EmitSnapshot(snapshot)
+}
+
+func (r *Redactor) EmitMeta(event CausalEvent) {
+	event.Payload = r.redact(event.Payload)
+	r.Emitter.EmitMeta(event)
+}
+
+// redact returns a redacted copy of m; m itself is left untouched, since
+// watchers may still hold it.
+func (r *Redactor) redact(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		// Left for the sink to report; it fails the same marshal.
+		return m
+	}
+	var copied map[string]interface{}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return m
+	}
+	r.walkMap(copied, r.paths)
+	return copied
+}
+
+// walkMap redacts the entries of m matched by a key rule or by a path in
+// active that ends at that entry, and descends with the paths that continue
+// below it.
+func (r *Redactor) walkMap(m map[string]interface{}, active [][]string) {
+	for k, v := range m {
+		var below [][]string
+		matched := r.keyMatches(k)
+		for _, p := range active {
+			if p[0] != "*" && p[0] != k {
+				continue
+			}
+			if len(p) == 1 {
+				matched = true
+			} else {
+				below = append(below, p[1:])
+			}
+		}
+		if matched {
+			m[k] = r.replacement(v)
+			continue
+		}
+		r.walk(v, below)
+	}
+}
+
+func (r *Redactor) walk(v interface{}, active [][]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		r.walkMap(v, active)
+	case []interface{}:
+		for _, e := range v {
+			r.walk(e, active)
+		}
+	}
+}
+
+func (r *Redactor) keyMatches(key string) bool {
+	for _, re := range r.keys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) replacement(v interface{}) string {
+	if r.salt == nil {
+		return RedactedValue
+	}
+	data, _ := json.Marshal(v)
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write(data)
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,191 @@
+package emitter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// nodeState stands in for the watcher's NodeSnapshot, a struct held in the
+// payload until it is encoded.
+type nodeState struct {
+	NodeName    string            `json:"node_name"`
+	Conditions  map[string]string `json:"conditions"`
+	InternalIPs []string          `json:"internal_ips"`
+	ProviderID  string            `json:"provider_id"`
+}
+
+func testPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"container_name": "api",
+		"labels":         map[string]interface{}{"team": "payments", "app": "api"},
+		"node_state": &nodeState{
+			NodeName:    "ip-10-0-1-17.internal",
+			Conditions:  map[string]string{"Ready": "True"},
+			InternalIPs: []string{"10.0.1.17"},
+			ProviderID:  "aws:///us-east-1a/i-0abc",
+		},
+		"config_references": map[string]interface{}{
+			"configmaps": []string{"acme-corp-config"},
+			"secrets":    []string{"acme-corp-db"},
+		},
+		"recent_terminations": []interface{}{
+			map[string]interface{}{"reason": "OOMKilled", "customer_id": "c-123"},
+			map[string]interface{}{"reason": "Error", "customer_id": "c-456"},
+		},
+		"annotations": map[string]interface{}{
+			"deploy": map[string]interface{}{"CustomerName": "Acme"},
+		},
+	}
+}
+
+func redactOne(t *testing.T, rules []string, salt string, payload map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	m := NewMemoryEmitter()
+	r, err := NewRedactor(m, rules, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Emit(CausalEvent{ID: "e1", EventType: "OOMKill", Payload: payload})
+	events := m.Events()
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	return events[0].Payload
+}
+
+// at follows keys and list indexes down a redacted payload.
+func at(t *testing.T, v interface{}, path ...interface{}) interface{} {
+	t.Helper()
+	for _, p := range path {
+		switch p := p.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("%v is not a map at %q", v, p)
+			}
+			v = m[p]
+		case int:
+			l, ok := v.([]interface{})
+			if !ok || p >= len(l) {
+				t.Fatalf("%v is not a list of %d at %d", v, p+1, p)
+			}
+			v = l[p]
+		}
+	}
+	return v
+}
+
+func TestRedactPaths(t *testing.T) {
+	p := redactOne(t, []string{
+		"$.labels.team",
+		"$.node_state.*",
+		"$.config_references.configmaps",
+		"$.recent_terminations.customer_id",
+	}, "", testPayload())
+
+	for _, tc := range []struct {
+		path []interface{}
+		want interface{}
+	}{
+		{[]interface{}{"labels", "team"}, RedactedValue},
+		{[]interface{}{"labels", "app"}, "api"},
+		{[]interface{}{"node_state", "node_name"}, RedactedValue},
+		{[]interface{}{"node_state", "conditions"}, RedactedValue},
+		{[]interface{}{"node_state", "internal_ips"}, RedactedValue},
+		{[]interface{}{"config_references", "configmaps"}, RedactedValue},
+		{[]interface{}{"config_references", "secrets", 0}, "acme-corp-db"},
+		{[]interface{}{"recent_terminations", 0, "customer_id"}, RedactedValue},
+		{[]interface{}{"recent_terminations", 1, "customer_id"}, RedactedValue},
+		{[]interface{}{"recent_terminations", 1, "reason"}, "Error"},
+		{[]interface{}{"container_name"}, "api"},
+	} {
+		if got := at(t, p, tc.path...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestRedactKeyRegexpAtAnyDepth(t *testing.T) {
+	p := redactOne(t, []string{"(?i)customer", "^provider_id$"}, "", testPayload())
+	for _, path := range [][]interface{}{
+		{"recent_terminations", 0, "customer_id"},
+		{"recent_terminations", 1, "customer_id"},
+		{"annotations", "deploy", "CustomerName"},
+		{"node_state", "provider_id"},
+	} {
+		if got := at(t, p, path...); got != RedactedValue {
+			t.Errorf("%v = %v, want it redacted", path, got)
+		}
+	}
+	if got := at(t, p, "node_state", "node_name"); got != "ip-10-0-1-17.internal" {
+		t.Errorf("node_name = %v, matched by no rule", got)
+	}
+}
+
+func TestRedactSaltedHash(t *testing.T) {
+	payload := testPayload()
+	payload["owner"] = "payments"
+	p := redactOne(t, []string{"$.labels.team", "$.owner", "$.config_references"}, "s3cret", payload)
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(`"payments"`))
+	want := "sha256:" + hex.EncodeToString(mac.Sum(nil))
+	if got := at(t, p, "labels", "team"); got != want {
+		t.Errorf("labels.team = %v, want %v", got, want)
+	}
+	if got := at(t, p, "owner"); got != want {
+		t.Errorf("equal values hashed differently: owner = %v, want %v", got, want)
+	}
+	refs, _ := json.Marshal(testPayload()["config_references"])
+	mac = hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(refs)
+	if got := at(t, p, "config_references"); got != "sha256:"+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("config_references = %v, want the hash of the whole map", got)
+	}
+
+	other := redactOne(t, []string{"$.labels.team"}, "other", testPayload())
+	if at(t, other, "labels", "team") == want {
+		t.Error("a different salt gave the same hash")
+	}
+}
+
+func TestRedactLeavesCallerMapUnmodified(t *testing.T) {
+	payload := testPayload()
+	want, _ := json.Marshal(payload)
+	redactOne(t, []string{"$.labels.team", "$.node_state.*", "$.recent_terminations.reason", "(?i)customer"}, "", payload)
+	got, _ := json.Marshal(payload)
+	if string(got) != string(want) {
+		t.Fatalf("payload modified:\n got %s\nwant %s", got, want)
+	}
+	if payload["node_state"].(*nodeState).NodeName != "ip-10-0-1-17.internal" {
+		t.Fatal("node_state struct modified")
+	}
+}
+
+func TestRedactSnapshotsAndMeta(t *testing.T) {
+	m := NewMemoryEmitter()
+	r, err := NewRedactor(m, []string{"$.labels.team"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.EmitSnapshot(Snapshot{State: map[string]interface{}{"labels": map[string]interface{}{"team": "payments"}}})
+	r.EmitMeta(CausalEvent{EventType: "CollectorError", Payload: map[string]interface{}{"labels": map[string]interface{}{"team": "payments"}}})
+	if got := at(t, m.Snapshots()[0].State, "labels", "team"); got != RedactedValue {
+		t.Errorf("snapshot labels.team = %v", got)
+	}
+	if got := at(t, m.MetaEvents()[0].Payload, "labels", "team"); got != RedactedValue {
+		t.Errorf("meta labels.team = %v", got)
+	}
+}
+
+func TestRedactInvalidRules(t *testing.T) {
+	for _, rule := range []string{"$.labels..team", "$.", "(?i)customer("} {
+		if _, err := NewRedactor(NewMemoryEmitter(), []string{rule}, ""); err == nil {
+			t.Errorf("rule %q accepted", rule)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package emitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRingSize is how many events the ring emitter keeps.
+const DefaultRingSize = 1000
+
+// RingEmitter keeps the most recent events in memory, the oldest evicted
+// first, and serves them as JSON on /events, for dashboards that poll the
+// collector instead of reading its files. Snapshots and meta events are not
+// kept.
+type RingEmitter struct {
+	mu      sync.RWMutex
+	events  []CausalEvent // ring of len capacity once full
+	next    int           // where the next event goes once full
+	evicted uint64
+	closed  bool
+}
+
+func NewRingEmitter(size int) (*RingEmitter, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("ring size must be positive, got %d", size)
+	}
+	return &RingEmitter{events: make([]CausalEvent, 0, size)}, nil
+}
+
+func (r *RingEmitter) Emit(event CausalEvent) {
+	event.stamp()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, event)
+		return
+	}
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+	r.evicted++
+}
+
+func (r *RingEmitter) EmitSnapshot(Snapshot) {}
+
+func (r *RingEmitter) EmitMeta(CausalEvent) {}
+
+// Close stops the ring taking events; those kept stay queryable.
+func (r *RingEmitter) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
+
+// RingQuery selects events from the ring. Zero fields match everything.
+type RingQuery struct {
+	EventTypes []string
+	Namespace  string
+	Since      time.Time // events at or after
+	Limit      int       // the newest Limit matches
+}
+
+func (q RingQuery) matches(e CausalEvent) bool {
+	if len(q.EventTypes) > 0 && !slices.Contains(q.EventTypes, e.EventType) {
+		return false
+	}
+	if q.Namespace != "" && e.Namespace != q.Namespace {
+		return false
+	}
+	return q.Since.IsZero() || !e.Timestamp.Before(q.Since)
+}
+
+// Recent returns the events q selects, oldest first.
+func (r *RingEmitter) Recent(q RingQuery) []CausalEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []CausalEvent{}
+	for i := range r.events {
+		e := r.events[(r.next+i)%len(r.events)]
+		if q.matches(e) {
+			out = append(out, e)
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out
+}
+
+// ServeHTTP answers GET /events. Query parameters: type, repeatable or
+// comma-separated; namespace; since, an RFC 3339 time or a duration back
+// from now such as 10m; limit.
+func (r *RingEmitter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseRingQuery(req, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events := r.Recent(q)
+	r.mu.RLock()
+	capacity, evicted := cap(r.events), r.evicted
+	r.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events":   events,
+		"count":    len(events),
+		"capacity": capacity,
+		"evicted":  evicted,
+	})
+}
+
+func parseRingQuery(req *http.Request, now time.Time) (RingQuery, error) {
+	values := req.URL.Query()
+	var q RingQuery
+	for _, v := range values["type"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				q.EventTypes = append(q.EventTypes, t)
+			}
+		}
+	}
+	q.Namespace = values.Get("namespace")
+	if since := values.Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			q.Since = now.Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			q.Since = t
+		} else {
+			return q, fmt.Errorf("since %q is neither an RFC 3339 time nor a duration", since)
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("limit %q is not a non-negative integer", limit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// Serve exposes /events on addr until ctx is cancelled.
+func (r *RingEmitter) Serve(ctx context.Context, addr string, log *slog.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle("/events", r)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Info("serving /events", "component", "ring_emitter", "addr", addr, "size", cap(r.events))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("events server failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package emitter
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// DefaultArchiveRetryInterval is how long a rotated file whose upload
+// failed waits before the next attempt.
+const DefaultArchiveRetryInterval = time.Minute
+
+// S3ArchiveOptions configures an S3Archiver.
+type S3ArchiveOptions struct {
+	Bucket string
+	// Prefix is prepended to every object key, e.g. "prod-cluster/".
+	Prefix string
+	Region string
+	// Endpoint overrides the AWS endpoint for S3-compatible stores such
+	// as MinIO; the bucket is then addressed in the path.
+	Endpoint string
+	// DeleteLocal removes a rotated file once it is uploaded.
+	DeleteLocal   bool
+	RetryInterval time.Duration
+}
+
+// S3Archiver uploads rotated, compressed JSONL files to object storage for
+// long-term retention, under prefix/YYYY/MM/DD/ keys partitioned by the
+// rotation time. A file whose upload fails stays on disk and is retried
+// every RetryInterval; MaxBackups pruning leaves it alone until it is
+// uploaded. Files still pending at Close are picked up on the next start,
+// when every rotated file on disk is offered again and those already in
+// the bucket with the same size are skipped, where the credentials may
+// read the bucket; otherwise they are uploaded again. A nil *S3Archiver
+// archives nothing.
+type S3Archiver struct {
+	client *s3Client
+	opts   S3ArchiveOptions
+	log    *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]bool // local paths not yet uploaded
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewS3Archiver(opts S3ArchiveOptions, log *slog.Logger) (*S3Archiver, error) {
+	client, err := newS3Client(opts.Bucket, opts.Region, opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultArchiveRetryInterval
+	}
+	a := &S3Archiver{
+		client:  client,
+		opts:    opts,
+		log:     log.With("component", "s3_archiver"),
+		pending: map[string]bool{},
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	a.log.Info("archiving rotated files", "bucket", opts.Bucket, "prefix", opts.Prefix, "delete_local", opts.DeleteLocal)
+	return a, nil
+}
+
+// Archive queues the compressed rotated file at path for upload.
+func (a *S3Archiver) Archive(path string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.pending[path] = true
+	a.mu.Unlock()
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending reports whether path is waiting to be uploaded.
+func (a *S3Archiver) Pending(path string) bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pending[path]
+}
+
+// Close stops uploading once the upload in progress, if any, is done.
+func (a *S3Archiver) Close() {
+	if a == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.pending) > 0 {
+		a.log.Warn("closed with uploads pending, retried on next start", "files", len(a.pending))
+	}
+}
+
+func (a *S3Archiver) run() {
+	defer close(a.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-a.stop
+		cancel()
+	}()
+	t := time.NewTicker(a.opts.RetryInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-a.wake:
+		case <-t.C:
+		}
+		a.mu.Lock()
+		paths := make([]string, 0, len(a.pending))
+		for p := range a.pending {
+			paths = append(paths, p)
+		}
+		a.mu.Unlock()
+		sort.Strings(paths) // oldest rotation first
+		for _, p := range paths {
+			if ctx.Err() != nil {
+				return
+			}
+			a.upload(ctx, p)
+		}
+	}
+}
+
+func (a *S3Archiver) upload(ctx context.Context, localPath string) {
+	key := a.key(localPath)
+	data, err := os.ReadFile(localPath)
+	if os.IsNotExist(err) {
+		a.forget(localPath) // removed behind our back; nothing to upload
+		return
+	}
+	if err == nil {
+		var size int64
+		if size, err = a.client.size(ctx, key); err == nil && size != int64(len(data)) {
+			err = a.client.put(ctx, key, data)
+		}
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			metrics.ArchiveUploads.WithLabelValues("failed").Inc()
+			a.log.Warn("upload failed, retrying later", "file", filepath.Base(localPath), "key", key, "err", err)
+		}
+		return
+	}
+	metrics.ArchiveUploads.WithLabelValues("uploaded").Inc()
+	a.log.Info("archived", "file", filepath.Base(localPath), "key", key)
+	a.forget(localPath)
+	if a.opts.DeleteLocal {
+		if err := os.Remove(localPath); err != nil {
+			a.log.Warn("local copy not removed", "file", filepath.Base(localPath), "err", err)
+		}
+	}
+}
+
+func (a *S3Archiver) forget(localPath string) {
+	a.mu.Lock()
+	delete(a.pending, localPath)
+	a.mu.Unlock()
+}
+
+// key names the object for a rotated file: prefix, then the UTC date of
+// the rotation taken from the file name (its modification time if the
+// name does not parse), then the file name.
+func (a *S3Archiver) key(localPath string) string {
+	name := filepath.Base(localPath)
+	at, ok := rotationTime(name)
+	if !ok {
+		if info, err := os.Stat(localPath); err == nil {
+			at = info.ModTime()
+		} else {
+			at = time.Now()
+		}
+	}
+	return path.Join(a.opts.Prefix, at.UTC().Format("2006/01/02"), name)
+}
+
+// rotationTime parses the rotation time out of a rotated file name such as
+// events-20260301T120000.000Z.jsonl.gz.
+func rotationTime(name string) (time.Time, bool) {
+	_, rest, ok := strings.Cut(name, "-")
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, _, ok := strings.Cut(rest, ".jsonl")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(rotatedTimeFormat, stamp)
+	return t, err == nil
+}
@@ -0,0 +1,94 @@
+package emitter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3Client is the little of the S3 API the archiver needs, PutObject and
+// HeadObject. Region and credentials come from the SDK's default chain:
+// the AWS_* environment variables, shared config and credentials files,
+// web identity (IRSA) and the instance or pod metadata endpoints. Uploads
+// need s3:PutObject; see size for the actions that spare re-uploads.
+type s3Client struct {
+	bucket string
+	s3     *s3.Client
+}
+
+// s3CredentialsTimeout bounds the check at startup that the default chain
+// yields credentials at all, which may involve the metadata endpoints.
+const s3CredentialsTimeout = 30 * time.Second
+
+func newS3Client(bucket, region, endpoint string) (*s3Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3CredentialsTimeout)
+	defer cancel()
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(region),
+		config.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(5*time.Minute)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no S3 region given")
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("no AWS credentials: %w", err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint == "" {
+			return
+		}
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = true
+		// S3-compatible stores do not all accept the checksums the SDK
+		// adds to every upload by default.
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+	})
+	return &s3Client{bucket: bucket, s3: client}, nil
+}
+
+// put uploads body as the object key.
+func (c *s3Client) put(ctx context.Context, key string, body []byte) error {
+	_, err := c.s3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(c.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentType:   aws.String("application/gzip"),
+	})
+	if err != nil {
+		return fmt.Errorf("PUT %s: %w", key, err)
+	}
+	return nil
+}
+
+// size returns the size of the object key, or -1 if there is none or the
+// credentials may not tell. HEAD needs s3:GetObject, and s3:ListBucket for
+// a missing key to answer 404 rather than 403; a policy granting only
+// s3:PutObject gets 403 either way, and the object is then uploaded again.
+func (c *s3Client) size(ctx context.Context, key string) (int64, error) {
+	out, err := c.s3.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	var notFound *types.NotFound
+	var resp *awshttp.ResponseError
+	if errors.As(err, &notFound) || errors.As(err, &resp) && resp.HTTPStatusCode() == http.StatusForbidden {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("HEAD %s: %w", key, err)
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
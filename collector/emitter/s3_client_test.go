@@ -0,0 +1,159 @@
+package emitter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an S3-compatible store holding objects in memory, addressed in
+// the path as the client does for a custom endpoint.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	auth    []string // the Authorization header of each request
+	// putOnly answers HEAD with 403, as S3 does for credentials granted
+	// s3:PutObject alone.
+	putOnly bool
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead:
+		if f.putOnly {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// isolateAWS points the default chain at static test credentials and
+// away from the developer's own config and the metadata endpoint.
+func isolateAWS(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+}
+
+func TestS3ClientPutAndSize(t *testing.T) {
+	isolateAWS(t)
+	store := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+	c, err := newS3Client("archive", "us-east-1", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := "prod/2026/03/01/events-20260301T120000.000Z.jsonl.gz"
+
+	if n, err := c.size(ctx, key); n != -1 || err != nil {
+		t.Fatalf("size of a missing object = %d, %v, want -1", n, err)
+	}
+	if err := c.put(ctx, key, []byte("gzipped records")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(store.objects["/archive/"+key]); got != "gzipped records" {
+		t.Fatalf("stored %q", got)
+	}
+	if n, err := c.size(ctx, key); n != int64(len("gzipped records")) || err != nil {
+		t.Fatalf("size = %d, %v", n, err)
+	}
+	for _, a := range store.auth {
+		if !strings.HasPrefix(a, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") || !strings.Contains(a, "/us-east-1/s3/aws4_request") {
+			t.Fatalf("request signed with %q", a)
+		}
+	}
+}
+
+func TestS3ClientErrors(t *testing.T) {
+	status := http.StatusForbidden
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	isolateAWS(t)
+	c, err := newS3Client("archive", "us-east-1", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.put(context.Background(), "k", []byte("x")); err == nil {
+		t.Error("put succeeded against a 403")
+	}
+	// A 403 on HEAD leaves the size unknown, for the object to be put.
+	if n, err := c.size(context.Background(), "k"); n != -1 || err != nil {
+		t.Errorf("size against a 403 = %d, %v, want -1", n, err)
+	}
+	status = http.StatusBadRequest
+	if _, err := c.size(context.Background(), "k"); err == nil {
+		t.Error("size succeeded against a 400")
+	}
+
+	if _, err := newS3Client("archive", "", srv.URL); err == nil {
+		t.Error("client created without a region")
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if _, err := newS3Client("archive", "us-east-1", srv.URL); err == nil {
+		t.Error("client created without credentials")
+	}
+}
+
+// Credentials granted s3:PutObject alone get 403 on every HEAD; the
+// rotated file is uploaded all the same.
+func TestS3ArchiverUploadsWithoutReadAccess(t *testing.T) {
+	isolateAWS(t)
+	store := &fakeS3{objects: map[string][]byte{}, putOnly: true}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+	a, err := NewS3Archiver(S3ArchiveOptions{Bucket: "archive", Prefix: "prod", Region: "us-east-1", Endpoint: srv.URL, RetryInterval: time.Hour}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	file := filepath.Join(t.TempDir(), "events-20260301T120000.000Z.jsonl.gz")
+	if err := os.WriteFile(file, []byte("gzipped records"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a.Archive(file)
+	for deadline := time.Now().Add(10 * time.Second); a.Pending(file); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("file still pending")
+		}
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if got := string(store.objects["/archive/prod/2026/03/01/events-20260301T120000.000Z.jsonl.gz"]); got != "gzipped records" {
+		t.Fatalf("stored %q, objects %v", got, store.objects)
+	}
+}
@@ -0,0 +1,57 @@
+package emitter
+
+import "time"
+
+// SchemaVersion identifies the shape of CausalEvent and Snapshot records
+// and their payloads. Bump it whenever a field is removed, renamed or
+// changes type, so consumers can reject or migrate streams they do not
+// understand. Adding a field does not require a bump.
+const SchemaVersion = "oma.v1"
+
+// CollectorVersion is the collector build, set at link time:
+//
+//	go build -ldflags "-X github.com/opscart/k8s-causal-memory/collector/emitter.CollectorVersion=v0.4.0"
+var CollectorVersion = "dev"
+
+// Header is written as the first line of every new JSONL file. Records
+// that follow are events, snapshots or meta events depending on Stream.
+type Header struct {
+	Record           string    `json:"record"` // always "header"
+	Stream           string    `json:"stream"` // "events", "snapshots" or "meta"
+	SchemaVersion    string    `json:"schema_version"`
+	CollectorVersion string    `json:"collector_version"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func newHeader(stream string) Header {
+	return Header{
+		Record:           "header",
+		Stream:           stream,
+		SchemaVersion:    SchemaVersion,
+		CollectorVersion: CollectorVersion,
+		CreatedAt:        time.Now().UTC(),
+	}
+}
+
+func (e *CausalEvent) stamp() {
+	e.SchemaVersion = SchemaVersion
+	e.CollectorVersion = CollectorVersion
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = e.Timestamp
+	}
+	if e.EmittedAt.IsZero() {
+		e.EmittedAt = time.Now()
+	}
+}
+
+// Stamped returns the event as an emitter records it, for a copy of it
+// kept or served outside the emitters.
+func (e CausalEvent) Stamped() CausalEvent {
+	e.stamp()
+	return e
+}
+
+func (s *Snapshot) stamp() {
+	s.SchemaVersion = SchemaVersion
+	s.CollectorVersion = CollectorVersion
+}
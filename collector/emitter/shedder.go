@@ -0,0 +1,177 @@
+package emitter
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// DefaultShedSampleRate is the fraction of sheddable events kept while the
+// queue is above its high-water mark.
+const DefaultShedSampleRate = 0.1
+
+// DefaultShedEventTypes are the event types a Shedder may sample: the
+// high-volume effects of a storm, whose causes (OOMKill, NodeMemoryPressure)
+// are always kept.
+var DefaultShedEventTypes = []string{"ContainerTerminated", "CrashLoopBackOff"}
+
+// ShedOptions configures a Shedder.
+type ShedOptions struct {
+	QueueSize int
+	// HighWater is the queue depth from which sheddable events are sampled.
+	HighWater  int
+	SampleRate float64
+	EventTypes []string
+}
+
+// Shedder wraps an Emitter with a bounded queue drained by one goroutine,
+// so a storm of events waits in memory rather than on the sink's lock and
+// disk. While the queue holds HighWater records or more, events of the
+// sheddable types are kept with probability SampleRate and the rest
+// dropped. The next kept event of a type carries sampled: true and the
+// number of its type dropped since the last one kept as dropped_count.
+// Every other event, snapshots and meta events are always kept, waiting
+// for room when the queue is full.
+//
+// The Shedder sits in front of the sinks only; listeners on an Observer
+// wrapping it, pattern matching among them, see every event.
+type Shedder struct {
+	inner Emitter
+	opts  ShedOptions
+	queue chan fanoutRecord
+	log   *slog.Logger
+	done  chan struct{}
+
+	mu       sync.RWMutex // guards closed against concurrent enqueue
+	closed   bool
+	countsMu sync.Mutex
+	dropped  map[string]int // per event type, since the last one kept
+	shedding bool
+}
+
+func NewShedder(inner Emitter, opts ShedOptions, log *slog.Logger) (*Shedder, error) {
+	if opts.QueueSize <= 0 {
+		return nil, fmt.Errorf("shed queue size must be positive, got %d", opts.QueueSize)
+	}
+	if opts.HighWater <= 0 || opts.HighWater > opts.QueueSize {
+		return nil, fmt.Errorf("shed high-water mark must be between 1 and the queue size %d, got %d", opts.QueueSize, opts.HighWater)
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return nil, fmt.Errorf("shed sample rate must be between 0 and 1, got %g", opts.SampleRate)
+	}
+	if opts.EventTypes == nil {
+		opts.EventTypes = DefaultShedEventTypes
+	}
+	s := &Shedder{
+		inner:   inner,
+		opts:    opts,
+		queue:   make(chan fanoutRecord, opts.QueueSize),
+		log:     log.With("component", "shedder"),
+		done:    make(chan struct{}),
+		dropped: map[string]int{},
+	}
+	go s.run()
+	s.log.Info("shedding under backpressure", "queue", opts.QueueSize, "high_water", opts.HighWater,
+		"sample_rate", opts.SampleRate, "event_types", opts.EventTypes)
+	return s, nil
+}
+
+func (s *Shedder) Emit(event CausalEvent) {
+	event, keep := s.sample(event)
+	if keep {
+		s.enqueue(fanoutRecord{kind: fanoutEvent, event: event})
+	}
+}
+
+func (s *Shedder) EmitSnapshot(snapshot Snapshot) {
+	s.enqueue(fanoutRecord{kind: fanoutSnapshot, snapshot: snapshot})
+}
+
+func (s *Shedder) EmitMeta(event CausalEvent) {
+	s.enqueue(fanoutRecord{kind: fanoutMeta, event: event})
+}
+
+// sample decides whether event is kept and, if it is and events of its
+// type were dropped before it, marks it as sampled.
+func (s *Shedder) sample(event CausalEvent) (CausalEvent, bool) {
+	if !slices.Contains(s.opts.EventTypes, event.EventType) {
+		return event, true
+	}
+	depth := len(s.queue)
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+	switch over := depth >= s.opts.HighWater; {
+	case over && !s.shedding:
+		s.shedding = true
+		s.log.Warn("backpressure: queue above high-water mark, sampling events", "depth", depth)
+	case !over && s.shedding:
+		s.shedding = false
+		s.log.Info("queue below high-water mark, sampling stopped", "depth", depth)
+	}
+	if s.shedding && rand.Float64() >= s.opts.SampleRate {
+		s.dropped[event.EventType]++
+		metrics.ShedEvents.WithLabelValues(event.EventType).Inc()
+		return event, false
+	}
+	if n := s.dropped[event.EventType]; n > 0 {
+		delete(s.dropped, event.EventType)
+		// The watcher, and the Observer's listeners, still hold the
+		// original payload.
+		event.Payload = maps.Clone(event.Payload)
+		if event.Payload == nil {
+			event.Payload = map[string]interface{}{}
+		}
+		event.Payload["sampled"] = true
+		event.Payload["dropped_count"] = n
+	}
+	return event, true
+}
+
+func (s *Shedder) enqueue(rec fanoutRecord) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	s.queue <- rec
+}
+
+func (s *Shedder) run() {
+	defer close(s.done)
+	for rec := range s.queue {
+		switch rec.kind {
+		case fanoutEvent:
+			s.inner.Emit(rec.event)
+		case fanoutSnapshot:
+			s.inner.EmitSnapshot(rec.snapshot)
+		case fanoutMeta:
+			s.inner.EmitMeta(rec.event)
+		}
+	}
+}
+
+// Close stops accepting records, drains the queue into the wrapped emitter
+// and closes it.
+func (s *Shedder) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.done
+	s.inner.Close()
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+	for eventType, n := range s.dropped {
+		s.log.Warn("closed with sampled events dropped", "event_type", eventType, "dropped", n)
+	}
+}
@@ -0,0 +1,343 @@
+package emitter
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// SQLiteEmitter writes events, snapshots and meta events to a SQLite
+// database, so an incident can be investigated with plain SELECTs:
+//
+//	SELECT timestamp, pod_name FROM events
+//	 WHERE event_type = 'OOMKill' AND node_name = 'node-1'
+//	   AND timestamp >= datetime('now', '-1 hour');
+//
+// The events and snapshots tables follow storage/schema.sql, so the
+// storage query tools read the database directly. Timestamps are stored
+// in UTC in SQLite's own "YYYY-MM-DD HH:MM:SS.SSS" form, which sorts and
+// compares correctly against datetime(). Payload and State are JSON text,
+// queryable with json_extract.
+//
+// As with KafkaEmitter, Emit never blocks: records go into a bounded queue
+// drained by one goroutine that writes each batch in a single transaction.
+// A full queue drops records and counts them (see Dropped).
+type SQLiteEmitter struct {
+	db    *sql.DB
+	path  string
+	queue chan sqliteRecord
+	log   *slog.Logger
+
+	mu      sync.RWMutex // guards closed against concurrent enqueue
+	closed  bool
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// sqliteRecord is one row for one of the three tables; args are in the
+// column order of the table's insert statement.
+type sqliteRecord struct {
+	table string
+	args  []interface{}
+}
+
+const (
+	sqliteMaxBatch      = 500
+	sqliteBusyTimeoutMs = 5000
+	sqliteTimeFormat    = "2006-01-02 15:04:05.000"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+    id              TEXT PRIMARY KEY,
+    timestamp       DATETIME NOT NULL,
+    event_type      TEXT NOT NULL,
+    pattern_id      TEXT,
+    pod_name        TEXT,
+    namespace       TEXT,
+    node_name       TEXT,
+    pod_uid         TEXT,
+    correlation_id  TEXT,
+    occurred_at     DATETIME,
+    cluster         TEXT,
+    payload         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_events_timestamp ON events(timestamp);
+CREATE INDEX IF NOT EXISTS idx_events_type      ON events(event_type);
+CREATE INDEX IF NOT EXISTS idx_events_pod       ON events(pod_name, namespace);
+CREATE INDEX IF NOT EXISTS idx_events_namespace ON events(namespace);
+CREATE INDEX IF NOT EXISTS idx_events_pattern   ON events(pattern_id);
+CREATE INDEX IF NOT EXISTS idx_events_node      ON events(node_name);
+CREATE INDEX IF NOT EXISTS idx_events_pod_uid   ON events(pod_uid);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+    id            TEXT PRIMARY KEY,
+    timestamp     DATETIME NOT NULL,
+    object_kind   TEXT NOT NULL,
+    object_name   TEXT NOT NULL,
+    namespace     TEXT,
+    trigger_event TEXT,
+    cluster       TEXT,
+    state         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_snapshots_object    ON snapshots(object_kind, object_name);
+CREATE INDEX IF NOT EXISTS idx_snapshots_timestamp ON snapshots(timestamp);
+
+CREATE TABLE IF NOT EXISTS meta_events (
+    id         TEXT PRIMARY KEY,
+    timestamp  DATETIME NOT NULL,
+    event_type TEXT NOT NULL,
+    namespace  TEXT,
+    cluster    TEXT,
+    payload    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_meta_timestamp ON meta_events(timestamp);
+
+-- Rows carry no schema or collector version; each collector start records
+-- them once here, as the header line does in a JSONL file.
+CREATE TABLE IF NOT EXISTS collector_runs (
+    started_at        DATETIME NOT NULL,
+    schema_version    TEXT NOT NULL,
+    collector_version TEXT NOT NULL
+);
+`
+
+// sqliteColumns are the columns added to tables after their creation; a
+// database written by an older collector gains them on open.
+var sqliteColumns = []struct{ table, column, decl, index string }{
+	{"events", "correlation_id", "TEXT", "CREATE INDEX IF NOT EXISTS idx_events_correlation ON events(correlation_id)"},
+	{"events", "occurred_at", "DATETIME", "CREATE INDEX IF NOT EXISTS idx_events_occurred ON events(occurred_at)"},
+	{"events", "cluster", "TEXT", "CREATE INDEX IF NOT EXISTS idx_events_cluster ON events(cluster)"},
+	{"snapshots", "cluster", "TEXT", ""},
+	{"meta_events", "cluster", "TEXT", ""},
+}
+
+func migrateSQLite(db *sql.DB) error {
+	for _, c := range sqliteColumns {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.decl)); err != nil {
+				return err
+			}
+		}
+		if c.index == "" {
+			continue
+		}
+		if _, err := db.Exec(c.index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var sqliteInserts = map[string]string{
+	"events": `INSERT OR IGNORE INTO events
+		(id, timestamp, event_type, pattern_id, pod_name, namespace, node_name, pod_uid, correlation_id, occurred_at, cluster, payload)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	"snapshots": `INSERT OR IGNORE INTO snapshots
+		(id, timestamp, object_kind, object_name, namespace, trigger_event, cluster, state)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+	"meta_events": `INSERT OR IGNORE INTO meta_events
+		(id, timestamp, event_type, namespace, cluster, payload)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+}
+
+func NewSQLiteEmitter(path string, queueSize int, log *slog.Logger) (*SQLiteEmitter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite emitter requires a database path")
+	}
+	if queueSize <= 0 {
+		return nil, fmt.Errorf("sqlite queue size must be positive, got %d", queueSize)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database dir: %w", err)
+	}
+	// WAL lets the query tools read while the collector writes.
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d", path, sqliteBusyTimeoutMs)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1) // one writer goroutine; SQLite serialises writes anyway
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema in %s: %w", path, err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema in %s: %w", path, err)
+	}
+	if _, err := db.Exec(`INSERT INTO collector_runs (started_at, schema_version, collector_version) VALUES (?, ?, ?)`,
+		sqliteTime(time.Now()), SchemaVersion, CollectorVersion); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to record run in %s: %w", path, err)
+	}
+	s := &SQLiteEmitter{
+		db:    db,
+		path:  path,
+		queue: make(chan sqliteRecord, queueSize),
+		log:   log.With("component", "sqlite_emitter"),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	s.log.Info("writing", "db", path, "queue", queueSize)
+	return s, nil
+}
+
+func (s *SQLiteEmitter) Emit(event CausalEvent) {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		s.log.Error("marshal failed", "err", err)
+		return
+	}
+	event.stamp()
+	if s.enqueue(sqliteRecord{table: "events", args: []interface{}{
+		event.ID, sqliteTime(event.Timestamp), event.EventType, event.PatternID,
+		event.PodName, event.Namespace, event.NodeName, event.PodUID, event.CorrelationID,
+		sqliteTime(event.OccurredAt), event.Cluster, string(payload),
+	}}) {
+		metrics.EventsEmitted.WithLabelValues(event.EventType).Inc()
+		s.log.Debug("event", "event_type", event.EventType, "pattern", event.PatternID, "pod", event.PodName)
+	}
+}
+
+func (s *SQLiteEmitter) EmitSnapshot(snapshot Snapshot) {
+	state, err := json.Marshal(snapshot.State)
+	if err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		s.log.Error("marshal failed", "err", err)
+		return
+	}
+	if s.enqueue(sqliteRecord{table: "snapshots", args: []interface{}{
+		snapshot.ID, sqliteTime(snapshot.Timestamp), snapshot.ObjectKind, snapshot.ObjectName,
+		snapshot.Namespace, snapshot.TriggerEvent, snapshot.Cluster, string(state),
+	}}) {
+		metrics.SnapshotsEmitted.WithLabelValues(snapshot.ObjectKind).Inc()
+		s.log.Debug("snapshot", "kind", snapshot.ObjectKind, "name", snapshot.ObjectName, "trigger", snapshot.TriggerEvent)
+	}
+}
+
+// EmitMeta writes collector meta events to their own meta_events table,
+// apart from the causal record.
+func (s *SQLiteEmitter) EmitMeta(event CausalEvent) {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		metrics.EmitterWriteErrors.Inc()
+		s.log.Error("marshal failed", "err", err)
+		return
+	}
+	if s.enqueue(sqliteRecord{table: "meta_events", args: []interface{}{
+		event.ID, sqliteTime(event.Timestamp), event.EventType, event.Namespace, event.Cluster, string(payload),
+	}}) {
+		s.log.Debug("meta", "event_type", event.EventType)
+	}
+}
+
+// Dropped reports how many records were discarded because the queue was full.
+func (s *SQLiteEmitter) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *SQLiteEmitter) enqueue(rec sqliteRecord) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.queue <- rec:
+		return true
+	default:
+		if n := s.dropped.Add(1); n == 1 || n%100 == 0 {
+			s.log.Warn("backpressure: queue full, records dropped", "dropped", n)
+		}
+		return false
+	}
+}
+
+// run drains the queue, writing whatever has accumulated, up to
+// sqliteMaxBatch records, in one transaction.
+func (s *SQLiteEmitter) run() {
+	defer close(s.done)
+	batch := make([]sqliteRecord, 0, sqliteMaxBatch)
+	for rec := range s.queue {
+		batch = append(batch[:0], rec)
+	drain:
+		for len(batch) < sqliteMaxBatch {
+			select {
+			case r, ok := <-s.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, r)
+			default:
+				break drain
+			}
+		}
+		if err := s.write(batch); err != nil {
+			metrics.EmitterWriteErrors.Inc()
+			s.log.Error("batch lost", "records", len(batch), "err", err)
+		}
+	}
+}
+
+func (s *SQLiteEmitter) write(batch []sqliteRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmts := map[string]*sql.Stmt{}
+	for _, rec := range batch {
+		stmt, ok := stmts[rec.table]
+		if !ok {
+			if stmt, err = tx.Prepare(sqliteInserts[rec.table]); err != nil {
+				tx.Rollback()
+				return err
+			}
+			defer stmt.Close()
+			stmts[rec.table] = stmt
+		}
+		if _, err := stmt.Exec(rec.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Close stops accepting records, writes everything still queued and closes
+// the database.
+func (s *SQLiteEmitter) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.done
+	if err := s.db.Close(); err != nil {
+		s.log.Error("close failed", "err", err)
+	}
+	s.log.Info("closed", "db", s.path, "dropped", s.Dropped())
+}
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
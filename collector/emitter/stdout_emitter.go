@@ -0,0 +1,209 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output formats of the StdoutEmitter.
+const (
+	StdoutJSONL   = "jsonl"   // one record per line, as in the output files
+	StdoutPretty  = "pretty"  // indented JSON under a "--- <kind>" separator
+	StdoutCompact = "compact" // one summary line per record
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiDim    = "\x1b[2m"
+)
+
+// alarmEvents are colored red: the failures themselves.
+var alarmEvents = map[string]bool{
+	"CrashLoopBackOff":  true,
+	"PodEvicted":        true,
+	"JobFailed":         true,
+	"DeploymentStalled": true,
+	"EndpointsDrained":  true,
+	"TrafficLoss":       true,
+}
+
+// changeEvents are colored yellow: the changes failures follow from.
+var changeEvents = map[string]bool{
+	"ConfigMapChanged":      true,
+	"SecretChanged":         true,
+	"ResourceLimitsChanged": true,
+	"DeploymentRolledOut":   true,
+	"WorkloadRolledOut":     true,
+	"ImageDigestChanged":    true,
+	"ServiceChanged":        true,
+	"IngressChanged":        true,
+	"HPAScaled":             true,
+	"ReplicaSetScaled":      true,
+	"ReplicaSetOrphaned":    true,
+	"NodeCordoned":          true,
+	"NodeTainted":           true,
+}
+
+// compactFields are the payload fields a compact line shows, when set.
+var compactFields = []string{"container_name", "workload", "reason", "configmap_name", "secret_name", "error"}
+
+// StdoutEmitter writes every record to a terminal or pipe as it is
+// emitted, for running the collector against a dev cluster: nothing is
+// buffered and no file is written. With color, event types are colored by
+// what they are: OOM kills and other failures red, the config, rollout and
+// resource changes they follow from yellow, detected chains cyan, meta
+// events dim.
+type StdoutEmitter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+	color  bool
+	closed bool
+}
+
+func NewStdoutEmitter(out io.Writer, format string, color bool) (*StdoutEmitter, error) {
+	switch format {
+	case StdoutJSONL, StdoutPretty, StdoutCompact:
+	default:
+		return nil, fmt.Errorf("unknown stdout format %q (want jsonl, pretty or compact)", format)
+	}
+	return &StdoutEmitter{out: out, format: format, color: color}, nil
+}
+
+// UseColor reports whether output to f should be colored: f is a terminal
+// and NO_COLOR is not set (https://no-color.org).
+func UseColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (s *StdoutEmitter) Emit(event CausalEvent) {
+	event.stamp()
+	s.write("event", event, event.EventType, s.colorOf(event.EventType), func() string { return s.compactEvent(event, "") })
+}
+
+func (s *StdoutEmitter) EmitSnapshot(snapshot Snapshot) {
+	snapshot.stamp()
+	s.write("snapshot", snapshot, snapshot.ObjectKind, "", func() string {
+		name := snapshot.ObjectName
+		if snapshot.Namespace != "" {
+			name = snapshot.Namespace + "/" + name
+		}
+		line := fmt.Sprintf("%s %s %s %s trigger=%s", snapshot.Timestamp.Format(time.TimeOnly),
+			s.paint(ansiDim, "snapshot"), snapshot.ObjectKind, name, snapshot.TriggerEvent)
+		if snapshot.Cluster != "" {
+			line += " cluster=" + snapshot.Cluster
+		}
+		return line
+	})
+}
+
+func (s *StdoutEmitter) EmitMeta(event CausalEvent) {
+	event.stamp()
+	s.write("meta", event, event.EventType, ansiDim, func() string { return s.compactEvent(event, "meta ") })
+}
+
+func (s *StdoutEmitter) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
+
+// write prints one record in the emitter's format: label, the event type
+// or object kind, follows the pretty separator in color; compact builds
+// the compact line. Records from concurrent watchers do not interleave.
+func (s *StdoutEmitter) write(kind string, record interface{}, label, color string, compact func() string) {
+	var line []byte
+	switch s.format {
+	case StdoutCompact:
+		line = []byte(compact())
+	default:
+		data, err := json.Marshal(record)
+		if err != nil {
+			return
+		}
+		line = data
+		if s.format == StdoutPretty {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, data, "", "  "); err == nil {
+				line = buf.Bytes()
+			}
+			line = append([]byte("--- "+kind+" "+s.paint(color, label)+"\n"), line...)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.out.Write(append(line, '\n'))
+}
+
+func (s *StdoutEmitter) compactEvent(e CausalEvent, prefix string) string {
+	var b strings.Builder
+	b.WriteString(e.Timestamp.Format(time.TimeOnly))
+	b.WriteByte(' ')
+	if prefix != "" {
+		b.WriteString(s.paint(ansiDim, prefix+e.EventType))
+	} else {
+		b.WriteString(s.paint(s.colorOf(e.EventType), e.EventType))
+	}
+	if e.PatternID != "" {
+		b.WriteString(" " + e.PatternID)
+	}
+	if e.Cluster != "" {
+		b.WriteString(" cluster=" + e.Cluster)
+	}
+	if e.PodName != "" {
+		b.WriteString(" " + e.Namespace + "/" + e.PodName)
+	} else if e.Namespace != "" {
+		b.WriteString(" ns=" + e.Namespace)
+	}
+	if e.NodeName != "" {
+		b.WriteString(" node=" + e.NodeName)
+	}
+	shown := []string{}
+	for _, k := range compactFields {
+		if v, ok := e.Payload[k]; ok && v != nil && v != "" {
+			shown = append(shown, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	sort.Strings(shown)
+	if len(shown) > 0 {
+		b.WriteString(" " + strings.Join(shown, " "))
+	}
+	return b.String()
+}
+
+func (s *StdoutEmitter) colorOf(eventType string) string {
+	switch {
+	case strings.Contains(eventType, "OOM") || alarmEvents[eventType]:
+		return ansiRed
+	case changeEvents[eventType]:
+		return ansiYellow
+	case eventType == "CausalChainDetected":
+		return ansiCyan
+	}
+	return ""
+}
+
+// paint colors text, if the emitter colors at all.
+func (s *StdoutEmitter) paint(color, text string) string {
+	if !s.color || color == "" {
+		return text
+	}
+	return color + text + ansiReset
+}
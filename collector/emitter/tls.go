@@ -0,0 +1,106 @@
+package emitter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions configures TLS for the network sinks: the Kafka producer
+// connecting to its brokers and the gRPC CausalStream server accepting
+// subscribers. Files are PEM encoded.
+type TLSOptions struct {
+	// CAFile holds the CAs that verify the brokers' certificates, and the
+	// subscribers' client certificates, which the gRPC server then
+	// requires (mTLS). Empty uses the system roots and requires no client
+	// certificate.
+	CAFile string
+	// CertFile and KeyFile are the collector's certificate: the client
+	// certificate presented to brokers that require one, and the gRPC
+	// server's certificate, which it needs to serve TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name the brokers' certificates are
+	// verified against.
+	ServerName string
+	// Insecure skips verifying the brokers' certificates.
+	Insecure bool
+}
+
+// Enabled reports whether any TLS option is set.
+func (o TLSOptions) Enabled() bool {
+	return o != TLSOptions{}
+}
+
+// ClientConfig is the tls.Config for connecting to a server.
+func (o TLSOptions) ClientConfig() (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.Insecure,
+	}
+	if o.CAFile != "" {
+		pool, err := loadCAs(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := o.keyPair()
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// ServerConfig is the tls.Config for serving, with client certificates
+// required and verified when CAFile is set.
+func (o TLSOptions) ServerConfig() (*tls.Config, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, fmt.Errorf("serving TLS requires a certificate and key file")
+	}
+	cert, err := o.keyPair()
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if o.CAFile != "" {
+		pool, err := loadCAs(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+func (o TLSOptions) keyPair() (tls.Certificate, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return tls.Certificate{}, fmt.Errorf("a TLS certificate needs both a certificate and a key file")
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	return cert, nil
+}
+
+func loadCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read TLS CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in TLS CA file %s", path)
+	}
+	return pool, nil
+}
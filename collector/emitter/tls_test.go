@@ -0,0 +1,232 @@
+package emitter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a self-signed CA with a server certificate for localhost and
+// a client certificate it signed, written as PEM files.
+type testPKI struct {
+	caFile                string
+	serverCert, serverKey string
+	clientCert, clientKey string
+	selfCert, selfKey     string // self-signed, not by the CA
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	p := testPKI{caFile: filepath.Join(dir, "ca.pem")}
+	writePEM(t, p.caFile, "CERTIFICATE", caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (string, string) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+		writePEM(t, certFile, "CERTIFICATE", der)
+		writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+		return certFile, keyFile
+	}
+	p.serverCert, p.serverKey = issue("server", 2, x509.ExtKeyUsageServerAuth, ca, caKey)
+	p.clientCert, p.clientKey = issue("subscriber", 3, x509.ExtKeyUsageClientAuth, ca, caKey)
+	p.selfCert, p.selfKey = issue("self-signed", 4, x509.ExtKeyUsageServerAuth, nil, nil)
+	return p
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake connects a client with client to a local server with server
+// and returns the common name of the client certificate the server
+// verified, if any, and the first error either side saw.
+func handshake(t *testing.T, server, client TLSOptions) (string, error) {
+	t.Helper()
+	serverConf, err := server.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConf, err := client.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	type result struct {
+		peer string
+		err  error
+	}
+	served := make(chan result, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			served <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		tc := conn.(*tls.Conn)
+		tc.SetDeadline(time.Now().Add(5 * time.Second))
+		var r result
+		if r.err = tc.Handshake(); r.err == nil {
+			if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+				r.peer = certs[0].Subject.CommonName
+			}
+			// Confirm the connection carries data both ways.
+			buf := make([]byte, 4)
+			if _, r.err = tc.Read(buf); r.err == nil {
+				_, r.err = tc.Write(buf)
+			}
+		}
+		served <- r
+	}()
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", ln.Addr().String(), clientConf)
+	if err == nil {
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		// With TLS 1.3 a client certificate the server rejects only shows
+		// on the client's first read.
+		if _, err = conn.Write([]byte("ping")); err == nil {
+			_, err = conn.Read(make([]byte, 4))
+		}
+	}
+	r := <-served
+	if err != nil {
+		return "", err
+	}
+	return r.peer, r.err
+}
+
+func TestTLSMutualAuth(t *testing.T) {
+	p := newTestPKI(t)
+	server := TLSOptions{CAFile: p.caFile, CertFile: p.serverCert, KeyFile: p.serverKey}
+
+	peer, err := handshake(t, server, TLSOptions{CAFile: p.caFile, CertFile: p.clientCert, KeyFile: p.clientKey, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("mTLS handshake failed: %v", err)
+	}
+	if peer != "subscriber" {
+		t.Errorf("server verified client %q, want subscriber", peer)
+	}
+
+	// With a CA the server requires a client certificate.
+	if _, err := handshake(t, server, TLSOptions{CAFile: p.caFile, ServerName: "localhost"}); err == nil {
+		t.Error("client without a certificate accepted")
+	}
+	// A certificate the CA did not sign is refused.
+	if _, err := handshake(t, server, TLSOptions{CAFile: p.caFile, CertFile: p.selfCert, KeyFile: p.selfKey, ServerName: "localhost"}); err == nil {
+		t.Error("client certificate from another issuer accepted")
+	}
+}
+
+func TestTLSServerVerification(t *testing.T) {
+	p := newTestPKI(t)
+	server := TLSOptions{CertFile: p.serverCert, KeyFile: p.serverKey}
+
+	if _, err := handshake(t, server, TLSOptions{CAFile: p.caFile}); err != nil {
+		t.Fatalf("handshake verified by the CA failed: %v", err)
+	}
+	// Without a client certificate required, the server takes any client.
+	if peer, err := handshake(t, server, TLSOptions{CAFile: p.caFile, CertFile: p.clientCert, KeyFile: p.clientKey}); err != nil || peer != "" {
+		t.Fatalf("handshake = %q, %v, want no verified peer", peer, err)
+	}
+	if _, err := handshake(t, server, TLSOptions{CAFile: p.caFile, ServerName: "broker.internal"}); err == nil {
+		t.Error("certificate accepted for a name it does not hold")
+	}
+	// The system roots do not know the test CA.
+	if _, err := handshake(t, server, TLSOptions{ServerName: "localhost"}); err == nil {
+		t.Error("certificate from an unknown CA accepted")
+	}
+}
+
+func TestTLSInsecureSkipsVerification(t *testing.T) {
+	p := newTestPKI(t)
+	server := TLSOptions{CertFile: p.selfCert, KeyFile: p.selfKey}
+	if _, err := handshake(t, server, TLSOptions{CAFile: p.caFile}); err == nil {
+		t.Fatal("self-signed certificate accepted without --tls-insecure")
+	}
+	if _, err := handshake(t, server, TLSOptions{Insecure: true}); err != nil {
+		t.Fatalf("insecure handshake failed: %v", err)
+	}
+	if _, err := handshake(t, server, TLSOptions{Insecure: true, ServerName: "anything"}); err != nil {
+		t.Fatalf("insecure handshake checked the server name: %v", err)
+	}
+}
+
+func TestTLSOptionErrors(t *testing.T) {
+	p := newTestPKI(t)
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+	for _, tc := range []struct {
+		name string
+		opts TLSOptions
+		fn   func(TLSOptions) (*tls.Config, error)
+		want string
+	}{
+		{"server without a certificate", TLSOptions{CAFile: p.caFile}, TLSOptions.ServerConfig, "requires a certificate and key file"},
+		{"client certificate without its key", TLSOptions{CertFile: p.clientCert}, TLSOptions.ClientConfig, "both a certificate and a key file"},
+		{"mismatched key", TLSOptions{CertFile: p.clientCert, KeyFile: p.serverKey}, TLSOptions.ClientConfig, "load TLS certificate"},
+		{"CA file without PEM", TLSOptions{CAFile: notPEM}, TLSOptions.ClientConfig, "no PEM certificates"},
+		{"missing CA file", TLSOptions{CAFile: notPEM + ".missing"}, TLSOptions.ClientConfig, "read TLS CA file"},
+		{"server CA file without PEM", TLSOptions{CAFile: notPEM, CertFile: p.serverCert, KeyFile: p.serverKey}, TLSOptions.ServerConfig, "no PEM certificates"},
+	} {
+		if _, err := tc.fn(tc.opts); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+	if (TLSOptions{}).Enabled() || !(TLSOptions{Insecure: true}).Enabled() {
+		t.Error("Enabled does not follow the options set")
+	}
+}
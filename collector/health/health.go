@@ -0,0 +1,201 @@
+// Package health serves liveness and readiness probes for the collector.
+// Every watch the collector runs registers a Probe and reports on it: when
+// its initial list has landed, when it last saw the apiserver answer, and
+// when its watch started failing. /readyz and /healthz are derived from all
+// of them, so Kubernetes can restart a collector that is running but no
+// longer seeing the cluster.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultDisconnectThreshold is how long every watch may fail before the
+// collector reports itself not alive.
+const DefaultDisconnectThreshold = 5 * time.Minute
+
+var (
+	mu      sync.Mutex
+	probes  = map[*Probe]struct{}{}
+	outputs = map[string]string{} // output → error, while it fails
+	standby bool
+)
+
+// Probe is the health of one watch.
+type Probe struct {
+	name string
+
+	mu           sync.Mutex
+	synced       bool
+	lastSuccess  time.Time
+	failingSince time.Time
+}
+
+// Register adds a probe for the watch called name (watcher and namespace).
+// Call Done when the watch stops.
+func Register(name string) *Probe {
+	p := &Probe{name: name}
+	mu.Lock()
+	probes[p] = struct{}{}
+	mu.Unlock()
+	return p
+}
+
+// Done removes the probe; a stopped watch no longer counts.
+func (p *Probe) Done() {
+	mu.Lock()
+	delete(probes, p)
+	mu.Unlock()
+}
+
+// Synced records that the watch's initial list landed and its cache is
+// primed. It counts as a success.
+func (p *Probe) Synced() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.synced = true
+	p.succeeded()
+}
+
+// Observed records an answer from the apiserver: an event, a bookmark, a
+// watch opened.
+func (p *Probe) Observed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.succeeded()
+}
+
+// Failed records a list or watch failure. The watch counts as disconnected
+// from its first failure until its next success.
+func (p *Probe) Failed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failingSince.IsZero() {
+		p.failingSince = time.Now()
+	}
+}
+
+// succeeded is called with p.mu held.
+func (p *Probe) succeeded() {
+	p.lastSuccess = time.Now()
+	p.failingSince = time.Time{}
+}
+
+// SetStandby marks a replica that is waiting for the leader election Lease
+// and runs no watches. It is ready and alive: it can take over at any time.
+func SetStandby(v bool) {
+	mu.Lock()
+	standby = v
+	mu.Unlock()
+}
+
+// OutputFailed records that the named output, such as an output file,
+// cannot be written: a collector that watches the cluster but records
+// nothing, on a full disk say, is not ready until OutputRecovered.
+func OutputFailed(name string, err error) {
+	mu.Lock()
+	outputs[name] = err.Error()
+	mu.Unlock()
+}
+
+// OutputRecovered records that the named output is written again.
+func OutputRecovered(name string) {
+	mu.Lock()
+	delete(outputs, name)
+	mu.Unlock()
+}
+
+// ProbeStatus is the per-watch detail in the probe responses.
+type ProbeStatus struct {
+	Synced                bool      `json:"synced"`
+	LastSuccess           time.Time `json:"last_success,omitzero"`
+	DisconnectedSince     time.Time `json:"disconnected_since,omitzero"`
+	DisconnectedSecs      float64   `json:"disconnected_seconds,omitempty"`
+	DisconnectedPastLimit bool      `json:"disconnected_past_threshold,omitempty"`
+}
+
+// Status is the body of /readyz and /healthz.
+type Status struct {
+	Ready    bool                   `json:"ready"`
+	Live     bool                   `json:"live"`
+	Standby  bool                   `json:"standby,omitempty"`
+	Watchers map[string]ProbeStatus `json:"watchers"`
+	Outputs  map[string]string      `json:"output_errors,omitempty"`
+}
+
+// Check evaluates every registered probe. The collector is ready once every
+// watch has synced and while every output is written, and not alive once every watch has been disconnected
+// for longer than threshold: one watch failing is reported by its
+// CollectorError events, all of them failing is a collector that sees
+// nothing and should be restarted. Before any watch has registered the
+// collector is alive but not ready.
+func Check(threshold time.Duration) Status {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	st := Status{Ready: true, Live: true, Standby: standby, Watchers: make(map[string]ProbeStatus, len(probes))}
+	if standby {
+		return st
+	}
+	allDown := len(probes) > 0
+	for p := range probes {
+		p.mu.Lock()
+		ps := ProbeStatus{Synced: p.synced, LastSuccess: p.lastSuccess, DisconnectedSince: p.failingSince}
+		p.mu.Unlock()
+		if !ps.DisconnectedSince.IsZero() {
+			down := now.Sub(ps.DisconnectedSince)
+			ps.DisconnectedSecs = down.Seconds()
+			ps.DisconnectedPastLimit = down > threshold
+		}
+		st.Ready = st.Ready && ps.Synced
+		allDown = allDown && ps.DisconnectedPastLimit
+		st.Watchers[p.name] = ps
+	}
+	if len(outputs) > 0 {
+		st.Outputs = maps.Clone(outputs)
+	}
+	st.Ready = st.Ready && len(probes) > 0 && len(outputs) == 0
+	st.Live = !allDown
+	return st
+}
+
+// Serve exposes /readyz and /healthz on addr until ctx is cancelled. Both
+// answer 200 or 503 with the Status as JSON.
+func Serve(ctx context.Context, addr string, threshold time.Duration, log *slog.Logger) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", handler(threshold, func(s Status) bool { return s.Ready }))
+	mux.HandleFunc("/healthz", handler(threshold, func(s Status) bool { return s.Live }))
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Info("serving /readyz and /healthz", "component", "health", "addr", addr, "disconnect_threshold", threshold)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("health server failed: %w", err)
+	}
+	return nil
+}
+
+func handler(threshold time.Duration, ok func(Status) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := Check(threshold)
+		w.Header().Set("Content-Type", "application/json")
+		if !ok(st) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(st)
+	}
+}
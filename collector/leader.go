@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/health"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// runElected runs run only while this replica holds the Lease
+// namespace/name, so several replicas can be deployed without duplicating
+// every event. When leadership is lost, run's context is cancelled and the
+// replica waits for it to return before campaigning again, so two
+// generations of watchers never overlap, short of a watcher runWatchers
+// abandoned after --shutdown-timeout. It returns when ctx is cancelled
+// or run fails; on failure the Lease is released for another replica.
+func runElected(ctx context.Context, client kubernetes.Interface, namespace, name string, e emitter.Emitter, log *slog.Logger, run func(context.Context) error) error {
+	identity, err := os.Hostname() // the pod name when run as a Deployment
+	if err != nil {
+		return fmt.Errorf("leader election identity: %w", err)
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	lease := namespace + "/" + name
+	log = log.With("component", "leader")
+	log.Info("campaigning", "identity", identity, "lease", lease)
+	health.SetStandby(true) // not leading: no watches to report on
+
+	var runErr error
+	for ctx.Err() == nil && runErr == nil {
+		runErr = campaign(ctx, lock, name, identity, lease, e, log, run)
+	}
+	return runErr
+}
+
+// campaign runs one leader election: it waits to acquire the Lease, leads
+// until the Lease is lost, ctx is cancelled or run fails, and returns once
+// run has returned. It returns run's error.
+func campaign(ctx context.Context, lock resourcelock.Interface, name, identity, lease string, e emitter.Emitter, log *slog.Logger, run func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The elector starts OnStartedLeading in a goroutine and does not wait
+	// for it. mu orders it against OnStoppedLeading: either it registers
+	// with wg before the stop, and is waited for, or it sees stopped and
+	// never starts the watchers.
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		leading bool
+		stopped bool
+		runErr  error
+	)
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            name,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leadCtx context.Context) {
+				mu.Lock()
+				if stopped {
+					mu.Unlock()
+					return
+				}
+				leading = true
+				wg.Add(1)
+				mu.Unlock()
+				health.SetStandby(false)
+				defer wg.Done()
+				emitLeadership(e, log, "LeadershipAcquired", identity, lease)
+				if err := run(leadCtx); err != nil {
+					runErr = err
+					cancel() // release the Lease for another replica
+				}
+			},
+			// Called on every exit from Run, whether or not this replica
+			// ever led.
+			OnStoppedLeading: func() {
+				mu.Lock()
+				stopped = true
+				wasLeading := leading
+				mu.Unlock()
+				if wasLeading {
+					health.SetStandby(true)
+					emitLeadership(e, log, "LeadershipLost", identity, lease)
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Info("standing by", "leader", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("leader election: %w", err)
+	}
+	elector.Run(ctx)
+	wg.Wait()
+	return runErr
+}
+
+func emitLeadership(e emitter.Emitter, log *slog.Logger, eventType, identity, lease string) {
+	log.Info(eventType, "identity", identity, "lease", lease)
+	e.EmitMeta(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: eventType,
+		Payload: map[string]interface{}{
+			"identity": identity,
+			"lease":    lease,
+		},
+	})
+}
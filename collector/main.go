@@ -1,94 +1,594 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
-
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	"time"
 
 	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/health"
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+	"github.com/opscart/k8s-causal-memory/collector/tracing"
 	"github.com/opscart/k8s-causal-memory/collector/watcher"
 )
 
 func main() {
-	kubeconfig := flag.String("kubeconfig", "", "Path to kubeconfig")
-	namespace := flag.String("namespace", "", "Namespace to watch (default: all)")
-	outputDir := flag.String("output", "./output", "Directory for JSONL output")
-	flag.Parse()
-
-	fmt.Println("========================================")
-	fmt.Println(" k8s-causal-memory collector")
-	fmt.Println(" Operational Memory Architecture (OMA)")
-	fmt.Println(" github.com/opscart/k8s-causal-memory")
-	fmt.Println("========================================")
-
-	client, err := buildClient(*kubeconfig)
+	// "collector doctor [flags]" checks what a run with the same flags
+	// needs, instead of running.
+	doctor := len(os.Args) > 1 && os.Args[1] == "doctor"
+	args := os.Args[1:]
+	if doctor {
+		args = os.Args[2:]
+	}
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [doctor] [flags]\n\ndoctor checks cluster connectivity, permissions, output directories and endpoints for the given flags, prints a pass/fail table and exits non-zero on any failure, without watching.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	cfg, configFile, err := parseConfig(flag.CommandLine, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	log, err := newLogger(os.Stderr, cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to build client: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if configFile != "" {
+		log.Info("config file loaded", "path", configFile)
+	}
+	if err := cfg.resolve(); err != nil {
+		log.Error("invalid configuration", "err", err)
 		os.Exit(1)
 	}
-	fmt.Println("[main] Kubernetes client connected")
+	if doctor {
+		if !runDoctor(context.Background(), os.Stdout, cfg.doctor()) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	log.Info("k8s-causal-memory collector starting",
+		"version", emitter.CollectorVersion,
+		"schema", emitter.SchemaVersion,
+	)
 
-	emit, err := emitter.NewJSONEmitter(*outputDir)
+	clusters, err := buildClusters(cfg, log)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize emitter: %v\n", err)
+		log.Error("failed to build client", "err", err)
+		os.Exit(1)
+	}
+	if len(cfg.contexts) > 0 {
+		log.Info("Kubernetes clients built", "contexts", cfg.contexts)
+	} else {
+		log.Info("Kubernetes client connected")
+	}
+
+	// With --contexts each cluster is checked as it starts instead, so one
+	// that cannot be reached does not keep the others from starting.
+	if len(cfg.contexts) == 0 {
+		if err := clusters[0].preflight(context.Background(), cfg.namespaces, cfg.features(), cfg.podSel, cfg.objSel, cfg.IgnoreRBAC); err != nil {
+			log.Error("preflight failed", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	emit, ring, err := buildEmitter(cfg, log)
+	if err != nil {
+		log.Error("failed to initialize emitter", "err", err)
 		os.Exit(1)
 	}
 	defer emit.Close()
+	matcher, chains, chainExporter, err := buildMatcher(cfg, emit, log)
+	if err != nil {
+		log.Error("failed to initialize pattern detection", "err", err)
+		os.Exit(1)
+	}
 
-	nodeW := watcher.NewNodeWatcher(client, emit)
-	podW := watcher.NewPodWatcher(client, *namespace, emit, nodeW)
-	cmW := watcher.NewConfigMapWatcher(client, *namespace, emit)
-	eventW := watcher.NewEventWatcher(client, *namespace, emit)         // H2: scheduler event pruning
-	ephemeralW := watcher.NewEphemeralWatcher(client, *namespace, emit) // H3: ephemeral container exit
+	for _, c := range clusters {
+		c.useEmitter(emit)
+		if cfg.Resume {
+			c.checkpoint, err = watcher.LoadCheckpoint(cfg.OutputDir, c.name, c.log)
+			if err != nil {
+				log.Error("failed to load checkpoint", "err", err)
+				os.Exit(1)
+			}
+		}
+		c.watchers = clusterWatchers(cfg, c, emit)
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	fmt.Printf("[main] namespace=%q | output=%s\n", *namespace, *outputDir)
-	fmt.Println("[main] Press Ctrl+C to stop")
-	fmt.Println("----------------------------------------")
-
-	errCh := make(chan error, 5) // 3 original + 1 H2 + 1 H3
-	go func() { errCh <- nodeW.Watch(ctx) }()
-	go func() { errCh <- podW.Watch(ctx) }()
-	go func() { errCh <- cmW.Watch(ctx) }()
-	go func() { errCh <- eventW.Watch(ctx) }()     // H2
-	go func() { errCh <- ephemeralW.Watch(ctx) }() // H3
-
-	select {
-	case <-ctx.Done():
-		fmt.Println("\n[main] Shutting down...")
-	case err := <-errCh:
+	if cfg.nsSel.Label != "" {
+		log.Info("watching", "namespace_label_selector", cfg.nsSel.Label, "output", cfg.OutputDir, "emitter", cfg.Emitters)
+	} else {
+		log.Info("watching", "namespaces", cfg.namespaces, "output", cfg.OutputDir, "emitter", cfg.Emitters)
+	}
+	if len(cfg.contexts) > 0 {
+		log.Info("watching clusters", "contexts", cfg.contexts)
+	}
+	if cfg.podSel != (watcher.Selectors{}) {
+		log.Info("selectors", "label_selector", cfg.podSel.Label, "field_selector", cfg.podSel.Field)
+	}
+	if cfg.containerFilter != nil {
+		log.Info("container filter", "image", cfg.ContainerImageFilter, "name", cfg.ContainerNameFilter)
+	}
+	// What this run watches, for a reader of the output to tell a quiet
+	// cluster from a filtered one.
+	emit.EmitMeta(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "CollectorStarted",
+		Payload: map[string]interface{}{
+			"collector_version":        emitter.CollectorVersion,
+			"namespaces":               cfg.namespaces,
+			"namespace_label_selector": cfg.nsSel.Label,
+			"contexts":                 cfg.contexts,
+			"emitters":                 cfg.Emitters,
+			"label_selector":           cfg.podSel.Label,
+			"field_selector":           cfg.podSel.Field,
+			"container_image_filter":   cfg.ContainerImageFilter,
+			"container_name_filter":    cfg.ContainerNameFilter,
+			"enabled_events":           splitList(cfg.EnabledEvents),
+			"disabled_events":          splitList(cfg.DisabledEvents),
+		},
+	})
+
+	// The matcher emits CausalChainDetected, so it is waited for along with
+	// the watchers before the emitter closes.
+	var background sync.WaitGroup
+	background.Go(func() { matcher.Run(ctx, 5*time.Second) }) // resolves absence and optional-step windows
+	for _, c := range clusters {
+		background.Go(func() { c.checkpoint.Run(ctx, 2*time.Second) })
+		if cfg.AuthCheckInterval > 0 {
+			background.Go(func() {
+				checkAuth(ctx, c.client, c.transport, c.emit, c.log, cfg.AuthCheckInterval, cfg.AuthRebuildAfter)
+			})
+		}
+	}
+	if cfg.MetricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, cfg.MetricsAddr, log); err != nil {
+				log.Error("metrics endpoint failed", "err", err)
+			}
+		}()
+	}
+	if ring != nil {
+		go func() {
+			if err := ring.Serve(ctx, cfg.RingAddr, log); err != nil {
+				log.Error("events endpoint failed", "err", err)
+			}
+		}()
+	}
+	if chains != nil {
+		go func() {
+			if err := chains.Serve(ctx, cfg.ChainsAddr, log); err != nil {
+				log.Error("chains endpoint failed", "err", err)
+			}
+		}()
+	}
+	if cfg.HealthAddr != "" {
+		go func() {
+			if err := health.Serve(ctx, cfg.HealthAddr, cfg.DisconnectThreshold, log); err != nil {
+				log.Error("health endpoint failed", "err", err)
+			}
+		}()
+	}
+
+	run := func(ctx context.Context) error {
+		return runWatchers(ctx, log, clusters[0].watchers, cfg.ShutdownTimeout)
+	}
+	if len(cfg.contexts) > 0 {
+		run = func(ctx context.Context) error {
+			runClusters(ctx, clusters, func(ctx context.Context, c *cluster) error {
+				return c.preflight(ctx, cfg.namespaces, cfg.features(), cfg.podSel, cfg.objSel, cfg.IgnoreRBAC)
+			}, func(ctx context.Context, c *cluster) error {
+				return runWatchers(ctx, c.log, c.watchers, cfg.ShutdownTimeout)
+			})
+			return nil
+		}
+	}
+	if cfg.LeaderElect {
+		err = runElected(ctx, clusters[0].client, cfg.LeaseNamespace, cfg.LeaseName, emit, log, run)
+	} else {
+		err = run(ctx)
+	}
+	if err != nil {
+		log.Error("collector failed", "err", err)
+	} else {
+		log.Info("shutting down")
+	}
+	cancel()
+	background.Wait()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	chainExporter.Shutdown(shutdownCtx)
+	cancelShutdown()
+	for _, c := range clusters {
+		if err := c.checkpoint.Save(); err != nil {
+			c.log.Error("checkpoint save failed", "err", err)
+		}
+	}
+	log.Info("done")
+}
+
+// buildEmitter builds every sink of --emitter and wraps them, in order, in
+// the fan-out, the gRPC stream, redaction, load shedding and the event
+// filter. Watchers and the matcher emit into the returned Observer; the
+// ring sink, if any, is returned too for its endpoint to be served.
+func buildEmitter(cfg *Config, log *slog.Logger) (*emitter.Observer, *emitter.RingEmitter, error) {
+	jsonOpts := cfg.JSON
+	if cfg.Archive.Bucket != "" {
+		var err error
+		jsonOpts.Archive, err = emitter.NewS3Archiver(cfg.Archive, log)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[main] Error: %v\n", err)
-			cancel()
+			return nil, nil, fmt.Errorf("S3 archive: %w", err)
+		}
+	}
+	var kafkaTLS, grpcTLS *tls.Config
+	if cfg.TLS.Enabled() {
+		var err error
+		if slices.Contains(cfg.Emitters, "kafka") {
+			if kafkaTLS, err = cfg.TLS.ClientConfig(); err != nil {
+				return nil, nil, fmt.Errorf("Kafka TLS: %w", err)
+			}
+			if cfg.TLS.Insecure {
+				log.Warn("--tls-insecure: Kafka broker certificates are NOT verified; anyone on the network path can impersonate the brokers and read every record")
+			}
+		}
+		if cfg.GRPCAddr != "" {
+			if grpcTLS, err = cfg.TLS.ServerConfig(); err != nil {
+				return nil, nil, fmt.Errorf("gRPC TLS: %w", err)
+			}
+		}
+		if kafkaTLS == nil && grpcTLS == nil {
+			log.Warn("--tls-* flags set but neither --emitter=kafka nor --grpc-addr is, ignoring them")
+		}
+	}
+
+	var sinks []emitter.NamedEmitter
+	var ring *emitter.RingEmitter
+	for _, kind := range cfg.Emitters {
+		s, err := buildSink(cfg, kind, jsonOpts, kafkaTLS, log)
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
+			}
+			return nil, nil, fmt.Errorf("%s: %w", kind, err)
+		}
+		if r, ok := s.(*emitter.RingEmitter); ok {
+			ring = r
+		}
+		sinks = append(sinks, emitter.NamedEmitter{Name: kind, Emitter: s})
+	}
+	sink, err := wrapSinks(cfg, sinks, grpcTLS, log)
+	if err != nil {
+		for _, s := range sinks {
+			s.Close()
 		}
+		return nil, nil, err
 	}
-	fmt.Println("[main] Done.")
+	return emitter.NewObserver(sink), ring, nil
 }
 
-func buildClient(kubeconfigPath string) (kubernetes.Interface, error) {
-	var config *rest.Config
+// wrapSinks puts the sinks behind the fan-out and the wrappers the flags
+// ask for.
+func wrapSinks(cfg *Config, sinks []emitter.NamedEmitter, grpcTLS *tls.Config, log *slog.Logger) (emitter.Emitter, error) {
+	var sink emitter.Emitter = sinks[0].Emitter
 	var err error
-	if kubeconfigPath != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	} else if k := os.Getenv("KUBECONFIG"); k != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", k)
-	} else {
-		config, err = rest.InClusterConfig()
+	if len(sinks) > 1 {
+		if sink, err = emitter.NewMultiEmitter(sinks, cfg.EmitterQueue, log); err != nil {
+			return nil, fmt.Errorf("fan-out: %w", err)
+		}
+	}
+	if cfg.GRPCAddr != "" {
+		if sink, err = emitter.NewGRPCEmitter(sink, cfg.GRPCAddr, cfg.GRPCQueue, grpcTLS, log); err != nil {
+			return nil, fmt.Errorf("gRPC stream: %w", err)
+		}
+	}
+	if len(cfg.RedactRules) > 0 {
+		if sink, err = emitter.NewRedactor(sink, cfg.RedactRules, cfg.RedactSalt); err != nil {
+			return nil, fmt.Errorf("invalid --redact: %w", err)
+		}
+	}
+	if cfg.Shed.HighWater > 0 {
+		if sink, err = emitter.NewShedder(sink, cfg.Shed, log); err != nil {
+			return nil, fmt.Errorf("invalid --shed-high-water: %w", err)
+		}
+	}
+	if cfg.EnabledEvents != "" || cfg.DisabledEvents != "" {
+		enabled, disabled := splitList(cfg.EnabledEvents), splitList(cfg.DisabledEvents)
+		sink = emitter.NewEventFilter(sink, enabled, disabled)
+		log.Info("event filter", "enabled", enabled, "disabled", disabled)
+	}
+	return sink, nil
+}
+
+func buildSink(cfg *Config, kind string, jsonOpts emitter.JSONOptions, kafkaTLS *tls.Config, log *slog.Logger) (emitter.Emitter, error) {
+	switch kind {
+	case "json":
+		return emitter.NewJSONEmitter(cfg.OutputDir, jsonOpts, log)
+	case "kafka":
+		return emitter.NewKafkaEmitter(strings.Split(cfg.KafkaBrokers, ","), cfg.KafkaTopic, cfg.KafkaQueue, kafkaTLS, log)
+	case "sqlite":
+		return emitter.NewSQLiteEmitter(cfg.DBPath, cfg.SQLiteQueue, log)
+	case "ring":
+		return emitter.NewRingEmitter(cfg.RingSize)
+	case "stdout":
+		return emitter.NewStdoutEmitter(os.Stdout, cfg.StdoutFormat, emitter.UseColor(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown emitter %q (want json, kafka, sqlite, ring or stdout)", kind)
+	}
+}
+
+// buildMatcher loads the --patterns-dir patterns and sets up detection on
+// emit: the matcher, which emits the chains it detects and exports them
+// as traces, the chain store behind /chains if served, and the
+// correlator. The store and the exporter are nil when disabled.
+func buildMatcher(cfg *Config, emit *emitter.Observer, log *slog.Logger) (*patterns.Matcher, *patterns.ChainStore, *tracing.ChainExporter, error) {
+	if cfg.PatternsDir != "" {
+		loaded, err := patterns.LoadDir(cfg.PatternsDir)
 		if err != nil {
-			config, err = clientcmd.BuildConfigFromFlags("", os.Getenv("HOME")+"/.kube/config")
+			return nil, nil, nil, fmt.Errorf("invalid --patterns-dir: %w", err)
 		}
+		patterns.Register(loaded...)
+		log.Info("loaded patterns", "count", len(loaded), "dir", cfg.PatternsDir)
 	}
-	if err != nil {
-		return nil, fmt.Errorf("kubeconfig error: %w", err)
+	if err := cfg.Windows.Validate(patterns.AllPatterns); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid --namespace-window: %w", err)
+	}
+	var chainExporter *tracing.ChainExporter
+	if cfg.OTLPEndpoint != "" {
+		var err error
+		chainExporter, err = tracing.NewChainExporter(context.Background(), cfg.OTLPEndpoint, cfg.OTLPInsecure, log)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("OTLP trace export: %w", err)
+		}
+	}
+	var chains *patterns.ChainStore
+	if cfg.ChainsAddr != "" {
+		var err error
+		chains, err = patterns.NewChainStore(cfg.ChainStoreSize)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid --chain-store-size: %w", err)
+		}
+	}
+	matcher := patterns.NewMatcher(patterns.AllPatterns, func(chain patterns.CausalChain) {
+		emit.Emit(chain.Event())
+		chainExporter.Export(chain)
+	})
+	if cfg.EmitPartials {
+		matcher.OnPartial(func(chain patterns.CausalChain) {
+			emit.Emit(chain.Event())
+		})
+	}
+	matcher.UseWindows(cfg.Windows)
+	emit.AddListener(matcher.Feed)
+	if chains != nil {
+		emit.AddListener(chains.Observe)
+	}
+	emit.UseCorrelator(patterns.NewCorrelator(cfg.CorrelationWindow))
+	return matcher, chains, chainExporter, nil
+}
+
+// clusterWatchers builds the watchers of cluster c, which emits through
+// its own c.emit, and adds the cluster's detectors to emit as listeners.
+// Nodes are cluster-scoped and watched once per cluster; everything else
+// gets one watcher per namespace, all sharing the emitter. With
+// --namespace-label-selector the namespace watchers run only while their
+// namespace matches.
+func clusterWatchers(cfg *Config, c *cluster, emit *emitter.Observer) []runner {
+	lag := watcher.NewLagMonitor(c.emit, c.log, cfg.LagThreshold)
+	nodeW := watcher.NewNodeWatcher(c.client, c.emit, c.log, cfg.NodeCacheTTL)
+	nodeW.UseLagMonitor(lag)
+	nodeW.SnapshotOn(cfg.snapshotTriggers)
+	var limiter *watcher.APILimiter
+	if cfg.APICallQPS > 0 {
+		limiter = watcher.NewAPILimiter(c.emit, c.log, float32(cfg.APICallQPS), cfg.APICallBurst, cfg.APICallTimeout)
+	}
+	nodeW.UseAPILimiter(limiter)
+	nodeW.UseCheckpoint(c.checkpoint)
+	nodeW.WatchOvercommit(cfg.OvercommitThreshold, cfg.OvercommitInterval)
+	if cfg.NodePodMemory {
+		nodeW.AggregatePodMemory()
+	}
+	if cfg.StormThreshold > 0 {
+		emit.AddListener(c.listener(watcher.NewOOMStormDetector(c.emit, c.log, nodeW, cfg.StormWindow, cfg.StormThreshold).Feed))
+	}
+	watchers := []runner{nodeW}
+	watched := func() []string { return cfg.namespaces }
+	if cfg.nsSel.Label != "" {
+		nsW := watcher.NewNamespaceWatcher(c.client, cfg.nsSel, c.emit, c.log, func(ctx context.Context, ns string) error {
+			return runWatchers(ctx, c.log, namespaceWatchers(cfg, c, ns, nodeW, lag, limiter), cfg.ShutdownTimeout)
+		})
+		watched = nsW.Namespaces
+		watchers = append(watchers, nsW)
+	} else {
+		for _, ns := range cfg.namespaces {
+			watchers = append(watchers, namespaceWatchers(cfg, c, ns, nodeW, lag, limiter)...)
+		}
+	}
+	if cfg.RiskThreshold > 0 {
+		emit.AddListener(c.listener(watcher.NewOOMRiskDetector(c.client, cfg.podSel, c.emit, c.log, watched, cfg.RiskThreshold).Feed))
+	}
+	return watchers
+}
+
+// namespaceWatchers builds the watchers of namespace ns of cluster c,
+// wired to each other and to the cluster-wide node watcher, lag monitor
+// and API limiter.
+func namespaceWatchers(cfg *Config, c *cluster, ns string, nodeW *watcher.NodeWatcher, lag *watcher.LagMonitor, limiter *watcher.APILimiter) []runner {
+	var nsWatchers []runner
+	owners := watcher.NewOwners(c.client, ns, c.emit, c.log)
+	podW := watcher.NewPodWatcher(c.client, ns, cfg.podSel, c.emit, c.log, nodeW)
+	podW.UseOwners(owners)
+	podW.UseLagMonitor(lag)
+	podW.DebounceCrashLoops(cfg.CrashLoopQuiet)
+	podW.TrackTerminations(cfg.TerminationHistory)
+	podW.MinRestartCount(int32(cfg.MinRestarts))
+	podW.LinkCascades(cfg.CascadeWindow)
+	podW.ReconcileEvery(cfg.ReconcileInterval)
+	podW.FilterContainers(cfg.containerFilter)
+	podW.SnapshotOn(cfg.snapshotTriggers)
+	podW.UseWindows(cfg.Windows)
+	if cfg.SnapshotFirstSeen {
+		podW.SnapshotOnFirstSeen(watcher.DefaultFirstSeenCapacity)
+	}
+	if cfg.NodeProxy {
+		podW.UseNodeProxy()
+	}
+	if cfg.TrackImages {
+		podW.TrackImages()
+	}
+	if cfg.RecommendVPA {
+		podW.RecommendLimits(cfg.VPAHeadroom)
+	}
+	if cfg.CaptureLogs {
+		podW.CaptureLogs(cfg.LogTailLines)
+	}
+	if cfg.EnableSampling {
+		sampler := watcher.NewMemorySampler(c.client, ns, cfg.podSel, c.emit, c.log, cfg.SamplingInterval, cfg.SamplingDepth)
+		podW.UseSampler(sampler)
+		nsWatchers = append(nsWatchers, sampler)
+	}
+	cmW := watcher.NewConfigMapWatcher(c.client, ns, cfg.objSel, c.emit, c.log)
+	cmW.UseOwners(owners)
+	cmW.UseLagMonitor(lag)
+	cmW.HashLargeIncrementally(cfg.LargeConfigMap)
+	cmW.UseWindows(cfg.Windows)
+	cmW.UsePods(podW)
+	if cfg.CaptureDiffs {
+		cmW.CaptureDiffs(cfg.redact)
+	}
+	secretW := watcher.NewSecretWatcher(c.client, ns, watcher.Selectors{}, c.emit, c.log)
+	eventW := watcher.NewEventWatcher(c.client, ns, c.emit, c.log)                   // H2: scheduler event pruning
+	ephemeralW := watcher.NewEphemeralWatcher(c.client, ns, c.emit, c.log)           // H3: ephemeral container exit
+	deployW := watcher.NewDeploymentWatcher(c.client, ns, cfg.objSel, c.emit, c.log) // rollout precursors
+	stsW := watcher.NewStatefulSetWatcher(c.client, ns, cfg.objSel, c.emit, c.log)
+	dsW := watcher.NewDaemonSetWatcher(c.client, ns, cfg.objSel, c.emit, c.log)
+	hpaW := watcher.NewHPAWatcher(c.client, ns, watcher.Selectors{}, c.emit, c.log)
+	jobW := watcher.NewJobWatcher(c.client, ns, watcher.Selectors{}, c.emit, c.log)
+	pvcW := watcher.NewPVCWatcher(c.client, ns, watcher.Selectors{}, c.emit, c.log, cfg.PVCPendingThreshold)
+	pvcW.UseOwners(owners)
+	pvcW.UseAPILimiter(limiter)
+	svcW := watcher.NewServiceWatcher(c.client, ns, watcher.Selectors{}, c.emit, c.log)
+	ingW := watcher.NewIngressWatcher(c.client, ns, watcher.Selectors{}, c.emit, c.log)
+	epW := watcher.NewEndpointSliceWatcher(c.client, ns, watcher.Selectors{}, c.emit, c.log, cfg.TrafficLossGrace)
+	epW.DrainThreshold(cfg.DrainThreshold)
+	epW.UseIngresses(ingW)
+	secretW.UseHashKey([]byte(cmp.Or(cfg.SecretHashKey, cfg.RedactSalt)))
+	secretW.UseLagMonitor(lag)
+	secretW.UseWindows(cfg.Windows)
+	secretW.UsePods(podW)
+	eventW.UseVolumes(pvcW)
+	probes := watcher.NewProbeFailures(watcher.DefaultProbeFailureWindow)
+	eventW.UseProbeFailures(probes)
+	podW.UseProbeFailures(probes)
+	rsW := watcher.NewReplicaSetWatcher(c.client, ns, cfg.objSel, c.emit, c.log)
+	scaleDowns := watcher.NewScaleDowns(watcher.DefaultScaleDownWindow)
+	rsW.UseScaleDowns(scaleDowns)
+	podW.UseScaleDowns(scaleDowns)
+	podW.UseCheckpoint(c.checkpoint)
+	cmW.UseCheckpoint(c.checkpoint)
+	eventW.UseLagMonitor(lag)
+	eventW.UseCheckpoint(c.checkpoint)
+	ephemeralW.UseOwners(owners)
+	ephemeralW.UseCheckpoint(c.checkpoint)
+	deployW.UseCheckpoint(c.checkpoint)
+	return append(nsWatchers, owners, podW, cmW, secretW, eventW, pvcW, ephemeralW, deployW, rsW, stsW, dsW, hpaW, jobW, svcW, ingW, epW)
+}
+
+// runner is implemented by every watcher.
+type runner interface {
+	Watch(ctx context.Context) error
+}
+
+// runWatchers runs every watcher until ctx is cancelled or one of them
+// fails, then stops the rest and waits for all of them to return, so that
+// no watcher is still emitting when the emitter is closed. A watcher that
+// has not returned shutdownTimeout after the stop is abandoned rather than
+// hanging the process. It returns the first error.
+func runWatchers(ctx context.Context, log *slog.Logger, watchers []runner, shutdownTimeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, len(watchers))
+	for _, w := range watchers {
+		go func() { errCh <- w.Watch(ctx) }()
+	}
+	var first error
+	stopping := ctx.Done()
+	var deadline <-chan time.Time // armed once stopping
+	for remaining := len(watchers); remaining > 0; {
+		select {
+		case err := <-errCh:
+			remaining--
+			if err != nil && first == nil {
+				first = err
+				cancel()
+			}
+		case <-stopping:
+			stopping = nil
+			deadline = time.After(shutdownTimeout)
+		case <-deadline:
+			log.Warn("watchers still running after shutdown timeout, not waiting for them", "remaining", remaining, "timeout", shutdownTimeout)
+			return first
+		}
+	}
+	return first
+}
+
+// parseNamespaces splits the --namespace flag. An empty flag yields a
+// single "" entry, which watches all namespaces.
+func parseNamespaces(flagValue string) []string {
+	if out := splitList(flagValue); len(out) > 0 {
+		return out
+	}
+	return []string{""}
+}
+
+// splitList splits a comma-separated flag, dropping empty and repeated
+// entries.
+func splitList(flagValue string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range strings.Split(flagValue, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// newLogger builds the operational logger. It writes to w, kept apart from
+// the event output so that JSONL on stdout (--dry-run) or in files is never
+// interleaved with log lines.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q (want debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid --log-format %q (want text or json)", format)
 	}
-	return kubernetes.NewForConfig(config)
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+func watcherTypes(watchers []runner) []string {
+	var types []string
+	for _, w := range watchers {
+		types = append(types, fmt.Sprintf("%T", w))
+	}
+	return types
+}
+
+func testCluster(t *testing.T, cfg *Config) (*cluster, *emitter.Observer) {
+	t.Helper()
+	if err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	emit := emitter.NewObserver(emitter.NewMemoryEmitter())
+	c := &cluster{client: fake.NewSimpleClientset(), log: slog.New(slog.DiscardHandler)}
+	c.useEmitter(emit)
+	return c, emit
+}
+
+// One node watcher per cluster, and a full set of watchers per namespace,
+// or a namespace watcher starting them with --namespace-label-selector.
+func TestClusterWatchers(t *testing.T) {
+	cfg := testConfig(t, "--namespace", "prod,staging")
+	c, emit := testCluster(t, cfg)
+	types := watcherTypes(clusterWatchers(cfg, c, emit))
+	perNamespace := (len(types) - 1) / 2
+	if types[0] != "*watcher.NodeWatcher" || len(types) != 1+2*perNamespace || perNamespace < 16 {
+		t.Fatalf("watchers %q, want the node watcher and as many per namespace", types)
+	}
+	if !slices.Equal(types[1:1+perNamespace], types[1+perNamespace:]) {
+		t.Errorf("namespaces watched by different watchers: %q", types)
+	}
+
+	cfg = testConfig(t, "--namespace", "prod", "--enable-metrics-sampling")
+	c, emit = testCluster(t, cfg)
+	sampled := watcherTypes(clusterWatchers(cfg, c, emit))
+	if len(sampled) != 2+perNamespace || !slices.Contains(sampled, "*watcher.MemorySampler") {
+		t.Errorf("with sampling, watchers %q", sampled)
+	}
+
+	cfg = testConfig(t, "--namespace-label-selector", "oma=true")
+	c, emit = testCluster(t, cfg)
+	if got := watcherTypes(clusterWatchers(cfg, c, emit)); !slices.Equal(got, []string{"*watcher.NodeWatcher", "*watcher.NamespaceWatcher"}) {
+		t.Errorf("with a namespace selector, watchers %q", got)
+	}
+}
+
+// Every --emitter sink receives each event, and the ring sink is handed
+// back for its endpoint.
+func TestBuildEmitter(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(t, "--emitter", "json", "--emitter", "ring", "--output", dir)
+	if err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	emit, ring, err := buildEmitter(cfg, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emit.Emit(emitter.CausalEvent{ID: "e1", Timestamp: time.Now(), EventType: "OOMKill"})
+	emit.Close()
+	if ring == nil {
+		t.Fatal("no ring sink returned for --emitter=ring")
+	}
+	if got := ring.Recent(emitter.RingQuery{}); len(got) != 1 || got[0].ID != "e1" {
+		t.Errorf("ring holds %+v", got)
+	}
+	recs, err := emitter.ReadJSONL(filepath.Join(dir, "events.jsonl"), nil, nil)
+	if err != nil || len(recs) != 1 || recs[0].Event.ID != "e1" {
+		t.Errorf("events.jsonl holds %+v, %v", recs, err)
+	}
+
+	cfg = testConfig(t, "--emitter", "carrier-pigeon")
+	if err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := buildEmitter(cfg, slog.New(slog.DiscardHandler)); err == nil {
+		t.Fatal("unknown emitter accepted")
+	}
+}
@@ -0,0 +1,120 @@
+// Package metrics exposes collector health as Prometheus metrics. The
+// collector is silent by design when the cluster is healthy, so these are
+// what distinguishes "nothing happened" from "the collector stopped seeing
+// anything".
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	EventsEmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "causal_events_emitted_total",
+		Help: "Causal events accepted by the emitter, by event type.",
+	}, []string{"event_type"})
+
+	SnapshotsEmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "causal_snapshots_emitted_total",
+		Help: "Snapshots accepted by the emitter, by object kind.",
+	}, []string{"kind"})
+
+	SuppressedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "suppressed_events_total",
+		Help: "Causal events filtered out before emission, by event type.",
+	}, []string{"event_type"})
+
+	ShedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shed_events_total",
+		Help: "Causal events dropped by sampling while the emit queue was above its high-water mark, by event type.",
+	}, []string{"event_type"})
+
+	ObservationLag = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "observation_lag_seconds",
+		Help:    "Time from a change, as the object records it, to the collector emitting it, by watcher.",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300},
+	}, []string{"watcher"})
+
+	WatchReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "watch_reconnects_total",
+		Help: "Watch reconnections, by watcher.",
+	}, []string{"watcher"})
+
+	EmitterWriteErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "emitter_write_errors_total",
+		Help: "Records the emitter failed to marshal or write.",
+	})
+
+	ArchiveUploads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "archive_uploads_total",
+		Help: "Rotated files uploaded to object storage, by result (uploaded, failed).",
+	}, []string{"result"})
+
+	NodeCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "node_cache_size",
+		Help: "Nodes currently held in the node snapshot cache.",
+	})
+
+	StreamSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_subscribers",
+		Help: "Clients currently subscribed to the gRPC CausalStream.",
+	})
+
+	StreamRecordsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "stream_records_dropped_total",
+		Help: "Records not delivered to a gRPC subscriber because it fell behind.",
+	})
+
+	APIThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_calls_throttled_total",
+		Help: "Per-event API server calls given up on and answered from cache, by cause (rate_limit, api_server, timeout).",
+	}, []string{"cause"})
+)
+
+func init() {
+	registry.MustRegister(
+		EventsEmitted,
+		SnapshotsEmitted,
+		SuppressedEvents,
+		ShedEvents,
+		ObservationLag,
+		WatchReconnects,
+		EmitterWriteErrors,
+		ArchiveUploads,
+		NodeCacheSize,
+		StreamSubscribers,
+		StreamRecordsDropped,
+		APIThrottled,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Serve exposes /metrics on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string, log *slog.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Info("serving /metrics", "component", "metrics", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("metrics server failed: %w", err)
+	}
+	return nil
+}
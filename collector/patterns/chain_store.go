@@ -0,0 +1,274 @@
+package patterns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// DefaultChainStoreSize is how many chains the chain store keeps.
+const DefaultChainStoreSize = 10000
+
+// ChainStore keeps the causal chains detected since the collector started,
+// indexed by chain ID, pattern, namespace and completion time, and serves
+// them on /chains: the query surface of an incident review, without
+// grepping output files. It observes the emitter for CausalChainDetected
+// events; partial chains are not kept. Past its size the oldest chains are
+// evicted first.
+type ChainStore struct {
+	mu          sync.RWMutex
+	size        int
+	chains      []*storedChain // by completion time, oldest first
+	byID        map[string]*storedChain
+	byPattern   map[string][]*storedChain // each by completion time
+	byNamespace map[string][]*storedChain // each by completion time
+	evicted     uint64
+}
+
+// storedChain is a chain as served: its CausalChainDetected event, which
+// carries what the CausalChain leaves out of its JSON, the trigger's pod
+// and namespace, the IDs of the step events and the correlation ID.
+type storedChain struct {
+	event     emitter.CausalEvent
+	completed time.Time
+}
+
+func NewChainStore(size int) (*ChainStore, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("chain store size must be positive, got %d", size)
+	}
+	return &ChainStore{
+		size:        size,
+		byID:        map[string]*storedChain{},
+		byPattern:   map[string][]*storedChain{},
+		byNamespace: map[string][]*storedChain{},
+	}, nil
+}
+
+// Observe stores the chain a CausalChainDetected event reports, replacing
+// one stored with the same ID; other events are ignored.
+func (s *ChainStore) Observe(event emitter.CausalEvent) {
+	if event.EventType != "CausalChainDetected" {
+		return
+	}
+	c := &storedChain{event: event.Stamped(), completed: event.Timestamp}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.byID[event.ID]; ok {
+		s.remove(old)
+	}
+	s.chains = insertByTime(s.chains, c)
+	s.byID[event.ID] = c
+	s.byPattern[event.PatternID] = insertByTime(s.byPattern[event.PatternID], c)
+	ns := event.Namespace
+	s.byNamespace[ns] = insertByTime(s.byNamespace[ns], c)
+	for len(s.chains) > s.size {
+		s.remove(s.chains[0])
+		s.evicted++
+	}
+}
+
+// insertByTime inserts c into chains after those completed no later. The
+// matcher completes chains in time order, so this is almost always an
+// append.
+func insertByTime(chains []*storedChain, c *storedChain) []*storedChain {
+	i := len(chains)
+	for i > 0 && chains[i-1].completed.After(c.completed) {
+		i--
+	}
+	return slices.Insert(chains, i, c)
+}
+
+// remove drops c from every index. Caller holds s.mu for writing.
+func (s *ChainStore) remove(c *storedChain) {
+	without := func(chains []*storedChain) []*storedChain {
+		return slices.DeleteFunc(chains, func(o *storedChain) bool { return o == c })
+	}
+	s.chains = without(s.chains)
+	delete(s.byID, c.event.ID)
+	pattern, ns := c.event.PatternID, c.event.Namespace
+	if s.byPattern[pattern] = without(s.byPattern[pattern]); len(s.byPattern[pattern]) == 0 {
+		delete(s.byPattern, pattern)
+	}
+	if s.byNamespace[ns] = without(s.byNamespace[ns]); len(s.byNamespace[ns]) == 0 {
+		delete(s.byNamespace, ns)
+	}
+}
+
+// Get returns the chain with the given ID as its CausalChainDetected
+// event.
+func (s *ChainStore) Get(id string) (emitter.CausalEvent, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.byID[id]
+	if !ok {
+		return emitter.CausalEvent{}, false
+	}
+	return c.event, true
+}
+
+// ListByPattern returns the chains of a pattern, oldest first.
+func (s *ChainStore) ListByPattern(patternID string) []emitter.CausalEvent {
+	return s.List(ChainQuery{PatternID: patternID})
+}
+
+// ListByTimeRange returns the chains completed from since until until,
+// oldest first. A zero bound is open.
+func (s *ChainStore) ListByTimeRange(since, until time.Time) []emitter.CausalEvent {
+	return s.List(ChainQuery{Since: since, Until: until})
+}
+
+// ChainQuery selects chains from the store. Zero fields match everything.
+type ChainQuery struct {
+	PatternID string
+	Namespace string
+	Since     time.Time // completed at or after
+	Until     time.Time // completed at or before
+	Limit     int       // the newest Limit matches
+}
+
+func (q ChainQuery) matches(c *storedChain) bool {
+	if q.PatternID != "" && c.event.PatternID != q.PatternID {
+		return false
+	}
+	if q.Namespace != "" && c.event.Namespace != q.Namespace {
+		return false
+	}
+	if !q.Since.IsZero() && c.completed.Before(q.Since) {
+		return false
+	}
+	return q.Until.IsZero() || !c.completed.After(q.Until)
+}
+
+// List returns the chains q selects, oldest first, reading the narrowest
+// index q allows.
+func (s *ChainStore) List(q ChainQuery) []emitter.CausalEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	candidates := s.chains
+	if q.PatternID != "" && len(s.byPattern[q.PatternID]) < len(candidates) {
+		candidates = s.byPattern[q.PatternID]
+	}
+	if q.Namespace != "" && len(s.byNamespace[q.Namespace]) < len(candidates) {
+		candidates = s.byNamespace[q.Namespace]
+	}
+	// Every index is by completion time: skip what precedes the range.
+	if !q.Since.IsZero() {
+		i, _ := slices.BinarySearchFunc(candidates, q.Since, func(c *storedChain, t time.Time) int {
+			return c.completed.Compare(t)
+		})
+		candidates = candidates[i:]
+	}
+	out := []emitter.CausalEvent{}
+	for _, c := range candidates {
+		if !q.Until.IsZero() && c.completed.After(q.Until) {
+			break
+		}
+		if q.matches(c) {
+			out = append(out, c.event)
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out
+}
+
+// Handler serves GET /chains, the chains selected by the query parameters
+// pattern, namespace, since and until, each an RFC 3339 time or a
+// duration back from now such as 1h, and limit; and GET /chains/{id}, one
+// chain.
+func (s *ChainStore) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /chains", func(w http.ResponseWriter, req *http.Request) {
+		q, err := parseChainQuery(req, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		chains := s.List(q)
+		s.mu.RLock()
+		stored, evicted := len(s.chains), s.evicted
+		s.mu.RUnlock()
+		writeJSON(w, map[string]interface{}{
+			"chains":   chains,
+			"count":    len(chains),
+			"stored":   stored,
+			"capacity": s.size,
+			"evicted":  evicted,
+		})
+	})
+	mux.HandleFunc("GET /chains/{id}", func(w http.ResponseWriter, req *http.Request) {
+		chain, ok := s.Get(req.PathValue("id"))
+		if !ok {
+			http.Error(w, "chain not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, chain)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func parseChainQuery(req *http.Request, now time.Time) (ChainQuery, error) {
+	values := req.URL.Query()
+	q := ChainQuery{PatternID: values.Get("pattern"), Namespace: values.Get("namespace")}
+	var err error
+	if q.Since, err = parseQueryTime("since", values.Get("since"), now); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseQueryTime("until", values.Get("until"), now); err != nil {
+		return q, err
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("limit %q is not a non-negative integer", limit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// parseQueryTime reads an RFC 3339 time, or a duration back from now.
+func parseQueryTime(name, value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s %q is neither an RFC 3339 time nor a duration", name, value)
+}
+
+// Serve exposes /chains on addr until ctx is cancelled.
+func (s *ChainStore) Serve(ctx context.Context, addr string, log *slog.Logger) error {
+	srv := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Info("serving /chains", "component", "chain_store", "addr", addr, "size", s.size)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("chains server failed: %w", err)
+	}
+	return nil
+}
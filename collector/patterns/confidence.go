@@ -0,0 +1,122 @@
+package patterns
+
+import (
+	"math"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// Confidence component weights. A component that does not apply to a
+// chain is left out and the others are rescaled to sum to one.
+const (
+	weightEarly    = 0.4
+	weightEvidence = 0.3
+	weightTiming   = 0.3
+)
+
+// confidence scores how much a completed chain can be trusted, from 0 to 1,
+// as the weighted mean of three components, each also in [0, 1]:
+//
+//   - early (0.4): over the required steps other than the trigger, 1 for a
+//     step matched within the first half of its window, 0.5 for one
+//     matched later or for an absence step resolved by silence rather
+//     than witnessed. Applies when the pattern has such steps.
+//   - evidence (0.3): over the evidence steps, 1 for evidence captured
+//     before the trigger's evidence_expires_at (or, without one, within
+//     the step's window), 0 for evidence never captured. Applies when the
+//     pattern has evidence steps.
+//   - timing (0.3): over the non-absence steps other than the trigger that
+//     have a window, 1 - |offset from trigger| / window for a matched step
+//     and 0 for a skipped optional one, so tight chains score higher and
+//     chains that got by on missing optional steps lower. Applies when
+//     the pattern has such steps.
+//
+// A trigger-only chain, where no component applies, scores 1.
+func confidence(steps []ChainStep, trigger emitter.CausalEvent) float64 {
+	var early, evidence, timing component
+	for _, s := range steps {
+		if s.Role == "trigger" {
+			continue
+		}
+		window := time.Duration(s.WindowSecs) * time.Second
+		offset := time.Duration(0)
+		if s.Event != nil {
+			offset = s.Event.Timestamp.Sub(trigger.Timestamp).Abs()
+		}
+
+		if !s.Optional {
+			switch {
+			case s.Status == StepMatched && (window == 0 || offset <= window/2):
+				early.add(1)
+			case s.Status == StepMatched || s.Status == StepAbsent:
+				early.add(0.5)
+			default:
+				early.add(0)
+			}
+		}
+
+		if s.Role == "evidence" {
+			expires, ok := evidenceExpiry(trigger)
+			switch {
+			case s.Event == nil:
+				evidence.add(0)
+			case ok && s.Event.Timestamp.After(expires):
+				evidence.add(0)
+			default:
+				evidence.add(1)
+			}
+		}
+
+		if s.Role != "absence" && window > 0 {
+			if s.Event == nil {
+				timing.add(0)
+			} else {
+				timing.add(math.Max(0, 1-float64(offset)/float64(window)))
+			}
+		}
+	}
+
+	var sum, weights float64
+	for _, c := range []struct {
+		component
+		weight float64
+	}{{early, weightEarly}, {evidence, weightEvidence}, {timing, weightTiming}} {
+		if c.n == 0 {
+			continue
+		}
+		sum += c.weight * c.mean()
+		weights += c.weight
+	}
+	if weights == 0 {
+		return 1
+	}
+	return math.Round(sum/weights*1000) / 1000
+}
+
+type component struct {
+	total float64
+	n     int
+}
+
+func (c *component) add(v float64) {
+	c.total += v
+	c.n++
+}
+
+func (c component) mean() float64 {
+	return c.total / float64(c.n)
+}
+
+// evidenceExpiry reads the trigger's evidence_expires_at, a time.Time in
+// process or an RFC 3339 string once the event has been through JSON.
+func evidenceExpiry(trigger emitter.CausalEvent) (time.Time, bool) {
+	switch v := trigger.Payload["evidence_expires_at"].(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
@@ -10,7 +10,8 @@ var ConfigMapEnvPattern = CausalPattern{
 	Description: "ConfigMap update not propagated to pods consuming it as env vars",
 	Steps: []PatternStep{
 		{EventType: "ConfigMapChanged", Role: "trigger", Optional: false, WindowSecs: 0, Description: "ConfigMap content changed"},
-		{EventType: "PodNotRestarted", Role: "absence", Optional: false, WindowSecs: 120, Description: "No pod restart observed for env var consumers"},
+		{EventType: "PodNotRestarted", Role: "absence", Optional: false, WindowSecs: 120, Description: "No pod restart observed for env var consumers",
+			AbsentEventTypes: []string{"ContainerTerminated", "DeploymentRolledOut", "WorkloadRolledOut"}, Witnessed: true},
 	},
 	RemediationActions: []string{"rollout_restart_deployment", "alert_config_drift"},
 }
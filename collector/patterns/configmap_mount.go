@@ -10,7 +10,7 @@ var ConfigMapMountPattern = CausalPattern{
 	Description: "ConfigMap update propagated via kubelet atomic symlink swap",
 	Steps: []PatternStep{
 		{EventType: "ConfigMapChanged", Role: "trigger", Optional: false, WindowSecs: 0, Description: "ConfigMap content changed"},
-		{EventType: "KubeletSync", Role: "propagation", Optional: true, WindowSecs: 90, Description: "Kubelet syncs ConfigMap via symlink swap"},
+		{EventType: "KubeletSync", Role: "propagation", Optional: true, WindowSecs: 90, Description: "Kubelet syncs ConfigMap via symlink swap (inferred, see payload confidence)"},
 	},
 	RemediationActions: []string{"verify_inotify_watch_pattern", "check_app_reload_logs"},
 }
@@ -0,0 +1,86 @@
+package patterns
+
+import (
+	"sync"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// DefaultCorrelationWindow is how far apart two related events may be and
+// still belong to one incident. It covers the effect windows of the
+// built-in patterns; the hour- and day-long precursor windows of a few
+// would merge a busy node's incidents into one.
+const DefaultCorrelationWindow = 10 * time.Minute
+
+// Correlator assigns CorrelationIDs as events are emitted, by the rule the
+// matcher groups events into chains with: an event belongs with the events
+// it relates to (the same pod, else the same ConfigMap, Secret, claim,
+// Service or workload, else the same node) within the window. An event
+// joins the incident of the closest related event in time; one relating to
+// none starts an incident named by its own ID. So the events of a chain
+// share their CorrelationID before the chain completes, and whether or not
+// it ever does, unless the chain spans more than the window.
+//
+// Relations are not transitive: two pods on one node are not related to
+// each other, but both are to a node condition, whose incident they join.
+type Correlator struct {
+	mu     sync.Mutex
+	window time.Duration
+	now    time.Time
+	recent []correlated // in emit order
+}
+
+type correlated struct {
+	at            time.Time
+	identity      identity
+	correlationID string
+}
+
+func NewCorrelator(window time.Duration) *Correlator {
+	if window <= 0 {
+		window = DefaultCorrelationWindow
+	}
+	return &Correlator{window: window}
+}
+
+// Correlate sets event's CorrelationID.
+func (c *Correlator) Correlate(event *emitter.CausalEvent) {
+	id := identityOf(*event)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if event.Timestamp.After(c.now) {
+		c.now = event.Timestamp
+	}
+	// Watchers emit concurrently, so timestamps are only roughly in
+	// order: compare distances rather than stopping at the first match.
+	var best *correlated
+	var bestDist time.Duration
+	for i := range c.recent {
+		r := &c.recent[i]
+		dist := event.Timestamp.Sub(r.at).Abs()
+		if dist > c.window || !id.relates(r.identity) {
+			continue
+		}
+		if best == nil || dist <= bestDist {
+			best, bestDist = r, dist
+		}
+	}
+	event.CorrelationID = event.ID
+	if best != nil {
+		event.CorrelationID = best.correlationID
+	}
+	c.remember(correlated{at: event.Timestamp, identity: id, correlationID: event.CorrelationID})
+}
+
+func (c *Correlator) remember(r correlated) {
+	c.recent = append(c.recent, r)
+	cutoff := c.now.Add(-c.window)
+	drop := 0
+	for drop < len(c.recent) && (c.recent[drop].at.Before(cutoff) || len(c.recent)-drop > maxHistory) {
+		drop++
+	}
+	if drop > 0 {
+		c.recent = append([]correlated(nil), c.recent[drop:]...)
+	}
+}
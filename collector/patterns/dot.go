@@ -0,0 +1,176 @@
+package patterns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// ChainFromEvent rebuilds the chain a CausalChainDetected record describes.
+// Step events are looked up by ID in events; a step whose event is not
+// there (recorded in a file that was not read) keeps the type and time the
+// record carries for it.
+func ChainFromEvent(ev emitter.CausalEvent, events map[string]emitter.CausalEvent) (CausalChain, error) {
+	if ev.EventType != "CausalChainDetected" {
+		return CausalChain{}, fmt.Errorf("%s is a %s, not a CausalChainDetected", ev.ID, ev.EventType)
+	}
+	data, err := json.Marshal(ev.Payload)
+	if err != nil {
+		return CausalChain{}, err
+	}
+	var p struct {
+		ChainID        string    `json:"chain_id"`
+		PatternName    string    `json:"pattern_name"`
+		TriggerEventID string    `json:"trigger_event_id"`
+		StartedAt      time.Time `json:"started_at"`
+		CompletedAt    time.Time `json:"completed_at"`
+		Confidence     float64   `json:"confidence"`
+		Steps          []struct {
+			EventType string    `json:"event_type"`
+			Role      string    `json:"role"`
+			Optional  bool      `json:"optional"`
+			Status    string    `json:"status"`
+			EventID   string    `json:"event_id"`
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"steps"`
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return CausalChain{}, fmt.Errorf("chain %s: %w", ev.ID, err)
+	}
+	c := CausalChain{
+		ID:          p.ChainID,
+		PatternID:   ev.PatternID,
+		PatternName: p.PatternName,
+		StartedAt:   p.StartedAt,
+		CompletedAt: p.CompletedAt,
+		Confidence:  p.Confidence,
+		Trigger:     events[p.TriggerEventID],
+	}
+	if c.Trigger.ID == "" {
+		c.Trigger = emitter.CausalEvent{ID: p.TriggerEventID, PodName: ev.PodName, Namespace: ev.Namespace, NodeName: ev.NodeName, PodUID: ev.PodUID}
+	}
+	for _, s := range p.Steps {
+		step := ChainStep{PatternStep: PatternStep{EventType: s.EventType, Role: s.Role, Optional: s.Optional}, Status: s.Status}
+		if s.EventID != "" {
+			found, ok := events[s.EventID]
+			if !ok {
+				found = emitter.CausalEvent{ID: s.EventID, EventType: s.EventType, Timestamp: s.Timestamp}
+				if s.EventID == c.Trigger.ID {
+					c.Trigger.EventType, c.Trigger.Timestamp = s.EventType, s.Timestamp
+				}
+			}
+			step.Event = &found
+		}
+		c.Steps = append(c.Steps, step)
+	}
+	return c, nil
+}
+
+// WriteDOT renders chains as one Graphviz digraph, each chain a cluster
+// read left to right: a node per step, labeled with its event type, role
+// and time, and an edge per causal link, labeled with the delay between
+// the two steps' events. Optional steps that were skipped and absence
+// steps are dashed; the trigger is drawn bold.
+//
+//	export-dot --chain-id 3f2a... output/events.jsonl | dot -Tsvg > chain.svg
+func WriteDOT(w io.Writer, chains ...CausalChain) error {
+	var b strings.Builder
+	b.WriteString("digraph causal_chains {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, style=rounded, fontname=Helvetica, fontsize=10];\n")
+	b.WriteString("\tedge [fontname=Helvetica, fontsize=9];\n")
+	for i, c := range chains {
+		fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(&b, "\t\tlabel=%s;\n", dotQuote(chainTitle(c)))
+		b.WriteString("\t\tlabeljust=l;\n")
+		for j, s := range c.Steps {
+			fmt.Fprintf(&b, "\t\tc%d_s%d [label=%s%s];\n", i, j, dotQuote(stepLabel(c, s)), stepStyle(c, s))
+		}
+		for j := 1; j < len(c.Steps); j++ {
+			fmt.Fprintf(&b, "\t\tc%d_s%d -> c%d_s%d [label=%s%s];\n", i, j-1, i, j, dotQuote(linkLabel(c.Steps[j-1], c.Steps[j])), linkStyle(c.Steps[j]))
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func chainTitle(c CausalChain) string {
+	title := fmt.Sprintf("%s %s (confidence %.2f)", c.PatternID, c.PatternName, c.Confidence)
+	var subject []string
+	if c.Trigger.Namespace != "" || c.Trigger.PodName != "" {
+		subject = append(subject, "pod "+c.Trigger.Namespace+"/"+c.Trigger.PodName)
+	}
+	if c.Trigger.NodeName != "" {
+		subject = append(subject, "node "+c.Trigger.NodeName)
+	}
+	if len(subject) > 0 {
+		title += "\n" + strings.Join(subject, ", ")
+	}
+	return title + "\nchain " + c.ID
+}
+
+func stepLabel(c CausalChain, s ChainStep) string {
+	label := s.EventType + "\n" + s.Role
+	switch {
+	case s.Event != nil:
+		label += "\n" + s.Event.Timestamp.UTC().Format("15:04:05Z")
+		if c.Trigger.ID != "" && s.Event.ID != c.Trigger.ID && !c.Trigger.Timestamp.IsZero() {
+			label += fmt.Sprintf(" (%+.0fs)", s.Event.Timestamp.Sub(c.Trigger.Timestamp).Seconds())
+		}
+	case s.Status != "":
+		label += "\n(" + s.Status + ")"
+	}
+	return label
+}
+
+func stepStyle(c CausalChain, s ChainStep) string {
+	switch {
+	case s.Event != nil && s.Event.ID == c.Trigger.ID:
+		return ", penwidth=2"
+	case s.Status == StepSkipped:
+		return `, style="rounded,dashed", color=gray50, fontcolor=gray50`
+	case s.Status == StepAbsent || s.Role == "absence":
+		return `, style="rounded,dashed"`
+	}
+	return ""
+}
+
+// linkLabel is the delay between two steps' events, when both have one,
+// and what is special about the later step.
+func linkLabel(from, to ChainStep) string {
+	var parts []string
+	if from.Event != nil && to.Event != nil {
+		delay := to.Event.Timestamp.Sub(from.Event.Timestamp).Round(time.Second)
+		if delay >= 0 {
+			parts = append(parts, "+"+delay.String())
+		} else {
+			parts = append(parts, delay.String())
+		}
+	}
+	if to.Optional {
+		parts = append(parts, "optional")
+	}
+	if to.Role == "absence" || to.Status == StepAbsent {
+		parts = append(parts, "absence")
+	}
+	return strings.Join(parts, "\n")
+}
+
+func linkStyle(to ChainStep) string {
+	if to.Event == nil {
+		return ", style=dashed"
+	}
+	return ""
+}
+
+// dotQuote quotes s as a DOT string; newlines become centered line breaks.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,19 @@
+package patterns
+
+// PatternJobFailure: OOMKill / CrashLoopBackOff → JobFailed
+// A batch Job retries its pods until the backoff limit or active deadline
+// runs out. Each attempt fails on its own, and only JobFailed marks the
+// point where the work was given up; the attempts before it say why.
+const PatternJobFailure = "P008"
+
+var JobFailurePattern = CausalPattern{
+	ID:          PatternJobFailure,
+	Name:        "Batch Job Failure",
+	Description: "Job pods OOMKilled or crashlooping until the backoff limit or deadline ran out",
+	Steps: []PatternStep{
+		{EventType: "OOMKill", Role: "precursor", Optional: true, WindowSecs: 3600, Description: "A pod of the Job OOMKilled"},
+		{EventType: "CrashLoopBackOff", Role: "precursor", Optional: true, WindowSecs: 3600, Description: "A pod of the Job crashlooping"},
+		{EventType: "JobFailed", Role: "trigger", Optional: false, WindowSecs: 0, Description: "Job gave up: BackoffLimitExceeded, DeadlineExceeded or a pod failure policy"},
+	},
+	RemediationActions: []string{"increase_memory_limit", "review_backoff_limit_and_deadline", "alert_engineering"},
+}
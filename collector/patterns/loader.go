@@ -0,0 +1,158 @@
+package patterns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Step roles understood by the matcher.
+var knownRoles = map[string]bool{
+	"precursor":   true,
+	"trigger":     true,
+	"effect":      true,
+	"evidence":    true,
+	"absence":     true,
+	"propagation": true,
+}
+
+// LoadFromFile reads pattern definitions from a YAML or JSON file holding
+// either one pattern or a list of them. Field names are the JSON names of
+// CausalPattern and PatternStep (id, steps, event_type, window_secs, ...).
+// Every pattern is validated; the error lists all problems found, one per
+// line.
+func LoadFromFile(path string) ([]CausalPattern, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// YAML is a superset of JSON, so one decoder serves both.
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var loaded []CausalPattern
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = yaml.UnmarshalStrict(data, &loaded)
+	} else {
+		var p CausalPattern
+		err = yaml.UnmarshalStrict(data, &p)
+		loaded = []CausalPattern{p}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var errs []error
+	for _, p := range loaded {
+		for _, err := range validate(p) {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// LoadDir loads every *.yaml, *.yml and *.json file in dir, in name order.
+// Two files defining the same pattern ID is an error.
+func LoadDir(dir string) ([]CausalPattern, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !e.IsDir() {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	var all []CausalPattern
+	definedIn := map[string]string{}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		loaded, err := LoadFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range loaded {
+			if prev, ok := definedIn[p.ID]; ok {
+				return nil, fmt.Errorf("%s: pattern %q already defined in %s", path, p.ID, prev)
+			}
+			definedIn[p.ID] = path
+		}
+		all = append(all, loaded...)
+	}
+	return all, nil
+}
+
+// Register adds patterns to AllPatterns, replacing built-in patterns with
+// the same ID. Call it before building a Matcher.
+func Register(loaded ...CausalPattern) {
+	for _, p := range loaded {
+		AllPatterns[p.ID] = p
+	}
+}
+
+// Validate checks a pattern definition: an ID, exactly one required
+// trigger, known roles, non-negative windows, and absence-only fields used
+// only on absence steps.
+func Validate(p CausalPattern) error {
+	return errors.Join(validate(p)...)
+}
+
+// validate returns one error per problem, each naming the pattern and step.
+func validate(p CausalPattern) []error {
+	if p.ID == "" {
+		return []error{errors.New("pattern with no id")}
+	}
+	var errs []error
+	if len(p.Steps) == 0 {
+		errs = append(errs, fmt.Errorf("pattern %q: no steps", p.ID))
+	}
+	triggers := 0
+	for i, s := range p.Steps {
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, fmt.Errorf("pattern %q step %d (%s): %s", p.ID, i, s.EventType, fmt.Sprintf(format, args...)))
+		}
+		if s.EventType == "" {
+			fail("missing event_type")
+		}
+		if !knownRoles[s.Role] {
+			fail("unknown role %q (want precursor, trigger, effect, evidence, absence or propagation)", s.Role)
+		}
+		if s.WindowSecs < 0 {
+			fail("window_secs must not be negative, got %d", s.WindowSecs)
+		}
+		switch {
+		case s.Role == "trigger":
+			triggers++
+			if s.Optional {
+				fail("trigger cannot be optional")
+			}
+		case s.Role == "absence":
+			if len(s.AbsentEventTypes) == 0 {
+				fail("absence step needs absent_event_types")
+			}
+			if s.WindowSecs == 0 {
+				fail("absence step needs a window_secs")
+			}
+		case len(s.AbsentEventTypes) > 0 || s.Witnessed:
+			fail("absent_event_types and witnessed apply to absence steps only")
+		}
+	}
+	if triggers != 1 {
+		errs = append(errs, fmt.Errorf("pattern %q: want exactly one trigger step, got %d", p.ID, triggers))
+	}
+	return errs
+}
@@ -0,0 +1,584 @@
+package patterns
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// Step resolution states recorded on a CausalChain.
+const (
+	StepMatched = "matched" // an event satisfied the step
+	StepSkipped = "skipped" // optional step whose window elapsed without a match
+	StepAbsent  = "absent"  // absence step whose window elapsed uncontradicted
+	StepMissing = "missing" // required step whose window elapsed without a match
+	StepPending = "pending" // step still open when another went missing
+)
+
+// maxHistory bounds the look-back buffer used to resolve precursor steps.
+const maxHistory = 10000
+
+// CausalChain is a completed pattern match, or with Partial set, one that
+// expired when a required step went missing.
+type CausalChain struct {
+	ID          string      `json:"chain_id"`
+	PatternID   string      `json:"pattern_id"`
+	PatternName string      `json:"pattern_name"`
+	Steps       []ChainStep `json:"steps"`
+	StartedAt   time.Time   `json:"started_at"`
+	CompletedAt time.Time   `json:"completed_at"`
+	// Confidence is how far the chain can be trusted, from 0 to 1; see
+	// confidence for the formula.
+	Confidence float64 `json:"confidence"`
+	Partial    bool    `json:"partial,omitempty"`
+
+	Trigger emitter.CausalEvent `json:"-"`
+}
+
+// ChainStep pairs a pattern step with how it was resolved. Event is nil for
+// skipped optional steps and for absence steps resolved by an empty window.
+type ChainStep struct {
+	PatternStep
+	Status string               `json:"status"`
+	Event  *emitter.CausalEvent `json:"-"`
+}
+
+// Matcher correlates emitted CausalEvents against CausalPatterns. Events
+// must be fed in timestamp order; the matcher's clock is the latest event
+// timestamp seen, or the time passed to Advance, whichever is later.
+type Matcher struct {
+	mu        sync.Mutex
+	patterns  []CausalPattern
+	onChain   func(CausalChain)
+	onPartial func(CausalChain) // nil drops expired partials silently
+
+	now      time.Time
+	partials map[string]*partialMatch // key: "<pattern-id>|<identity>"
+	history  []emitter.CausalEvent
+	lookback time.Duration
+	windows  *NamespaceWindows // nil keeps every pattern's windows
+}
+
+type partialMatch struct {
+	pattern    CausalPattern
+	identity   identity
+	trigger    emitter.CausalEvent
+	triggerIdx int
+	steps      []ChainStep
+}
+
+func NewMatcher(all map[string]CausalPattern, onChain func(CausalChain)) *Matcher {
+	m := &Matcher{onChain: onChain, partials: map[string]*partialMatch{}}
+	for _, p := range all {
+		m.patterns = append(m.patterns, p)
+		for i, step := range p.Steps {
+			if i < triggerIndex(p) && time.Duration(step.WindowSecs)*time.Second > m.lookback {
+				m.lookback = time.Duration(step.WindowSecs) * time.Second
+			}
+		}
+	}
+	sort.Slice(m.patterns, func(i, j int) bool { return m.patterns[i].ID < m.patterns[j].ID })
+	return m
+}
+
+// OnPartial makes the matcher deliver, to fn, the partial matches that
+// expire because a required step after the trigger saw no event within its
+// window: an OOMKill whose container was never seen terminated because the
+// pod was deleted, say. That the effect never came is itself a finding.
+// The chain has Partial set, its missing steps StepMissing and those still
+// open StepPending. A partial dropped because an event contradicted an
+// absence step is not delivered; that is a pattern ruled out, not cut
+// short.
+func (m *Matcher) OnPartial(fn func(CausalChain)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onPartial = fn
+}
+
+// UseWindows resolves the windows of a chain's steps through w for the
+// namespace of its trigger.
+func (m *Matcher) UseWindows(w *NamespaceWindows) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windows = w
+	m.lookback = max(m.lookback, w.longest())
+}
+
+// Feed ingests one event. Completed chains are delivered to the callback
+// after the matcher's lock is released, so the callback may emit events
+// that are fed back into the matcher.
+func (m *Matcher) Feed(event emitter.CausalEvent) {
+	m.mu.Lock()
+	chains := m.feed(event)
+	m.mu.Unlock()
+	m.deliver(chains)
+}
+
+// Advance moves the clock forward without an event, resolving windows that
+// have elapsed. Absence steps only complete through Advance or later Feeds.
+func (m *Matcher) Advance(now time.Time) {
+	m.mu.Lock()
+	if now.After(m.now) {
+		m.now = now
+	}
+	chains := m.expire()
+	m.mu.Unlock()
+	m.deliver(chains)
+}
+
+// Run calls Advance on every tick until ctx is cancelled.
+func (m *Matcher) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			m.Advance(now)
+		}
+	}
+}
+
+func (m *Matcher) deliver(chains []CausalChain) {
+	m.mu.Lock()
+	onPartial := m.onPartial
+	m.mu.Unlock()
+	for _, c := range chains {
+		switch {
+		case c.Partial && onPartial != nil:
+			onPartial(c)
+		case !c.Partial && m.onChain != nil:
+			m.onChain(c)
+		}
+	}
+}
+
+func (m *Matcher) feed(event emitter.CausalEvent) []CausalChain {
+	if event.Timestamp.After(m.now) {
+		m.now = event.Timestamp
+	}
+	completed := m.expire()
+	id := identityOf(event)
+
+	for key, p := range m.partials {
+		if !p.identity.relates(id) {
+			continue
+		}
+		if !p.observe(event) {
+			delete(m.partials, key) // absence contradicted
+			continue
+		}
+		if p.resolved() {
+			completed = append(completed, p.chain(m.now))
+			delete(m.partials, key)
+		}
+	}
+
+	for _, pattern := range m.patterns {
+		ti := triggerIndex(pattern)
+		if ti < 0 || !stepMatches(pattern.Steps[ti], event) {
+			continue
+		}
+		key := pattern.ID + "|" + id.cluster + "|" + id.primary(event)
+		if _, open := m.partials[key]; open {
+			continue
+		}
+		p, ok := m.open(pattern, ti, event, id)
+		if !ok {
+			continue
+		}
+		if p.resolved() {
+			completed = append(completed, p.chain(m.now))
+			continue
+		}
+		m.partials[key] = p
+	}
+
+	m.remember(event)
+	return completed
+}
+
+// open starts a partial match at a trigger event, resolving precursor steps
+// from history. It returns false if a required precursor is missing.
+func (m *Matcher) open(pattern CausalPattern, ti int, trigger emitter.CausalEvent, id identity) (*partialMatch, bool) {
+	pattern = m.windows.Pattern(pattern, trigger.Namespace)
+	p := &partialMatch{
+		pattern:    pattern,
+		identity:   id,
+		trigger:    trigger,
+		triggerIdx: ti,
+		steps:      make([]ChainStep, len(pattern.Steps)),
+	}
+	for i, step := range pattern.Steps {
+		p.steps[i].PatternStep = step
+	}
+	t := trigger
+	p.steps[ti].Status = StepMatched
+	p.steps[ti].Event = &t
+
+	for i := 0; i < ti; i++ {
+		step := pattern.Steps[i]
+		earliest := trigger.Timestamp.Add(-time.Duration(step.WindowSecs) * time.Second)
+		var found *emitter.CausalEvent
+		contradicted := false
+		for j := len(m.history) - 1; j >= 0; j-- {
+			h := m.history[j]
+			if h.Timestamp.Before(earliest) {
+				break
+			}
+			if !id.relates(identityOf(h)) {
+				continue
+			}
+			if step.Role == "absence" && containsType(step.AbsentEventTypes, h.EventType) {
+				contradicted = true
+				break
+			}
+			if stepMatches(step, h) {
+				found = &h
+				break
+			}
+		}
+		switch {
+		case found != nil:
+			p.steps[i].Status = StepMatched
+			p.steps[i].Event = found
+		case step.Role == "absence" && !contradicted:
+			p.steps[i].Status = StepAbsent
+		case step.Optional:
+			p.steps[i].Status = StepSkipped
+		default:
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+// expire resolves post-trigger steps whose windows have elapsed. Partials
+// with an unmatched required step are dropped, and returned as partial
+// chains if OnPartial asked for them.
+func (m *Matcher) expire() []CausalChain {
+	var completed []CausalChain
+	for key, p := range m.partials {
+		failed := false
+		for i := p.triggerIdx + 1; i < len(p.steps); i++ {
+			s := &p.steps[i]
+			deadline := p.deadline(i)
+			if s.Witnessed {
+				deadline = deadline.Add(AbsenceGrace)
+			}
+			if s.Status != "" || !m.now.After(deadline) {
+				continue
+			}
+			switch {
+			case s.Role == "absence" && !s.Witnessed:
+				s.Status = StepAbsent
+			case s.Optional:
+				s.Status = StepSkipped
+			default:
+				s.Status = StepMissing
+				failed = true
+			}
+		}
+		if failed {
+			delete(m.partials, key)
+			if m.onPartial != nil {
+				for i := range p.steps {
+					if p.steps[i].Status == "" {
+						p.steps[i].Status = StepPending
+					}
+				}
+				chain := p.chain(m.now)
+				chain.ID = fmt.Sprintf("partial-%s-%s", p.pattern.ID, p.trigger.ID)
+				chain.Partial = true
+				completed = append(completed, chain)
+			}
+			continue
+		}
+		if p.resolved() {
+			completed = append(completed, p.chain(m.now))
+			delete(m.partials, key)
+		}
+	}
+	return completed
+}
+
+func (m *Matcher) remember(event emitter.CausalEvent) {
+	m.history = append(m.history, event)
+	cutoff := m.now.Add(-m.lookback)
+	drop := 0
+	for drop < len(m.history) && (m.history[drop].Timestamp.Before(cutoff) || len(m.history)-drop > maxHistory) {
+		drop++
+	}
+	if drop > 0 {
+		m.history = append([]emitter.CausalEvent(nil), m.history[drop:]...)
+	}
+}
+
+func (p *partialMatch) deadline(i int) time.Time {
+	return p.trigger.Timestamp.Add(time.Duration(p.steps[i].WindowSecs) * time.Second)
+}
+
+// observe offers a related event to the first pending post-trigger step it
+// satisfies. It returns false if the event contradicts an absence step.
+func (p *partialMatch) observe(event emitter.CausalEvent) bool {
+	for i := p.triggerIdx + 1; i < len(p.steps); i++ {
+		s := &p.steps[i]
+		if s.Status != "" || event.Timestamp.After(p.deadline(i)) || event.Timestamp.Before(p.trigger.Timestamp) {
+			continue
+		}
+		if s.Role == "absence" && containsType(s.AbsentEventTypes, event.EventType) {
+			return false
+		}
+		if stepMatches(s.PatternStep, event) {
+			e := event
+			s.Status = StepMatched
+			s.Event = &e
+			return true
+		}
+	}
+	return true
+}
+
+func (p *partialMatch) resolved() bool {
+	for _, s := range p.steps {
+		if s.Status == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *partialMatch) chain(now time.Time) CausalChain {
+	started := p.trigger.Timestamp
+	for _, s := range p.steps {
+		if s.Event != nil && s.Event.Timestamp.Before(started) {
+			started = s.Event.Timestamp
+		}
+	}
+	return CausalChain{
+		ID:          fmt.Sprintf("chain-%s-%s", p.pattern.ID, p.trigger.ID),
+		PatternID:   p.pattern.ID,
+		PatternName: p.pattern.Name,
+		Steps:       append([]ChainStep(nil), p.steps...),
+		StartedAt:   started,
+		CompletedAt: now,
+		Confidence:  confidence(p.steps, p.trigger),
+		Trigger:     p.trigger,
+	}
+}
+
+// Event renders the chain as a CausalChainDetected event for the emitter,
+// or a PartialChainExpired event if it is partial.
+func (c CausalChain) Event() emitter.CausalEvent {
+	if c.Partial {
+		return c.partialEvent()
+	}
+	return emitter.CausalEvent{
+		ID:            c.ID,
+		Timestamp:     c.CompletedAt,
+		EventType:     "CausalChainDetected",
+		PatternID:     c.PatternID,
+		PodName:       c.Trigger.PodName,
+		Namespace:     c.Trigger.Namespace,
+		NodeName:      c.Trigger.NodeName,
+		PodUID:        c.Trigger.PodUID,
+		Cluster:       c.Trigger.Cluster,
+		CorrelationID: c.Trigger.CorrelationID,
+		Payload: map[string]interface{}{
+			"chain_id":            c.ID,
+			"pattern_name":        c.PatternName,
+			"trigger_event_id":    c.Trigger.ID,
+			"steps":               c.stepsPayload(),
+			"started_at":          c.StartedAt,
+			"completed_at":        c.CompletedAt,
+			"duration_seconds":    c.CompletedAt.Sub(c.StartedAt).Seconds(),
+			"confidence":          c.Confidence,
+			"remediation_actions": AllPatterns[c.PatternID].RemediationActions,
+		},
+	}
+}
+
+// partialEvent renders a partial chain as a PartialChainExpired event,
+// naming the steps that matched and those that went missing.
+func (c CausalChain) partialEvent() emitter.CausalEvent {
+	matched, missing := []string{}, []string{}
+	for _, s := range c.Steps {
+		switch s.Status {
+		case StepMatched:
+			matched = append(matched, s.EventType)
+		case StepMissing:
+			missing = append(missing, s.EventType)
+		}
+	}
+	return emitter.CausalEvent{
+		ID:            c.ID,
+		Timestamp:     c.CompletedAt,
+		EventType:     "PartialChainExpired",
+		PatternID:     c.PatternID,
+		PodName:       c.Trigger.PodName,
+		Namespace:     c.Trigger.Namespace,
+		NodeName:      c.Trigger.NodeName,
+		PodUID:        c.Trigger.PodUID,
+		Cluster:       c.Trigger.Cluster,
+		CorrelationID: c.Trigger.CorrelationID,
+		Payload: map[string]interface{}{
+			"chain_id":         c.ID,
+			"pattern_name":     c.PatternName,
+			"trigger_event_id": c.Trigger.ID,
+			"steps":            c.stepsPayload(),
+			"matched_steps":    matched,
+			"missing_steps":    missing,
+			"started_at":       c.StartedAt,
+			"expired_at":       c.CompletedAt,
+			"duration_seconds": c.CompletedAt.Sub(c.StartedAt).Seconds(),
+		},
+	}
+}
+
+func (c CausalChain) stepsPayload() []map[string]interface{} {
+	steps := make([]map[string]interface{}, 0, len(c.Steps))
+	for _, s := range c.Steps {
+		step := map[string]interface{}{
+			"event_type": s.EventType,
+			"role":       s.Role,
+			"optional":   s.Optional,
+			"status":     s.Status,
+		}
+		if s.Event != nil {
+			step["event_id"] = s.Event.ID
+			step["timestamp"] = s.Event.Timestamp
+			step["offset_seconds"] = s.Event.Timestamp.Sub(c.Trigger.Timestamp).Seconds()
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func triggerIndex(p CausalPattern) int {
+	for i, s := range p.Steps {
+		if s.Role == "trigger" {
+			return i
+		}
+	}
+	return -1
+}
+
+func stepMatches(step PatternStep, event emitter.CausalEvent) bool {
+	if step.EventType != event.EventType {
+		return false
+	}
+	for k, want := range step.PayloadMatch {
+		if fmt.Sprint(event.Payload[k]) != want {
+			return false
+		}
+	}
+	return true
+}
+
+func containsType(types []string, t string) bool {
+	for _, x := range types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// identity is what the matcher uses to decide that two events concern the
+// same thing: the same pod, else the same ConfigMap, Secret, claim,
+// Service or workload, else the same node, all in the same cluster.
+type identity struct {
+	cluster  string
+	pod      string
+	node     string
+	subjects map[string]bool
+}
+
+func identityOf(e emitter.CausalEvent) identity {
+	id := identity{cluster: e.Cluster, node: e.NodeName, subjects: map[string]bool{}}
+	if e.PodName != "" {
+		id.pod = e.Namespace + "/" + e.PodName
+	}
+	if name, ok := e.Payload["configmap_name"].(string); ok && name != "" {
+		id.subjects["configmap:"+e.Namespace+"/"+name] = true
+	}
+	if name, ok := e.Payload["secret_name"].(string); ok && name != "" {
+		id.subjects["secret:"+e.Namespace+"/"+name] = true
+	}
+	if name, ok := e.Payload["pvc_name"].(string); ok && name != "" {
+		id.subjects["pvc:"+e.Namespace+"/"+name] = true
+	}
+	if name, ok := e.Payload["service_name"].(string); ok && name != "" {
+		id.subjects["service:"+e.Namespace+"/"+name] = true
+	}
+	for _, name := range stringList(e.Payload["backend_services"]) {
+		id.subjects["service:"+e.Namespace+"/"+name] = true
+	}
+	if w, ok := e.Payload["workload"].(string); ok && w != "" {
+		id.subjects["workload:"+e.Namespace+"/"+w] = true
+	}
+	if refs, ok := e.Payload["config_references"].(map[string]interface{}); ok {
+		for _, name := range stringList(refs["configmaps"]) {
+			id.subjects["configmap:"+e.Namespace+"/"+name] = true
+		}
+		for _, name := range stringList(refs["secrets"]) {
+			id.subjects["secret:"+e.Namespace+"/"+name] = true
+		}
+	}
+	return id
+}
+
+func (a identity) relates(b identity) bool {
+	if a.cluster != b.cluster {
+		return false
+	}
+	if a.pod != "" && b.pod != "" {
+		return a.pod == b.pod
+	}
+	for s := range a.subjects {
+		if b.subjects[s] {
+			return true
+		}
+	}
+	return a.node != "" && a.node == b.node
+}
+
+func (a identity) primary(e emitter.CausalEvent) string {
+	switch {
+	case a.pod != "":
+		return "pod:" + a.pod
+	case len(a.subjects) > 0:
+		keys := make([]string, 0, len(a.subjects))
+		for s := range a.subjects {
+			keys = append(keys, s)
+		}
+		sort.Strings(keys)
+		return keys[0]
+	case a.node != "":
+		return "node:" + a.node
+	}
+	return "ns:" + e.Namespace
+}
+
+// stringList accepts both in-process []string payloads and the []interface{}
+// produced when a payload has round-tripped through JSON.
+func stringList(v interface{}) []string {
+	switch l := v.(type) {
+	case []string:
+		return l
+	case []interface{}:
+		out := make([]string, 0, len(l))
+		for _, x := range l {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
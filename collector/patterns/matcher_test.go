@@ -0,0 +1,109 @@
+package patterns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+var t0 = time.Date(2026, 4, 17, 16, 0, 0, 0, time.UTC)
+
+func podEvent(id, eventType string, at time.Duration) emitter.CausalEvent {
+	return emitter.CausalEvent{
+		ID:        id,
+		Timestamp: t0.Add(at),
+		EventType: eventType,
+		PodName:   "api-7d9f-x2x",
+		Namespace: "prod",
+		NodeName:  "node-1",
+		PodUID:    "uid-1",
+		Payload:   map[string]interface{}{"container_name": "api"},
+	}
+}
+
+func oomKillMatcher() (*Matcher, *[]CausalChain, *[]CausalChain) {
+	var chains, partials []CausalChain
+	m := NewMatcher(map[string]CausalPattern{PatternOOMKill: OOMKillPattern}, func(c CausalChain) { chains = append(chains, c) })
+	m.OnPartial(func(c CausalChain) { partials = append(partials, c) })
+	return m, &chains, &partials
+}
+
+func stepStatuses(c CausalChain) map[string]string {
+	out := map[string]string{}
+	for _, s := range c.Steps {
+		out[s.EventType+"/"+s.Role] = s.Status
+	}
+	return out
+}
+
+// The sequence the pod watcher really emits for an OOMKill: node pressure,
+// the OOMKill itself, then the evidence capture. No ContainerTerminated
+// follows, as the OOMKill is the container's termination.
+func TestMatcherOOMKillCompletesP001(t *testing.T) {
+	m, chains, partials := oomKillMatcher()
+	pressure := emitter.CausalEvent{ID: "e1", Timestamp: t0.Add(-time.Minute), EventType: "NodeMemoryPressure", NodeName: "node-1", Payload: map[string]interface{}{}}
+	m.Feed(pressure)
+	m.Feed(podEvent("e2", "OOMKill", 0))
+	m.Feed(podEvent("e3", "OOMKillEvidence", 5*time.Second))
+	if len(*chains) != 0 {
+		t.Fatalf("chain completed before the effect window elapsed: %+v", *chains)
+	}
+	m.Advance(t0.Add(2 * time.Minute))
+
+	if len(*partials) != 0 {
+		t.Fatalf("got partial chains %+v", *partials)
+	}
+	if len(*chains) != 1 {
+		t.Fatalf("got %d chains, want 1", len(*chains))
+	}
+	c := (*chains)[0]
+	if c.PatternID != PatternOOMKill || c.Partial || c.Trigger.ID != "e2" {
+		t.Fatalf("chain = %s partial=%v trigger=%s", c.PatternID, c.Partial, c.Trigger.ID)
+	}
+	want := map[string]string{
+		"ResourceLimitsChanged/precursor": StepSkipped,
+		"HPAScaled/precursor":             StepSkipped,
+		"NodeMemoryPressure/precursor":    StepMatched,
+		"K8sEvent/precursor":              StepSkipped,
+		"OOMKill/trigger":                 StepMatched,
+		"OOMKillEvidence/evidence":        StepMatched,
+		"ContainerTerminated/effect":      StepSkipped,
+	}
+	got := stepStatuses(c)
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("step %s = %q, want %q", k, got[k], v)
+		}
+	}
+	if !c.StartedAt.Equal(pressure.Timestamp) {
+		t.Errorf("StartedAt = %v, want the precursor's %v", c.StartedAt, pressure.Timestamp)
+	}
+}
+
+func TestMatcherOOMKillWithoutEvidenceStillCompletes(t *testing.T) {
+	m, chains, partials := oomKillMatcher()
+	m.Feed(podEvent("e1", "OOMKill", 0))
+	m.Advance(t0.Add(91 * time.Second))
+	if len(*chains) != 1 || len(*partials) != 0 {
+		t.Fatalf("got %d chains and %d partials, want 1 and 0", len(*chains), len(*partials))
+	}
+	if got := stepStatuses((*chains)[0])["OOMKillEvidence/evidence"]; got != StepSkipped {
+		t.Errorf("evidence step = %q, want %q", got, StepSkipped)
+	}
+}
+
+func TestMatcherOOMKillIgnoresOtherPods(t *testing.T) {
+	m, chains, _ := oomKillMatcher()
+	m.Feed(podEvent("e1", "OOMKill", 0))
+	other := podEvent("e2", "OOMKillEvidence", 5*time.Second)
+	other.PodName = "worker-0"
+	m.Feed(other)
+	m.Advance(t0.Add(2 * time.Minute))
+	if len(*chains) != 1 {
+		t.Fatalf("got %d chains, want 1", len(*chains))
+	}
+	if got := stepStatuses((*chains)[0])["OOMKillEvidence/evidence"]; got != StepSkipped {
+		t.Errorf("evidence of another pod matched: step = %q", got)
+	}
+}
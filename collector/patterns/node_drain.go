@@ -0,0 +1,37 @@
+package patterns
+
+// PatternNodeDrain: NodeCordoned → PodEvicted (Eviction API)
+// A node cordoned for maintenance, an upgrade or a cluster autoscaler
+// scale-down is then drained: its pods are evicted through the Eviction
+// API and rescheduled elsewhere. The disruption was planned; telling it
+// apart from pods that crashed or were evicted under pressure is the
+// point.
+const PatternNodeDrain = "P010"
+
+var NodeDrainPattern = CausalPattern{
+	ID:          PatternNodeDrain,
+	Name:        "Node Drain Evicts Pods",
+	Description: "Node cordoned for maintenance or scale-down, its pods evicted through the Eviction API",
+	Steps: []PatternStep{
+		{EventType: "NodeCordoned", Role: "precursor", Optional: false, WindowSecs: 3600, Description: "Node marked unschedulable"},
+		{EventType: "PodEvicted", Role: "trigger", Optional: false, WindowSecs: 0, PayloadMatch: map[string]string{"eviction_source": "eviction_api"}, Description: "Pod evicted off the node through the Eviction API"},
+	},
+	RemediationActions: []string{"confirm_planned_maintenance", "check_pod_disruption_budgets", "uncordon_node_when_done"},
+}
+
+// PatternNoExecuteTaint: NodeTainted (NoExecute) → PodEvicted (taint manager)
+// A NoExecute taint, added by hand or by the node lifecycle controller for
+// a node gone NotReady or unreachable, evicts every pod that does not
+// tolerate it, after its tolerationSeconds if it has any.
+const PatternNoExecuteTaint = "P011"
+
+var NoExecuteTaintPattern = CausalPattern{
+	ID:          PatternNoExecuteTaint,
+	Name:        "NoExecute Taint Evicts Pods",
+	Description: "NoExecute taint added to a node, pods not tolerating it deleted by the taint manager",
+	Steps: []PatternStep{
+		{EventType: "NodeTainted", Role: "precursor", Optional: false, WindowSecs: 3600, PayloadMatch: map[string]string{"taint_effect": "NoExecute"}, Description: "NoExecute taint added to the node"},
+		{EventType: "PodEvicted", Role: "trigger", Optional: false, WindowSecs: 0, PayloadMatch: map[string]string{"eviction_source": "taint_manager"}, Description: "Pod deleted for not tolerating the taint"},
+	},
+	RemediationActions: []string{"check_node_health", "review_pod_tolerations", "remove_taint_if_unintended"},
+}
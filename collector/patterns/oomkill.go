@@ -9,10 +9,17 @@ var OOMKillPattern = CausalPattern{
 	Name:        "OOMKill Causal Chain",
 	Description: "Memory pressure leading to kernel OOMKill and evidence rotation",
 	Steps: []PatternStep{
+		{EventType: "ResourceLimitsChanged", Role: "precursor", Optional: true, WindowSecs: 21600, PayloadMatch: map[string]string{"memory_limit_reduced": "true"}, Description: "Memory limit of the OOMKilled workload lowered by a deploy"},
+		{EventType: "HPAScaled", Role: "precursor", Optional: true, WindowSecs: 600, PayloadMatch: map[string]string{"direction": "up"}, Description: "Autoscaler scale-up of the OOMKilled workload"},
 		{EventType: "NodeMemoryPressure", Role: "precursor", Optional: true, WindowSecs: 300, Description: "Node memory pressure preceding OOMKill"},
+		{EventType: "K8sEvent", Role: "precursor", Optional: true, WindowSecs: 300, PayloadMatch: map[string]string{"reason": "OOMKilling"}, Description: "Node-level kernel OOM reported by node-problem-detector"},
 		{EventType: "OOMKill", Role: "trigger", Optional: false, WindowSecs: 0, Description: "Kernel OOM killer terminates container"},
 		{EventType: "OOMKillEvidence", Role: "evidence", Optional: true, WindowSecs: 90, Description: "LastTerminationState evidence before 90s rotation"},
-		{EventType: "ContainerTerminated", Role: "effect", Optional: false, WindowSecs: 10, Description: "Container restart following OOMKill"},
+		// The OOMKill is itself the container's termination, which the pod
+		// watcher reports as OOMKill and never also as ContainerTerminated,
+		// so a further termination only follows a container killed again
+		// right after its restart and cannot be required.
+		{EventType: "ContainerTerminated", Role: "effect", Optional: true, WindowSecs: 10, Description: "Container terminated again after its OOMKill restart"},
 	},
 	RemediationActions: []string{"increase_memory_limit", "add_vpa_recommendation", "alert_engineering"},
 }
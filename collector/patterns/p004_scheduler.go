@@ -12,18 +12,27 @@ var SchedulerPattern = CausalPattern{
 	Description: "Scheduler placement decisions pruned before downstream failure root cause analysis",
 	Steps: []PatternStep{
 		{
-			EventType:   "SchedulerEvent",
+			EventType:   "PodUnschedulable",
 			Role:        "precursor",
 			Optional:    true,
 			WindowSecs:  3600,
-			Description: "FailedScheduling events: node rejection reasons before 1hr TTL",
+			Description: "PodScheduled=False: insufficient resources against node allocatable",
 		},
 		{
-			EventType:   "SchedulerEvent",
-			Role:        "trigger",
-			Optional:    false,
-			WindowSecs:  0,
-			Description: "Scheduled event: final placement decision captured",
+			EventType:    "SchedulerEvent",
+			Role:         "precursor",
+			Optional:     true,
+			WindowSecs:   3600,
+			Description:  "FailedScheduling events: node rejection reasons before 1hr TTL",
+			PayloadMatch: map[string]string{"reason": "FailedScheduling"},
+		},
+		{
+			EventType:    "SchedulerEvent",
+			Role:         "trigger",
+			Optional:     false,
+			WindowSecs:   0,
+			Description:  "Scheduled event: final placement decision captured",
+			PayloadMatch: map[string]string{"reason": "Scheduled"},
 		},
 		{
 			EventType:   "OOMKill",
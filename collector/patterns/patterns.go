@@ -1,5 +1,7 @@
 package patterns
 
+import "time"
+
 type CausalPattern struct {
 	ID                 string        `json:"id"`
 	Name               string        `json:"name"`
@@ -8,16 +10,56 @@ type CausalPattern struct {
 	RemediationActions []string      `json:"remediation_actions"`
 }
 
+// PatternStep is one link in a causal chain. Steps listed before the trigger
+// are looked up in the recent past (within WindowSecs before the trigger);
+// steps after it must arrive within WindowSecs after the trigger.
 type PatternStep struct {
 	EventType   string `json:"event_type"`
 	Role        string `json:"role"`
 	Optional    bool   `json:"optional"`
 	WindowSecs  int    `json:"window_secs"`
 	Description string `json:"description"`
+
+	// PayloadMatch narrows EventType to events whose payload fields equal
+	// these values, e.g. {"reason": "Scheduled"} for SchedulerEvent.
+	PayloadMatch map[string]string `json:"payload_match,omitempty"`
+
+	// AbsentEventTypes applies to absence steps: the step holds if none of
+	// these event types is observed for the same subject within the window.
+	AbsentEventTypes []string `json:"absent_event_types,omitempty"`
+
+	// Witnessed marks an absence step that a collector component confirms
+	// by emitting EventType, timestamped at the end of the window. The
+	// matcher waits AbsenceGrace past the window for that event and drops
+	// the partial chain if it never arrives, instead of inferring absence
+	// from silence.
+	Witnessed bool `json:"witnessed,omitempty"`
+}
+
+// AbsenceGrace is how long past a witnessed absence window the matcher
+// waits for the confirming event.
+const AbsenceGrace = 15 * time.Second
+
+// AbsenceWindow returns the window of pattern's absence step with the given
+// event type, or zero if there is none.
+func AbsenceWindow(pattern CausalPattern, eventType string) time.Duration {
+	for _, s := range pattern.Steps {
+		if s.Role == "absence" && s.EventType == eventType {
+			return time.Duration(s.WindowSecs) * time.Second
+		}
+	}
+	return 0
 }
 
 var AllPatterns = map[string]CausalPattern{
-	PatternOOMKill:        OOMKillPattern,
-	PatternConfigMapEnv:   ConfigMapEnvPattern,
-	PatternConfigMapMount: ConfigMapMountPattern,
+	PatternOOMKill:         OOMKillPattern,
+	PatternConfigMapEnv:    ConfigMapEnvPattern,
+	PatternConfigMapMount:  ConfigMapMountPattern,
+	PatternSecretEnv:       SecretEnvPattern,
+	PatternVolumeMount:     VolumeMountPattern,
+	PatternJobFailure:      JobFailurePattern,
+	PatternServiceSelector: ServiceSelectorPattern,
+	PatternNodeDrain:       NodeDrainPattern,
+	PatternNoExecuteTaint:  NoExecuteTaintPattern,
+	PatternProbeRestart:    ProbeRestartPattern,
 }
@@ -0,0 +1,21 @@
+package patterns
+
+// PatternProbeRestart: ConfigMapChanged → ProbeTimeoutTightened → ProbeInducedRestart
+// A liveness probe whose timeout was lowered, often alongside a config
+// change that makes the application slower to answer, starts failing, and
+// the kubelet kills the container. The restarts exit with Error and look
+// like the application crashing; the Unhealthy events before each kill
+// say it was the probe.
+const PatternProbeRestart = "P012"
+
+var ProbeRestartPattern = CausalPattern{
+	ID:          PatternProbeRestart,
+	Name:        "Probe-Induced Restart Loop",
+	Description: "Probe timeout tightened, the probe failing and its container restarted as if it had crashed",
+	Steps: []PatternStep{
+		{EventType: "ConfigMapChanged", Role: "precursor", Optional: true, WindowSecs: 3600, Description: "ConfigMap consumed by the pod modified"},
+		{EventType: "ProbeTimeoutTightened", Role: "precursor", Optional: false, WindowSecs: 3600, Description: "Workload's probe timeout lowered"},
+		{EventType: "ProbeInducedRestart", Role: "trigger", Optional: false, WindowSecs: 0, Description: "Container restarted after failing its probe"},
+	},
+	RemediationActions: []string{"raise_probe_timeout", "check_application_latency", "rollback_config_change"},
+}
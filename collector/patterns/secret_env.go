@@ -0,0 +1,18 @@
+package patterns
+
+// PatternSecretEnv: SecretChanged → PodNotRestarted → StaleSecretInEffect
+// The Secret counterpart of P002: a rotated token or credential read through
+// env vars stays in effect until the consuming containers restart.
+const PatternSecretEnv = "P006"
+
+var SecretEnvPattern = CausalPattern{
+	ID:          PatternSecretEnv,
+	Name:        "Secret Env Var Silent Misconfiguration",
+	Description: "Secret rotation not propagated to pods consuming it as env vars",
+	Steps: []PatternStep{
+		{EventType: "SecretChanged", Role: "trigger", Optional: false, WindowSecs: 0, Description: "Secret content changed"},
+		{EventType: "PodNotRestarted", Role: "absence", Optional: false, WindowSecs: 120, Description: "No pod restart observed for env var consumers",
+			AbsentEventTypes: []string{"ContainerTerminated", "DeploymentRolledOut", "WorkloadRolledOut"}, Witnessed: true},
+	},
+	RemediationActions: []string{"rollout_restart_deployment", "alert_secret_rotation_drift"},
+}
@@ -0,0 +1,21 @@
+package patterns
+
+// PatternServiceSelector: ServiceChanged (selector) → EndpointsDrained → TrafficLoss
+// A Service selector edited to labels its pods do not carry (a typo, a
+// relabeled Deployment, a version label bumped on one side only) leaves the
+// Service without endpoints. No pod restarts or fails; requests through
+// the Service and the Ingresses in front of it fail until the selector or
+// the labels are fixed.
+const PatternServiceSelector = "P009"
+
+var ServiceSelectorPattern = CausalPattern{
+	ID:          PatternServiceSelector,
+	Name:        "Service Selector Change Drains Endpoints",
+	Description: "Service selector changed to match no ready pods, endpoints drained, traffic to the Service lost",
+	Steps: []PatternStep{
+		{EventType: "ServiceChanged", Role: "trigger", Optional: false, WindowSecs: 0, PayloadMatch: map[string]string{"selector_changed": "true"}, Description: "Service selector changed"},
+		{EventType: "EndpointsDrained", Role: "effect", Optional: false, WindowSecs: 120, Description: "Service lost its last ready endpoint"},
+		{EventType: "TrafficLoss", Role: "effect", Optional: true, WindowSecs: 600, Description: "No ready endpoint back after the grace period (inferred from endpoints)"},
+	},
+	RemediationActions: []string{"revert_service_selector", "compare_selector_with_pod_labels", "check_ingress_backends"},
+}
@@ -0,0 +1,19 @@
+package patterns
+
+// PatternVolumeMount: PVCStuckPending → VolumeMountFailed → DeploymentStalled
+// A claim that never binds (no matching StorageClass, exhausted quota, a
+// provisioner that is down) leaves every pod using it Pending, and the
+// workload hits its progress deadline without any container ever failing.
+const PatternVolumeMount = "P007"
+
+var VolumeMountPattern = CausalPattern{
+	ID:          PatternVolumeMount,
+	Name:        "Stuck Volume Blocks Workload",
+	Description: "PersistentVolumeClaim not bound or volume not mountable, pods stuck Pending, workload never ready",
+	Steps: []PatternStep{
+		{EventType: "PVCStuckPending", Role: "precursor", Optional: true, WindowSecs: 3600, Description: "Claim Pending past the threshold: provisioning or binding stalled"},
+		{EventType: "VolumeMountFailed", Role: "trigger", Optional: false, WindowSecs: 0, Description: "FailedMount or FailedAttachVolume on a pod using the claim"},
+		{EventType: "DeploymentStalled", Role: "effect", Optional: true, WindowSecs: 900, Description: "Deployment exceeded its progress deadline"},
+	},
+	RemediationActions: []string{"check_storage_class_and_provisioner", "check_volume_attachment", "check_storage_quota"},
+}
@@ -0,0 +1,157 @@
+package patterns
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EvidenceOverride is the key of a namespace window override that sets the
+// OOMKill evidence-capture window rather than a pattern step's.
+const EvidenceOverride = "evidence"
+
+// NamespaceWindows overrides, per namespace, the windows of pattern steps
+// and the evidence-capture window, for namespaces whose workloads run on
+// other timescales than the defaults assume: a batch namespace whose pods
+// restart minutes after a change, next to a serving namespace where
+// anything later than seconds is unrelated. An override applies to the
+// chains triggered in its namespace; steps and namespaces without one
+// keep the pattern's window. A nil *NamespaceWindows overrides nothing.
+type NamespaceWindows struct {
+	steps    map[string]map[stepKey]time.Duration // by namespace
+	evidence map[string]time.Duration             // by namespace
+}
+
+type stepKey struct {
+	pattern   string
+	eventType string
+}
+
+func NewNamespaceWindows() *NamespaceWindows {
+	return &NamespaceWindows{steps: map[string]map[stepKey]time.Duration{}, evidence: map[string]time.Duration{}}
+}
+
+// Set adds one override, written NAMESPACE:PATTERN/EVENT_TYPE=DURATION for
+// the steps of a pattern with that event type, or NAMESPACE:evidence=DURATION
+// for the evidence-capture window, which also widens the pattern steps of
+// the evidence role not overridden themselves:
+//
+//	batch:P002/PodNotRestarted=15m
+//	batch:evidence=3m
+//
+// Durations are whole seconds, as windows are.
+func (w *NamespaceWindows) Set(spec string) error {
+	ns, rest, ok := strings.Cut(spec, ":")
+	key, value, ok2 := strings.Cut(rest, "=")
+	if !ok || !ok2 || ns == "" || key == "" {
+		return fmt.Errorf("namespace window %q: want NAMESPACE:PATTERN/EVENT_TYPE=DURATION or NAMESPACE:%s=DURATION", spec, EvidenceOverride)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("namespace window %q: %w", spec, err)
+	}
+	if d < time.Second || d%time.Second != 0 {
+		return fmt.Errorf("namespace window %q: duration must be a positive whole number of seconds", spec)
+	}
+	if key == EvidenceOverride {
+		w.evidence[ns] = d
+		return nil
+	}
+	pattern, eventType, ok := strings.Cut(key, "/")
+	if !ok || pattern == "" || eventType == "" {
+		return fmt.Errorf("namespace window %q: want PATTERN/EVENT_TYPE before =, got %q", spec, key)
+	}
+	if w.steps[ns] == nil {
+		w.steps[ns] = map[stepKey]time.Duration{}
+	}
+	w.steps[ns][stepKey{pattern, eventType}] = d
+	return nil
+}
+
+// Validate checks that every step override names a step of one of the
+// patterns, and not its trigger, which has no window.
+func (w *NamespaceWindows) Validate(all map[string]CausalPattern) error {
+	if w == nil {
+		return nil
+	}
+	var errs []error
+	for _, ns := range slices.Sorted(maps.Keys(w.steps)) {
+		for k := range w.steps[ns] {
+			p, ok := all[k.pattern]
+			if !ok {
+				errs = append(errs, fmt.Errorf("namespace window %s:%s/%s: unknown pattern %q", ns, k.pattern, k.eventType, k.pattern))
+				continue
+			}
+			found := false
+			for _, s := range p.Steps {
+				if s.EventType == k.eventType && s.Role != "trigger" {
+					found = true
+				}
+			}
+			if !found {
+				errs = append(errs, fmt.Errorf("namespace window %s:%s/%s: pattern %q has no %s step other than its trigger", ns, k.pattern, k.eventType, k.pattern, k.eventType))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Pattern returns pattern with the windows of its steps overridden for
+// namespace. The pattern itself is left as it is.
+func (w *NamespaceWindows) Pattern(pattern CausalPattern, namespace string) CausalPattern {
+	if w == nil {
+		return pattern
+	}
+	steps, evidence := w.steps[namespace], w.evidence[namespace]
+	if len(steps) == 0 && evidence == 0 {
+		return pattern
+	}
+	pattern.Steps = append([]PatternStep(nil), pattern.Steps...)
+	for i := range pattern.Steps {
+		s := &pattern.Steps[i]
+		if s.Role == "trigger" {
+			continue
+		}
+		if d, ok := steps[stepKey{pattern.ID, s.EventType}]; ok {
+			s.WindowSecs = int(d / time.Second)
+		} else if s.Role == "evidence" && evidence > 0 {
+			s.WindowSecs = int(evidence / time.Second)
+		}
+	}
+	return pattern
+}
+
+// AbsenceWindow returns the window of pattern's absence step with the given
+// event type in namespace, or zero if there is none.
+func (w *NamespaceWindows) AbsenceWindow(pattern CausalPattern, eventType, namespace string) time.Duration {
+	return AbsenceWindow(w.Pattern(pattern, namespace), eventType)
+}
+
+// EvidenceWindow returns the evidence-capture window of namespace, def
+// unless overridden.
+func (w *NamespaceWindows) EvidenceWindow(namespace string, def time.Duration) time.Duration {
+	if w == nil {
+		return def
+	}
+	if d, ok := w.evidence[namespace]; ok {
+		return d
+	}
+	return def
+}
+
+// longest returns the longest step window overridden in any namespace.
+func (w *NamespaceWindows) longest() time.Duration {
+	var longest time.Duration
+	if w == nil {
+		return longest
+	}
+	for _, steps := range w.steps {
+		for _, d := range steps {
+			longest = max(longest, d)
+		}
+	}
+	return longest
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// permission is one verb on one resource that an enabled watcher needs.
+// namespace is "" for cluster-scoped resources and for watches across all
+// namespaces; both can only be granted by a ClusterRole.
+type permission struct {
+	namespace   string
+	group       string
+	resource    string
+	subresource string
+	verb        string
+}
+
+// preflightFeatures are the optional features that need permissions of
+// their own.
+type preflightFeatures struct {
+	captureLogs    bool
+	nodeProxy      bool
+	sampling       bool
+	leaderElect    bool
+	leaseNamespace string
+	namespaceWatch bool
+	allPods        bool
+}
+
+// requiredPermissions lists what the watchers main starts will call, per
+// watched namespace. Keep it in step with the watchers: a missing entry
+// only shows up later as a watch failing with Forbidden.
+func requiredPermissions(namespaces []string, f preflightFeatures) []permission {
+	var perms []permission
+	add := func(namespace, group, resource, subresource string, verbs ...string) {
+		for _, v := range verbs {
+			perms = append(perms, permission{namespace, group, resource, subresource, v})
+		}
+	}
+	add("", "", "nodes", "", "get", "list", "watch")
+	if f.nodeProxy {
+		add("", "", "nodes", "proxy", "get")
+	}
+	if f.allPods {
+		add("", "", "pods", "", "list", "watch")
+	}
+	if f.namespaceWatch {
+		add("", "", "namespaces", "", "list", "watch")
+	}
+	for _, ns := range namespaces {
+		add(ns, "", "pods", "", "get", "list", "watch")
+		add(ns, "", "configmaps", "", "list", "watch")
+		add(ns, "", "secrets", "", "list", "watch")
+		add(ns, "", "events", "", "list", "watch")
+		add(ns, "", "persistentvolumeclaims", "", "get", "list", "watch")
+		add(ns, "apps", "deployments", "", "list", "watch")
+		add(ns, "apps", "statefulsets", "", "list", "watch")
+		add(ns, "apps", "daemonsets", "", "list", "watch")
+		add(ns, "apps", "replicasets", "", "get", "list", "watch")
+		add(ns, "autoscaling", "horizontalpodautoscalers", "", "list", "watch")
+		add(ns, "batch", "jobs", "", "list", "watch")
+		add(ns, "", "services", "", "list", "watch")
+		add(ns, "discovery.k8s.io", "endpointslices", "", "list", "watch")
+		add(ns, "networking.k8s.io", "ingresses", "", "list", "watch")
+		if f.captureLogs {
+			add(ns, "", "pods", "log", "get")
+		}
+		if f.sampling {
+			add(ns, "metrics.k8s.io", "pods", "", "list")
+		}
+	}
+	if f.leaderElect {
+		add(f.leaseNamespace, "coordination.k8s.io", "leases", "", "get", "create", "update")
+	}
+	return perms
+}
+
+// checkPermissions asks the API server, with one SelfSubjectAccessReview
+// per permission, which of perms the collector's identity lacks.
+func checkPermissions(ctx context.Context, client kubernetes.Interface, perms []permission) ([]permission, error) {
+	var missing []permission
+	for _, p := range perms {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   p.namespace,
+					Group:       p.group,
+					Resource:    p.resource,
+					Subresource: p.subresource,
+					Verb:        p.verb,
+				},
+			},
+		}
+		res, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("access review for %s %s failed: %w", p.verb, p.qualifiedResource(), err)
+		}
+		if !res.Status.Allowed {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+func (p permission) qualifiedResource() string {
+	r := p.resource
+	if p.group != "" {
+		r += "." + p.group
+	}
+	if p.subresource != "" {
+		r += "/" + p.subresource
+	}
+	return r
+}
+
+// rbacRule is one PolicyRule granting the missing verbs on one resource,
+// and the Role or ClusterRole it belongs in.
+type rbacRule struct {
+	namespace string // "" for a ClusterRole
+	group     string
+	resource  string
+	verbs     []string
+}
+
+// rules folds missing permissions into the rules to add, one per resource
+// and scope, in the order the permissions were listed.
+func rules(missing []permission) []*rbacRule {
+	var out []*rbacRule
+	byKey := map[permission]*rbacRule{}
+	for _, p := range missing {
+		resource := p.resource
+		if p.subresource != "" {
+			resource += "/" + p.subresource
+		}
+		key := permission{namespace: p.namespace, group: p.group, resource: resource}
+		r, ok := byKey[key]
+		if !ok {
+			r = &rbacRule{namespace: p.namespace, group: p.group, resource: resource}
+			byKey[key] = r
+			out = append(out, r)
+		}
+		r.verbs = append(r.verbs, p.verb)
+	}
+	return out
+}
+
+func (r *rbacRule) role() string {
+	if r.namespace == "" {
+		return "ClusterRole"
+	}
+	return "Role in namespace " + r.namespace
+}
+
+// String renders the rule as a YAML flow mapping, ready to paste into the
+// rules of a Role or ClusterRole.
+func (r *rbacRule) String() string {
+	return fmt.Sprintf("{apiGroups: ['%s'], resources: ['%s'], verbs: [%s]}", r.group, r.resource, strings.Join(r.verbs, ", "))
+}
+
+// preflightRBAC checks that the collector may make every call the enabled
+// watchers need, before any of them starts, and logs the exact rule to add
+// for each one it may not. Without it a missing permission half-starts the
+// collector: the watchers that are allowed run, the rest fail with a
+// Forbidden wrapped several layers deep. It returns an error if anything
+// is missing.
+func preflightRBAC(ctx context.Context, client kubernetes.Interface, namespaces []string, f preflightFeatures, log *slog.Logger) error {
+	log = log.With("component", "rbac_preflight")
+	missing, err := checkPermissions(ctx, client, requiredPermissions(namespaces, f))
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		log.Info("all required permissions granted")
+		return nil
+	}
+	rs := rules(missing)
+	for _, r := range rs {
+		log.Error("missing RBAC permission", "add_to", r.role(), "rule", r.String())
+	}
+	return fmt.Errorf("%d RBAC rules missing for the collector's ServiceAccount; add the rules logged above", len(rs))
+}
@@ -0,0 +1,581 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        v5.28.3
+// source: causal.proto
+
+package streampb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// SubscribeRequest filters the stream. Empty lists match everything.
+type SubscribeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// event_types applies to events only.
+	EventTypes []string `protobuf:"bytes,1,rep,name=event_types,json=eventTypes,proto3" json:"event_types,omitempty"`
+	// Namespaces also filter snapshots; cluster-scoped records (nodes) have no
+	// namespace and only match an empty list.
+	Namespaces       []string `protobuf:"bytes,2,rep,name=namespaces,proto3" json:"namespaces,omitempty"`
+	IncludeSnapshots bool     `protobuf:"varint,3,opt,name=include_snapshots,json=includeSnapshots,proto3" json:"include_snapshots,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_causal_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_causal_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_causal_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubscribeRequest) GetEventTypes() []string {
+	if x != nil {
+		return x.EventTypes
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetNamespaces() []string {
+	if x != nil {
+		return x.Namespaces
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetIncludeSnapshots() bool {
+	if x != nil {
+		return x.IncludeSnapshots
+	}
+	return false
+}
+
+type Record struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Record:
+	//
+	//	*Record_Event
+	//	*Record_Snapshot
+	Record isRecord_Record `protobuf_oneof:"record"`
+	// dropped is how many records this subscriber has missed so far because
+	// it fell behind. A change between two records marks a gap.
+	Dropped       uint64 `protobuf:"varint,3,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Record) Reset() {
+	*x = Record{}
+	mi := &file_causal_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Record) ProtoMessage() {}
+
+func (x *Record) ProtoReflect() protoreflect.Message {
+	mi := &file_causal_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Record.ProtoReflect.Descriptor instead.
+func (*Record) Descriptor() ([]byte, []int) {
+	return file_causal_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Record) GetRecord() isRecord_Record {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+func (x *Record) GetEvent() *CausalEvent {
+	if x != nil {
+		if x, ok := x.Record.(*Record_Event); ok {
+			return x.Event
+		}
+	}
+	return nil
+}
+
+func (x *Record) GetSnapshot() *Snapshot {
+	if x != nil {
+		if x, ok := x.Record.(*Record_Snapshot); ok {
+			return x.Snapshot
+		}
+	}
+	return nil
+}
+
+func (x *Record) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+type isRecord_Record interface {
+	isRecord_Record()
+}
+
+type Record_Event struct {
+	Event *CausalEvent `protobuf:"bytes,1,opt,name=event,proto3,oneof"`
+}
+
+type Record_Snapshot struct {
+	Snapshot *Snapshot `protobuf:"bytes,2,opt,name=snapshot,proto3,oneof"`
+}
+
+func (*Record_Event) isRecord_Record() {}
+
+func (*Record_Snapshot) isRecord_Record() {}
+
+type CausalEvent struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	SchemaVersion    string                 `protobuf:"bytes,2,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	CollectorVersion string                 `protobuf:"bytes,3,opt,name=collector_version,json=collectorVersion,proto3" json:"collector_version,omitempty"`
+	Timestamp        *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	EventType        string                 `protobuf:"bytes,5,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`
+	PatternId        string                 `protobuf:"bytes,6,opt,name=pattern_id,json=patternId,proto3" json:"pattern_id,omitempty"`
+	PodName          string                 `protobuf:"bytes,7,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	Namespace        string                 `protobuf:"bytes,8,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	NodeName         string                 `protobuf:"bytes,9,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	PodUid           string                 `protobuf:"bytes,10,opt,name=pod_uid,json=podUid,proto3" json:"pod_uid,omitempty"`
+	Payload          *structpb.Struct       `protobuf:"bytes,11,opt,name=payload,proto3" json:"payload,omitempty"`
+	// correlation_id is shared by the events of one incident, related to one
+	// another within a pattern window.
+	CorrelationId string `protobuf:"bytes,12,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	// occurred_at is when the change happened, by the source object's own
+	// record of it; sort by it to reconstruct cause before effect.
+	// emitted_at is when the collector emitted the event.
+	OccurredAt *timestamppb.Timestamp `protobuf:"bytes,13,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"`
+	EmittedAt  *timestamppb.Timestamp `protobuf:"bytes,14,opt,name=emitted_at,json=emittedAt,proto3" json:"emitted_at,omitempty"`
+	// cluster is the kubeconfig context of the cluster the event came from,
+	// when the collector watches more than one.
+	Cluster       string `protobuf:"bytes,15,opt,name=cluster,proto3" json:"cluster,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CausalEvent) Reset() {
+	*x = CausalEvent{}
+	mi := &file_causal_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CausalEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CausalEvent) ProtoMessage() {}
+
+func (x *CausalEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_causal_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CausalEvent.ProtoReflect.Descriptor instead.
+func (*CausalEvent) Descriptor() ([]byte, []int) {
+	return file_causal_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CausalEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetSchemaVersion() string {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetCollectorVersion() string {
+	if x != nil {
+		return x.CollectorVersion
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *CausalEvent) GetEventType() string {
+	if x != nil {
+		return x.EventType
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetPatternId() string {
+	if x != nil {
+		return x.PatternId
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetPodName() string {
+	if x != nil {
+		return x.PodName
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetPodUid() string {
+	if x != nil {
+		return x.PodUid
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetPayload() *structpb.Struct {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *CausalEvent) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *CausalEvent) GetOccurredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return nil
+}
+
+func (x *CausalEvent) GetEmittedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EmittedAt
+	}
+	return nil
+}
+
+func (x *CausalEvent) GetCluster() string {
+	if x != nil {
+		return x.Cluster
+	}
+	return ""
+}
+
+type Snapshot struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	SchemaVersion    string                 `protobuf:"bytes,2,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	CollectorVersion string                 `protobuf:"bytes,3,opt,name=collector_version,json=collectorVersion,proto3" json:"collector_version,omitempty"`
+	Timestamp        *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	ObjectKind       string                 `protobuf:"bytes,5,opt,name=object_kind,json=objectKind,proto3" json:"object_kind,omitempty"`
+	ObjectName       string                 `protobuf:"bytes,6,opt,name=object_name,json=objectName,proto3" json:"object_name,omitempty"`
+	Namespace        string                 `protobuf:"bytes,7,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	TriggerEvent     string                 `protobuf:"bytes,8,opt,name=trigger_event,json=triggerEvent,proto3" json:"trigger_event,omitempty"`
+	State            *structpb.Struct       `protobuf:"bytes,9,opt,name=state,proto3" json:"state,omitempty"`
+	Cluster          string                 `protobuf:"bytes,10,opt,name=cluster,proto3" json:"cluster,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_causal_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_causal_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_causal_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Snapshot) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Snapshot) GetSchemaVersion() string {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return ""
+}
+
+func (x *Snapshot) GetCollectorVersion() string {
+	if x != nil {
+		return x.CollectorVersion
+	}
+	return ""
+}
+
+func (x *Snapshot) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Snapshot) GetObjectKind() string {
+	if x != nil {
+		return x.ObjectKind
+	}
+	return ""
+}
+
+func (x *Snapshot) GetObjectName() string {
+	if x != nil {
+		return x.ObjectName
+	}
+	return ""
+}
+
+func (x *Snapshot) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *Snapshot) GetTriggerEvent() string {
+	if x != nil {
+		return x.TriggerEvent
+	}
+	return ""
+}
+
+func (x *Snapshot) GetState() *structpb.Struct {
+	if x != nil {
+		return x.State
+	}
+	return nil
+}
+
+func (x *Snapshot) GetCluster() string {
+	if x != nil {
+		return x.Cluster
+	}
+	return ""
+}
+
+var File_causal_proto protoreflect.FileDescriptor
+
+const file_causal_proto_rawDesc = "" +
+	"\n" +
+	"\fcausal.proto\x12\x06oma.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x80\x01\n" +
+	"\x10SubscribeRequest\x12\x1f\n" +
+	"\vevent_types\x18\x01 \x03(\tR\n" +
+	"eventTypes\x12\x1e\n" +
+	"\n" +
+	"namespaces\x18\x02 \x03(\tR\n" +
+	"namespaces\x12+\n" +
+	"\x11include_snapshots\x18\x03 \x01(\bR\x10includeSnapshots\"\x89\x01\n" +
+	"\x06Record\x12+\n" +
+	"\x05event\x18\x01 \x01(\v2\x13.oma.v1.CausalEventH\x00R\x05event\x12.\n" +
+	"\bsnapshot\x18\x02 \x01(\v2\x10.oma.v1.SnapshotH\x00R\bsnapshot\x12\x18\n" +
+	"\adropped\x18\x03 \x01(\x04R\adroppedB\b\n" +
+	"\x06record\"\xc4\x04\n" +
+	"\vCausalEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12%\n" +
+	"\x0eschema_version\x18\x02 \x01(\tR\rschemaVersion\x12+\n" +
+	"\x11collector_version\x18\x03 \x01(\tR\x10collectorVersion\x128\n" +
+	"\ttimestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1d\n" +
+	"\n" +
+	"event_type\x18\x05 \x01(\tR\teventType\x12\x1d\n" +
+	"\n" +
+	"pattern_id\x18\x06 \x01(\tR\tpatternId\x12\x19\n" +
+	"\bpod_name\x18\a \x01(\tR\apodName\x12\x1c\n" +
+	"\tnamespace\x18\b \x01(\tR\tnamespace\x12\x1b\n" +
+	"\tnode_name\x18\t \x01(\tR\bnodeName\x12\x17\n" +
+	"\apod_uid\x18\n" +
+	" \x01(\tR\x06podUid\x121\n" +
+	"\apayload\x18\v \x01(\v2\x17.google.protobuf.StructR\apayload\x12%\n" +
+	"\x0ecorrelation_id\x18\f \x01(\tR\rcorrelationId\x12;\n" +
+	"\voccurred_at\x18\r \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"occurredAt\x129\n" +
+	"\n" +
+	"emitted_at\x18\x0e \x01(\v2\x1a.google.protobuf.TimestampR\temittedAt\x12\x18\n" +
+	"\acluster\x18\x0f \x01(\tR\acluster\"\xf6\x02\n" +
+	"\bSnapshot\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12%\n" +
+	"\x0eschema_version\x18\x02 \x01(\tR\rschemaVersion\x12+\n" +
+	"\x11collector_version\x18\x03 \x01(\tR\x10collectorVersion\x128\n" +
+	"\ttimestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1f\n" +
+	"\vobject_kind\x18\x05 \x01(\tR\n" +
+	"objectKind\x12\x1f\n" +
+	"\vobject_name\x18\x06 \x01(\tR\n" +
+	"objectName\x12\x1c\n" +
+	"\tnamespace\x18\a \x01(\tR\tnamespace\x12#\n" +
+	"\rtrigger_event\x18\b \x01(\tR\ftriggerEvent\x12-\n" +
+	"\x05state\x18\t \x01(\v2\x17.google.protobuf.StructR\x05state\x12\x18\n" +
+	"\acluster\x18\n" +
+	" \x01(\tR\acluster2G\n" +
+	"\fCausalStream\x127\n" +
+	"\tSubscribe\x12\x18.oma.v1.SubscribeRequest\x1a\x0e.oma.v1.Record0\x01B9Z7github.com/opscart/k8s-causal-memory/collector/streampbb\x06proto3"
+
+var (
+	file_causal_proto_rawDescOnce sync.Once
+	file_causal_proto_rawDescData []byte
+)
+
+func file_causal_proto_rawDescGZIP() []byte {
+	file_causal_proto_rawDescOnce.Do(func() {
+		file_causal_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_causal_proto_rawDesc), len(file_causal_proto_rawDesc)))
+	})
+	return file_causal_proto_rawDescData
+}
+
+var file_causal_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_causal_proto_goTypes = []any{
+	(*SubscribeRequest)(nil),      // 0: oma.v1.SubscribeRequest
+	(*Record)(nil),                // 1: oma.v1.Record
+	(*CausalEvent)(nil),           // 2: oma.v1.CausalEvent
+	(*Snapshot)(nil),              // 3: oma.v1.Snapshot
+	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),       // 5: google.protobuf.Struct
+}
+var file_causal_proto_depIdxs = []int32{
+	2, // 0: oma.v1.Record.event:type_name -> oma.v1.CausalEvent
+	3, // 1: oma.v1.Record.snapshot:type_name -> oma.v1.Snapshot
+	4, // 2: oma.v1.CausalEvent.timestamp:type_name -> google.protobuf.Timestamp
+	5, // 3: oma.v1.CausalEvent.payload:type_name -> google.protobuf.Struct
+	4, // 4: oma.v1.CausalEvent.occurred_at:type_name -> google.protobuf.Timestamp
+	4, // 5: oma.v1.CausalEvent.emitted_at:type_name -> google.protobuf.Timestamp
+	4, // 6: oma.v1.Snapshot.timestamp:type_name -> google.protobuf.Timestamp
+	5, // 7: oma.v1.Snapshot.state:type_name -> google.protobuf.Struct
+	0, // 8: oma.v1.CausalStream.Subscribe:input_type -> oma.v1.SubscribeRequest
+	1, // 9: oma.v1.CausalStream.Subscribe:output_type -> oma.v1.Record
+	9, // [9:10] is the sub-list for method output_type
+	8, // [8:9] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_causal_proto_init() }
+func file_causal_proto_init() {
+	if File_causal_proto != nil {
+		return
+	}
+	file_causal_proto_msgTypes[1].OneofWrappers = []any{
+		(*Record_Event)(nil),
+		(*Record_Snapshot)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_causal_proto_rawDesc), len(file_causal_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_causal_proto_goTypes,
+		DependencyIndexes: file_causal_proto_depIdxs,
+		MessageInfos:      file_causal_proto_msgTypes,
+	}.Build()
+	File_causal_proto = out.File
+	file_causal_proto_goTypes = nil
+	file_causal_proto_depIdxs = nil
+}
@@ -0,0 +1,136 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: causal.proto
+
+package streampb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CausalStream_Subscribe_FullMethodName = "/oma.v1.CausalStream/Subscribe"
+)
+
+// CausalStreamClient is the client API for CausalStream service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CausalStream pushes causal events and snapshots to live consumers as the
+// collector emits them. Records mirror the JSONL schema (oma.v1): payload
+// and state are carried as google.protobuf.Struct with the same keys.
+type CausalStreamClient interface {
+	// Subscribe streams records accepted by the collector from the moment of
+	// subscription. There is no replay of earlier records.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Record], error)
+}
+
+type causalStreamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCausalStreamClient(cc grpc.ClientConnInterface) CausalStreamClient {
+	return &causalStreamClient{cc}
+}
+
+func (c *causalStreamClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Record], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CausalStream_ServiceDesc.Streams[0], CausalStream_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Record]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CausalStream_SubscribeClient = grpc.ServerStreamingClient[Record]
+
+// CausalStreamServer is the server API for CausalStream service.
+// All implementations must embed UnimplementedCausalStreamServer
+// for forward compatibility.
+//
+// CausalStream pushes causal events and snapshots to live consumers as the
+// collector emits them. Records mirror the JSONL schema (oma.v1): payload
+// and state are carried as google.protobuf.Struct with the same keys.
+type CausalStreamServer interface {
+	// Subscribe streams records accepted by the collector from the moment of
+	// subscription. There is no replay of earlier records.
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Record]) error
+	mustEmbedUnimplementedCausalStreamServer()
+}
+
+// UnimplementedCausalStreamServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCausalStreamServer struct{}
+
+func (UnimplementedCausalStreamServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Record]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedCausalStreamServer) mustEmbedUnimplementedCausalStreamServer() {}
+func (UnimplementedCausalStreamServer) testEmbeddedByValue()                      {}
+
+// UnsafeCausalStreamServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CausalStreamServer will
+// result in compilation errors.
+type UnsafeCausalStreamServer interface {
+	mustEmbedUnimplementedCausalStreamServer()
+}
+
+func RegisterCausalStreamServer(s grpc.ServiceRegistrar, srv CausalStreamServer) {
+	// If the following call pancis, it indicates UnimplementedCausalStreamServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CausalStream_ServiceDesc, srv)
+}
+
+func _CausalStream_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CausalStreamServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, Record]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CausalStream_SubscribeServer = grpc.ServerStreamingServer[Record]
+
+// CausalStream_ServiceDesc is the grpc.ServiceDesc for CausalStream service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CausalStream_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "oma.v1.CausalStream",
+	HandlerType: (*CausalStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _CausalStream_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "causal.proto",
+}
@@ -0,0 +1,227 @@
+// Package tracing exports detected causal chains as OpenTelemetry traces,
+// so incident causality can be browsed in an existing tracing UI. Each
+// chain is one trace: a root span named after the pattern ID covering the
+// whole chain, with one child span per pattern step.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// ChainExporter turns CausalChains into spans sent over OTLP/gRPC.
+//
+// A nil *ChainExporter is valid and exports nothing.
+type ChainExporter struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	log      *slog.Logger
+}
+
+// NewChainExporter connects to an OTLP/gRPC collector at endpoint
+// (host:port). The connection is made lazily; an unreachable endpoint
+// only shows up as export errors later.
+func NewChainExporter(ctx context.Context, endpoint string, insecure bool, log *slog.Logger) (*ChainExporter, error) {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exp, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "k8s-causal-memory-collector"),
+		attribute.String("service.version", emitter.CollectorVersion),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithIDGenerator(chainIDs{}),
+	)
+	log = log.With("component", "tracing")
+	log.Info("exporting causal chains", "endpoint", endpoint, "insecure", insecure)
+	return &ChainExporter{provider: provider, tracer: provider.Tracer("github.com/opscart/k8s-causal-memory/collector"), log: log}, nil
+}
+
+// Export records one chain as a trace. Span times are the timestamps of
+// the matched events, not the time of export:
+//
+//   - the root span runs from the chain's StartedAt to its CompletedAt;
+//   - a matched step starts at its event and ends at the next matched
+//     step's event, the last one at CompletedAt;
+//   - an absence step with no event covers its window after the trigger;
+//   - a skipped optional step is a zero-length span at the trigger.
+func (x *ChainExporter) Export(chain patterns.CausalChain) {
+	if x == nil {
+		return
+	}
+	ctx := context.WithValue(context.Background(), traceIDKey{}, chain.ID)
+	common := []attribute.KeyValue{
+		attribute.String("oma.pattern.id", chain.PatternID),
+		attribute.String("oma.chain.id", chain.ID),
+	}
+	if chain.Trigger.CorrelationID != "" {
+		common = append(common, attribute.String("oma.correlation.id", chain.Trigger.CorrelationID))
+	}
+	common = append(common, subject(chain.Trigger)...)
+
+	ctx, root := x.tracer.Start(ctx, chain.PatternID,
+		trace.WithTimestamp(chain.StartedAt),
+		trace.WithAttributes(common...),
+		trace.WithAttributes(
+			attribute.String("oma.pattern.name", chain.PatternName),
+			attribute.Float64("oma.chain.confidence", chain.Confidence),
+		),
+	)
+	for i, step := range chain.Steps {
+		start, end := stepSpan(chain, i)
+		attrs := []attribute.KeyValue{
+			attribute.String("oma.step.event_type", step.EventType),
+			attribute.String("oma.step.role", step.Role),
+			attribute.String("oma.step.status", step.Status),
+			attribute.Bool("oma.step.optional", step.Optional),
+		}
+		if step.Event != nil {
+			attrs = append(attrs, attribute.String("oma.event.id", step.Event.ID))
+			attrs = append(attrs, subject(*step.Event)...)
+			attrs = append(attrs, payloadAttributes(step.Event.Payload)...)
+		}
+		_, span := x.tracer.Start(ctx, step.Role+" "+step.EventType,
+			trace.WithTimestamp(start),
+			trace.WithAttributes(attrs...),
+		)
+		span.End(trace.WithTimestamp(end))
+	}
+	root.End(trace.WithTimestamp(chain.CompletedAt))
+}
+
+// Shutdown flushes spans still batched and closes the exporter.
+func (x *ChainExporter) Shutdown(ctx context.Context) {
+	if x == nil {
+		return
+	}
+	if err := x.provider.Shutdown(ctx); err != nil {
+		x.log.Error("shutdown failed", "err", err)
+	}
+}
+
+func stepSpan(chain patterns.CausalChain, i int) (time.Time, time.Time) {
+	step := chain.Steps[i]
+	anchor := chain.Trigger.Timestamp
+	switch {
+	case step.Event != nil:
+		start := step.Event.Timestamp
+		end := chain.CompletedAt
+		for _, next := range chain.Steps[i+1:] {
+			if next.Event != nil {
+				end = next.Event.Timestamp
+				break
+			}
+		}
+		return start, later(start, end)
+	case step.Role == "absence":
+		end := anchor.Add(time.Duration(step.WindowSecs) * time.Second)
+		if end.After(chain.CompletedAt) {
+			end = chain.CompletedAt
+		}
+		return anchor, later(anchor, end)
+	default:
+		return anchor, anchor
+	}
+}
+
+func later(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return a
+	}
+	return b
+}
+
+// subject maps the event's pod, namespace and node onto the OpenTelemetry
+// Kubernetes semantic conventions.
+func subject(e emitter.CausalEvent) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, kv := range []struct{ key, value string }{
+		{"k8s.pod.name", e.PodName},
+		{"k8s.pod.uid", e.PodUID},
+		{"k8s.namespace.name", e.Namespace},
+		{"k8s.node.name", e.NodeName},
+	} {
+		if kv.value != "" {
+			attrs = append(attrs, attribute.String(kv.key, kv.value))
+		}
+	}
+	return attrs
+}
+
+// payloadAttributes carries the scalar payload fields over as
+// oma.payload.<field>. Nested values (node_state, resource maps) are left
+// out; they stay in the event record.
+func payloadAttributes(payload map[string]interface{}) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for k, v := range payload {
+		key := "oma.payload." + k
+		switch v := v.(type) {
+		case string:
+			attrs = append(attrs, attribute.String(key, v))
+		case bool:
+			attrs = append(attrs, attribute.Bool(key, v))
+		case int:
+			attrs = append(attrs, attribute.Int(key, v))
+		case int32:
+			attrs = append(attrs, attribute.Int64(key, int64(v)))
+		case int64:
+			attrs = append(attrs, attribute.Int64(key, v))
+		case float64:
+			attrs = append(attrs, attribute.Float64(key, v))
+		case time.Time:
+			attrs = append(attrs, attribute.String(key, v.UTC().Format(time.RFC3339Nano)))
+		}
+	}
+	return attrs
+}
+
+type traceIDKey struct{}
+
+// chainIDs derives the trace ID from a hash of the chain ID, so the trace
+// of a CausalChainDetected record can be found from its chain_id alone.
+// Span IDs are random.
+type chainIDs struct{}
+
+func (chainIDs) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	var tid trace.TraceID
+	if id, ok := ctx.Value(traceIDKey{}).(string); ok {
+		sum := sha256.Sum256([]byte(id))
+		copy(tid[:], sum[:])
+	}
+	if !tid.IsValid() {
+		rand.Read(tid[:])
+	}
+	return tid, newSpanID()
+}
+
+func (chainIDs) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	return newSpanID()
+}
+
+func newSpanID() trace.SpanID {
+	var sid trace.SpanID
+	for !sid.IsValid() {
+		rand.Read(sid[:])
+	}
+	return sid
+}
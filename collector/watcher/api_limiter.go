@@ -0,0 +1,145 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// Defaults for the per-event API calls: the rate they may be made at, the
+// burst above it, and how long one may wait for its turn and its answer
+// together.
+const (
+	DefaultAPICallQPS     = 10
+	DefaultAPICallBurst   = 20
+	DefaultAPICallTimeout = 2 * time.Second
+)
+
+// throttleReportInterval is how often APIThrottled is reported for one
+// operation while its calls keep being throttled; those in between are
+// counted.
+const throttleReportInterval = time.Minute
+
+// errThrottled marks a call the APILimiter gave up on. Callers fall back to
+// what they have cached, and leave the reporting to the limiter.
+var errThrottled = errors.New("API call throttled")
+
+// APILimiter paces the API calls watchers make while handling an event,
+// such as fetching the node of a terminated container, apart from the
+// watches themselves. During an event storm these would otherwise queue
+// behind the client's own rate limiter, or be throttled by the API
+// server's priority and fairness, and stall the handler and every event
+// behind it. A call waits for its turn and its answer no longer than the
+// timeout; given up on, or rejected with 429 Too Many Requests, it is
+// reported as an APIThrottled meta event and the caller falls back to
+// cached data. A nil *APILimiter makes calls unpaced, with no timeout.
+type APILimiter struct {
+	limiter flowcontrol.RateLimiter
+	qps     float32
+	burst   int
+	timeout time.Duration
+	emitter emitter.Emitter
+	log     *slog.Logger
+
+	mu      sync.Mutex
+	reports map[string]*throttleReport // per watcher and operation
+}
+
+type throttleReport struct {
+	reportedAt time.Time
+	throttled  int // calls throttled since reportedAt
+}
+
+func NewAPILimiter(e emitter.Emitter, log *slog.Logger, qps float32, burst int, timeout time.Duration) *APILimiter {
+	if timeout <= 0 {
+		timeout = DefaultAPICallTimeout
+	}
+	return &APILimiter{
+		limiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+		qps:     qps,
+		burst:   burst,
+		timeout: timeout,
+		emitter: e,
+		log:     log.With("component", "api_limiter"),
+		reports: map[string]*throttleReport{},
+	}
+}
+
+// call makes one API call through fn, once the rate allows, with a context
+// bounded by the timeout. A call throttled, by the limiter, the timeout or
+// the API server, returns an error wrapping errThrottled. object names
+// what the call fetches.
+func (l *APILimiter) call(ctx context.Context, watcher, operation, object string, fn func(context.Context) error) error {
+	if l == nil {
+		return fn(ctx)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	var cause string
+	err := l.limiter.Wait(callCtx)
+	if err != nil {
+		cause = "rate_limit"
+	} else {
+		err = fn(callCtx)
+		switch {
+		case apierrors.IsTooManyRequests(err):
+			cause = "api_server"
+		case err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded):
+			cause = "timeout"
+		}
+	}
+	// Shutting down is not throttling.
+	if cause == "" || ctx.Err() != nil {
+		return err
+	}
+	l.throttled(watcher, operation, object, cause, err)
+	return fmt.Errorf("%w: %w", errThrottled, err)
+}
+
+func (l *APILimiter) throttled(watcher, operation, object, cause string, err error) {
+	metrics.APIThrottled.WithLabelValues(cause).Inc()
+	now := time.Now()
+	key := watcher + "/" + operation
+	l.mu.Lock()
+	r := l.reports[key]
+	if r == nil {
+		r = &throttleReport{}
+		l.reports[key] = r
+	}
+	r.throttled++
+	if now.Sub(r.reportedAt) < throttleReportInterval {
+		l.mu.Unlock()
+		return
+	}
+	throttled := r.throttled
+	r.reportedAt, r.throttled = now, 0
+	l.mu.Unlock()
+
+	l.log.Warn("API calls throttled, falling back to cache", "watcher", watcher, "operation", operation,
+		"cause", cause, "throttled", throttled, "err", err)
+	l.emitter.EmitMeta(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: now,
+		EventType: "APIThrottled",
+		Payload: map[string]interface{}{
+			"watcher":         watcher,
+			"operation":       operation,
+			"object":          object,
+			"cause":           cause,
+			"error":           err.Error(),
+			"throttled_calls": throttled,
+			"qps":             l.qps,
+			"burst":           l.burst,
+			"timeout_seconds": l.timeout.Seconds(),
+		},
+	})
+}
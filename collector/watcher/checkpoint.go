@@ -0,0 +1,229 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Checkpoint persists the last-seen resourceVersion per watcher so that a
+// restarted collector resumes its watches where it stopped instead of
+// starting from "now" and losing whatever happened while it was down.
+//
+// Raw-watch watchers (events, ephemeral containers, deployments) resume
+// their watch from the checkpointed resourceVersion. Informer-backed
+// watchers always relist on start. For pods, nodes and ConfigMaps the
+// checkpoint tells them which listed objects changed while the collector
+// was down, so that what happened to those is reported from their current
+// state rather than taken as the baseline; intermediate transitions are
+// still lost. The other informers take the list as their baseline.
+//
+// A nil *Checkpoint is valid and disables checkpointing: every method is a
+// no-op and ResourceVersion always returns "".
+type Checkpoint struct {
+	mu      sync.Mutex
+	path    string
+	rvs     map[string]string // checkpointKey → resourceVersion
+	dirty   bool
+	savedAt time.Time // when the file loaded was last written
+	log     *slog.Logger
+}
+
+// LoadCheckpoint reads <outputDir>/checkpoint.json, or for one of several
+// clusters watched at once, whose resourceVersions are unrelated,
+// <outputDir>/checkpoint-<cluster>.json. A missing file yields an empty
+// checkpoint.
+func LoadCheckpoint(outputDir, cluster string, log *slog.Logger) (*Checkpoint, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output dir: %w", err)
+	}
+	name := "checkpoint.json"
+	if cluster != "" {
+		// Context names such as EKS ARNs hold slashes and colons.
+		name = "checkpoint-" + unsafeFileChars.ReplaceAllString(cluster, "_") + ".json"
+	}
+	c := &Checkpoint{path: filepath.Join(outputDir, name), rvs: map[string]string{}, log: log.With("component", "checkpoint")}
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.rvs); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", c.path, err)
+	}
+	if info, err := os.Stat(c.path); err == nil {
+		c.savedAt = info.ModTime()
+	}
+	c.log.Info("loaded checkpoint", "resource_versions", len(c.rvs), "path", c.path)
+	return c, nil
+}
+
+func (c *Checkpoint) ResourceVersion(watcher string) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rvs[watcher]
+}
+
+// Record stores the resourceVersion of an object delivered by a watch.
+func (c *Checkpoint) Record(watcher string, obj runtime.Object) {
+	if c == nil || obj == nil {
+		return
+	}
+	rv := resourceVersionOf(obj)
+	if rv == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rvs[watcher] = rv
+	c.dirty = true
+}
+
+// Advance stores the resourceVersion of an object delivered by an
+// informer unless the one stored is newer: an informer's initial list comes
+// in no particular order.
+func (c *Checkpoint) Advance(watcher string, obj runtime.Object) {
+	if c == nil || obj == nil {
+		return
+	}
+	rv := resourceVersionOf(obj)
+	if rv == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cur, ok := c.rvs[watcher]; ok && !newerVersion(rv, cur) {
+		return
+	}
+	c.rvs[watcher] = rv
+	c.dirty = true
+}
+
+// SavedAt returns when the checkpoint loaded was last saved by the previous
+// run, roughly when it stopped watching; the zero time if there was none.
+func (c *Checkpoint) SavedAt() time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+	return c.savedAt
+}
+
+// Reset forgets a watcher's resourceVersion, forcing a fresh List.
+func (c *Checkpoint) Reset(watcher string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.rvs, watcher)
+	c.dirty = true
+}
+
+// Save writes the checkpoint atomically (temp file + rename) if it changed.
+func (c *Checkpoint) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.rvs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// Run saves the checkpoint every interval until ctx is cancelled.
+func (c *Checkpoint) Run(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.Save(); err != nil {
+				c.log.Error("checkpoint save failed", "err", err)
+			}
+		}
+	}
+}
+
+func resourceVersionOf(obj runtime.Object) string {
+	if obj == nil {
+		return ""
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return m.GetResourceVersion()
+}
+
+// newerVersion reports whether resourceVersion a is newer than b. Resource
+// versions are opaque but in practice etcd revisions; anything that does
+// not parse is treated as not newer.
+func newerVersion(a, b string) bool {
+	av, err1 := strconv.ParseUint(a, 10, 64)
+	bv, err2 := strconv.ParseUint(b, 10, 64)
+	return err1 == nil && err2 == nil && av > bv
+}
+
+// changedSince reports whether obj changed after resourceVersion since,
+// true when since is "" and nothing is known of it.
+func changedSince(obj runtime.Object, since string) bool {
+	return since == "" || newerVersion(resourceVersionOf(obj), since)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// checkpointKey names a watcher's entry. Watchers scoped to one of several
+// namespaces each keep their own resourceVersion.
+func checkpointKey(watcher, namespace string) string {
+	if namespace == "" {
+		return watcher
+	}
+	return watcher + "/" + namespace
+}
+
+// isExpired reports whether a watch error means the requested
+// resourceVersion has been compacted away (HTTP 410 Gone).
+func isExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// expiredEvent reports whether a watch delivered a 410 Gone error event.
+func expiredEvent(event watch.Event) bool {
+	return event.Type == watch.Error && isExpired(apierrors.FromObject(event.Object))
+}
@@ -0,0 +1,77 @@
+package watcher
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestPodAddedAlreadyOOMKilledIsReportedOnce(t *testing.T) {
+	pw, e, ctx := newTestPodWatcher(t)
+	pod := testPod(oomKilledState(), 0)
+	pw.handleEvent(ctx, watch.Event{Type: watch.Added, Object: pod})
+	// The updates that follow keep reporting the same terminated state.
+	for _, rv := range []string{"101", "102", "103"} {
+		pod = pod.DeepCopy()
+		pod.ResourceVersion = rv
+		pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: pod})
+	}
+	if got := eventsOfType(e, "OOMKill"); len(got) != 1 {
+		t.Fatalf("got %d OOMKill events, want 1", len(got))
+	}
+}
+
+func TestPodAddedUnchangedSinceCheckpointIsNotReported(t *testing.T) {
+	cp, err := LoadCheckpoint(t.TempDir(), "", discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.rvs[checkpointKey("pod_watcher", "prod")] = "100"
+
+	pw, e, ctx := newTestPodWatcher(t)
+	pw.UseCheckpoint(cp)
+	pw.resumeFrom = cp.ResourceVersion(checkpointKey("pod_watcher", "prod"))
+
+	seen := testPod(oomKilledState(), 0) // resourceVersion 100
+	pw.handleEvent(ctx, watch.Event{Type: watch.Added, Object: seen})
+	if got := eventsOfType(e, "OOMKill"); len(got) != 0 {
+		t.Fatalf("pod unchanged since the checkpoint reported: %d OOMKill events", len(got))
+	}
+
+	changed := testPod(oomKilledState(), 0)
+	changed.Name, changed.UID, changed.ResourceVersion = "api-7d9f-b8c", "uid-b8c", "150"
+	pw.handleEvent(ctx, watch.Event{Type: watch.Added, Object: changed})
+	got := eventsOfType(e, "OOMKill")
+	if len(got) != 1 || got[0].PodName != "api-7d9f-b8c" {
+		t.Fatalf("got %+v, want one OOMKill of the pod changed while down", got)
+	}
+	if rv := cp.ResourceVersion(checkpointKey("pod_watcher", "prod")); rv != "150" {
+		t.Errorf("checkpoint advanced to %q, want 150", rv)
+	}
+}
+
+func TestCheckpointAdvanceNeverGoesBack(t *testing.T) {
+	dir := t.TempDir()
+	cp, err := LoadCheckpoint(dir, "", discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rv := range []string{"120", "90", "130", "125"} {
+		pod := testPod(oomKilledState(), 0)
+		pod.ResourceVersion = rv
+		cp.Advance("pod_watcher", pod)
+	}
+	if rv := cp.ResourceVersion("pod_watcher"); rv != "130" {
+		t.Fatalf("resourceVersion = %q, want 130", rv)
+	}
+	if err := cp.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCheckpoint(dir, "", discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ResourceVersion("pod_watcher") != "130" || loaded.SavedAt().IsZero() {
+		t.Fatalf("loaded %q saved at %v", loaded.ResourceVersion("pod_watcher"), loaded.SavedAt())
+	}
+}
@@ -0,0 +1,255 @@
+package watcher
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// envConsumer is a pod that reads a ConfigMap or Secret through env vars,
+// as it stood when the object changed.
+type envConsumer struct {
+	pod      string
+	uid      string
+	restarts int32
+	workload string // "Deployment/<name>", "<Kind>/<name>" or "Pod/<name>"
+}
+
+// watchEnvConsumers drives the P002 absence step. Env vars are resolved
+// only when a container starts, so a ConfigMap change reaches env consumers
+// only through a restart or a replacement pod. It records the consumers'
+// restart counts at changedAt, waits out the P002 window, and emits one
+// PodNotRestarted per workload whose pods neither restarted nor were
+// replaced in that time.
+func (cw *ConfigMapWatcher) watchEnvConsumers(ctx context.Context, cm *corev1.ConfigMap, changedAt time.Time) {
+	window := cw.windows.AbsenceWindow(patterns.ConfigMapEnvPattern, "PodNotRestarted", cm.Namespace)
+	deadline := changedAt.Add(window)
+	stale, ok := awaitStaleEnvConsumers(ctx, cw.client, cw.pods, cw.emitter, cw.log, "configmap_watcher", cm.Namespace, "env_configmaps", cm.Name, deadline)
+	if !ok {
+		return
+	}
+	for _, w := range sortedKeys(stale) {
+		kind, name, _ := strings.Cut(w, "/")
+		sort.Strings(stale[w])
+		payload := map[string]interface{}{
+			"configmap_name":     cm.Name,
+			"namespace":          cm.Namespace,
+			"resource_version":   cm.ResourceVersion,
+			"workload_kind":      kind,
+			"workload_name":      name,
+			"stale_pods":         stale[w],
+			"stale_pod_count":    len(stale[w]),
+			"window_seconds":     window.Seconds(),
+			"change_observed_at": changedAt.UTC().Format(time.RFC3339Nano),
+		}
+		if kind == "Deployment" {
+			payload["deployment_name"] = name
+		}
+		// Timestamped at the end of the window: that is the instant the
+		// absence was established, whatever the relist latency.
+		cw.emitter.Emit(emitter.CausalEvent{
+			ID:        emitter.NewID(),
+			Timestamp: deadline,
+			EventType: "PodNotRestarted",
+			PatternID: patterns.PatternConfigMapEnv,
+			Namespace: cm.Namespace,
+			Payload:   payload,
+		})
+		cw.log.Info("PodNotRestarted", "configmap", cm.Namespace+"/"+cm.Name, "workload", w, "stale", len(stale[w]))
+	}
+}
+
+// awaitStaleEnvConsumers records the pods that read object name through
+// env vars (refKey is the extractConfigReferences list naming them), waits
+// until deadline, and returns those that neither restarted nor were
+// replaced since, grouped by workload. Pods come from pods' cache if set.
+// It returns false if there were no consumers, ctx ended, or a list failed
+// (reported as a CollectorError).
+func awaitStaleEnvConsumers(ctx context.Context, client kubernetes.Interface, pods *PodWatcher, e emitter.Emitter, log *slog.Logger, watcherName, namespace, refKey, name string, deadline time.Time) (map[string][]string, bool) {
+	baseline, err := envConsumers(ctx, client, pods, namespace, refKey, name)
+	if err != nil {
+		reportError(e, log, watcherName, namespace, "list env consumers of", namespace+"/"+name, err)
+		return nil, false
+	}
+	if len(baseline) == 0 {
+		return nil, false
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case <-timer.C:
+	}
+
+	running, err := consumerPods(ctx, client, pods, namespace)
+	if err != nil {
+		reportError(e, log, watcherName, namespace, "relist env consumers of", namespace+"/"+name, err)
+		return nil, false
+	}
+	current := map[string]int32{}
+	for _, pod := range running {
+		current[string(pod.UID)] = restartCount(pod)
+	}
+
+	stale := map[string][]string{} // workload → pods still running the old env
+	for _, c := range baseline {
+		restarts, alive := current[c.uid]
+		if !alive || restarts > c.restarts {
+			continue
+		}
+		stale[c.workload] = append(stale[c.workload], c.pod)
+	}
+	return stale, len(stale) > 0
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func envConsumers(ctx context.Context, client kubernetes.Interface, pods *PodWatcher, namespace, refKey, name string) ([]envConsumer, error) {
+	running, err := consumerPods(ctx, client, pods, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var out []envConsumer
+	for _, pod := range running {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		envRefs, _ := extractConfigReferences(pod)[refKey].([]string)
+		if !containsString(envRefs, name) {
+			continue
+		}
+		out = append(out, envConsumer{
+			pod:      pod.Name,
+			uid:      string(pod.UID),
+			restarts: restartCount(pod),
+			workload: workloadOf(ctx, client, pod),
+		})
+	}
+	return out, nil
+}
+
+// consumerPods returns the pods of namespace that a ConfigMap or Secret
+// change may reach: from the PodWatcher's informer cache if pods is set,
+// so a change costs no pod list, else listed from the API.
+func consumerPods(ctx context.Context, client kubernetes.Interface, pods *PodWatcher, namespace string) ([]*corev1.Pod, error) {
+	if pods != nil {
+		return pods.cachedPods(ctx, namespace), nil
+	}
+	list, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*corev1.Pod, len(list.Items))
+	for i := range list.Items {
+		out[i] = &list.Items[i]
+	}
+	return out, nil
+}
+
+// consumerPod returns one pod, as consumerPods does. It returns false if
+// the pod is gone.
+func consumerPod(ctx context.Context, client kubernetes.Interface, pods *PodWatcher, namespace, name string) (*corev1.Pod, bool) {
+	if pods != nil {
+		return pods.cachedPod(ctx, namespace, name)
+	}
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	return pod, err == nil
+}
+
+// pendingChecks runs the consumer checks of ConfigMap or Secret changes
+// and tracks those still waiting out their window, per object, so that a
+// later change of the object supersedes them: the new checks cover the
+// same pods from a later baseline, and running both would report every
+// pod that restarted for neither twice. The zero value is ready to use.
+type pendingChecks struct {
+	mu      sync.Mutex
+	cancels map[string]*context.CancelFunc // by namespace/name
+	running sync.WaitGroup
+}
+
+// start runs checks for a change of the object key, cancelling those of an
+// earlier change still pending.
+func (p *pendingChecks) start(ctx context.Context, key string, checks ...func(context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+	p.mu.Lock()
+	if prev := p.cancels[key]; prev != nil {
+		(*prev)()
+	}
+	if p.cancels == nil {
+		p.cancels = map[string]*context.CancelFunc{}
+	}
+	p.cancels[key] = &cancel
+	p.mu.Unlock()
+
+	var change sync.WaitGroup
+	for _, check := range checks {
+		change.Go(func() { check(ctx) })
+	}
+	p.running.Go(func() {
+		change.Wait()
+		p.mu.Lock()
+		if p.cancels[key] == &cancel {
+			delete(p.cancels, key)
+		}
+		p.mu.Unlock()
+		cancel()
+	})
+}
+
+// Wait returns once every check has.
+func (p *pendingChecks) Wait() {
+	p.running.Wait()
+}
+
+// workloadOf names the controller that owns pod, following a ReplicaSet up
+// to its Deployment.
+func workloadOf(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod/" + pod.Name
+	}
+	if owner.Kind == "ReplicaSet" {
+		rs, err := client.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err == nil {
+			if dep := metav1.GetControllerOf(rs); dep != nil && dep.Kind == "Deployment" {
+				return "Deployment/" + dep.Name
+			}
+		}
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+func restartCount(pod *corev1.Pod) int32 {
+	var n int32
+	for _, cs := range pod.Status.ContainerStatuses {
+		n += cs.RestartCount
+	}
+	return n
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultRedactPattern matches ConfigMap keys whose values are never
+// written out, even with diff capture enabled.
+const DefaultRedactPattern = `(?i)(password|passwd|secret|token|credential|api[_-]?key|private[_-]?key)`
+
+const (
+	redactedValue = "[REDACTED]"
+	binaryValue   = "[binary omitted]"
+)
+
+// configMapVersion is what the watcher remembers about a ConfigMap between
+// events: a whole-object hash plus per-key hashes, from which the changed
+// keys are derived. data holds the values themselves and is only kept with
+// diff capture enabled.
+type configMapVersion struct {
+	hash   string
+	keys   map[string]string // Data key → value hash
+	binary map[string]string // BinaryData key → value hash
+	data   map[string]string
+	large  bool
+}
+
+// DefaultLargeConfigMapBytes is the content size from which a ConfigMap is
+// hashed incrementally.
+const DefaultLargeConfigMapBytes = 256 * 1024
+
+// largeHashChunk bounds the copy made of a string value to hash it.
+const largeHashChunk = 32 * 1024
+
+// HashLargeIncrementally sets the content size, keys and values together,
+// from which a ConfigMap is hashed incrementally: each value is hashed once,
+// a chunk at a time, and the whole-object hash is derived from the per-key
+// hashes instead of from the content a second time. ConfigMaps near the
+// 1MiB limit that change often otherwise cost a noticeable share of CPU.
+// Their ConfigMapChanged events carry large_configmap: true. 0 hashes every
+// ConfigMap whole.
+func (cw *ConfigMapWatcher) HashLargeIncrementally(bytes int) {
+	cw.largeBytes = bytes
+}
+
+// CaptureDiffs makes ConfigMapChanged events carry a per-key diff with old
+// and new values. Values of keys matching redact are replaced with
+// "[REDACTED]"; BinaryData values are never captured. Off by default
+// because ConfigMaps routinely hold values that should not leave the
+// cluster.
+func (cw *ConfigMapWatcher) CaptureDiffs(redact *regexp.Regexp) {
+	cw.captureDiffs = true
+	cw.redact = redact
+}
+
+func (cw *ConfigMapWatcher) versionOf(cm *corev1.ConfigMap) configMapVersion {
+	v := configMapVersion{
+		keys:   make(map[string]string, len(cm.Data)),
+		binary: make(map[string]string, len(cm.BinaryData)),
+		large:  cw.largeBytes > 0 && contentSize(cm) >= cw.largeBytes,
+	}
+	if v.large {
+		for k, s := range cm.Data {
+			v.keys[k] = stringHash(s)
+		}
+	} else {
+		for k, s := range cm.Data {
+			v.keys[k] = valueHash([]byte(s))
+		}
+	}
+	for k, b := range cm.BinaryData {
+		v.binary[k] = valueHash(b)
+	}
+	if v.large {
+		v.hash = keyHashesHash(v)
+	} else {
+		v.hash = contentHash(cm)
+	}
+	if cw.captureDiffs {
+		v.data = maps.Clone(cm.Data)
+	}
+	return v
+}
+
+func valueHash(b []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(b))[:16]
+}
+
+// stringHash is valueHash of s without copying all of s at once.
+func stringHash(s string) string {
+	h := sha256.New()
+	for len(s) > 0 {
+		n := min(len(s), largeHashChunk)
+		h.Write([]byte(s[:n]))
+		s = s[n:]
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+// keyHashesHash derives the whole-object hash of a large ConfigMap from its
+// per-key hashes, keys in sorted order.
+func keyHashesHash(v configMapVersion) string {
+	h := sha256.New()
+	for _, k := range slices.Sorted(maps.Keys(v.keys)) {
+		h.Write([]byte(k + "=" + v.keys[k] + "\n"))
+	}
+	for _, k := range slices.Sorted(maps.Keys(v.binary)) {
+		h.Write([]byte(k + "(binary)=" + v.binary[k] + "\n"))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+func contentSize(cm *corev1.ConfigMap) int {
+	n := 0
+	for k, s := range cm.Data {
+		n += len(k) + len(s)
+	}
+	for k, b := range cm.BinaryData {
+		n += len(k) + len(b)
+	}
+	return n
+}
+
+// extractChangedKeys returns the keys added, removed or modified between
+// two versions, BinaryData keys suffixed "(binary)". With no previous
+// version every current key counts as changed.
+func extractChangedKeys(prev, cur configMapVersion) []string {
+	var keys []string
+	keys = appendChanged(keys, prev.keys, cur.keys, "")
+	keys = appendChanged(keys, prev.binary, cur.binary, "(binary)")
+	sort.Strings(keys)
+	return keys
+}
+
+func appendChanged(keys []string, prev, cur map[string]string, suffix string) []string {
+	for k, h := range cur {
+		if old, ok := prev[k]; !ok || old != h {
+			keys = append(keys, k+suffix)
+		}
+	}
+	for k := range prev {
+		if _, ok := cur[k]; !ok {
+			keys = append(keys, k+suffix)
+		}
+	}
+	return keys
+}
+
+// diffConfigMap compares two captured versions key by key. cur is the zero
+// value when the ConfigMap was deleted.
+func (cw *ConfigMapWatcher) diffConfigMap(prev, cur configMapVersion) map[string]interface{} {
+	added := map[string]interface{}{}
+	removed := map[string]interface{}{}
+	modified := map[string]interface{}{}
+	for k, old := range prev.data {
+		nv, ok := cur.data[k]
+		switch {
+		case !ok:
+			removed[k] = cw.displayValue(k, old)
+		case nv != old:
+			modified[k] = map[string]interface{}{"old": cw.displayValue(k, old), "new": cw.displayValue(k, nv)}
+		}
+	}
+	for k, nv := range cur.data {
+		if _, ok := prev.data[k]; !ok {
+			added[k] = cw.displayValue(k, nv)
+		}
+	}
+	for k, old := range prev.binary {
+		nv, ok := cur.binary[k]
+		switch {
+		case !ok:
+			removed[k] = binaryValue
+		case nv != old:
+			modified[k] = map[string]interface{}{"old": binaryValue, "new": binaryValue}
+		}
+	}
+	for k := range cur.binary {
+		if _, ok := prev.binary[k]; !ok {
+			added[k] = binaryValue
+		}
+	}
+	return map[string]interface{}{"added": added, "removed": removed, "modified": modified}
+}
+
+func (cw *ConfigMapWatcher) displayValue(key, value string) string {
+	if cw.redact != nil && cw.redact.MatchString(key) {
+		return redactedValue
+	}
+	return value
+}
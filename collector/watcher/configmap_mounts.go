@@ -0,0 +1,194 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// kubeletSyncDelay approximates when a ConfigMap change has reached mounted
+// volumes: the kubelet's default --sync-frequency (1m) plus a margin for its
+// ConfigMap cache. It must stay inside the P003 KubeletSync window.
+const kubeletSyncDelay = 65 * time.Second
+
+// Values of the KubeletSync confidence field.
+const (
+	syncConfidenceMedium = "medium" // pod stayed Ready on the same node, no mount errors
+	syncConfidenceLow    = "low"    // pod running but not Ready; sync may have stalled
+)
+
+// mountConsumer is a pod that mounts a ConfigMap as a volume.
+type mountConsumer struct {
+	pod      string
+	uid      types.UID
+	node     string
+	volumes  []string
+	subPaths []string // mount paths using subPath, which never receive updates
+}
+
+// watchMountConsumers drives the P003 propagation step. The kubelet's
+// symlink swap is not visible through the API, so KubeletSync is inferred:
+// a pod that still runs on the same node one sync period after the change,
+// with no FailedMount event since, is assumed to have received the update.
+// The payload carries the heuristic and a confidence so consumers can tell
+// it from directly observed events. Pods that mount the ConfigMap only via
+// subPath are skipped; the kubelet never updates those.
+func (cw *ConfigMapWatcher) watchMountConsumers(ctx context.Context, cm *corev1.ConfigMap, changedAt time.Time) {
+	consumers, err := cw.mountConsumers(ctx, cm.Namespace, cm.Name)
+	if err != nil {
+		reportError(cw.emitter, cw.log, "configmap_watcher", cm.Namespace, "list mount consumers of", cm.Namespace+"/"+cm.Name, err)
+		return
+	}
+	if len(consumers) == 0 {
+		return
+	}
+	timer := time.NewTimer(time.Until(changedAt.Add(kubeletSyncDelay)))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	for _, c := range consumers {
+		if len(c.volumes) == len(c.subPaths) {
+			cw.log.Debug("subPath-only mount, no kubelet sync", "pod", cm.Namespace+"/"+c.pod, "configmap", cm.Name)
+			continue
+		}
+		pod, ok := consumerPod(ctx, cw.client, cw.pods, cm.Namespace, c.pod)
+		if !ok || pod.UID != c.uid || pod.DeletionTimestamp != nil || pod.Spec.NodeName != c.node {
+			continue // replaced or gone: the new pod mounts fresh content
+		}
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		failed, err := cw.mountFailedSince(ctx, pod, changedAt)
+		if err != nil {
+			reportError(cw.emitter, cw.log, "configmap_watcher", pod.Namespace, "list mount events of", pod.Namespace+"/"+pod.Name, err)
+			continue
+		}
+		if failed {
+			continue
+		}
+		confidence := syncConfidenceLow
+		if podReady(pod) {
+			confidence = syncConfidenceMedium
+		}
+		payload := map[string]interface{}{
+			"configmap_name":     cm.Name,
+			"resource_version":   cm.ResourceVersion,
+			"volumes":            c.volumes,
+			"subpath_mounts":     c.subPaths,
+			"inferred":           true,
+			"heuristic":          "pod running on same node past kubelet sync period with no FailedMount since change",
+			"confidence":         confidence,
+			"assumed_sync_delay": kubeletSyncDelay.Seconds(),
+			"change_observed_at": changedAt.UTC().Format(time.RFC3339Nano),
+		}
+		cw.owners.annotate(payload, pod)
+		cw.emitter.Emit(emitter.CausalEvent{
+			ID:        emitter.NewID(),
+			Timestamp: time.Now(),
+			EventType: "KubeletSync",
+			PatternID: patterns.PatternConfigMapMount,
+			PodName:   pod.Name,
+			Namespace: pod.Namespace,
+			NodeName:  pod.Spec.NodeName,
+			PodUID:    string(pod.UID),
+			Payload:   payload,
+		})
+		cw.log.Info("KubeletSync inferred", "configmap", cm.Namespace+"/"+cm.Name, "pod", pod.Name, "confidence", confidence)
+	}
+}
+
+func (cw *ConfigMapWatcher) mountConsumers(ctx context.Context, namespace, name string) ([]mountConsumer, error) {
+	pods, err := consumerPods(ctx, cw.client, cw.pods, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var out []mountConsumer
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		c := mountConsumer{pod: pod.Name, uid: pod.UID, node: pod.Spec.NodeName}
+		for _, vol := range pod.Spec.Volumes {
+			if mountsConfigMap(vol, name) {
+				c.volumes = append(c.volumes, vol.Name)
+			}
+		}
+		if len(c.volumes) == 0 {
+			continue
+		}
+		c.subPaths = subPathMounts(pod, c.volumes)
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func mountsConfigMap(vol corev1.Volume, name string) bool {
+	if vol.ConfigMap != nil && vol.ConfigMap.Name == name {
+		return true
+	}
+	if vol.Projected != nil {
+		for _, src := range vol.Projected.Sources {
+			if src.ConfigMap != nil && src.ConfigMap.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subPathMounts returns the volumes (from volumes) that every container
+// mounts through subPath. A volume mounted whole by any container still
+// receives updates.
+func subPathMounts(pod *corev1.Pod, volumes []string) []string {
+	whole, sub := map[string]bool{}, map[string]bool{}
+	for _, c := range pod.Spec.Containers {
+		for _, m := range c.VolumeMounts {
+			if m.SubPath != "" || m.SubPathExpr != "" {
+				sub[m.Name] = true
+			} else {
+				whole[m.Name] = true
+			}
+		}
+	}
+	var out []string
+	for _, v := range volumes {
+		if sub[v] && !whole[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (cw *ConfigMapWatcher) mountFailedSince(ctx context.Context, pod *corev1.Pod, since time.Time) (bool, error) {
+	sel := fields.Set{"involvedObject.uid": string(pod.UID), "reason": "FailedMount"}.AsSelector().String()
+	events, err := cw.client.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{FieldSelector: sel})
+	if err != nil {
+		return false, err
+	}
+	for _, e := range events.Items {
+		if e.LastTimestamp.Time.After(since) || e.EventTime.Time.After(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 
@@ -18,121 +21,184 @@ import (
 type ConfigMapWatcher struct {
 	client       kubernetes.Interface
 	namespace    string
-	emitter      *emitter.JSONEmitter
-	versionCache map[string]string
+	selectors    Selectors
+	emitter      emitter.Emitter
+	log          *slog.Logger
+	versionCache map[string]configMapVersion
+
+	captureDiffs bool
+	redact       *regexp.Regexp
+	largeBytes   int // 0 hashes every ConfigMap whole
+	owners       *Owners
+	lag          *LagMonitor
+	windows      *patterns.NamespaceWindows
+	pods         *PodWatcher // nil lists consumers from the API
+	checkpoint   *Checkpoint
+	resumeFrom   string    // resourceVersion resumed from; "" unless resuming
+	downSince    time.Time // when the previous run saved it
+
+	consumers pendingChecks // consumer checks still waiting out their window
+}
+
+func NewConfigMapWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *ConfigMapWatcher {
+	return &ConfigMapWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "configmap_watcher"), versionCache: map[string]configMapVersion{},
+		largeBytes: DefaultLargeConfigMapBytes,
+	}
+}
+
+// UseOwners resolves the workload of pods in emitted events through o.
+func (cw *ConfigMapWatcher) UseOwners(o *Owners) {
+	cw.owners = o
 }
 
-func NewConfigMapWatcher(client kubernetes.Interface, namespace string, e *emitter.JSONEmitter) *ConfigMapWatcher {
-	return &ConfigMapWatcher{client: client, namespace: namespace, emitter: e, versionCache: map[string]string{}}
+// UseLagMonitor measures the observation lag of changes through lm, from
+// the last write recorded in the ConfigMap's managed fields.
+func (cw *ConfigMapWatcher) UseLagMonitor(lm *LagMonitor) {
+	cw.lag = lm
+}
+
+// UseWindows takes the P002 absence window of a namespace from w.
+func (cw *ConfigMapWatcher) UseWindows(w *patterns.NamespaceWindows) {
+	cw.windows = w
+}
+
+// UsePods finds the pods a change reaches in pw's informer cache instead
+// of listing the namespace's pods from the API on every change. Only the
+// pods pw watches, those its selectors match, are consumers then.
+func (cw *ConfigMapWatcher) UsePods(pw *PodWatcher) {
+	cw.pods = pw
+}
+
+// UseCheckpoint records the resourceVersion the ConfigMap informer reached
+// in cp and, resuming from it, reports as ConfigMapChanged the ConfigMaps
+// changed while the collector was down, which the initial list would
+// otherwise take as the baseline. Their old content is unknown.
+func (cw *ConfigMapWatcher) UseCheckpoint(cp *Checkpoint) {
+	cw.checkpoint = cp
 }
 
 func (cw *ConfigMapWatcher) Watch(ctx context.Context) error {
-	fmt.Printf("[configmap_watcher] Starting namespace=%q\n", cw.namespace)
-	if err := cw.primeCache(ctx); err != nil {
-		fmt.Printf("[configmap_watcher] cache prime failed: %v\n", err)
-	}
-	w, err := cw.client.CoreV1().ConfigMaps(cw.namespace).Watch(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("configmap watch failed: %w", err)
-	}
-	defer w.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case event, ok := <-w.ResultChan():
-			if !ok {
-				return cw.Watch(ctx)
-			}
-			cw.handleEvent(event)
-		}
+	cw.log.Info("starting", "namespace", cw.namespace)
+	cw.resumeFrom = cw.checkpoint.ResourceVersion(checkpointKey("configmap_watcher", cw.namespace))
+	cw.downSince = cw.checkpoint.SavedAt()
+	cw.lag.start("configmap_watcher", cw.namespace)
+	// The informer's initial list delivers every ConfigMap as an Add, which
+	// primes versionCache before any Modified event is compared against it.
+	factory := newInformerFactory(cw.client, cw.namespace, cw.selectors)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(func(event watch.Event) {
+		cw.handleEvent(ctx, event)
+	})); err != nil {
+		return fmt.Errorf("configmap informer registration failed: %w", err)
 	}
+	// Consumer checks emit when their window closes or ctx ends; Watch
+	// returns only once they have, so nothing is emitted after shutdown.
+	defer cw.consumers.Wait()
+	return runInformer(ctx, cw.log, "configmap_watcher", cw.namespace, cw.emitter, factory, informer)
 }
 
 func (cw *ConfigMapWatcher) GetContentHash(namespace, name string) string {
-	if h, ok := cw.versionCache[namespace+"/"+name]; ok {
-		return h
+	if v, ok := cw.versionCache[namespace+"/"+name]; ok {
+		return v.hash
 	}
 	return "unknown"
 }
 
-func (cw *ConfigMapWatcher) handleEvent(event watch.Event) {
+func (cw *ConfigMapWatcher) handleEvent(ctx context.Context, event watch.Event) {
 	cm, ok := event.Object.(*corev1.ConfigMap)
 	if !ok {
 		return
 	}
+	cw.checkpoint.Advance(checkpointKey("configmap_watcher", cw.namespace), cm)
 	key := cm.Namespace + "/" + cm.Name
-	newHash := contentHash(cm)
+	cur := cw.versionOf(cm)
 	switch event.Type {
 	case watch.Added:
-		cw.versionCache[key] = newHash
+		cw.versionCache[key] = cur
+		if !cw.changedWhileDown(cm) {
+			return
+		}
+		changedAt := cw.captureChange(cm, configMapVersion{}, cur, watch.Modified)
+		cw.checkConsumers(ctx, cm, changedAt)
 	case watch.Modified:
-		oldHash, known := cw.versionCache[key]
-		if known && oldHash == newHash {
+		prev, known := cw.versionCache[key]
+		if known && prev.hash == cur.hash {
 			return
 		}
-		cw.captureChange(cm, oldHash, newHash, event.Type)
-		cw.versionCache[key] = newHash
+		changedAt := cw.captureChange(cm, prev, cur, event.Type)
+		cw.versionCache[key] = cur
+		cw.checkConsumers(ctx, cm, changedAt)
 	case watch.Deleted:
-		cw.captureChange(cm, cw.versionCache[key], "", event.Type)
+		cw.captureChange(cm, cw.versionCache[key], configMapVersion{}, event.Type)
 		delete(cw.versionCache, key)
 	}
 }
 
-func (cw *ConfigMapWatcher) captureChange(cm *corev1.ConfigMap, oldHash, newHash string, eventType watch.EventType) {
-	cw.emitter.Emit(emitter.CausalEvent{
-		ID:        generateID(),
-		Timestamp: time.Now(),
-		EventType: "ConfigMapChanged",
-		Namespace: cm.Namespace,
-		Payload: map[string]interface{}{
-			"configmap_name":     cm.Name,
-			"namespace":          cm.Namespace,
-			"resource_version":   cm.ResourceVersion,
-			"old_content_hash":   oldHash,
-			"new_content_hash":   newHash,
-			"changed_keys":       extractChangedKeys(cm),
-			"key_count":          len(cm.Data) + len(cm.BinaryData),
-			"event_type":         string(eventType),
-			"potential_patterns": []string{patterns.PatternConfigMapEnv, patterns.PatternConfigMapMount},
-			"content_captured":   false,
-		},
-	})
-	fmt.Printf("[configmap_watcher] Changed: %s/%s\n", cm.Namespace, cm.Name)
+// checkConsumers starts the P002 and P003 consumer checks of a change of
+// cm, superseding those of an earlier change still waiting.
+func (cw *ConfigMapWatcher) checkConsumers(ctx context.Context, cm *corev1.ConfigMap, changedAt time.Time) {
+	cw.consumers.start(ctx, cm.Namespace+"/"+cm.Name,
+		func(ctx context.Context) { cw.watchEnvConsumers(ctx, cm, changedAt) },
+		func(ctx context.Context) { cw.watchMountConsumers(ctx, cm, changedAt) },
+	)
+}
+
+// changedWhileDown reports whether cm, created before the previous run
+// stopped, changed after its checkpoint. ConfigMaps created since are new,
+// not changed.
+func (cw *ConfigMapWatcher) changedWhileDown(cm *corev1.ConfigMap) bool {
+	return cw.resumeFrom != "" && cm.CreationTimestamp.Time.Before(cw.downSince) && changedSince(cm, cw.resumeFrom)
 }
 
-func (cw *ConfigMapWatcher) primeCache(ctx context.Context) error {
-	cms, err := cw.client.CoreV1().ConfigMaps(cw.namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return err
+// captureChange emits ConfigMapChanged. cur is the zero value on deletion;
+// prev is the zero value if the ConfigMap was never seen before.
+func (cw *ConfigMapWatcher) captureChange(cm *corev1.ConfigMap, prev, cur configMapVersion, eventType watch.EventType) time.Time {
+	now := time.Now()
+	payload := map[string]interface{}{
+		"configmap_name":     cm.Name,
+		"namespace":          cm.Namespace,
+		"resource_version":   cm.ResourceVersion,
+		"old_content_hash":   prev.hash,
+		"new_content_hash":   cur.hash,
+		"changed_keys":       extractChangedKeys(prev, cur),
+		"key_count":          len(cm.Data) + len(cm.BinaryData),
+		"event_type":         string(eventType),
+		"potential_patterns": []string{patterns.PatternConfigMapEnv, patterns.PatternConfigMapMount},
+		"content_captured":   false,
+		"large_configmap":    prev.large || cur.large,
 	}
-	for i := range cms.Items {
-		cm := &cms.Items[i]
-		cw.versionCache[cm.Namespace+"/"+cm.Name] = contentHash(cm)
+	if cw.captureDiffs && prev.data != nil {
+		payload["diff"] = cw.diffConfigMap(prev, cur)
+		payload["content_captured"] = true
 	}
-	fmt.Printf("[configmap_watcher] Cache primed: %d configmaps\n", len(cms.Items))
-	return nil
+	var occurred time.Time
+	if eventType == watch.Modified {
+		// A deletion is not recorded in the managed fields.
+		occurred = lastChanged(cm.ObjectMeta)
+		cw.lag.observe(payload, "configmap_watcher", cm.Namespace, "ConfigMapChanged", occurred)
+	}
+	cw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  now,
+		OccurredAt: occurred,
+		EventType:  "ConfigMapChanged",
+		Namespace:  cm.Namespace,
+		Payload:    payload,
+	})
+	cw.log.Info("ConfigMap changed", "configmap", cm.Namespace+"/"+cm.Name)
+	return now
 }
 
+// contentHash hashes the whole ConfigMap, keys in sorted order, so equal
+// content always yields the same hash.
 func contentHash(cm *corev1.ConfigMap) string {
 	h := sha256.New()
-	for k, v := range cm.Data {
-		h.Write([]byte(k + "=" + v + "\n"))
+	for _, k := range slices.Sorted(maps.Keys(cm.Data)) {
+		h.Write([]byte(k + "=" + cm.Data[k] + "\n"))
 	}
-	for k, v := range cm.BinaryData {
+	for _, k := range slices.Sorted(maps.Keys(cm.BinaryData)) {
 		h.Write([]byte(k))
-		h.Write(v)
+		h.Write(cm.BinaryData[k])
 	}
 	return fmt.Sprintf("%x", h.Sum(nil))[:16]
 }
-
-func extractChangedKeys(cm *corev1.ConfigMap) []string {
-	keys := make([]string, 0, len(cm.Data)+len(cm.BinaryData))
-	for k := range cm.Data {
-		keys = append(keys, k)
-	}
-	for k := range cm.BinaryData {
-		keys = append(keys, k+"(binary)")
-	}
-	return keys
-}
@@ -0,0 +1,215 @@
+package watcher
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+func TestConfigMapChangedKeys(t *testing.T) {
+	before := testConfigMap("1",
+		map[string]string{"LOG_LEVEL": "info", "POOL_SIZE": "10", "TIMEOUT": "30s"},
+		map[string][]byte{"cert.der": {1, 2, 3}, "logo.png": {9}},
+	)
+	after := testConfigMap("2",
+		map[string]string{"LOG_LEVEL": "debug", "POOL_SIZE": "10", "RETRIES": "3"},
+		map[string][]byte{"cert.der": {1, 2, 4}, "favicon.ico": {7}},
+	)
+	want := []string{"LOG_LEVEL", "RETRIES", "TIMEOUT", "cert.der(binary)", "favicon.ico(binary)", "logo.png(binary)"}
+
+	for _, tc := range []struct {
+		name       string
+		largeBytes int
+	}{
+		{"whole", 0},
+		{"incremental", 1}, // every ConfigMap counts as large
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cw, e, ctx := newTestConfigMapWatcher(t)
+			cw.HashLargeIncrementally(tc.largeBytes)
+			cw.handleEvent(ctx, watch.Event{Type: watch.Added, Object: before})
+			cw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: after})
+
+			got := eventsOfType(e, "ConfigMapChanged")
+			if len(got) != 1 {
+				t.Fatalf("got %d ConfigMapChanged events, want 1", len(got))
+			}
+			p := got[0].Payload
+			if keys := p["changed_keys"].([]string); !slices.Equal(keys, want) {
+				t.Errorf("changed_keys = %q, want %q", keys, want)
+			}
+			if p["old_content_hash"] == p["new_content_hash"] || p["old_content_hash"] == "" {
+				t.Errorf("hashes old %v new %v", p["old_content_hash"], p["new_content_hash"])
+			}
+			if p["key_count"] != 5 || p["large_configmap"] != (tc.largeBytes > 0) {
+				t.Errorf("key_count %v large_configmap %v", p["key_count"], p["large_configmap"])
+			}
+		})
+	}
+}
+
+func TestConfigMapBinaryOnlyChange(t *testing.T) {
+	cw, e, ctx := newTestConfigMapWatcher(t)
+	data := map[string]string{"LOG_LEVEL": "info"}
+	cw.handleEvent(ctx, watch.Event{Type: watch.Added, Object: testConfigMap("1", data, map[string][]byte{"blob": {0, 1}})})
+	cw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: testConfigMap("2", data, map[string][]byte{"blob": {0, 2}})})
+	got := eventsOfType(e, "ConfigMapChanged")
+	if len(got) != 1 {
+		t.Fatalf("got %d ConfigMapChanged events, want 1", len(got))
+	}
+	if keys := got[0].Payload["changed_keys"].([]string); !slices.Equal(keys, []string{"blob(binary)"}) {
+		t.Errorf("changed_keys = %q", keys)
+	}
+}
+
+func TestConfigMapMetadataOnlyUpdateIsNotAChange(t *testing.T) {
+	cw, e, ctx := newTestConfigMapWatcher(t)
+	cm := testConfigMap("1", map[string]string{"LOG_LEVEL": "info"}, nil)
+	cw.handleEvent(ctx, watch.Event{Type: watch.Added, Object: cm})
+	relabelled := cm.DeepCopy()
+	relabelled.ResourceVersion = "2"
+	relabelled.Labels = map[string]string{"team": "payments"}
+	cw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: relabelled})
+	if got := eventsOfType(e, "ConfigMapChanged"); len(got) != 0 {
+		t.Fatalf("label change reported as %d ConfigMapChanged events", len(got))
+	}
+}
+
+func TestConfigMapDeletedReportsEveryKey(t *testing.T) {
+	cw, e, ctx := newTestConfigMapWatcher(t)
+	cm := testConfigMap("1", map[string]string{"A": "1", "B": "2"}, map[string][]byte{"C": {3}})
+	cw.handleEvent(ctx, watch.Event{Type: watch.Added, Object: cm})
+	cw.handleEvent(ctx, watch.Event{Type: watch.Deleted, Object: cm})
+	got := eventsOfType(e, "ConfigMapChanged")
+	if len(got) != 1 {
+		t.Fatalf("got %d ConfigMapChanged events, want 1", len(got))
+	}
+	if keys := got[0].Payload["changed_keys"].([]string); !slices.Equal(keys, []string{"A", "B", "C(binary)"}) {
+		t.Errorf("changed_keys = %q", keys)
+	}
+	if got[0].Payload["new_content_hash"] != "" {
+		t.Errorf("new_content_hash = %v, want none", got[0].Payload["new_content_hash"])
+	}
+}
+
+// wideConfigMap has enough keys that map iteration order varies from one
+// range to the next, and one value spanning several hash chunks.
+func wideConfigMap(rv string) *corev1.ConfigMap {
+	data := map[string]string{"big.yaml": strings.Repeat("replicas: 3\n", 3*largeHashChunk/12)}
+	binary := map[string][]byte{}
+	for i := range 64 {
+		data[fmt.Sprintf("KEY_%02d", i)] = strconv.Itoa(i * i)
+		binary[fmt.Sprintf("blob-%02d", i)] = []byte{byte(i), byte(i >> 1)}
+	}
+	return testConfigMap(rv, data, binary)
+}
+
+func TestConfigMapHashIsStable(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		largeBytes int
+	}{
+		{"whole", 0},
+		{"incremental", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cw, e, ctx := newTestConfigMapWatcher(t)
+			cw.HashLargeIncrementally(tc.largeBytes)
+			want := cw.versionOf(wideConfigMap("1"))
+			if want.large != (tc.largeBytes > 0) {
+				t.Fatalf("large = %v", want.large)
+			}
+			for i := range 500 {
+				// A fresh copy each time: its maps are built, and ranged over,
+				// in an order of their own.
+				if got := cw.versionOf(wideConfigMap("1")).hash; got != want.hash {
+					t.Fatalf("hash %d = %s, want %s", i, got, want.hash)
+				}
+			}
+
+			// Updates that leave the content alone, as a controller
+			// re-applying the same manifest makes, are not changes.
+			for i := range 50 {
+				cm := wideConfigMap(strconv.Itoa(i + 1))
+				typ := watch.Modified
+				if i == 0 {
+					typ = watch.Added
+				}
+				cw.handleEvent(ctx, watch.Event{Type: typ, Object: cm})
+			}
+			if got := eventsOfType(e, "ConfigMapChanged"); len(got) != 0 {
+				t.Fatalf("unchanged content reported as %d ConfigMapChanged events", len(got))
+			}
+			if got := cw.GetContentHash("prod", "app-config"); got != want.hash {
+				t.Fatalf("cached hash %s, want %s", got, want.hash)
+			}
+		})
+	}
+}
+
+// The incremental hash of a value is the whole-value hash, so the per-key
+// hashes, and with them changed_keys, do not depend on the mode.
+func TestStringHashMatchesValueHash(t *testing.T) {
+	for _, n := range []int{0, 1, largeHashChunk - 1, largeHashChunk, largeHashChunk + 1, 5*largeHashChunk + 7} {
+		s := strings.Repeat("x", n)
+		if stringHash(s) != valueHash([]byte(s)) {
+			t.Errorf("stringHash of %d bytes differs from valueHash", n)
+		}
+	}
+}
+
+// With the pod watcher's cache, consumer checks make no pod API calls of
+// their own, and a change made while the check of the previous one is
+// still waiting supersedes it: the api pod, which restarted for neither,
+// is reported once, against the later change.
+func TestConfigMapConsumersFromPodCache(t *testing.T) {
+	h := newHarness(t, flowConfigMap("30", -time.Hour, map[string]string{"LOG_LEVEL": "info"}), flowPod("20", 0, runningSince(-20*time.Minute), corev1.ContainerState{}))
+	windows := patterns.NewNamespaceWindows()
+	if err := windows.Set("prod:P002/PodNotRestarted=1s"); err != nil {
+		t.Fatal(err)
+	}
+	pw := NewPodWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger(), nil)
+	cw := NewConfigMapWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger())
+	cw.UseWindows(windows)
+	cw.UsePods(pw)
+	h.run("pods", pw.Watch)
+	h.run("configmaps", cw.Watch)
+
+	h.Modify(flowConfigMap("31", time.Minute, map[string]string{"LOG_LEVEL": "debug"}))
+	h.waitForEvents(1)
+	time.Sleep(200 * time.Millisecond)
+	h.Modify(flowConfigMap("32", 2*time.Minute, map[string]string{"LOG_LEVEL": "warn"}))
+	h.eventually("PodNotRestarted", func() bool { return len(eventsOfType(h.emitter, "PodNotRestarted")) > 0 })
+
+	changes := eventsOfType(h.emitter, "ConfigMapChanged")
+	stale := eventsOfType(h.emitter, "PodNotRestarted")
+	if len(changes) != 2 || len(stale) != 1 {
+		t.Fatalf("got %d ConfigMapChanged and %d PodNotRestarted events, want 2 and 1", len(changes), len(stale))
+	}
+	if got, want := stale[0].Payload["change_observed_at"], changes[1].Timestamp.UTC().Format(time.RFC3339Nano); got != want {
+		t.Errorf("PodNotRestarted for the change observed at %v, want the later one at %v", got, want)
+	}
+	var lists, gets int
+	for _, a := range h.client.Actions() {
+		if a.GetResource().Resource != "pods" {
+			continue
+		}
+		switch a.GetVerb() {
+		case "list":
+			lists++
+		case "get":
+			gets++
+		}
+	}
+	if lists != 1 || gets != 0 {
+		t.Errorf("pods listed %d times and got %d times, want only the informer's list", lists, gets)
+	}
+}
@@ -0,0 +1,78 @@
+package watcher
+
+import (
+	"fmt"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ContainerFilter restricts the container events of the PodWatcher to the
+// containers whose image and name match, for an investigation of one
+// application that would otherwise drown in the terminations of its
+// sidecars. A nil *ContainerFilter matches every container.
+type ContainerFilter struct {
+	image *regexp.Regexp // nil matches any image
+	name  *regexp.Regexp // nil matches any name
+}
+
+// ParseContainerFilter compiles the image and name regexps, either of
+// which may be empty to match anything. It returns nil if both are.
+func ParseContainerFilter(image, name string) (*ContainerFilter, error) {
+	if image == "" && name == "" {
+		return nil, nil
+	}
+	f := &ContainerFilter{}
+	var err error
+	if image != "" {
+		if f.image, err = regexp.Compile(image); err != nil {
+			return nil, fmt.Errorf("invalid container image filter %q: %w", image, err)
+		}
+	}
+	if name != "" {
+		if f.name, err = regexp.Compile(name); err != nil {
+			return nil, fmt.Errorf("invalid container name filter %q: %w", name, err)
+		}
+	}
+	return f, nil
+}
+
+// matches reports whether the container cs of pod passes the filter. The
+// image matches if either the image in the pod spec or the one the kubelet
+// reports, which a registry mirror or a digest pin may have rewritten,
+// does.
+func (f *ContainerFilter) matches(pod *corev1.Pod, cs corev1.ContainerStatus) bool {
+	if f == nil {
+		return true
+	}
+	if f.name != nil && !f.name.MatchString(cs.Name) {
+		return false
+	}
+	return f.image == nil || f.image.MatchString(cs.Image) || f.image.MatchString(specImage(pod, cs.Name))
+}
+
+// FilterContainers skips the statuses of containers that do not pass f:
+// they emit no termination, OOMKill, crash loop or probe restart.
+func (pw *PodWatcher) FilterContainers(f *ContainerFilter) {
+	pw.containerFilter = f
+}
+
+// specImage is the image of the named container in the pod spec.
+func specImage(pod *corev1.Pod, name string) string {
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == name {
+			return c.Image
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == name {
+			return c.Image
+		}
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		if c.Name == name {
+			return c.Image
+		}
+	}
+	return ""
+}
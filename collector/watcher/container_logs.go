@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	DefaultLogTailLines = 50
+
+	// logFetchTimeout bounds how long the pod watcher's handler waits on
+	// the kubelet; the logs are a bonus, the termination event is not.
+	logFetchTimeout = 3 * time.Second
+	// logMaxBytes caps last_log_lines. The newest lines are kept.
+	logMaxBytes = 16 * 1024
+)
+
+// CaptureLogs attaches the last lines of a terminated container's log to
+// its OOMKill or ContainerTerminated event as last_log_lines. Fetching is
+// best-effort: on timeout or error the event is emitted without them.
+// lines <= 0 disables capture.
+func (pw *PodWatcher) CaptureLogs(lines int) {
+	pw.logTailLines = int64(lines)
+}
+
+// tailLogs fetches the last pw.logTailLines lines of the container's log,
+// newest last, and reports whether they were cut to logMaxBytes.
+//
+// The status being handled still shows the container terminated, not yet
+// restarted, so its log is the current one of that container rather than
+// Previous: asking for Previous here would return the run before it, or
+// nothing on a first failure. Once the kubelet has restarted the
+// container the current log is the new run's, so a capture that loses that
+// race returns the new run's first lines.
+func (pw *PodWatcher) tailLogs(ctx context.Context, pod *corev1.Pod, container string) ([]string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, logFetchTimeout)
+	defer cancel()
+	stream, err := pw.client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &pw.logTailLines,
+	}).Stream(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer stream.Close()
+	// Keep a rolling tail: N lines can still be megabytes.
+	var data []byte
+	truncated := false
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Read(buf)
+		data = append(data, buf[:n]...)
+		if len(data) > logMaxBytes {
+			data = append(data[:0], data[len(data)-logMaxBytes:]...)
+			truncated = true
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if truncated {
+		// Drop the partial line the cut left at the front.
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return []string{}, truncated, nil
+	}
+	return strings.Split(text, "\n"), truncated, nil
+}
@@ -0,0 +1,316 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// DeploymentWatcher records rollouts so that a CrashLoopBackOff or OOMKill
+// following a deploy has its precursor in the timeline. A rollout is detected
+// as a change in the hash of .spec.template — replica-only scaling does not
+// produce a DeploymentRolledOut event.
+type DeploymentWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+
+	// templateCache holds the last-seen pod template per deployment.
+	// Key: "<namespace>/<name>"
+	templateCache map[string]workloadTemplate
+	// stalled holds the deployments whose progress deadline is exceeded,
+	// so DeploymentStalled is emitted once per stall.
+	stalled    map[string]bool
+	checkpoint *Checkpoint
+	// primed is set once templateCache has been filled by a list.
+	primed bool
+}
+
+type workloadTemplate struct {
+	hash      string
+	images    map[string]string                      // container name → image
+	resources map[string]corev1.ResourceRequirements // container name → requests and limits
+	probes    map[string]containerProbes             // container name → probes
+	revision  string
+}
+
+func NewDeploymentWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *DeploymentWatcher {
+	return &DeploymentWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "deployment_watcher"), templateCache: map[string]workloadTemplate{}, stalled: map[string]bool{}}
+}
+
+// UseCheckpoint enables resourceVersion checkpointing for this watcher.
+func (dw *DeploymentWatcher) UseCheckpoint(cp *Checkpoint) {
+	dw.checkpoint = cp
+}
+
+func (dw *DeploymentWatcher) Watch(ctx context.Context) error {
+	dw.log.Info("starting", "namespace", dw.namespace)
+	cpKey := checkpointKey("deployment_watcher", dw.namespace)
+	return watchWithBackoff(ctx, dw.log, "deployment_watcher", dw.namespace, cpKey, dw.checkpoint, dw.emitter,
+		func(ctx context.Context, rv string, alive func()) (string, error) {
+			return dw.watchOnce(ctx, rv, cpKey, alive)
+		})
+}
+
+func (dw *DeploymentWatcher) watchOnce(ctx context.Context, rv, cpKey string, alive func()) (string, error) {
+	// Resuming from a checkpoint, the cache is filled as the deployments
+	// were at the checkpointed resourceVersion: the watch then replays the
+	// changes since, and a rollout while the collector was down is told
+	// from a status update by the template it had before.
+	if rv == "" || !dw.primed {
+		listRV, err := dw.primeCache(ctx, rv)
+		if isExpired(err) {
+			return rv, errWatchExpired
+		}
+		if err != nil {
+			return rv, fmt.Errorf("deployment list failed: %w", err)
+		}
+		rv = listRV
+	}
+	opts := dw.selectors.listOptions()
+	opts.ResourceVersion = rv
+	w, err := dw.client.AppsV1().Deployments(dw.namespace).Watch(ctx, opts)
+	if isExpired(err) {
+		return rv, errWatchExpired
+	}
+	if err != nil {
+		return rv, fmt.Errorf("deployment watch failed: %w", err)
+	}
+	defer w.Stop()
+	alive()
+	for {
+		select {
+		case <-ctx.Done():
+			return rv, nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return rv, errWatchClosed
+			}
+			if expiredEvent(event) {
+				return rv, errWatchExpired
+			}
+			alive()
+			dw.handleEvent(event)
+			if v := resourceVersionOf(event.Object); v != "" {
+				rv = v
+			}
+			dw.checkpoint.Record(cpKey, event.Object)
+		}
+	}
+}
+
+func (dw *DeploymentWatcher) handleEvent(event watch.Event) {
+	d, ok := event.Object.(*appsv1.Deployment)
+	if !ok {
+		return
+	}
+	key := d.Namespace + "/" + d.Name
+	current := templateOf(d)
+	switch event.Type {
+	case watch.Added:
+		if _, known := dw.templateCache[key]; !known {
+			dw.templateCache[key] = current
+		}
+	case watch.Modified:
+		dw.inspectProgress(d)
+		previous, known := dw.templateCache[key]
+		if known && previous.hash == current.hash {
+			return
+		}
+		dw.captureRollout(d, previous, current)
+		emitResourceChanges(dw.emitter, dw.log, "Deployment", d.ObjectMeta, previous, current)
+		emitProbeChanges(dw.emitter, dw.log, "Deployment", d.ObjectMeta, previous, current)
+		dw.templateCache[key] = current
+	case watch.Deleted:
+		delete(dw.templateCache, key)
+		delete(dw.stalled, key)
+	}
+}
+
+// inspectProgress emits DeploymentStalled when the deployment controller
+// marks a rollout as past its progressDeadlineSeconds: the new pods never
+// became ready, whether they crashed or never started at all.
+func (dw *DeploymentWatcher) inspectProgress(d *appsv1.Deployment) {
+	key := d.Namespace + "/" + d.Name
+	var progressing *appsv1.DeploymentCondition
+	for i := range d.Status.Conditions {
+		if d.Status.Conditions[i].Type == appsv1.DeploymentProgressing {
+			progressing = &d.Status.Conditions[i]
+		}
+	}
+	stalled := progressing != nil && progressing.Status == corev1.ConditionFalse && progressing.Reason == "ProgressDeadlineExceeded"
+	if !stalled || dw.stalled[key] {
+		dw.stalled[key] = stalled
+		return
+	}
+	dw.stalled[key] = true
+	var deadline int32
+	if d.Spec.ProgressDeadlineSeconds != nil {
+		deadline = *d.Spec.ProgressDeadlineSeconds
+	}
+	var replicas int32 = 1
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	dw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: progressing.LastTransitionTime.Time,
+		EventType:  "DeploymentStalled",
+		Namespace:  d.Namespace,
+		Payload: map[string]interface{}{
+			"deployment_name":           d.Name,
+			"namespace":                 d.Namespace,
+			"workload":                  "Deployment/" + d.Name,
+			"resource_version":          d.ResourceVersion,
+			"revision":                  d.Annotations["deployment.kubernetes.io/revision"],
+			"reason":                    progressing.Reason,
+			"message":                   progressing.Message,
+			"progress_deadline_seconds": deadline,
+			"replicas":                  replicas,
+			"ready_replicas":            d.Status.ReadyReplicas,
+			"updated_replicas":          d.Status.UpdatedReplicas,
+			"unavailable_replicas":      d.Status.UnavailableReplicas,
+		},
+	})
+	dw.log.Info("DeploymentStalled", "deployment", d.Namespace+"/"+d.Name, "ready", d.Status.ReadyReplicas, "replicas", replicas)
+}
+
+func (dw *DeploymentWatcher) captureRollout(d *appsv1.Deployment, previous, current workloadTemplate) {
+	var replicas int32 = 1
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+
+	// The deployment controller bumps the revision annotation after it
+	// observes the template change, so "revision" may still hold the
+	// previous value on this event. generation is always current.
+	dw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: lastChanged(d.ObjectMeta),
+		EventType:  "DeploymentRolledOut",
+		Namespace:  d.Namespace,
+		Payload: map[string]interface{}{
+			"deployment_name":        d.Name,
+			"namespace":              d.Namespace,
+			"resource_version":       d.ResourceVersion,
+			"generation":             d.Generation,
+			"previous_revision":      previous.revision,
+			"revision":               current.revision,
+			"old_template_hash":      previous.hash,
+			"new_template_hash":      current.hash,
+			"replicas":               replicas,
+			"ready_replicas":         d.Status.ReadyReplicas,
+			"updated_replicas":       d.Status.UpdatedReplicas,
+			"image_changes":          imageChanges(previous.images, current.images),
+			"strategy":               string(d.Spec.Strategy.Type),
+			"strategy_params":        rolloutStrategyParams(d.Spec.Strategy),
+			"selector":               metav1.FormatLabelSelector(d.Spec.Selector),
+			"config_references":      templateConfigReferences(d.Spec.Template.Spec),
+			"previous_template_seen": previous.hash != "",
+		},
+	})
+	dw.log.Info("rollout", "deployment", d.Namespace+"/"+d.Name, "revision", current.revision, "strategy", d.Spec.Strategy.Type)
+}
+
+// primeCache lists the deployments into templateCache, as they are now or,
+// if rv is set, exactly as they were at rv.
+func (dw *DeploymentWatcher) primeCache(ctx context.Context, rv string) (string, error) {
+	opts := dw.selectors.listOptions()
+	if rv != "" {
+		opts.ResourceVersion = rv
+		opts.ResourceVersionMatch = metav1.ResourceVersionMatchExact
+	}
+	deployments, err := dw.client.AppsV1().Deployments(dw.namespace).List(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		dw.templateCache[d.Namespace+"/"+d.Name] = templateOf(d)
+	}
+	dw.primed = true
+	dw.log.Info("cache primed", "deployments", len(deployments.Items), "resource_version", rv)
+	return deployments.ResourceVersion, nil
+}
+
+func templateOf(d *appsv1.Deployment) workloadTemplate {
+	return podTemplateOf(d.Spec.Template, d.Annotations["deployment.kubernetes.io/revision"])
+}
+
+func podTemplateOf(tmpl corev1.PodTemplateSpec, revision string) workloadTemplate {
+	images := map[string]string{}
+	resources := map[string]corev1.ResourceRequirements{}
+	probes := map[string]containerProbes{}
+	for _, c := range slices.Concat(tmpl.Spec.InitContainers, tmpl.Spec.Containers) {
+		images[c.Name] = c.Image
+		resources[c.Name] = c.Resources
+		probes[c.Name] = probesOf(c)
+	}
+	return workloadTemplate{
+		hash:      templateHash(tmpl),
+		images:    images,
+		resources: resources,
+		probes:    probes,
+		revision:  revision,
+	}
+}
+
+// templateHash hashes the JSON encoding of the pod template. encoding/json
+// sorts map keys, so labels and annotations hash deterministically.
+func templateHash(tmpl corev1.PodTemplateSpec) string {
+	data, err := json.Marshal(tmpl)
+	if err != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+func imageChanges(previous, current map[string]string) []map[string]string {
+	changes := []map[string]string{}
+	for name, image := range current {
+		if old, ok := previous[name]; !ok || old != image {
+			changes = append(changes, map[string]string{"container": name, "old_image": previous[name], "new_image": image})
+		}
+	}
+	for name, old := range previous {
+		if _, ok := current[name]; !ok {
+			changes = append(changes, map[string]string{"container": name, "old_image": old, "new_image": ""})
+		}
+	}
+	return changes
+}
+
+func rolloutStrategyParams(s appsv1.DeploymentStrategy) map[string]string {
+	params := map[string]string{}
+	if s.RollingUpdate != nil {
+		if s.RollingUpdate.MaxSurge != nil {
+			params["max_surge"] = s.RollingUpdate.MaxSurge.String()
+		}
+		if s.RollingUpdate.MaxUnavailable != nil {
+			params["max_unavailable"] = s.RollingUpdate.MaxUnavailable.String()
+		}
+	}
+	return params
+}
+
+// templateConfigReferences wraps a pod template spec so the same extraction
+// used for live pods applies to the template being rolled out.
+func templateConfigReferences(spec corev1.PodSpec) map[string]interface{} {
+	return extractConfigReferences(&corev1.Pod{Spec: spec})
+}
@@ -0,0 +1,91 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testDeployment(rv, image string, ready int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "prod", UID: "uid-deploy", ResourceVersion: rv},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "api", Image: image}}}},
+		},
+		Status: appsv1.DeploymentStatus{ReadyReplicas: ready},
+	}
+}
+
+func resumingCheckpoint(t *testing.T, key, rv string) *Checkpoint {
+	t.Helper()
+	cp, err := LoadCheckpoint(t.TempDir(), "", discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.rvs[key] = rv
+	return cp
+}
+
+// Resuming, the deployments are listed as they were at the checkpoint, so
+// a status update replayed by the watch is not a rollout and a template
+// change is one, against the template it replaced.
+func TestDeploymentResumeFillsCacheAtCheckpoint(t *testing.T) {
+	h := newHarness(t, testDeployment("100", "api:1.4", 1))
+	dw := NewDeploymentWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger())
+	dw.UseCheckpoint(resumingCheckpoint(t, checkpointKey("deployment_watcher", "prod"), "100"))
+	h.run("deployments", dw.Watch)
+
+	var listed []metav1.ListOptions
+	for _, a := range h.client.Actions() {
+		if l, ok := a.(k8stesting.ListActionImpl); ok {
+			listed = append(listed, l.ListOptions)
+		}
+	}
+	if len(listed) != 1 || listed[0].ResourceVersion != "100" || listed[0].ResourceVersionMatch != metav1.ResourceVersionMatchExact {
+		t.Fatalf("listed with %+v, want one list exactly at the checkpoint", listed)
+	}
+
+	h.Modify(testDeployment("101", "api:1.4", 2))
+	h.Modify(testDeployment("102", "api:1.5", 2))
+	h.waitForEvents(1)
+	time.Sleep(100 * time.Millisecond)
+
+	events := h.emitter.Events()
+	if len(events) != 1 || events[0].EventType != "DeploymentRolledOut" {
+		t.Fatalf("got %d events, want the one DeploymentRolledOut", len(events))
+	}
+	if p := events[0].Payload; p["old_template_hash"] == "" || p["previous_template_seen"] != true {
+		t.Errorf("rollout without the template it replaced: %v", p)
+	}
+}
+
+// A checkpoint compacted away is dropped and the deployments relisted as
+// they are now.
+func TestDeploymentResumeFromExpiredCheckpointRelists(t *testing.T) {
+	h := newHarness(t, testDeployment("200", "api:1.4", 1))
+	h.client.PrependReactor("list", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.ListActionImpl).ListOptions.ResourceVersion != "" {
+			return true, nil, apierrors.NewResourceExpired("too old resource version: 100")
+		}
+		return false, nil, nil
+	})
+	cp := resumingCheckpoint(t, checkpointKey("deployment_watcher", "prod"), "100")
+	dw := NewDeploymentWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger())
+	dw.UseCheckpoint(cp)
+	h.run("deployments", dw.Watch)
+
+	h.Modify(testDeployment("201", "api:1.4", 2))
+	time.Sleep(100 * time.Millisecond)
+	if got := h.emitter.Events(); len(got) != 0 {
+		t.Fatalf("status update after relisting emitted %s", got[0].EventType)
+	}
+	if rv := cp.ResourceVersion(checkpointKey("deployment_watcher", "prod")); rv != "201" {
+		t.Errorf("checkpoint at %q, want 201", rv)
+	}
+}
@@ -0,0 +1,243 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// DefaultTrafficLossGrace is how long a drained Service may stay without
+// ready endpoints before TrafficLoss is emitted: a rollout replacing every
+// pod at once recovers within it.
+const DefaultTrafficLossGrace = time.Minute
+
+// EndpointSliceWatcher follows the ready endpoints of every Service through
+// its EndpointSlices. When every backend of a Service goes NotReady,
+// traffic to it blackholes with no pod deletion to observe.
+// EndpointsDrained marks the Service's ready endpoints dropping to the
+// threshold, zero by default, and names the pods that left the ready set.
+// If a Service lost its last ready endpoint and none is back after the
+// grace period, TrafficLoss records that requests to it, and to the
+// Ingresses routing to it, have been failing since. The collector sees no
+// traffic itself, so TrafficLoss is inferred from the endpoints and says
+// so. Both are P009 effects of a selector change, and stand on their own
+// when pods fail readiness.
+type EndpointSliceWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	grace     time.Duration
+	threshold int
+	ingresses *IngressWatcher
+
+	// mu guards ready and drainedAt against the grace period checks.
+	mu sync.Mutex
+	// ready holds the ready endpoints of each Service per EndpointSlice.
+	// Key: "<namespace>/<service>", then the slice name.
+	ready     map[string]map[string]map[string]readyEndpoint
+	drainedAt map[string]time.Time // Services without a ready endpoint
+	checks    sync.WaitGroup
+}
+
+// readyEndpoint is a ready endpoint, keyed by its pod's UID, or by its
+// addresses when it has no pod behind it.
+type readyEndpoint struct {
+	pod string
+	uid string
+}
+
+func NewEndpointSliceWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger, grace time.Duration) *EndpointSliceWatcher {
+	if grace <= 0 {
+		grace = DefaultTrafficLossGrace
+	}
+	return &EndpointSliceWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "endpointslice_watcher"), grace: grace,
+		ready:     map[string]map[string]map[string]readyEndpoint{},
+		drainedAt: map[string]time.Time{},
+	}
+}
+
+// DrainThreshold makes EndpointsDrained fire when a Service's ready
+// endpoints drop to n or fewer, rather than to zero: a Service sized for
+// five backends is in trouble with one. TrafficLoss still needs zero.
+func (ew *EndpointSliceWatcher) DrainThreshold(n int) {
+	ew.threshold = n
+}
+
+// UseIngresses names, in TrafficLoss events, the Ingresses routing to the
+// drained Service, as iw last saw them.
+func (ew *EndpointSliceWatcher) UseIngresses(iw *IngressWatcher) {
+	ew.ingresses = iw
+}
+
+func (ew *EndpointSliceWatcher) Watch(ctx context.Context) error {
+	ew.log.Info("starting", "namespace", ew.namespace)
+	factory := newInformerFactory(ew.client, ew.namespace, ew.selectors)
+	informer := factory.Discovery().V1().EndpointSlices().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(func(event watch.Event) {
+		ew.handleEvent(ctx, event)
+	})); err != nil {
+		return fmt.Errorf("endpointslice informer registration failed: %w", err)
+	}
+	// Grace period checks emit when their period ends or ctx ends; Watch
+	// returns only once they have.
+	defer ew.checks.Wait()
+	return runInformer(ctx, ew.log, "endpointslice_watcher", ew.namespace, ew.emitter, factory, informer)
+}
+
+func (ew *EndpointSliceWatcher) handleEvent(ctx context.Context, event watch.Event) {
+	slice, ok := event.Object.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	service := slice.Labels[discoveryv1.LabelServiceName]
+	if service == "" {
+		return // not managed for a Service
+	}
+	key := slice.Namespace + "/" + service
+
+	ew.mu.Lock()
+	before := ew.readyLocked(key)
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		if ew.ready[key] == nil {
+			ew.ready[key] = map[string]map[string]readyEndpoint{}
+		}
+		ew.ready[key][slice.Name] = readyEndpoints(slice)
+	case watch.Deleted:
+		// The slices of a deleted Service go with it; that is not a
+		// drain, and ServiceChanged records the deletion.
+		delete(ew.ready[key], slice.Name)
+		if len(ew.ready[key]) == 0 {
+			delete(ew.ready, key)
+			delete(ew.drainedAt, key)
+		}
+		ew.mu.Unlock()
+		return
+	}
+	after := ew.readyLocked(key)
+	drainedAt, wasDrained := ew.drainedAt[key]
+	now := time.Now()
+	emptied := len(before) > 0 && len(after) == 0
+	switch {
+	case emptied:
+		ew.drainedAt[key] = now
+	case wasDrained && len(after) > 0:
+		delete(ew.drainedAt, key)
+	}
+	ew.mu.Unlock()
+
+	if len(before) > ew.threshold && len(after) <= ew.threshold {
+		ew.captureDrained(slice, service, before, after, now)
+	}
+	switch {
+	case emptied:
+		ew.checks.Go(func() { ew.awaitTrafficLoss(ctx, slice.Namespace, service, now) })
+	case wasDrained && len(after) > 0:
+		ew.log.Info("endpoints restored", "service", key, "ready", len(after), "drained_for", now.Sub(drainedAt).Round(time.Second))
+	}
+}
+
+// readyLocked merges the ready endpoints of all the Service's slices.
+func (ew *EndpointSliceWatcher) readyLocked(key string) map[string]readyEndpoint {
+	all := map[string]readyEndpoint{}
+	for _, eps := range ew.ready[key] {
+		maps.Copy(all, eps)
+	}
+	return all
+}
+
+// readyEndpoints returns the endpoints of a slice that receive traffic. A
+// nil ready condition means ready.
+func readyEndpoints(slice *discoveryv1.EndpointSlice) map[string]readyEndpoint {
+	eps := map[string]readyEndpoint{}
+	for _, ep := range slice.Endpoints {
+		if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+			continue
+		}
+		if ref := ep.TargetRef; ref != nil && ref.Kind == "Pod" {
+			eps[string(ref.UID)] = readyEndpoint{pod: ref.Name, uid: string(ref.UID)}
+			continue
+		}
+		eps[fmt.Sprint(ep.Addresses)] = readyEndpoint{}
+	}
+	return eps
+}
+
+func (ew *EndpointSliceWatcher) captureDrained(slice *discoveryv1.EndpointSlice, service string, before, after map[string]readyEndpoint, at time.Time) {
+	var left []map[string]interface{}
+	for _, k := range slices.Sorted(maps.Keys(before)) {
+		if _, still := after[k]; still || before[k].uid == "" {
+			continue
+		}
+		left = append(left, map[string]interface{}{"pod_name": before[k].pod, "pod_uid": before[k].uid})
+	}
+	ew.emitter.Emit(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: at,
+		EventType: "EndpointsDrained",
+		PatternID: patterns.PatternServiceSelector,
+		Namespace: slice.Namespace,
+		Payload: map[string]interface{}{
+			"service_name":             service,
+			"previous_ready_endpoints": len(before),
+			"ready_endpoints":          len(after),
+			"threshold":                ew.threshold,
+			"pods_left":                left,
+			"endpoint_slice":           slice.Name,
+			"address_type":             string(slice.AddressType),
+			"resource_version":         slice.ResourceVersion,
+		},
+	})
+	ew.log.Info("EndpointsDrained", "service", slice.Namespace+"/"+service, "previous_ready", len(before), "ready", len(after))
+}
+
+// awaitTrafficLoss emits TrafficLoss once the grace period after the last
+// ready endpoint left is over, unless one came back in the meantime.
+func (ew *EndpointSliceWatcher) awaitTrafficLoss(ctx context.Context, namespace, service string, drainedAt time.Time) {
+	deadline := drainedAt.Add(ew.grace)
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Until(deadline)):
+	}
+	key := namespace + "/" + service
+	ew.mu.Lock()
+	still := ew.drainedAt[key].Equal(drainedAt)
+	ew.mu.Unlock()
+	if !still {
+		return
+	}
+	payload := map[string]interface{}{
+		"service_name":    service,
+		"drained_at":      drainedAt.UTC().Format(time.RFC3339Nano),
+		"drained_seconds": ew.grace.Seconds(),
+		"inferred_from":   "endpoints",
+	}
+	if ew.ingresses != nil {
+		payload["ingresses"] = ew.ingresses.RoutesTo(namespace, service)
+	}
+	// Timestamped at the end of the grace period: that is the instant the
+	// loss was established.
+	ew.emitter.Emit(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: deadline,
+		EventType: "TrafficLoss",
+		PatternID: patterns.PatternServiceSelector,
+		Namespace: namespace,
+		Payload:   payload,
+	})
+	ew.log.Info("TrafficLoss", "service", key, "drained_for", ew.grace)
+}
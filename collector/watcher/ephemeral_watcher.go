@@ -3,6 +3,7 @@ package watcher
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -30,46 +31,80 @@ import (
 type EphemeralWatcher struct {
 	client    kubernetes.Interface
 	namespace string
-	emitter   *emitter.JSONEmitter
+	emitter   emitter.Emitter
+	log       *slog.Logger
 
 	// lastSeen tracks the last-known termination state per ephemeral container
 	// to avoid double-firing on repeated Modified events for the same exit.
 	// Key: "<namespace>/<pod>/<container-name>"
 	lastSeen map[string]bool // true = terminated already captured
+
+	checkpoint *Checkpoint
+	owners     *Owners
 }
 
-func NewEphemeralWatcher(client kubernetes.Interface, namespace string, e *emitter.JSONEmitter) *EphemeralWatcher {
+func NewEphemeralWatcher(client kubernetes.Interface, namespace string, e emitter.Emitter, log *slog.Logger) *EphemeralWatcher {
 	return &EphemeralWatcher{
 		client:    client,
 		namespace: namespace,
 		emitter:   e,
+		log:       log.With("component", "ephemeral_watcher"),
 		lastSeen:  make(map[string]bool),
 	}
 }
 
+// UseOwners resolves the workload of pods in emitted events through o.
+func (ew *EphemeralWatcher) UseOwners(o *Owners) {
+	ew.owners = o
+}
+
+// UseCheckpoint enables resourceVersion checkpointing for this watcher.
+func (ew *EphemeralWatcher) UseCheckpoint(cp *Checkpoint) {
+	ew.checkpoint = cp
+}
+
 func (ew *EphemeralWatcher) Watch(ctx context.Context) error {
-	fmt.Printf("[ephemeral_watcher] Starting namespace=%q\n", ew.namespace)
-	w, err := ew.client.CoreV1().Pods(ew.namespace).Watch(ctx, metav1.ListOptions{})
+	ew.log.Info("starting", "namespace", ew.namespace)
+	cpKey := checkpointKey("ephemeral_watcher", ew.namespace)
+	return watchWithBackoff(ctx, ew.log, "ephemeral_watcher", ew.namespace, cpKey, ew.checkpoint, ew.emitter,
+		func(ctx context.Context, rv string, alive func()) (string, error) {
+			return ew.watchOnce(ctx, rv, cpKey, alive)
+		})
+}
+
+func (ew *EphemeralWatcher) watchOnce(ctx context.Context, rv, cpKey string, alive func()) (string, error) {
+	w, err := ew.client.CoreV1().Pods(ew.namespace).Watch(ctx, metav1.ListOptions{ResourceVersion: rv})
+	if isExpired(err) {
+		return rv, errWatchExpired
+	}
 	if err != nil {
-		return fmt.Errorf("ephemeral pod watch failed: %w", err)
+		return rv, fmt.Errorf("ephemeral pod watch failed: %w", err)
 	}
 	defer w.Stop()
+	alive()
 
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Println("[ephemeral_watcher] Stopped.")
-			return nil
+			return rv, nil
 		case evt, ok := <-w.ResultChan():
 			if !ok {
-				return ew.Watch(ctx)
+				return rv, errWatchClosed
+			}
+			if expiredEvent(evt) {
+				return rv, errWatchExpired
 			}
+			alive()
 			if evt.Type == watch.Modified {
 				pod, ok := evt.Object.(*corev1.Pod)
 				if ok {
 					ew.checkEphemeralStatuses(pod)
 				}
 			}
+			if v := resourceVersionOf(evt.Object); v != "" {
+				rv = v
+			}
+			ew.checkpoint.Record(cpKey, evt.Object)
 		}
 	}
 }
@@ -109,40 +144,47 @@ func (ew *EphemeralWatcher) captureTermination(pod *corev1.Pod, status corev1.Co
 
 	exitClass := classifyEphemeralExit(term.ExitCode, term.Reason)
 
+	payload := map[string]interface{}{
+		"container_name":    status.Name,
+		"image":             status.Image,
+		"image_id":          status.ImageID,
+		"container_id":      status.ContainerID,
+		"target_container":  targetContainer,
+		"exit_code":         term.ExitCode,
+		"reason":            term.Reason,
+		"exit_class":        exitClass,
+		"exit_code_class":   classifyExitCode(term.ExitCode, term.Reason),
+		"started_at":        term.StartedAt.UTC().Format(time.RFC3339Nano),
+		"finished_at":       term.FinishedAt.UTC().Format(time.RFC3339Nano),
+		"duration_seconds":  durationSeconds,
+		"pod_phase":         string(pod.Status.Phase),
+		"pod_restart_count": ephemeralTotalRestarts(pod),
+		// Documented API boundary — not an OMA limitation
+		"log_content":       "NOT_CAPTURABLE_VIA_API",
+		"log_boundary_note": "stdout/stderr only accessible via kubectl logs while container is running",
+		"horizon":           "H3",
+		"spec_exclusion":    "EphemeralContainerStatus.lastState excluded by Kubernetes API spec",
+	}
+	ew.owners.annotate(payload, pod)
 	ew.emitter.Emit(emitter.CausalEvent{
-		ID:        generateID(),
-		Timestamp: time.Now(),
-		EventType: "EphemeralContainerTerminated",
-		PatternID: patterns.PatternEphemeral,
-		PodName:   pod.Name,
-		Namespace: pod.Namespace,
-		NodeName:  pod.Spec.NodeName,
-		PodUID:    string(pod.UID),
-		Payload: map[string]interface{}{
-			"container_name":    status.Name,
-			"image":             status.Image,
-			"image_id":          status.ImageID,
-			"container_id":      status.ContainerID,
-			"target_container":  targetContainer,
-			"exit_code":         term.ExitCode,
-			"reason":            term.Reason,
-			"exit_class":        exitClass,
-			"started_at":        term.StartedAt.UTC().Format(time.RFC3339Nano),
-			"finished_at":       term.FinishedAt.UTC().Format(time.RFC3339Nano),
-			"duration_seconds":  durationSeconds,
-			"pod_phase":         string(pod.Status.Phase),
-			"pod_restart_count": ephemeralTotalRestarts(pod),
-			// Documented API boundary — not an OMA limitation
-			"log_content":       "NOT_CAPTURABLE_VIA_API",
-			"log_boundary_note": "stdout/stderr only accessible via kubectl logs while container is running",
-			"horizon":           "H3",
-			"spec_exclusion":    "EphemeralContainerStatus.lastState excluded by Kubernetes API spec",
-		},
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: term.FinishedAt.Time,
+		EventType:  "EphemeralContainerTerminated",
+		PatternID:  patterns.PatternEphemeral,
+		PodName:    pod.Name,
+		Namespace:  pod.Namespace,
+		NodeName:   pod.Spec.NodeName,
+		PodUID:     string(pod.UID),
+		Payload:    payload,
 	})
 
-	fmt.Printf("[ephemeral_watcher] P005: pod=%s/%s container=%s exit_code=%d duration=%.1fs class=%s\n",
-		pod.Namespace, pod.Name, status.Name,
-		term.ExitCode, durationSeconds, exitClass,
+	ew.log.Info("EphemeralContainerExited",
+		"pod", pod.Namespace+"/"+pod.Name,
+		"container", status.Name,
+		"exit_code", term.ExitCode,
+		"duration_seconds", durationSeconds,
+		"exit_class", exitClass,
 	)
 }
 
@@ -3,6 +3,7 @@ package watcher
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -21,69 +22,211 @@ import (
 // rejected and why) exist only as transient Event objects. Once pruned,
 // the causal link between a pod's placement and its subsequent failure
 // is permanently severed.
+//
+// Beyond the scheduler, every Warning event and a handful of notable Normal
+// ones (Killing, Preempting) are emitted as K8sEvent, so kubelet and
+// node-problem-detector reasons such as BackOff, Unhealthy or OOMKilling
+// sit next to the watcher-derived events in the causal record.
 type EventWatcher struct {
-	client    kubernetes.Interface
-	namespace string
-	emitter   *emitter.JSONEmitter
+	client     kubernetes.Interface
+	namespace  string
+	emitter    emitter.Emitter
+	log        *slog.Logger
+	checkpoint *Checkpoint
+	volumes    *PVCWatcher
+	probes     *ProbeFailures
+	lag        *LagMonitor
+}
+
+func NewEventWatcher(client kubernetes.Interface, namespace string, e emitter.Emitter, log *slog.Logger) *EventWatcher {
+	return &EventWatcher{client: client, namespace: namespace, emitter: e, log: log.With("component", "event_watcher")}
+}
+
+// UseCheckpoint enables resourceVersion checkpointing for this watcher.
+func (ew *EventWatcher) UseCheckpoint(cp *Checkpoint) {
+	ew.checkpoint = cp
 }
 
-func NewEventWatcher(client kubernetes.Interface, namespace string, e *emitter.JSONEmitter) *EventWatcher {
-	return &EventWatcher{client: client, namespace: namespace, emitter: e}
+// UseVolumes hands FailedMount and FailedAttachVolume events to vw, which
+// resolves them to the PersistentVolumeClaims involved.
+func (ew *EventWatcher) UseVolumes(vw *PVCWatcher) {
+	ew.volumes = vw
+}
+
+// UseProbeFailures hands the kubelet's Unhealthy events to pf, for the pod
+// watcher to find the probe failures behind a restart.
+func (ew *EventWatcher) UseProbeFailures(pf *ProbeFailures) {
+	ew.probes = pf
+}
+
+// UseLagMonitor measures the observation lag of events through lm, from
+// their last occurrence.
+func (ew *EventWatcher) UseLagMonitor(lm *LagMonitor) {
+	ew.lag = lm
 }
 
 func (ew *EventWatcher) Watch(ctx context.Context) error {
-	fmt.Printf("[event_watcher] Starting namespace=%q\n", ew.namespace)
+	ew.log.Info("starting", "namespace", ew.namespace)
+	ew.lag.start("event_watcher", ew.namespace)
+	cpKey := checkpointKey("event_watcher", ew.namespace)
+	return watchWithBackoff(ctx, ew.log, "event_watcher", ew.namespace, cpKey, ew.checkpoint, ew.emitter,
+		func(ctx context.Context, rv string, alive func()) (string, error) {
+			return ew.watchOnce(ctx, rv, cpKey, alive)
+		})
+}
+
+func (ew *EventWatcher) watchOnce(ctx context.Context, rv, cpKey string, alive func()) (string, error) {
 	// Note: source.component is NOT a supported field selector in the
 	// Kubernetes watch API. We watch all events and filter in handleEvent.
-	w, err := ew.client.CoreV1().Events(ew.namespace).Watch(ctx, metav1.ListOptions{})
+	w, err := ew.client.CoreV1().Events(ew.namespace).Watch(ctx, metav1.ListOptions{ResourceVersion: rv})
+	if isExpired(err) {
+		return rv, errWatchExpired
+	}
 	if err != nil {
-		return fmt.Errorf("event watch failed: %w", err)
+		return rv, fmt.Errorf("event watch failed: %w", err)
 	}
 	defer w.Stop()
+	alive()
 
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Println("[event_watcher] Stopped.")
-			return nil
+			return rv, nil
 		case evt, ok := <-w.ResultChan():
 			if !ok {
-				return ew.Watch(ctx)
+				return rv, errWatchClosed
+			}
+			if expiredEvent(evt) {
+				return rv, errWatchExpired
 			}
+			alive()
 			if evt.Type == watch.Added || evt.Type == watch.Modified {
-				ew.handleEvent(evt)
+				ew.handleEvent(ctx, evt)
 			}
+			if v := resourceVersionOf(evt.Object); v != "" {
+				rv = v
+			}
+			ew.checkpoint.Record(cpKey, evt.Object)
 		}
 	}
 }
 
-func (ew *EventWatcher) handleEvent(evt watch.Event) {
+func (ew *EventWatcher) handleEvent(ctx context.Context, evt watch.Event) {
 	k8sEvent, ok := evt.Object.(*corev1.Event)
 	if !ok {
 		return
 	}
 
-	// Filter to scheduler events only — source.component check done here
-	// because the watch API does not support it as a field selector.
-	if k8sEvent.Source.Component != "default-scheduler" {
+	// Scheduler events keep their dedicated H2 record — source.component
+	// check done here because the watch API does not support it as a field
+	// selector.
+	reason := k8sEvent.Reason
+	if k8sEvent.Source.Component == "default-scheduler" &&
+		(reason == "FailedScheduling" || reason == "Scheduled" || reason == "Preempting") {
+		ew.handleSchedulerEvent(k8sEvent)
 		return
 	}
+	if k8sEvent.Type == corev1.EventTypeWarning || notableNormalReasons[reason] {
+		ew.handleK8sEvent(k8sEvent)
+	}
+	if k8sEvent.Type == corev1.EventTypeWarning {
+		ew.volumes.HandleMountFailure(ctx, k8sEvent)
+	}
+	if reason == "Unhealthy" {
+		ew.probes.record(k8sEvent)
+	}
+}
 
-	reason := k8sEvent.Reason
-	if reason != "FailedScheduling" && reason != "Scheduled" && reason != "Preempting" {
-		return
+// notableNormalReasons are Normal-type events worth recording. Most Normal
+// events (Pulled, Created, Started) are routine and skipped.
+var notableNormalReasons = map[string]bool{
+	"Killing":    true,
+	"Preempting": true,
+}
+
+// k8sEventPatterns maps well-known event reasons to the pattern they are a
+// precursor of. OOMKilling (node-problem-detector) and SystemOOM (kubelet)
+// are reported on the node when the kernel kills a process, and NodeNotReady
+// often follows sustained memory pressure; all three precede container
+// OOMKills on that node. FailedMount on a configMap volume blocks the
+// kubelet sync P003 observes.
+var k8sEventPatterns = map[string]string{
+	"OOMKilling":   patterns.PatternOOMKill,
+	"SystemOOM":    patterns.PatternOOMKill,
+	"NodeNotReady": patterns.PatternOOMKill,
+	"FailedMount":  patterns.PatternConfigMapMount,
+}
+
+func (ew *EventWatcher) handleK8sEvent(k8sEvent *corev1.Event) {
+	obj := k8sEvent.InvolvedObject
+	out := emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: lastOccurred(k8sEvent),
+		EventType:  "K8sEvent",
+		PatternID:  k8sEventPatterns[k8sEvent.Reason],
+		Namespace:  k8sEvent.Namespace,
+		NodeName:   k8sEvent.Source.Host,
+		Payload: map[string]interface{}{
+			"reason":  k8sEvent.Reason,
+			"message": k8sEvent.Message,
+			"type":    k8sEvent.Type,
+			"count":   k8sEvent.Count,
+			"involved_object": map[string]interface{}{
+				"kind":             obj.Kind,
+				"name":             obj.Name,
+				"namespace":        obj.Namespace,
+				"uid":              string(obj.UID),
+				"field_path":       obj.FieldPath,
+				"resource_version": obj.ResourceVersion,
+			},
+			"first_timestamp":     eventTime(k8sEvent.FirstTimestamp, k8sEvent),
+			"last_timestamp":      eventTime(k8sEvent.LastTimestamp, k8sEvent),
+			"source_component":    k8sEvent.Source.Component,
+			"source_host":         k8sEvent.Source.Host,
+			"reporting_component": k8sEvent.ReportingController,
+			"event_uid":           string(k8sEvent.UID),
+		},
+	}
+	switch obj.Kind {
+	case "Pod":
+		out.PodName = obj.Name
+		out.PodUID = string(obj.UID)
+	case "Node":
+		out.NodeName = obj.Name
 	}
+	ew.lag.observe(out.Payload, "event_watcher", k8sEvent.Namespace, out.EventType, out.OccurredAt)
+	ew.emitter.Emit(out)
+	ew.log.Debug("K8sEvent", "reason", k8sEvent.Reason, "object", obj.Kind+"/"+obj.Name, "namespace", k8sEvent.Namespace, "count", k8sEvent.Count)
+}
+
+// eventTime formats an Event timestamp. Events written through the
+// events.k8s.io API leave First/LastTimestamp empty and set EventTime
+// instead.
+func eventTime(t metav1.Time, k8sEvent *corev1.Event) string {
+	if t.IsZero() {
+		if k8sEvent.EventTime.IsZero() {
+			return ""
+		}
+		return k8sEvent.EventTime.UTC().Format(time.RFC3339Nano)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (ew *EventWatcher) handleSchedulerEvent(k8sEvent *corev1.Event) {
+	reason := k8sEvent.Reason
 
 	age := time.Since(k8sEvent.FirstTimestamp.Time)
 
-	ew.emitter.Emit(emitter.CausalEvent{
-		ID:        generateID(),
-		Timestamp: time.Now(),
-		EventType: "SchedulerEvent",
-		PatternID: patterns.PatternScheduler,
-		PodName:   k8sEvent.InvolvedObject.Name,
-		Namespace: k8sEvent.Namespace,
-		NodeName:  k8sEvent.Source.Host,
+	out := emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: lastOccurred(k8sEvent),
+		EventType:  "SchedulerEvent",
+		PatternID:  patterns.PatternScheduler,
+		PodName:    k8sEvent.InvolvedObject.Name,
+		Namespace:  k8sEvent.Namespace,
+		NodeName:   k8sEvent.Source.Host,
 		Payload: map[string]interface{}{
 			"reason":           reason,
 			"message":          k8sEvent.Message,
@@ -98,14 +241,15 @@ func (ew *EventWatcher) handleEvent(evt watch.Event) {
 			"horizon":          "H2",
 			"evidence_expires": k8sEvent.FirstTimestamp.Add(60 * time.Minute).UTC().Format(time.RFC3339Nano),
 		},
-	})
-
-	fmt.Printf("[event_watcher] %s pod=%s ns=%s age=%.0fs risk=%s\n",
-		reason,
-		k8sEvent.InvolvedObject.Name,
-		k8sEvent.Namespace,
-		age.Seconds(),
-		schedulerPruningRisk(age),
+	}
+	ew.lag.observe(out.Payload, "event_watcher", k8sEvent.Namespace, out.EventType, out.OccurredAt)
+	ew.emitter.Emit(out)
+
+	ew.log.Info(reason,
+		"pod", k8sEvent.InvolvedObject.Name,
+		"namespace", k8sEvent.Namespace,
+		"age_seconds", age.Seconds(),
+		"pruning_risk", schedulerPruningRisk(age),
 	)
 }
 
@@ -0,0 +1,52 @@
+package watcher
+
+// Values of the exit_code_class payload field: what a container's exit code
+// means, read together with the termination reason so consumers do not
+// have to remember that 137 is SIGKILL and 143 SIGTERM.
+const (
+	ExitClassSuccess = "success"
+	// ExitClassOOMKilled is a SIGKILL the kubelet attributed to the
+	// container's memory limit (reason OOMKilled).
+	ExitClassOOMKilled = "oomkilled"
+	// ExitClassOOMOrKilled is a SIGKILL without that attribution: an
+	// external kill, a liveness probe or grace period running out, or an
+	// OOM the runtime did not report as such.
+	ExitClassOOMOrKilled  = "oom_or_killed"
+	ExitClassGracefulTerm = "graceful_term"
+	ExitClassSegfault     = "segfault"
+	// ExitClassConfigError is a container that never ran its entrypoint:
+	// command not found or not executable, or the runtime refused to
+	// start it.
+	ExitClassConfigError = "config_error"
+	ExitClassAppError    = "app_error"
+)
+
+// configErrorReasons are termination reasons the runtime reports for a
+// container it could not start, whatever the exit code.
+var configErrorReasons = map[string]bool{
+	"ContainerCannotRun":         true,
+	"StartError":                 true,
+	"CreateContainerError":       true,
+	"CreateContainerConfigError": true,
+}
+
+// classifyExitCode maps a terminated container's exit code and reason to
+// one of the ExitClass values.
+func classifyExitCode(code int32, reason string) string {
+	switch {
+	case reason == "OOMKilled":
+		return ExitClassOOMKilled
+	case configErrorReasons[reason], code == 126, code == 127:
+		return ExitClassConfigError
+	case code == 0:
+		return ExitClassSuccess
+	case code == 137:
+		return ExitClassOOMOrKilled
+	case code == 143:
+		return ExitClassGracefulTerm
+	case code == 139:
+		return ExitClassSegfault
+	default:
+		return ExitClassAppError
+	}
+}
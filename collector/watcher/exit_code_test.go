@@ -0,0 +1,32 @@
+package watcher
+
+import "testing"
+
+func TestClassifyExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		code   int32
+		reason string
+		want   string
+	}{
+		{0, "Completed", ExitClassSuccess},
+		{137, "OOMKilled", ExitClassOOMKilled},
+		{0, "OOMKilled", ExitClassOOMKilled}, // the reason wins over the code
+		{137, "Error", ExitClassOOMOrKilled},
+		{137, "", ExitClassOOMOrKilled},
+		{143, "Error", ExitClassGracefulTerm},
+		{139, "Error", ExitClassSegfault},
+		{126, "Error", ExitClassConfigError},
+		{127, "Error", ExitClassConfigError},
+		{128, "ContainerCannotRun", ExitClassConfigError},
+		{0, "StartError", ExitClassConfigError},
+		{1, "CreateContainerConfigError", ExitClassConfigError},
+		{1, "Error", ExitClassAppError},
+		{2, "Error", ExitClassAppError},
+		{255, "Error", ExitClassAppError},
+		{-1, "Unknown", ExitClassAppError},
+	} {
+		if got := classifyExitCode(tc.code, tc.reason); got != tc.want {
+			t.Errorf("classifyExitCode(%d, %q) = %q, want %q", tc.code, tc.reason, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// DefaultFirstSeenCapacity is how many pod UIDs SnapshotOnFirstSeen
+// remembers.
+const DefaultFirstSeenCapacity = 10000
+
+// uidSet is a set of UIDs holding at most its capacity, forgetting the
+// oldest added first.
+type uidSet struct {
+	members map[types.UID]bool
+	order   []types.UID // ring of members, oldest at next once full
+	next    int
+}
+
+func newUIDSet(capacity int) *uidSet {
+	return &uidSet{members: map[types.UID]bool{}, order: make([]types.UID, 0, capacity)}
+}
+
+// add adds uid, reporting whether it was missing.
+func (s *uidSet) add(uid types.UID) bool {
+	if s.members[uid] {
+		return false
+	}
+	if len(s.order) < cap(s.order) {
+		s.order = append(s.order, uid)
+	} else {
+		delete(s.members, s.order[s.next])
+		s.order[s.next] = uid
+		s.next = (s.next + 1) % len(s.order)
+	}
+	s.members[uid] = true
+	return true
+}
+
+// SnapshotOnFirstSeen emits a FirstObserved snapshot of a pod's spec the
+// first time the watcher sees it, so a later incident is compared against
+// the images, resources and configuration the pod started with rather
+// than what it was left with. Up to capacity pod UIDs are remembered; past
+// that the oldest are forgotten, and a forgotten pod that is still running
+// is snapshotted again on its next update.
+func (pw *PodWatcher) SnapshotOnFirstSeen(capacity int) {
+	if capacity <= 0 {
+		capacity = DefaultFirstSeenCapacity
+	}
+	pw.firstSeen = newUIDSet(capacity)
+}
+
+func (pw *PodWatcher) inspectFirstSeen(pod *corev1.Pod) {
+	if pw.firstSeen == nil || !pw.firstSeen.add(pod.UID) {
+		return
+	}
+	state := map[string]interface{}{
+		"uid":               string(pod.UID),
+		"phase":             string(pod.Status.Phase),
+		"node_name":         pod.Spec.NodeName,
+		"qos_class":         string(pod.Status.QOSClass),
+		"service_account":   pod.Spec.ServiceAccountName,
+		"containers":        podContainers(pod),
+		"volumes":           podVolumes(pod),
+		"config_references": extractConfigReferences(pod),
+		"labels":            pod.Labels,
+	}
+	pw.owners.annotate(state, pod)
+	pw.emitter.EmitSnapshot(emitter.Snapshot{
+		ID:           emitter.NewID(),
+		Timestamp:    time.Now(),
+		ObjectKind:   "Pod",
+		ObjectName:   pod.Name,
+		Namespace:    pod.Namespace,
+		TriggerEvent: "FirstObserved",
+		State:        state,
+	})
+}
+
+// podContainers lists a pod's init and app containers with their images,
+// the digests once pulled, and resources.
+func podContainers(pod *corev1.Pod) []map[string]interface{} {
+	digests := map[string]string{}
+	for _, cs := range allContainerStatuses(pod) {
+		digests[cs.Name] = cs.ImageID
+	}
+	var containers []map[string]interface{}
+	add := func(cs []corev1.Container, containerType string) {
+		for _, c := range cs {
+			containers = append(containers, map[string]interface{}{
+				"name":           c.Name,
+				"container_type": containerType,
+				"image":          c.Image,
+				"image_id":       digests[c.Name],
+				"requests":       extractResourceRequests(pod, c.Name),
+				"limits":         extractResourceLimits(pod, c.Name),
+			})
+		}
+	}
+	add(pod.Spec.InitContainers, ContainerTypeInit)
+	add(pod.Spec.Containers, ContainerTypeApp)
+	return containers
+}
+
+// podVolumes lists a pod's volumes with their type and, for the types
+// naming another object, that object.
+func podVolumes(pod *corev1.Pod) []map[string]interface{} {
+	volumes := make([]map[string]interface{}, 0, len(pod.Spec.Volumes))
+	for _, v := range pod.Spec.Volumes {
+		typ, source := "other", ""
+		switch {
+		case v.ConfigMap != nil:
+			typ, source = "configMap", v.ConfigMap.Name
+		case v.Secret != nil:
+			typ, source = "secret", v.Secret.SecretName
+		case v.PersistentVolumeClaim != nil:
+			typ, source = "persistentVolumeClaim", v.PersistentVolumeClaim.ClaimName
+		case v.EmptyDir != nil:
+			typ = "emptyDir"
+		case v.HostPath != nil:
+			typ, source = "hostPath", v.HostPath.Path
+		case v.Projected != nil:
+			typ = "projected"
+		case v.DownwardAPI != nil:
+			typ = "downwardAPI"
+		case v.CSI != nil:
+			typ, source = "csi", v.CSI.Driver
+		case v.Ephemeral != nil:
+			typ = "ephemeral"
+		}
+		volumes = append(volumes, map[string]interface{}{"name": v.Name, "type": typ, "source": source})
+	}
+	return volumes
+}
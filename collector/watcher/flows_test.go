@@ -0,0 +1,194 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// flowTime is when the objects of the flows were created; every time they
+// record is an offset from it, so the golden files do not change.
+var flowTime = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func flowAt(offset time.Duration) metav1.Time {
+	return metav1.NewTime(flowTime.Add(offset))
+}
+
+func flowNode(rv string, memPressure bool) *corev1.Node {
+	pressure, since := corev1.ConditionFalse, flowAt(0)
+	if memPressure {
+		pressure, since = corev1.ConditionTrue, flowAt(time.Minute)
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "uid-node-1", ResourceVersion: rv, CreationTimestamp: flowAt(-time.Hour)},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastTransitionTime: flowAt(-time.Hour), Reason: "KubeletReady"},
+				{Type: corev1.NodeMemoryPressure, Status: pressure, LastTransitionTime: since, Reason: "KubeletHasInsufficientMemory", Message: "kubelet has insufficient memory available"},
+			},
+			Allocatable: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("7Gi"), corev1.ResourceCPU: resource.MustParse("3920m")},
+			Capacity:    corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("8Gi"), corev1.ResourceCPU: resource.MustParse("4")},
+			Addresses:   []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.1.17"}, {Type: corev1.NodeHostName, Address: "node-1"}},
+			NodeInfo:    corev1.NodeSystemInfo{KernelVersion: "6.1.0", KubeletVersion: "v1.35.1", ContainerRuntimeVersion: "containerd://2.1.0"},
+		},
+	}
+}
+
+// flowPod is the api pod on node-1, reading app-config through envFrom,
+// with its container in state after restarts restarts, the last of them
+// ended by last.
+func flowPod(rv string, restarts int32, state, last corev1.ContainerState) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-7d9f-x2x", Namespace: "prod", UID: "uid-api", ResourceVersion: rv, CreationTimestamp: flowAt(-30 * time.Minute)},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Containers: []corev1.Container{{
+				Name:  "api",
+				Image: "registry.example.com/api:1.4",
+				EnvFrom: []corev1.EnvFromSource{{
+					ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app-config"}},
+				}},
+				Resources: corev1.ResourceRequirements{
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi"), corev1.ResourceCPU: resource.MustParse("500m")},
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("32Mi"), corev1.ResourceCPU: resource.MustParse("0.1")},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{
+			Phase:    corev1.PodRunning,
+			QOSClass: corev1.PodQOSBurstable,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "api", Image: "registry.example.com/api:1.4", ImageID: "registry.example.com/api@sha256:4f1c",
+				RestartCount: restarts, State: state, LastTerminationState: last,
+			}},
+		},
+	}
+}
+
+func runningSince(offset time.Duration) corev1.ContainerState {
+	return corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: flowAt(offset)}}
+}
+
+func flowOOMKilled() corev1.ContainerState {
+	return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		Reason: "OOMKilled", ExitCode: 137, StartedAt: flowAt(-20 * time.Minute), FinishedAt: flowAt(2 * time.Minute),
+		ContainerID: "containerd://8e2f",
+	}}
+}
+
+// Node memory pressure, then the api container OOMKilled on that node and
+// restarted, then the pod deleted: NodeConditionChanged and
+// NodeMemoryPressure, OOMKill with the node under pressure, and
+// OOMKillEvidence from the restarted container's last termination. Every
+// later update re-reports what is still on record, the evidence and the
+// pressure; the deletion of a running pod reports nothing.
+func TestFlowOOMKill(t *testing.T) {
+	h := newHarness(t, flowNode("10", false), flowPod("20", 0, runningSince(-20*time.Minute), corev1.ContainerState{}))
+	nw := NewNodeWatcher(h.client, h.emitter, discardLogger(), time.Hour)
+	pw := NewPodWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger(), nw)
+	h.run("nodes", nw.Watch)
+	h.run("pods", pw.Watch)
+	if got := h.emitter.Events(); len(got) != 0 {
+		t.Fatalf("the initial list emitted %d events, want none", len(got))
+	}
+
+	restarted := runningSince(2*time.Minute + 10*time.Second)
+	h.Modify(flowNode("11", true))
+	h.waitForEvents(2)
+	h.Modify(flowPod("21", 0, flowOOMKilled(), corev1.ContainerState{}))
+	h.waitForEvents(3)
+	h.Modify(flowPod("22", 1, restarted, flowOOMKilled()))
+	h.waitForEvents(4)
+	h.Modify(flowPod("23", 1, restarted, flowOOMKilled()))
+	h.waitForEvents(5)
+	h.Delete(flowPod("23", 1, restarted, flowOOMKilled()))
+	h.Modify(flowNode("12", true))
+	h.waitForEvents(6)
+	time.Sleep(100 * time.Millisecond)
+
+	assertGolden(t, "oomkill", h.emitter.Events())
+}
+
+// flowConfigMap is app-config as last written by kubectl at offset.
+func flowConfigMap(rv string, offset time.Duration, data map[string]string) *corev1.ConfigMap {
+	written := flowAt(offset)
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "app-config", Namespace: "prod", UID: "uid-cm", ResourceVersion: rv, CreationTimestamp: flowAt(-time.Hour),
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationUpdate, Time: &written}},
+		},
+		Data: data,
+	}
+}
+
+// app-config changes twice, once only in its labels, and is then deleted:
+// one ConfigMapChanged for the content change, PodNotRestarted for the api
+// pod still running on the old env vars once the window closes, and one
+// ConfigMapChanged for the deletion.
+func TestFlowConfigMapChanged(t *testing.T) {
+	before := map[string]string{"LOG_LEVEL": "info", "POOL_SIZE": "10", "TIMEOUT": "30s"}
+	after := map[string]string{"LOG_LEVEL": "debug", "POOL_SIZE": "10", "RETRIES": "3"}
+	h := newHarness(t, flowConfigMap("30", -time.Hour, before), flowPod("20", 0, runningSince(-20*time.Minute), corev1.ContainerState{}))
+	windows := patterns.NewNamespaceWindows()
+	if err := windows.Set("prod:P002/PodNotRestarted=1s"); err != nil {
+		t.Fatal(err)
+	}
+	cw := NewConfigMapWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger())
+	cw.UseWindows(windows)
+	h.run("configmaps", cw.Watch)
+
+	relabelled := flowConfigMap("31", time.Minute, before)
+	relabelled.Labels = map[string]string{"team": "payments"}
+	h.Modify(relabelled)
+	h.Modify(flowConfigMap("32", 2*time.Minute, after))
+	h.waitForEvents(2)
+	h.Delete(flowConfigMap("32", 2*time.Minute, after))
+	h.waitForEvents(3)
+	time.Sleep(100 * time.Millisecond)
+
+	assertGolden(t, "configmap_changed", h.emitter.Events())
+}
+
+// Objects created after the initial list: a node already under pressure
+// reports the pressure but no condition change, a pod first seen with its
+// container OOMKilled reports the kill, and a new ConfigMap is a baseline,
+// not a change.
+func TestFlowAddedObjects(t *testing.T) {
+	h := newHarness(t, flowNode("10", false))
+	nw := NewNodeWatcher(h.client, h.emitter, discardLogger(), time.Hour)
+	pw := NewPodWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger(), nw)
+	cw := NewConfigMapWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger())
+	h.run("nodes", nw.Watch)
+	h.run("pods", pw.Watch)
+	h.run("configmaps", cw.Watch)
+
+	node := flowNode("11", true)
+	node.Name = "node-2"
+	h.Add(node)
+	h.waitForEvents(1)
+	h.Add(flowConfigMap("30", 0, map[string]string{"LOG_LEVEL": "info"}))
+	pod := flowPod("20", 0, flowOOMKilled(), corev1.ContainerState{})
+	pod.Spec.NodeName = "node-2"
+	h.Add(pod)
+	events := h.waitForEvents(2)
+	time.Sleep(100 * time.Millisecond)
+
+	if got := h.emitter.Events(); len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	if events[0].EventType != "NodeMemoryPressure" || events[0].NodeName != "node-2" {
+		t.Errorf("first event %s on %s, want NodeMemoryPressure on node-2", events[0].EventType, events[0].NodeName)
+	}
+	oom := events[1]
+	if oom.EventType != "OOMKill" || oom.PodName != "api-7d9f-x2x" || oom.NodeName != "node-2" {
+		t.Fatalf("second event %s of %s on %s, want the OOMKill", oom.EventType, oom.PodName, oom.NodeName)
+	}
+	if s := oom.Payload["node_state"].(*NodeSnapshot); s == nil || !s.MemPressure {
+		t.Errorf("OOMKill node_state = %+v, want node-2 under pressure", s)
+	}
+}
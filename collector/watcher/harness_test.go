@@ -0,0 +1,236 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// harness runs watchers, through their Watch methods, against a fake
+// clientset. The informers list the objects the clientset was created
+// with; every watch they then open is a FakeWatcher the test drives with
+// Add, Modify and Delete, which also keep the clientset's objects in step
+// for the watchers' own Gets.
+type harness struct {
+	t       *testing.T
+	client  *fake.Clientset
+	emitter *emitter.MemoryEmitter
+	ctx     context.Context
+
+	mu      sync.Mutex
+	watches map[string]*watch.FakeWatcher // by resource, e.g. "pods"
+}
+
+func newHarness(t *testing.T, objs ...runtime.Object) *harness {
+	t.Helper()
+	h := &harness{
+		t:       t,
+		client:  fake.NewSimpleClientset(objs...),
+		emitter: emitter.NewMemoryEmitter(),
+		watches: map[string]*watch.FakeWatcher{},
+	}
+	h.client.PrependWatchReactor("*", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		h.mu.Lock()
+		h.watches[action.GetResource().Resource] = w
+		h.mu.Unlock()
+		return true, w, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	h.ctx = ctx
+	t.Cleanup(cancel)
+	return h
+}
+
+// run starts a watcher's Watch, and waits for its informer to open the
+// watch of resource. The test ends only once Watch has returned.
+func (h *harness) run(resource string, watchFn func(context.Context) error) {
+	h.t.Helper()
+	ctx, cancel := context.WithCancel(h.ctx)
+	done := make(chan error, 1)
+	go func() { done <- watchFn(ctx) }()
+	h.t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			h.t.Errorf("%s watch: %v", resource, err)
+		}
+	})
+	h.eventually("the "+resource+" watch to open", func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.watches[resource] != nil
+	})
+}
+
+func (h *harness) Add(obj runtime.Object) {
+	h.t.Helper()
+	h.must(h.client.Tracker().Add(obj))
+	h.watch(obj).Add(obj)
+}
+
+func (h *harness) Modify(obj runtime.Object) {
+	h.t.Helper()
+	h.must(h.client.Tracker().Update(h.gvr(obj), obj, namespaceOf(obj)))
+	h.watch(obj).Modify(obj)
+}
+
+func (h *harness) Delete(obj runtime.Object) {
+	h.t.Helper()
+	m, _ := meta.Accessor(obj)
+	h.must(h.client.Tracker().Delete(h.gvr(obj), m.GetNamespace(), m.GetName()))
+	h.watch(obj).Delete(obj)
+}
+
+// waitForEvents waits until n events have been emitted and returns them.
+func (h *harness) waitForEvents(n int) []emitter.CausalEvent {
+	h.t.Helper()
+	h.eventually(strconv.Itoa(n)+" events", func() bool { return len(h.emitter.Events()) >= n })
+	return h.emitter.Events()
+}
+
+func (h *harness) watch(obj runtime.Object) *watch.FakeWatcher {
+	h.t.Helper()
+	resource := h.gvr(obj).Resource
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := h.watches[resource]
+	if w == nil {
+		h.t.Fatalf("no watcher is watching %s", resource)
+	}
+	return w
+}
+
+func (h *harness) gvr(obj runtime.Object) schema.GroupVersionResource {
+	h.t.Helper()
+	switch obj.(type) {
+	case *corev1.Pod:
+		return corev1.SchemeGroupVersion.WithResource("pods")
+	case *corev1.Node:
+		return corev1.SchemeGroupVersion.WithResource("nodes")
+	case *corev1.ConfigMap:
+		return corev1.SchemeGroupVersion.WithResource("configmaps")
+	case *appsv1.Deployment:
+		return appsv1.SchemeGroupVersion.WithResource("deployments")
+	case *appsv1.StatefulSet:
+		return appsv1.SchemeGroupVersion.WithResource("statefulsets")
+	case *appsv1.DaemonSet:
+		return appsv1.SchemeGroupVersion.WithResource("daemonsets")
+	case *autoscalingv2.HorizontalPodAutoscaler:
+		return autoscalingv2.SchemeGroupVersion.WithResource("horizontalpodautoscalers")
+	}
+	h.t.Fatalf("the harness does not watch %T", obj)
+	return schema.GroupVersionResource{}
+}
+
+func (h *harness) must(err error) {
+	h.t.Helper()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func (h *harness) eventually(what string, cond func() bool) {
+	h.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func namespaceOf(obj runtime.Object) string {
+	m, _ := meta.Accessor(obj)
+	return m.GetNamespace()
+}
+
+// volatileFields vary from run to run: IDs and the times taken from the
+// clock rather than from the objects. assertGolden blanks them.
+var volatileFields = map[string]bool{
+	"id":                      true,
+	"timestamp":               true,
+	"emitted_at":              true,
+	"evidence_expires_at":     true,
+	"snapshot_time":           true,
+	"change_observed_at":      true,
+	"observation_lag_seconds": true,
+}
+
+// assertGolden compares events, encoded as the JSON sinks write them with
+// volatileFields blanked, with testdata/name.json. occurred_at is blanked
+// too where the emitter filled it in from timestamp. go test -update
+// rewrites the file.
+func assertGolden(t *testing.T, name string, events []emitter.CausalEvent) {
+	t.Helper()
+	data, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r["occurred_at"] == r["timestamp"] {
+			r["occurred_at"] = "*"
+		}
+		blankVolatile(r)
+	}
+	got, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("events differ from %s (go test -update rewrites it):\n%s", path, got)
+	}
+}
+
+func blankVolatile(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			if volatileFields[k] {
+				v[k] = "*"
+				continue
+			}
+			blankVolatile(x)
+		}
+	case []interface{}:
+		for _, x := range v {
+			blankVolatile(x)
+		}
+	}
+}
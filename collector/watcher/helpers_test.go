@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// newTestPodWatcher returns a PodWatcher over a fake clientset holding
+// objs, emitting into a MemoryEmitter, and a context cancelled, with the
+// watcher's evidence re-fetches waited for, when the test ends.
+func newTestPodWatcher(t *testing.T, objs ...runtime.Object) (*PodWatcher, *emitter.MemoryEmitter, context.Context) {
+	t.Helper()
+	client := fake.NewSimpleClientset(objs...)
+	e := emitter.NewMemoryEmitter()
+	log := discardLogger()
+	pw := NewPodWatcher(client, "prod", Selectors{}, e, log, NewNodeWatcher(client, e, log, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		pw.refetches.Wait()
+	})
+	return pw, e, ctx
+}
+
+// eventsOfType returns the events of the given type e holds, in emit order.
+func eventsOfType(e *emitter.MemoryEmitter, eventType string) []emitter.CausalEvent {
+	var out []emitter.CausalEvent
+	for _, ev := range e.Events() {
+		if ev.EventType == eventType {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+var testFinishedAt = metav1.NewTime(time.Now().Add(-5 * time.Second).Truncate(time.Second))
+
+// testPod is a running pod of the api Deployment on node-1 with one app
+// container, api, in the given state.
+func testPod(state corev1.ContainerState, restarts int32) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "api-7d9f-x2x", Namespace: "prod", UID: k8stypes.UID("uid-api"), ResourceVersion: "100",
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "api", Image: "api:1.4"}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "api", Image: "api:1.4", RestartCount: restarts, State: state,
+			}},
+		},
+	}
+}
+
+func oomKilledState() corev1.ContainerState {
+	return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		Reason: "OOMKilled", ExitCode: 137, StartedAt: metav1.NewTime(testFinishedAt.Add(-time.Minute)), FinishedAt: testFinishedAt,
+	}}
+}
+
+// newTestConfigMapWatcher returns a ConfigMapWatcher over a fake clientset
+// holding objs, emitting into a MemoryEmitter, and a context cancelled,
+// with the watcher's consumer checks waited for, when the test ends.
+func newTestConfigMapWatcher(t *testing.T, objs ...runtime.Object) (*ConfigMapWatcher, *emitter.MemoryEmitter, context.Context) {
+	t.Helper()
+	e := emitter.NewMemoryEmitter()
+	cw := NewConfigMapWatcher(fake.NewSimpleClientset(objs...), "prod", Selectors{}, e, discardLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		cw.consumers.Wait()
+	})
+	return cw, e, ctx
+}
+
+func testConfigMap(rv string, data map[string]string, binary map[string][]byte) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-config", Namespace: "prod", UID: "uid-cm", ResourceVersion: rv},
+		Data:       data,
+		BinaryData: binary,
+	}
+}
@@ -0,0 +1,241 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// HPAWatcher records HorizontalPodAutoscaler scaling as HPAScaled events.
+// A scale-up packs more replicas onto the same nodes, which is a common
+// precursor of node memory pressure and the OOMKills that follow (P001).
+type HPAWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+
+	// replicaCache holds the last-seen status.currentReplicas per HPA.
+	// Key: "<namespace>/<name>". Only the informer's handler goroutine
+	// touches it.
+	replicaCache map[string]int32
+}
+
+func NewHPAWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *HPAWatcher {
+	return &HPAWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "hpa_watcher"), replicaCache: map[string]int32{}}
+}
+
+func (hw *HPAWatcher) Watch(ctx context.Context) error {
+	hw.log.Info("starting", "namespace", hw.namespace)
+	factory := newInformerFactory(hw.client, hw.namespace, hw.selectors)
+	informer := factory.Autoscaling().V2().HorizontalPodAutoscalers().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(hw.handleEvent)); err != nil {
+		return fmt.Errorf("hpa informer registration failed: %w", err)
+	}
+	return runInformer(ctx, hw.log, "hpa_watcher", hw.namespace, hw.emitter, factory, informer)
+}
+
+func (hw *HPAWatcher) handleEvent(event watch.Event) {
+	h, ok := event.Object.(*autoscalingv2.HorizontalPodAutoscaler)
+	if !ok {
+		return
+	}
+	key := h.Namespace + "/" + h.Name
+	switch event.Type {
+	case watch.Added:
+		if _, known := hw.replicaCache[key]; !known {
+			hw.replicaCache[key] = h.Status.CurrentReplicas
+		}
+	case watch.Modified:
+		previous, known := hw.replicaCache[key]
+		hw.replicaCache[key] = h.Status.CurrentReplicas
+		if !known || previous == h.Status.CurrentReplicas {
+			return
+		}
+		hw.captureScale(h, previous)
+	case watch.Deleted:
+		delete(hw.replicaCache, key)
+	}
+}
+
+func (hw *HPAWatcher) captureScale(h *autoscalingv2.HorizontalPodAutoscaler, previous int32) {
+	direction := "up"
+	if h.Status.CurrentReplicas < previous {
+		direction = "down"
+	}
+	metrics := hpaMetrics(h)
+	target := h.Spec.ScaleTargetRef
+	var minReplicas int32 = 1
+	if h.Spec.MinReplicas != nil {
+		minReplicas = *h.Spec.MinReplicas
+	}
+	payload := map[string]interface{}{
+		"hpa_name": h.Name,
+		"target_ref": map[string]string{
+			"kind":        target.Kind,
+			"name":        target.Name,
+			"api_version": target.APIVersion,
+		},
+		"workload":          target.Kind + "/" + target.Name,
+		"direction":         direction,
+		"previous_replicas": previous,
+		"current_replicas":  h.Status.CurrentReplicas,
+		"desired_replicas":  h.Status.DesiredReplicas,
+		"min_replicas":      minReplicas,
+		"max_replicas":      h.Spec.MaxReplicas,
+		"metrics":           metrics,
+		"conditions":        hpaConditions(h),
+		"resource_version":  h.ResourceVersion,
+	}
+	var occurred time.Time
+	if h.Status.LastScaleTime != nil {
+		payload["last_scale_time"] = h.Status.LastScaleTime.UTC().Format(time.RFC3339Nano)
+		occurred = h.Status.LastScaleTime.Time
+	}
+	// The HPA acts on the metric proposing the most replicas, i.e. the one
+	// furthest above (or least below) its target.
+	if m := triggeringMetric(metrics); m != nil {
+		payload["triggering_metric"] = m
+	}
+	hw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: occurred,
+		EventType:  "HPAScaled",
+		PatternID:  patterns.PatternOOMKill,
+		Namespace:  h.Namespace,
+		Payload:    payload,
+	})
+	hw.log.Info("scaled", "direction", direction, "hpa", h.Namespace+"/"+h.Name,
+		"from", previous, "to", h.Status.CurrentReplicas, "target", target.Kind+"/"+target.Name)
+}
+
+// hpaMetrics pairs each spec metric with its current status value. ratio
+// is current/target where both are known.
+func hpaMetrics(h *autoscalingv2.HorizontalPodAutoscaler) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(h.Spec.Metrics))
+	for i, spec := range h.Spec.Metrics {
+		m := map[string]interface{}{"type": string(spec.Type)}
+		var status *autoscalingv2.MetricStatus
+		if i < len(h.Status.CurrentMetrics) && h.Status.CurrentMetrics[i].Type == spec.Type {
+			status = &h.Status.CurrentMetrics[i]
+		}
+		var target autoscalingv2.MetricTarget
+		var current *autoscalingv2.MetricValueStatus
+		switch spec.Type {
+		case autoscalingv2.ResourceMetricSourceType:
+			m["name"] = string(spec.Resource.Name)
+			target = spec.Resource.Target
+			if status != nil && status.Resource != nil {
+				current = &status.Resource.Current
+			}
+		case autoscalingv2.ContainerResourceMetricSourceType:
+			m["name"] = string(spec.ContainerResource.Name)
+			m["container"] = spec.ContainerResource.Container
+			target = spec.ContainerResource.Target
+			if status != nil && status.ContainerResource != nil {
+				current = &status.ContainerResource.Current
+			}
+		case autoscalingv2.PodsMetricSourceType:
+			m["name"] = spec.Pods.Metric.Name
+			target = spec.Pods.Target
+			if status != nil && status.Pods != nil {
+				current = &status.Pods.Current
+			}
+		case autoscalingv2.ObjectMetricSourceType:
+			m["name"] = spec.Object.Metric.Name
+			target = spec.Object.Target
+			if status != nil && status.Object != nil {
+				current = &status.Object.Current
+			}
+		case autoscalingv2.ExternalMetricSourceType:
+			m["name"] = spec.External.Metric.Name
+			target = spec.External.Target
+			if status != nil && status.External != nil {
+				current = &status.External.Current
+			}
+		}
+		m["target_type"] = string(target.Type)
+		tv, hasTarget := metricTargetValue(target)
+		if hasTarget {
+			m["target"] = tv
+		}
+		if current != nil {
+			if cv, ok := metricCurrentValue(target.Type, *current); ok {
+				m["current"] = cv
+				if hasTarget && tv > 0 {
+					m["ratio"] = cv / tv
+				}
+			}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func metricTargetValue(t autoscalingv2.MetricTarget) (float64, bool) {
+	switch t.Type {
+	case autoscalingv2.UtilizationMetricType:
+		if t.AverageUtilization != nil {
+			return float64(*t.AverageUtilization), true
+		}
+	case autoscalingv2.AverageValueMetricType:
+		if t.AverageValue != nil {
+			return t.AverageValue.AsApproximateFloat64(), true
+		}
+	case autoscalingv2.ValueMetricType:
+		if t.Value != nil {
+			return t.Value.AsApproximateFloat64(), true
+		}
+	}
+	return 0, false
+}
+
+func metricCurrentValue(targetType autoscalingv2.MetricTargetType, v autoscalingv2.MetricValueStatus) (float64, bool) {
+	switch targetType {
+	case autoscalingv2.UtilizationMetricType:
+		if v.AverageUtilization != nil {
+			return float64(*v.AverageUtilization), true
+		}
+	case autoscalingv2.AverageValueMetricType:
+		if v.AverageValue != nil {
+			return v.AverageValue.AsApproximateFloat64(), true
+		}
+	case autoscalingv2.ValueMetricType:
+		if v.Value != nil {
+			return v.Value.AsApproximateFloat64(), true
+		}
+	}
+	return 0, false
+}
+
+func triggeringMetric(metrics []map[string]interface{}) map[string]interface{} {
+	var best map[string]interface{}
+	for _, m := range metrics {
+		r, ok := m["ratio"].(float64)
+		if !ok {
+			continue
+		}
+		if best == nil || r > best["ratio"].(float64) {
+			best = m
+		}
+	}
+	return best
+}
+
+func hpaConditions(h *autoscalingv2.HorizontalPodAutoscaler) map[string]string {
+	conds := map[string]string{}
+	for _, c := range h.Status.Conditions {
+		conds[string(c.Type)] = string(c.Status) + ": " + c.Reason
+	}
+	return conds
+}
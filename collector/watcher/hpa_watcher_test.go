@@ -0,0 +1,42 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testHPA(rv string, current int32) *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "prod", UID: "uid-hpa", ResourceVersion: rv},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: "api", APIVersion: "apps/v1"},
+			MaxReplicas:    10,
+		},
+		Status: autoscalingv2.HorizontalPodAutoscalerStatus{CurrentReplicas: current, DesiredReplicas: current},
+	}
+}
+
+// The replicas the informer lists are the baseline: an update that leaves
+// them is not a scale, one that changes them is, from the listed count.
+func TestHPAScaledFromListedReplicas(t *testing.T) {
+	h := newHarness(t, testHPA("100", 2))
+	hw := NewHPAWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger())
+	h.run("horizontalpodautoscalers", hw.Watch)
+
+	h.Modify(testHPA("101", 2))
+	h.Modify(testHPA("102", 4))
+	h.waitForEvents(1)
+	time.Sleep(100 * time.Millisecond)
+
+	events := h.emitter.Events()
+	if len(events) != 1 || events[0].EventType != "HPAScaled" {
+		t.Fatalf("got %d events, want the one HPAScaled", len(events))
+	}
+	p := events[0].Payload
+	if p["previous_replicas"] != int32(2) || p["current_replicas"] != int32(4) || p["direction"] != "up" || p["workload"] != "Deployment/api" {
+		t.Errorf("HPAScaled = %v, want Deployment/api up from 2 to 4", p)
+	}
+}
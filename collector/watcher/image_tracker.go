@@ -0,0 +1,167 @@
+package watcher
+
+import (
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// imageHistoryDepth is how many digests are remembered per workload
+// container.
+const imageHistoryDepth = 10
+
+// imageDigest is one digest a workload's container ran, and when it was
+// first seen running.
+type imageDigest struct {
+	image     string
+	imageID   string
+	firstSeen time.Time
+}
+
+// TrackImages makes the pod watcher record the image digests, the ImageID
+// of the container statuses, that each workload's containers run. Tags get
+// re-pushed, so the digest is what tells which build was running. The
+// first time a workload's container is seen running a digest it has not
+// run before, ImageDigestChanged is emitted with the digest it ran until
+// then: alongside the Deployment's rollout events, which only know the
+// tags in the template, it pins a rollout to the digests it replaced. The
+// OOMKill and ContainerTerminated events of a container running the newest
+// digest carry the digest before it, the one to roll back to. Digests are
+// kept per workload, or per pod for pods no controller owns, and a
+// rollout's old and new pods running side by side do not count as changes
+// back and forth.
+func (pw *PodWatcher) TrackImages() {
+	pw.images = map[string][]imageDigest{}
+}
+
+// imageKey identifies a container across the pods of its workload.
+func (pw *PodWatcher) imageKey(pod *corev1.Pod, container string) string {
+	kind, name := pw.owners.Workload(pod)
+	if kind == "" {
+		kind, name = "Pod", pod.Name
+	}
+	return pod.Namespace + "/" + kind + "/" + name + "/" + container
+}
+
+// inspectImages records the digests pod's containers run, emitting
+// ImageDigestChanged for those new to their workload.
+func (pw *PodWatcher) inspectImages(pod *corev1.Pod) {
+	if pw.images == nil {
+		return
+	}
+	for _, cs := range allContainerStatuses(pod) {
+		if cs.ImageID == "" {
+			continue // not pulled yet
+		}
+		key := pw.imageKey(pod, cs.Name)
+		history := pw.images[key]
+		if slices.ContainsFunc(history, func(d imageDigest) bool { return d.imageID == cs.ImageID }) {
+			continue
+		}
+		seen := imageDigest{image: cs.Image, imageID: cs.ImageID, firstSeen: time.Now()}
+		if cs.State.Running != nil {
+			seen.firstSeen = cs.State.Running.StartedAt.Time
+		}
+		// A digest started before the newest known is an old one first
+		// seen late, such as an old pod of a rollout under way when the
+		// collector started: it goes into the history in order, unreported.
+		i := len(history)
+		for i > 0 && seen.firstSeen.Before(history[i-1].firstSeen) {
+			i--
+		}
+		history = slices.Insert(history, i, seen)
+		if len(history) > imageHistoryDepth {
+			history = history[len(history)-imageHistoryDepth:]
+		}
+		pw.images[key] = history
+		if i > 0 && i == len(history)-1 {
+			pw.emitImageChange(pod, cs.Name, history[i-1], seen)
+		}
+	}
+}
+
+func (pw *PodWatcher) emitImageChange(pod *corev1.Pod, container string, previous, current imageDigest) {
+	payload := map[string]interface{}{
+		"container_name":     container,
+		"old_image":          previous.image,
+		"old_image_id":       previous.imageID,
+		"old_image_since":    previous.firstSeen,
+		"new_image":          current.image,
+		"new_image_id":       current.imageID,
+		"tag_repushed":       previous.image == current.image,
+		"image_changed_at":   current.firstSeen,
+		"previous_image_ids": pw.previousImageIDs(pod, container),
+	}
+	pw.owners.annotate(payload, pod)
+	pw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: current.firstSeen,
+		EventType:  "ImageDigestChanged",
+		PodName:    pod.Name,
+		Namespace:  pod.Namespace,
+		NodeName:   pod.Spec.NodeName,
+		PodUID:     string(pod.UID),
+		Payload:    payload,
+	})
+	pw.log.Info("ImageDigestChanged", "pod", pod.Name, "namespace", pod.Namespace, "container", container,
+		"old_image_id", previous.imageID, "new_image_id", current.imageID)
+}
+
+// previousImageIDs lists the digests the workload's container ran before
+// its newest, newest first.
+func (pw *PodWatcher) previousImageIDs(pod *corev1.Pod, container string) []string {
+	history := pw.images[pw.imageKey(pod, container)]
+	ids := []string{}
+	for i := len(history) - 2; i >= 0; i-- {
+		ids = append(ids, history[i].imageID)
+	}
+	return ids
+}
+
+// imageTransition describes the digest change behind a container status, for
+// a termination's payload: the image before the newest, and when the newest
+// was first seen, if cs runs the newest of several digests.
+func (pw *PodWatcher) imageTransition(pod *corev1.Pod, cs corev1.ContainerStatus) map[string]interface{} {
+	out := map[string]interface{}{
+		"previous_image":    nil,
+		"previous_image_id": nil,
+		"image_changed_at":  nil,
+	}
+	history := pw.images[pw.imageKey(pod, cs.Name)]
+	if len(history) < 2 || history[len(history)-1].imageID != cs.ImageID {
+		return out
+	}
+	previous := history[len(history)-2]
+	out["previous_image"] = previous.image
+	out["previous_image_id"] = previous.imageID
+	out["image_changed_at"] = history[len(history)-1].firstSeen
+	return out
+}
+
+// forgetImages drops the digests of a deleted pod no controller owns, whose
+// history ends with it.
+func (pw *PodWatcher) forgetImages(pod *corev1.Pod) {
+	if pw.images == nil {
+		return
+	}
+	if kind, _ := pw.owners.Workload(pod); kind != "" {
+		return
+	}
+	for _, cs := range allContainerStatuses(pod) {
+		delete(pw.images, pw.imageKey(pod, cs.Name))
+	}
+}
+
+// containerImages maps each container of pod to its image and, once
+// pulled, the digest it runs.
+func containerImages(pod *corev1.Pod) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, cs := range allContainerStatuses(pod) {
+		out[cs.Name] = map[string]string{"image": cs.Image, "image_id": cs.ImageID}
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/health"
+)
+
+// informerResync is zero: no periodic resync. Every UpdateFunc then
+// corresponds to a real object change, matching the watch.Modified
+// semantics the handlers were written against. Relisting after a dropped
+// watch is handled by the informer's reflector.
+const informerResync = 0
+
+// informerProbeInterval is how often runInformer checks the reflector's
+// resourceVersion for progress.
+const informerProbeInterval = 10 * time.Second
+
+func newInformerFactory(client kubernetes.Interface, namespace string, sel Selectors) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(client, informerResync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(sel.apply),
+	)
+}
+
+// eventHandler adapts informer callbacks to the watch.Event handlers used by
+// the watchers, so the same handleEvent code serves both raw watches and
+// informers. Deletions observed only through a relist arrive as tombstones
+// and are unwrapped to the last known object.
+func eventHandler(handle func(watch.Event)) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if o, ok := obj.(runtime.Object); ok {
+				handle(watch.Event{Type: watch.Added, Object: o})
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if o, ok := obj.(runtime.Object); ok {
+				handle(watch.Event{Type: watch.Modified, Object: o})
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tomb, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tomb.Obj
+			}
+			if o, ok := obj.(runtime.Object); ok {
+				handle(watch.Event{Type: watch.Deleted, Object: o})
+			}
+		},
+	}
+}
+
+// runInformer starts the factory, waits for the informer's initial list to
+// land, then blocks until ctx is cancelled. List and watch failures the
+// reflector retries on its own are reported as CollectorError meta events.
+// The informer's health is reported on a probe: synced once the initial
+// list lands, failing on a list/watch error, and alive again on any event
+// or, in a quiet namespace, any advance of the resourceVersion the
+// reflector has synced to (watch bookmarks move it).
+func runInformer(ctx context.Context, log *slog.Logger, name, namespace string, e emitter.Emitter, factory informers.SharedInformerFactory, informer cache.SharedIndexInformer) error {
+	probe := health.Register(probeName(name, namespace))
+	defer probe.Done()
+	err := informer.SetWatchErrorHandlerWithContext(func(ctx context.Context, r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+		if errors.Is(err, io.EOF) || isExpired(err) {
+			return // normal watch closure or relist
+		}
+		probe.Failed()
+		reportError(e, log, name, namespace, "list/watch", "", err)
+	})
+	if err != nil {
+		return fmt.Errorf("%s error handler registration failed: %w", name, err)
+	}
+	observe := func(interface{}) { probe.Observed() }
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    observe,
+		UpdateFunc: func(_, obj interface{}) { observe(obj) },
+		DeleteFunc: observe,
+	}); err != nil {
+		return fmt.Errorf("%s health handler registration failed: %w", name, err)
+	}
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("%s cache sync failed", name)
+	}
+	probe.Synced()
+	log.Info("cache synced", "objects", len(informer.GetStore().ListKeys()))
+	t := time.NewTicker(informerProbeInterval)
+	defer t.Stop()
+	rv := informer.LastSyncResourceVersion()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("stopped")
+			return nil
+		case <-t.C:
+			if cur := informer.LastSyncResourceVersion(); cur != rv {
+				rv = cur
+				probe.Observed()
+			}
+		}
+	}
+}
+
+// probeName is the health probe name of a watch: the watcher, and the
+// namespace unless it watches all of them.
+func probeName(name, namespace string) string {
+	if namespace == "" {
+		return name
+	}
+	return name + "/" + namespace
+}
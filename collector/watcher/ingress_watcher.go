@@ -0,0 +1,166 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// IngressWatcher records Ingress rule changes, which send a host or path
+// to another backend, or to none, without any pod noticing. IngressChanged
+// diffs the routes, each rendered as "host/path (pathType) -> service:port",
+// and names the backend Services so the change relates to their events.
+type IngressWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+
+	mu        sync.RWMutex // guards ingresses against RoutesTo
+	ingresses map[string]ingressVersion
+}
+
+type ingressVersion struct {
+	class    string
+	routes   []string
+	services []string // backend Service names, sorted
+}
+
+func NewIngressWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *IngressWatcher {
+	return &IngressWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "ingress_watcher"), ingresses: map[string]ingressVersion{}}
+}
+
+func (iw *IngressWatcher) Watch(ctx context.Context) error {
+	iw.log.Info("starting", "namespace", iw.namespace)
+	// As for ConfigMaps, the initial list primes ingresses.
+	factory := newInformerFactory(iw.client, iw.namespace, iw.selectors)
+	informer := factory.Networking().V1().Ingresses().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(iw.handleEvent)); err != nil {
+		return fmt.Errorf("ingress informer registration failed: %w", err)
+	}
+	return runInformer(ctx, iw.log, "ingress_watcher", iw.namespace, iw.emitter, factory, informer)
+}
+
+// RoutesTo lists the Ingresses in namespace with a backend on service.
+func (iw *IngressWatcher) RoutesTo(namespace, service string) []string {
+	iw.mu.RLock()
+	defer iw.mu.RUnlock()
+	var names []string
+	for key, v := range iw.ingresses {
+		ns, name, _ := strings.Cut(key, "/")
+		if ns != namespace {
+			continue
+		}
+		if _, found := slices.BinarySearch(v.services, service); found {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (iw *IngressWatcher) handleEvent(event watch.Event) {
+	ing, ok := event.Object.(*networkingv1.Ingress)
+	if !ok {
+		return
+	}
+	key := ing.Namespace + "/" + ing.Name
+	cur := ingressVersionOf(ing)
+	iw.mu.Lock()
+	prev, known := iw.ingresses[key]
+	if event.Type == watch.Deleted {
+		delete(iw.ingresses, key)
+		cur = ingressVersion{}
+	} else {
+		iw.ingresses[key] = cur
+	}
+	iw.mu.Unlock()
+	if event.Type == watch.Added || !known {
+		return
+	}
+	added, removed := diffStrings(prev.routes, cur.routes)
+	if len(added) == 0 && len(removed) == 0 && prev.class == cur.class {
+		return
+	}
+	iw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: lastChanged(ing.ObjectMeta),
+		EventType:  "IngressChanged",
+		Namespace:  ing.Namespace,
+		Payload: map[string]interface{}{
+			"ingress_name":      ing.Name,
+			"ingress_class":     cur.class,
+			"old_ingress_class": prev.class,
+			"routes":            cur.routes,
+			"routes_added":      added,
+			"routes_removed":    removed,
+			"backend_services":  mergeSorted(prev.services, cur.services),
+			"event_type":        string(event.Type),
+			"resource_version":  ing.ResourceVersion,
+		},
+	})
+	iw.log.Info("Ingress changed", "ingress", key, "routes_added", len(added), "routes_removed", len(removed))
+}
+
+func ingressVersionOf(ing *networkingv1.Ingress) ingressVersion {
+	var v ingressVersion
+	if ing.Spec.IngressClassName != nil {
+		v.class = *ing.Spec.IngressClassName
+	}
+	add := func(route string, backend networkingv1.IngressBackend) {
+		target := "<none>"
+		switch {
+		case backend.Service != nil:
+			port := backend.Service.Port.Name
+			if port == "" {
+				port = strconv.Itoa(int(backend.Service.Port.Number))
+			}
+			target = backend.Service.Name + ":" + port
+			v.services = append(v.services, backend.Service.Name)
+		case backend.Resource != nil:
+			target = backend.Resource.Kind + "/" + backend.Resource.Name
+		}
+		v.routes = append(v.routes, route+" -> "+target)
+	}
+	if ing.Spec.DefaultBackend != nil {
+		add("*", *ing.Spec.DefaultBackend)
+	}
+	for _, rule := range ing.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			route := host + p.Path
+			if p.PathType != nil {
+				route += " (" + string(*p.PathType) + ")"
+			}
+			add(route, p.Backend)
+		}
+	}
+	slices.Sort(v.routes)
+	slices.Sort(v.services)
+	v.services = slices.Compact(v.services)
+	return v
+}
+
+// mergeSorted returns the union of two sorted lists, sorted.
+func mergeSorted(a, b []string) []string {
+	return slices.Compact(slices.Sorted(slices.Values(slices.Concat(a, b))))
+}
@@ -0,0 +1,173 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// JobWatcher records batch Jobs that fail for good: backoff limit
+// exhausted, active deadline exceeded, a pod failure policy rule matched.
+// None of it shows up on the other watchers beyond the pods' own
+// terminations. JobFailed names the owning CronJob and carries the OOMKills
+// of the Job's pods, found through their owner references, and its
+// workload field ties it to the pod watcher's OOMKill events for P008.
+type JobWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+
+	// failed holds the Jobs JobFailed was emitted for, and the Jobs
+	// already failed when the collector started. Only the informer's
+	// handler goroutine touches it.
+	failed map[types.UID]bool
+}
+
+func NewJobWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *JobWatcher {
+	return &JobWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "job_watcher"), failed: map[types.UID]bool{}}
+}
+
+func (jw *JobWatcher) Watch(ctx context.Context) error {
+	jw.log.Info("starting", "namespace", jw.namespace)
+	factory := newInformerFactory(jw.client, jw.namespace, jw.selectors)
+	informer := factory.Batch().V1().Jobs().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(func(event watch.Event) {
+		jw.handleEvent(ctx, event)
+	})); err != nil {
+		return fmt.Errorf("job informer registration failed: %w", err)
+	}
+	return runInformer(ctx, jw.log, "job_watcher", jw.namespace, jw.emitter, factory, informer)
+}
+
+func (jw *JobWatcher) handleEvent(ctx context.Context, event watch.Event) {
+	job, ok := event.Object.(*batchv1.Job)
+	if !ok {
+		return
+	}
+	switch event.Type {
+	case watch.Added:
+		// A Job that failed before the collector started is history, not
+		// an incident.
+		if jobFailedCondition(job) != nil {
+			jw.failed[job.UID] = true
+		}
+	case watch.Modified:
+		cond := jobFailedCondition(job)
+		if cond == nil || jw.failed[job.UID] {
+			return
+		}
+		jw.failed[job.UID] = true
+		jw.emitFailed(ctx, job, cond)
+	case watch.Deleted:
+		delete(jw.failed, job.UID)
+	}
+}
+
+// jobFailedCondition returns the Job's Failed=True condition, if any.
+func jobFailedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func (jw *JobWatcher) emitFailed(ctx context.Context, job *batchv1.Job, cond *batchv1.JobCondition) {
+	payload := map[string]interface{}{
+		"job_name":       job.Name,
+		"workload":       "Job/" + job.Name,
+		"workload_kind":  "Job",
+		"workload_name":  job.Name,
+		"reason":         cond.Reason,
+		"message":        cond.Message,
+		"failed_at":      cond.LastTransitionTime.Time,
+		"failed_pods":    job.Status.Failed,
+		"succeeded_pods": job.Status.Succeeded,
+		"active_pods":    job.Status.Active,
+		"cronjob":        cronJobOf(job),
+	}
+	if job.Spec.BackoffLimit != nil {
+		payload["backoff_limit"] = *job.Spec.BackoffLimit
+	}
+	if job.Spec.ActiveDeadlineSeconds != nil {
+		payload["active_deadline_seconds"] = *job.Spec.ActiveDeadlineSeconds
+	}
+	if job.Spec.Completions != nil {
+		payload["completions"] = *job.Spec.Completions
+	}
+	if job.Status.StartTime != nil {
+		payload["start_time"] = job.Status.StartTime.Time
+		payload["run_seconds"] = cond.LastTransitionTime.Sub(job.Status.StartTime.Time).Seconds()
+	}
+
+	// The Job controller leaves finished pods in place until the Job is
+	// deleted, so the failed attempts can still be inspected.
+	if oomKills, err := jw.podOOMKills(ctx, job); err != nil {
+		reportError(jw.emitter, jw.log, "job_watcher", job.Namespace, "list pods of", job.Namespace+"/"+job.Name, err)
+	} else {
+		payload["oomkilled_containers"] = oomKills
+	}
+
+	jw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: cond.LastTransitionTime.Time,
+		EventType:  "JobFailed",
+		PatternID:  patterns.PatternJobFailure,
+		Namespace:  job.Namespace,
+		Payload:    payload,
+	})
+	jw.log.Info("JobFailed", "job", job.Namespace+"/"+job.Name, "reason", cond.Reason, "failed_pods", job.Status.Failed)
+}
+
+// cronJobOf names the CronJob that created job, or "" if none did.
+func cronJobOf(job *batchv1.Job) string {
+	if owner := metav1.GetControllerOf(job); owner != nil && owner.Kind == "CronJob" {
+		return owner.Name
+	}
+	return ""
+}
+
+// podOOMKills lists the OOMKilled containers of the pods job owns, current
+// or last termination, as pod/container entries.
+func (jw *JobWatcher) podOOMKills(ctx context.Context, job *batchv1.Job) ([]map[string]interface{}, error) {
+	opts := metav1.ListOptions{LabelSelector: batchv1.JobNameLabel + "=" + job.Name}
+	pods, err := jw.client.CoreV1().Pods(job.Namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	oomKills := []map[string]interface{}{}
+	for _, pod := range pods.Items {
+		if owner := metav1.GetControllerOf(&pod); owner == nil || owner.UID != job.UID {
+			continue // a previous Job of the same name
+		}
+		for _, cs := range allContainerStatuses(&pod) {
+			for _, term := range []*corev1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+				if term == nil || term.Reason != "OOMKilled" {
+					continue
+				}
+				oomKills = append(oomKills, map[string]interface{}{
+					"pod_name":       pod.Name,
+					"container_name": cs.Name,
+					"node_name":      pod.Spec.NodeName,
+					"finished_at":    term.FinishedAt.Time,
+				})
+			}
+		}
+	}
+	return oomKills, nil
+}
@@ -0,0 +1,130 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// kubeletFetchTimeout bounds how long the pod watcher's handler waits on
+// the kubelet through the API server proxy, as for logs.
+const kubeletFetchTimeout = 3 * time.Second
+
+var errNoCoreREST = errors.New("no REST client for the core API")
+
+// UseNodeProxy attaches to OOMKill events the container's memory as its
+// cgroup reports it, read from the kubelet's /stats/summary through the
+// API server's node proxy: the effective limit and working set, which
+// runtime overhead and page rounding set apart from the spec's. Fetching
+// is best-effort: if the proxy is forbidden or the kubelet unreachable the
+// event is emitted without them.
+func (pw *PodWatcher) UseNodeProxy() {
+	pw.nodeProxy = true
+}
+
+// statsSummary is the subset of the kubelet's /stats/summary the pod
+// watcher reads, decoded from the raw response so the collector does not
+// need the kubelet's API types.
+type statsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			UID       string `json:"uid"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name   string `json:"name"`
+			Memory *struct {
+				Time            time.Time `json:"time"`
+				AvailableBytes  *uint64   `json:"availableBytes"`
+				UsageBytes      *uint64   `json:"usageBytes"`
+				WorkingSetBytes *uint64   `json:"workingSetBytes"`
+				RSSBytes        *uint64   `json:"rssBytes"`
+			} `json:"memory"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+// cgroupMemory reads the container's cgroup memory from its node's
+// kubelet. By the time the OOMKill is handled the kubelet has usually
+// restarted the container, so the working set is the new run's; the limit
+// is the same for every run. The limit is nil when the cgroup has none,
+// which the kubelet reports by omitting availableBytes.
+func (pw *PodWatcher) cgroupMemory(ctx context.Context, pod *corev1.Pod, container string) (map[string]interface{}, error) {
+	rc := pw.client.CoreV1().RESTClient()
+	if rc == nil { // fake clientsets have no REST client
+		return nil, errNoCoreREST
+	}
+	ctx, cancel := context.WithTimeout(ctx, kubeletFetchTimeout)
+	defer cancel()
+	data, err := rc.Get().Resource("nodes").Name(pod.Spec.NodeName).SubResource("proxy").Suffix("stats/summary").DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var summary statsSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("decode stats summary: %w", err)
+	}
+	for _, p := range summary.Pods {
+		if p.PodRef.UID != string(pod.UID) {
+			continue
+		}
+		for _, c := range p.Containers {
+			if c.Name != container || c.Memory == nil || c.Memory.WorkingSetBytes == nil {
+				continue
+			}
+			out := map[string]interface{}{
+				"cgroup_memory_working_set_bytes": *c.Memory.WorkingSetBytes,
+				"cgroup_memory_limit_bytes":       nil,
+				"cgroup_stats_time":               c.Memory.Time,
+			}
+			if c.Memory.RSSBytes != nil {
+				out["cgroup_memory_rss_bytes"] = *c.Memory.RSSBytes
+			}
+			if c.Memory.AvailableBytes != nil {
+				out["cgroup_memory_limit_bytes"] = *c.Memory.WorkingSetBytes + *c.Memory.AvailableBytes
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("container %s not in the stats summary of node %s", container, pod.Spec.NodeName)
+}
+
+// effectiveMemory relates the cgroup memory limit to the spec's, and adds
+// the oom_score_adj the kubelet gives the container, which decides which
+// process the kernel kills first under node memory pressure.
+func effectiveMemory(cgroup map[string]interface{}, pod *corev1.Pod, container string, node *NodeSnapshot) {
+	res, _ := containerResources(pod, container)
+	if limit, ok := cgroup["cgroup_memory_limit_bytes"].(uint64); ok {
+		if declared, ok := res.Limits[corev1.ResourceMemory]; ok && !declared.IsZero() {
+			cgroup["memory_limit_delta_bytes"] = int64(limit) - declared.Value()
+		}
+	}
+	if node != nil && node.CapacityMemBytes > 0 {
+		cgroup["oom_score_adj"] = oomScoreAdj(pod.Status.QOSClass, res.Requests.Memory().Value(), node.CapacityMemBytes)
+	}
+}
+
+// oomScoreAdj follows the kubelet's policy: Guaranteed containers are the
+// last killed, BestEffort the first, and Burstable ones in between by the
+// share of the node's memory they request.
+func oomScoreAdj(qos corev1.PodQOSClass, request, capacity int64) int {
+	switch qos {
+	case corev1.PodQOSGuaranteed:
+		return -997
+	case corev1.PodQOSBestEffort:
+		return 1000
+	}
+	adj := 1000 - int(1000*request/capacity)
+	switch {
+	case adj < 2:
+		return 2
+	case adj >= 1000:
+		return 999
+	}
+	return adj
+}
@@ -0,0 +1,168 @@
+package watcher
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// DefaultLagThreshold is the observation lag above which HighCollectorLag
+// is reported.
+const DefaultLagThreshold = 30 * time.Second
+
+// lagReportInterval is how often one watcher reports HighCollectorLag while
+// it stays behind; the events lagging in between are counted.
+const lagReportInterval = time.Minute
+
+// LagMonitor measures how long after a change the collector emits it: the
+// observation lag, from the time the object records for the change (a
+// container's finishedAt, a condition's lastTransitionTime, an Event's last
+// occurrence) to the emit. Kubernetes keeps these to the second, so lags
+// under a second read as up to a second. The lag is attached to events as
+// observation_lag_seconds.
+//
+// A lag past the threshold means the API server or the collector's own
+// backlog delayed the event, and that evidence shorter-lived than the lag
+// (LastTerminationState, 90 seconds) may have been missed; it is reported
+// as a HighCollectorLag meta event. Changes made before the watcher that
+// reports them started are backfill from its initial list, not lag, and
+// are neither reported nor counted in the metric. A nil *LagMonitor only
+// attaches the lag.
+type LagMonitor struct {
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	threshold time.Duration // 0 disables HighCollectorLag
+
+	mu      sync.Mutex
+	started map[string]time.Time // per watcher and namespace
+	reports map[string]*lagReport
+}
+
+type lagReport struct {
+	reportedAt time.Time
+	lagging    int // events past the threshold since reportedAt
+	maxLag     time.Duration
+}
+
+func NewLagMonitor(e emitter.Emitter, log *slog.Logger, threshold time.Duration) *LagMonitor {
+	return &LagMonitor{emitter: e, log: log.With("component", "lag_monitor"), threshold: threshold,
+		started: map[string]time.Time{},
+		reports: map[string]*lagReport{},
+	}
+}
+
+// start marks a watcher as starting its initial list now.
+func (lm *LagMonitor) start(watcher, namespace string) {
+	if lm == nil {
+		return
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.started[watcher+"/"+namespace] = time.Now()
+}
+
+// observe attaches the observation lag of a change that happened at
+// occurred to payload, just before the event carrying it is emitted. A
+// zero occurred, unknown, attaches nothing.
+func (lm *LagMonitor) observe(payload map[string]interface{}, watcher, namespace, eventType string, occurred time.Time) {
+	if occurred.IsZero() {
+		return
+	}
+	now := time.Now()
+	lag := now.Sub(occurred)
+	payload["observation_lag_seconds"] = math.Round(lag.Seconds()*100) / 100
+	if lm == nil {
+		return
+	}
+	key := watcher + "/" + namespace
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if started, ok := lm.started[key]; !ok || occurred.Before(started) {
+		return
+	}
+	metrics.ObservationLag.WithLabelValues(watcher).Observe(lag.Seconds())
+	if lm.threshold <= 0 || lag < lm.threshold {
+		return
+	}
+	r := lm.reports[key]
+	if r == nil {
+		r = &lagReport{}
+		lm.reports[key] = r
+	}
+	r.lagging++
+	r.maxLag = max(r.maxLag, lag)
+	if now.Sub(r.reportedAt) < lagReportInterval {
+		return
+	}
+	lm.log.Warn("HighCollectorLag", "watcher", watcher, "namespace", namespace, "event_type", eventType, "lag", lag.Round(time.Millisecond), "lagging_events", r.lagging)
+	lm.emitter.EmitMeta(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: now,
+		EventType: "HighCollectorLag",
+		Namespace: namespace,
+		Payload: map[string]interface{}{
+			"watcher":                 watcher,
+			"event_type":              eventType,
+			"observation_lag_seconds": math.Round(lag.Seconds()*100) / 100,
+			"max_lag_seconds":         math.Round(r.maxLag.Seconds()*100) / 100,
+			"lagging_events":          r.lagging,
+			"threshold_seconds":       lm.threshold.Seconds(),
+			"occurred_at":             occurred,
+		},
+	})
+	*r = lagReport{reportedAt: now}
+}
+
+// lastChanged is the time of the last write to an object, as recorded in
+// its managed fields; zero if the writer left none.
+func lastChanged(meta metav1.ObjectMeta) time.Time {
+	var last time.Time
+	for _, f := range meta.ManagedFields {
+		if f.Time != nil && f.Time.After(last) {
+			last = f.Time.Time
+		}
+	}
+	return last
+}
+
+// nodeConditionSince is when node's condition t last changed status; zero
+// if the node does not report it.
+func nodeConditionSince(node *corev1.Node, t corev1.NodeConditionType) time.Time {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == t {
+			return cond.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+// podConditionSince is when pod's condition t last changed status; zero if
+// the pod does not have it.
+func podConditionSince(pod *corev1.Pod, t corev1.PodConditionType) time.Time {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == t {
+			return cond.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+// lastOccurred is the time of an Event's most recent occurrence, wherever
+// the API version that wrote it put it.
+func lastOccurred(k8sEvent *corev1.Event) time.Time {
+	switch {
+	case k8sEvent.Series != nil && !k8sEvent.Series.LastObservedTime.IsZero():
+		return k8sEvent.Series.LastObservedTime.Time
+	case !k8sEvent.LastTimestamp.IsZero():
+		return k8sEvent.LastTimestamp.Time
+	default:
+		return k8sEvent.EventTime.Time
+	}
+}
@@ -0,0 +1,199 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+const (
+	DefaultSamplingInterval = 15 * time.Second
+	DefaultSamplingDepth    = 20
+)
+
+// MemorySample is one metrics.k8s.io reading of a container's working set.
+type MemorySample struct {
+	Timestamp   time.Time `json:"timestamp"`
+	MemoryBytes int64     `json:"memory_bytes"`
+	Memory      string    `json:"memory"`
+}
+
+// MemorySampler polls metrics.k8s.io for the pods of one namespace and keeps
+// the last few memory readings per container, so an OOMKill can carry the
+// usage trajectory that led up to it. The metrics API is optional: while it
+// is not installed the sampler idles and Trajectory returns nothing.
+//
+// A nil *MemorySampler is valid and disables sampling.
+type MemorySampler struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	interval  time.Duration
+	depth     int
+
+	mu      sync.Mutex
+	samples map[string][]MemorySample // "<namespace>/<pod>/<container>" → oldest first
+	seenAt  map[string]time.Time
+}
+
+var errNoMetricsAPI = errors.New("no REST client for metrics.k8s.io")
+
+// sampleRetention is how long a container's samples outlive its last
+// appearance in the metrics API. metrics-server drops a container as soon
+// as it dies, which is exactly when its trajectory is wanted.
+const sampleRetention = 5 * time.Minute
+
+func NewMemorySampler(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger, interval time.Duration, depth int) *MemorySampler {
+	if interval <= 0 {
+		interval = DefaultSamplingInterval
+	}
+	if depth <= 0 {
+		depth = DefaultSamplingDepth
+	}
+	return &MemorySampler{
+		client:    client,
+		namespace: namespace,
+		selectors: sel,
+		emitter:   e,
+		log:       log.With("component", "memory_sampler"),
+		interval:  interval,
+		depth:     depth,
+		samples:   map[string][]MemorySample{},
+		seenAt:    map[string]time.Time{},
+	}
+}
+
+// Interval is the configured sampling interval; zero for a nil sampler.
+func (ms *MemorySampler) Interval() time.Duration {
+	if ms == nil {
+		return 0
+	}
+	return ms.interval
+}
+
+// Trajectory returns a copy of the recent samples of one container, oldest
+// first.
+func (ms *MemorySampler) Trajectory(namespace, pod, container string) []MemorySample {
+	if ms == nil {
+		return nil
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return append([]MemorySample(nil), ms.samples[namespace+"/"+pod+"/"+container]...)
+}
+
+func (ms *MemorySampler) Watch(ctx context.Context) error {
+	ms.log.Info("starting", "namespace", ms.namespace, "interval", ms.interval, "depth", ms.depth)
+	t := time.NewTicker(ms.interval)
+	defer t.Stop()
+	available := true
+	for {
+		err := ms.sample(ctx)
+		switch {
+		case ctx.Err() != nil:
+			ms.log.Info("stopped")
+			return nil
+		case errors.Is(err, errNoMetricsAPI) || apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err):
+			// Not installed, or metrics-server not ready: log the
+			// transition only, and keep checking in case it appears.
+			if available {
+				ms.log.Warn("metrics.k8s.io unavailable, OOMKills carry no memory_trajectory until it is", "err", err)
+				available = false
+			}
+		case err != nil:
+			reportError(ms.emitter, ms.log, "memory_sampler", ms.namespace, "list pod metrics", "", err)
+		case !available:
+			ms.log.Info("metrics.k8s.io available, sampling resumed")
+			available = true
+		}
+		select {
+		case <-ctx.Done():
+			ms.log.Info("stopped")
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// podMetricsList is the subset of metrics.k8s.io/v1beta1 PodMetricsList the
+// sampler reads, decoded from the raw response so the collector does not
+// need the metrics client library.
+type podMetricsList struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Timestamp  metav1.Time       `json:"timestamp"`
+		Containers []struct {
+			Name  string              `json:"name"`
+			Usage corev1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+func (ms *MemorySampler) sample(ctx context.Context) error {
+	rc := ms.client.Discovery().RESTClient()
+	if rc == nil { // fake clientsets have no REST client
+		return errNoMetricsAPI
+	}
+	path := "/apis/metrics.k8s.io/v1beta1/pods"
+	if ms.namespace != "" {
+		path = "/apis/metrics.k8s.io/v1beta1/namespaces/" + url.PathEscape(ms.namespace) + "/pods"
+	}
+	req := rc.Get().AbsPath(path)
+	if ms.selectors.Label != "" {
+		req = req.Param("labelSelector", ms.selectors.Label)
+	}
+	data, err := req.DoRaw(ctx)
+	if err != nil {
+		return err
+	}
+	var list podMetricsList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decode pod metrics: %w", err)
+	}
+
+	now := time.Now()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, pm := range list.Items {
+		for _, c := range pm.Containers {
+			mem, ok := c.Usage[corev1.ResourceMemory]
+			if !ok {
+				continue
+			}
+			key := pm.Metadata.Namespace + "/" + pm.Metadata.Name + "/" + c.Name
+			ms.seenAt[key] = now
+			buf := ms.samples[key]
+			// metrics-server refreshes on its own schedule; a poll between
+			// refreshes returns the reading already held.
+			if n := len(buf); n > 0 && buf[n-1].Timestamp.Equal(pm.Timestamp.Time) {
+				continue
+			}
+			buf = append(buf, MemorySample{Timestamp: pm.Timestamp.Time, MemoryBytes: mem.Value(), Memory: mem.String()})
+			if len(buf) > ms.depth {
+				buf = buf[len(buf)-ms.depth:]
+			}
+			ms.samples[key] = buf
+		}
+	}
+	for key, seen := range ms.seenAt {
+		if now.Sub(seen) > sampleRetention {
+			delete(ms.seenAt, key)
+			delete(ms.samples, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package watcher
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// reportError logs a collector failure and records it as a CollectorError
+// meta event, so gaps in the causal record can be traced to the collector
+// rather than read as "nothing happened". object names what the operation
+// was acting on and may be empty.
+func reportError(e emitter.Emitter, log *slog.Logger, watcher, namespace, operation, object string, err error) {
+	if object != "" {
+		log.Error(operation+" failed", "object", object, "err", err)
+	} else {
+		log.Error(operation+" failed", "err", err)
+	}
+	e.EmitMeta(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "CollectorError",
+		Namespace: namespace,
+		Payload: map[string]interface{}{
+			"watcher":   watcher,
+			"operation": operation,
+			"object":    object,
+			"error":     err.Error(),
+		},
+	})
+}
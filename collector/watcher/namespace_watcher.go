@@ -0,0 +1,167 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// Values of the reason payload field of NamespaceWatchStopped.
+const (
+	NamespaceStopRemoved  = "removed" // deleted, or no longer labeled
+	NamespaceStopFailed   = "failed"
+	NamespaceStopShutdown = "shutdown"
+)
+
+// NamespaceWatcher runs the per-namespace watchers for every namespace
+// matching a label selector, starting them when a namespace appears or
+// gains the label and stopping them when it is deleted or loses it (a
+// selector-filtered watch reports both as a deletion). run is called once
+// per namespace and must return once its context is cancelled. A
+// namespace whose run fails is started again on its next update.
+type NamespaceWatcher struct {
+	client    kubernetes.Interface
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	run       func(ctx context.Context, namespace string) error
+
+	mu      sync.Mutex // guards running against failing runs removing themselves
+	running map[string]*namespaceRun
+}
+
+type namespaceRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewNamespaceWatcher(client kubernetes.Interface, sel Selectors, e emitter.Emitter, log *slog.Logger, run func(ctx context.Context, namespace string) error) *NamespaceWatcher {
+	return &NamespaceWatcher{client: client, selectors: sel, emitter: e, log: log.With("component", "namespace_watcher"), run: run,
+		running: map[string]*namespaceRun{},
+	}
+}
+
+func (nw *NamespaceWatcher) Watch(ctx context.Context) error {
+	nw.log.Info("starting", "label_selector", nw.selectors.Label)
+	factory := newInformerFactory(nw.client, "", nw.selectors)
+	informer := factory.Core().V1().Namespaces().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(func(event watch.Event) {
+		nw.handleEvent(ctx, event)
+	})); err != nil {
+		return fmt.Errorf("namespace informer registration failed: %w", err)
+	}
+	defer nw.stopAll()
+	return runInformer(ctx, nw.log, "namespace_watcher", "", nw.emitter, factory, informer)
+}
+
+// Namespaces lists the namespaces whose watchers are running.
+func (nw *NamespaceWatcher) Namespaces() []string {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return slices.Sorted(maps.Keys(nw.running))
+}
+
+func (nw *NamespaceWatcher) handleEvent(ctx context.Context, event watch.Event) {
+	ns, ok := event.Object.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		// A Terminating namespace stays watched until it is gone, so the
+		// deletions of its objects are recorded.
+		nw.start(ctx, ns.Name)
+	case watch.Deleted:
+		nw.stop(ns.Name, NamespaceStopRemoved)
+	}
+}
+
+func (nw *NamespaceWatcher) start(ctx context.Context, namespace string) {
+	nw.mu.Lock()
+	if nw.running[namespace] != nil {
+		nw.mu.Unlock()
+		return
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	r := &namespaceRun{cancel: cancel, done: make(chan struct{})}
+	nw.running[namespace] = r
+	nw.mu.Unlock()
+
+	nw.log.Info("NamespaceWatchStarted", "namespace", namespace)
+	nw.emitMeta("NamespaceWatchStarted", namespace, map[string]interface{}{
+		"label_selector": nw.selectors.Label,
+	})
+	go func() {
+		defer close(r.done)
+		err := nw.run(runCtx, namespace)
+		if err == nil || runCtx.Err() != nil {
+			return
+		}
+		nw.mu.Lock()
+		removed := nw.running[namespace] == r
+		if removed {
+			delete(nw.running, namespace)
+		}
+		nw.mu.Unlock()
+		cancel()
+		if removed {
+			reportError(nw.emitter, nw.log, "namespace_watcher", namespace, "run watchers", "", err)
+			nw.stopped(namespace, NamespaceStopFailed)
+		}
+	}()
+}
+
+// stop cancels the namespace's watchers and waits for them to return.
+func (nw *NamespaceWatcher) stop(namespace, reason string) {
+	nw.mu.Lock()
+	r := nw.running[namespace]
+	delete(nw.running, namespace)
+	nw.mu.Unlock()
+	if r == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+	nw.stopped(namespace, reason)
+}
+
+func (nw *NamespaceWatcher) stopAll() {
+	nw.mu.Lock()
+	names := make([]string, 0, len(nw.running))
+	for ns, r := range nw.running {
+		r.cancel()
+		names = append(names, ns)
+	}
+	nw.mu.Unlock()
+	for _, ns := range names {
+		nw.stop(ns, NamespaceStopShutdown)
+	}
+}
+
+func (nw *NamespaceWatcher) stopped(namespace, reason string) {
+	nw.log.Info("NamespaceWatchStopped", "namespace", namespace, "reason", reason)
+	nw.emitMeta("NamespaceWatchStopped", namespace, map[string]interface{}{
+		"label_selector": nw.selectors.Label,
+		"reason":         reason,
+	})
+}
+
+func (nw *NamespaceWatcher) emitMeta(eventType, namespace string, payload map[string]interface{}) {
+	nw.emitter.EmitMeta(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: eventType,
+		Namespace: namespace,
+		Payload:   payload,
+	})
+}
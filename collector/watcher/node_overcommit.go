@@ -0,0 +1,302 @@
+package watcher
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// DefaultOvercommitInterval is how often node memory commitment is
+// computed.
+const DefaultOvercommitInterval = time.Minute
+
+// overcommitTopPods is how many of a node's pods, largest memory request
+// first, a NodeMemoryOvercommit event lists.
+const overcommitTopPods = 5
+
+// podNodeIndex indexes the node watcher's pod cache by node name.
+const podNodeIndex = "nodeName"
+
+// WatchOvercommit makes the node watcher sum, every interval, the memory
+// requests of the pods on each node, and emit NodeMemoryOvercommit when a
+// node's commitment, that sum over its allocatable memory, reaches
+// threshold. MemoryPressure only turns true once the node is short of
+// memory; a node committed past its allocatable memory is headed there as
+// soon as its pods use what they requested. The event is emitted when the
+// commitment crosses the threshold, and again only after it has dropped
+// below. The pods of every namespace count, whatever the collector
+// watches, through a cluster-wide pod cache trimmed to their requests and
+// limits.
+// threshold <= 0 disables it.
+func (nw *NodeWatcher) WatchOvercommit(threshold float64, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultOvercommitInterval
+	}
+	nw.overcommitThreshold = threshold
+	nw.overcommitInterval = interval
+}
+
+// AggregatePodMemory adds to every node snapshot, the node_state of OOMKill
+// events among them, how packed the node was: the pods on it, the sums of
+// their memory requests and limits, and those over its allocatable memory.
+// Like WatchOvercommit it counts the pods of every namespace, through the
+// same cluster-wide pod cache.
+func (nw *NodeWatcher) AggregatePodMemory() {
+	nw.podMemory = true
+}
+
+// aggregatePods fills in the pod totals of s from the pod cache, if it has
+// synced: until then the totals would undercount.
+func (nw *NodeWatcher) aggregatePods(s *NodeSnapshot) {
+	nw.mu.RLock()
+	pods := nw.pods
+	nw.mu.RUnlock()
+	if pods == nil || !pods.HasSynced() {
+		return
+	}
+	var requests, limits int64
+	var count, unlimited int
+	for _, pod := range nodePods(pods.GetIndexer(), s.NodeName) {
+		count++
+		requests += podMemoryRequest(pod)
+		if limit, ok := podMemoryLimit(pod); ok {
+			limits += limit
+		} else {
+			unlimited++
+		}
+	}
+	s.ScheduledPodCount, s.MemoryUnlimitedPods = &count, &unlimited
+	s.TotalMemoryRequests, s.TotalMemoryLimits = &requests, &limits
+	if s.AllocatableMemBytes > 0 {
+		requestsRatio := math.Round(float64(requests)/float64(s.AllocatableMemBytes)*1e4) / 1e4
+		limitsRatio := math.Round(float64(limits)/float64(s.AllocatableMemBytes)*1e4) / 1e4
+		s.MemoryRequestsRatio, s.MemoryLimitsRatio = &requestsRatio, &limitsRatio
+	}
+}
+
+// nodePods returns the pods on the named node that hold memory.
+func nodePods(pods cache.Indexer, nodeName string) []*corev1.Pod {
+	objs, err := pods.ByIndex(podNodeIndex, nodeName)
+	if err != nil {
+		return nil
+	}
+	out := make([]*corev1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		pod, ok := obj.(*corev1.Pod)
+		// Finished pods keep their node but no longer hold memory.
+		if !ok || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		out = append(out, pod)
+	}
+	return out
+}
+
+// podCache adds the cluster's pods, trimmed to what the commitment is
+// computed from and indexed by node, to factory.
+func (nw *NodeWatcher) podCache(factory informers.SharedInformerFactory) (cache.SharedIndexInformer, error) {
+	informer := factory.Core().V1().Pods().Informer()
+	if err := informer.SetTransform(trimPod); err != nil {
+		return nil, err
+	}
+	if err := informer.AddIndexers(cache.Indexers{podNodeIndex: func(obj interface{}) ([]string, error) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok || pod.Spec.NodeName == "" {
+			return nil, nil
+		}
+		return []string{pod.Spec.NodeName}, nil
+	}}); err != nil {
+		return nil, err
+	}
+	// runInformer only watches over the node informer.
+	err := informer.SetWatchErrorHandlerWithContext(func(ctx context.Context, r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+		if errors.Is(err, io.EOF) || isExpired(err) {
+			return
+		}
+		reportError(nw.emitter, nw.log, "node_watcher", "", "list/watch pods", "", err)
+	})
+	return informer, err
+}
+
+func trimPod(obj interface{}) (interface{}, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return obj, nil
+	}
+	trim := func(cs []corev1.Container) []corev1.Container {
+		out := make([]corev1.Container, 0, len(cs))
+		for _, c := range cs {
+			out = append(out, corev1.Container{
+				Name:          c.Name,
+				Resources:     corev1.ResourceRequirements{Requests: c.Resources.Requests, Limits: c.Resources.Limits},
+				RestartPolicy: c.RestartPolicy,
+			})
+		}
+		return out
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Spec: corev1.PodSpec{
+			NodeName:       pod.Spec.NodeName,
+			InitContainers: trim(pod.Spec.InitContainers),
+			Containers:     trim(pod.Spec.Containers),
+			Overhead:       pod.Spec.Overhead,
+		},
+		Status: corev1.PodStatus{Phase: pod.Status.Phase, QOSClass: pod.Status.QOSClass},
+	}, nil
+}
+
+func (nw *NodeWatcher) watchOvercommit(ctx context.Context, pods cache.SharedIndexInformer) {
+	if !cache.WaitForCacheSync(ctx.Done(), pods.HasSynced) {
+		return
+	}
+	nw.log.Info("pod cache synced, computing memory commitment", "pods", len(pods.GetStore().ListKeys()),
+		"threshold", nw.overcommitThreshold, "interval", nw.overcommitInterval)
+	t := time.NewTicker(nw.overcommitInterval)
+	defer t.Stop()
+	overcommitted := map[string]bool{}
+	for {
+		nw.checkOvercommit(pods.GetIndexer(), overcommitted)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// podRequest is one pod's share of a node's memory commitment.
+type podRequest struct {
+	pod   *corev1.Pod
+	bytes int64
+}
+
+// checkOvercommit emits NodeMemoryOvercommit for the nodes whose commitment
+// crossed the threshold since the last check. overcommitted holds the
+// nodes at or above it.
+func (nw *NodeWatcher) checkOvercommit(pods cache.Indexer, overcommitted map[string]bool) {
+	nw.mu.RLock()
+	nodes := make(map[string]*corev1.Node, len(nw.nodeCache))
+	for name, cached := range nw.nodeCache {
+		nodes[name] = cached.node
+	}
+	nw.mu.RUnlock()
+	for name := range overcommitted {
+		if _, ok := nodes[name]; !ok {
+			delete(overcommitted, name)
+		}
+	}
+
+	for name, node := range nodes {
+		allocatable := node.Status.Allocatable.Memory().Value()
+		if allocatable <= 0 {
+			continue
+		}
+		onNode := nodePods(pods, name)
+		var total int64
+		requests := make([]podRequest, 0, len(onNode))
+		for _, pod := range onNode {
+			r := podRequest{pod: pod, bytes: podMemoryRequest(pod)}
+			total += r.bytes
+			requests = append(requests, r)
+		}
+		ratio := float64(total) / float64(allocatable)
+		over := ratio >= nw.overcommitThreshold
+		switch {
+		case over && !overcommitted[name]:
+			overcommitted[name] = true
+			nw.emitOvercommit(node, total, allocatable, ratio, requests)
+		case !over && overcommitted[name]:
+			delete(overcommitted, name)
+			nw.log.Info("node memory commitment back below threshold", "node", name, "ratio", math.Round(ratio*1e4)/1e4)
+		}
+	}
+}
+
+func (nw *NodeWatcher) emitOvercommit(node *corev1.Node, total, allocatable int64, ratio float64, requests []podRequest) {
+	slices.SortStableFunc(requests, func(a, b podRequest) int { return cmp.Compare(b.bytes, a.bytes) })
+	top := make([]map[string]interface{}, 0, overcommitTopPods)
+	for _, r := range requests[:min(len(requests), overcommitTopPods)] {
+		top = append(top, map[string]interface{}{
+			"pod_name":             r.pod.Name,
+			"namespace":            r.pod.Namespace,
+			"memory_request_bytes": r.bytes,
+			"qos_class":            string(r.pod.Status.QOSClass),
+		})
+	}
+	nw.emitter.Emit(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "NodeMemoryOvercommit",
+		PatternID: patterns.PatternOOMKill,
+		NodeName:  node.Name,
+		Payload: map[string]interface{}{
+			"memory_requests_bytes":    total,
+			"allocatable_memory_bytes": allocatable,
+			"commitment_ratio":         math.Round(ratio*1e4) / 1e4,
+			"threshold":                nw.overcommitThreshold,
+			"pod_count":                len(requests),
+			"top_pods":                 top,
+			"node_snapshot":            nw.snapshotFrom(node, SnapshotSourceCache),
+		},
+	})
+	nw.log.Info("NodeMemoryOvercommit", "node", node.Name, "ratio", math.Round(ratio*1e4)/1e4, "pods", len(requests))
+}
+
+// podMemoryRequest is the memory the scheduler reserves for pod: its app
+// containers and sidecars, or its largest init container alongside the
+// sidecars started before it if that is more, plus the pod overhead.
+func podMemoryRequest(pod *corev1.Pod) int64 {
+	return podMemory(pod, func(c corev1.Container) int64 {
+		return c.Resources.Requests.Memory().Value()
+	})
+}
+
+// podMemoryLimit is the most memory pod may use, summed as its request is,
+// or false if one of its containers has no memory limit.
+func podMemoryLimit(pod *corev1.Pod) (int64, bool) {
+	for _, c := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+		if _, ok := c.Resources.Limits[corev1.ResourceMemory]; !ok {
+			return 0, false
+		}
+	}
+	return podMemory(pod, func(c corev1.Container) int64 {
+		return c.Resources.Limits.Memory().Value()
+	}), true
+}
+
+// podMemory sums request, a memory quantity of each container, over pod
+// as the scheduler does.
+func podMemory(pod *corev1.Pod, request func(corev1.Container) int64) int64 {
+	var app, sidecars, init int64
+	for _, c := range pod.Spec.Containers {
+		app += request(c)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			sidecars += request(c)
+			init = max(init, sidecars)
+			continue
+		}
+		init = max(init, sidecars+request(c))
+	}
+	return max(app+sidecars, init) + pod.Spec.Overhead.Memory().Value()
+}
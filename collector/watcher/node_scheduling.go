@@ -0,0 +1,134 @@
+package watcher
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// nodeScheduling is what a node last told the scheduler: whether it is
+// cordoned, and its taints.
+type nodeScheduling struct {
+	unschedulable bool
+	taints        []corev1.Taint
+}
+
+// diffScheduling emits NodeCordoned or NodeUncordoned when the node's
+// spec.unschedulable flips, and NodeTainted or NodeUntainted for every
+// taint added or removed, a taint being its key and effect: a taint whose
+// value changes is reported as added, with its old value. A cordon or a
+// NoExecute taint is what comes before a wave of evictions during
+// maintenance or an autoscaler drain, which would otherwise look
+// causeless. The unschedulable taint the node controller mirrors a cordon
+// with is left to NodeCordoned. As with conditions, the first sight of a
+// node only records its state.
+func (nw *NodeWatcher) diffScheduling(node *corev1.Node, s *NodeSnapshot, emit bool) {
+	prev, seen := nw.scheduling[node.Name]
+	cur := nodeScheduling{unschedulable: node.Spec.Unschedulable, taints: node.Spec.Taints}
+	nw.scheduling[node.Name] = cur
+	if !emit || !seen {
+		return
+	}
+
+	if cur.unschedulable != prev.unschedulable {
+		eventType, patternID := "NodeCordoned", patterns.PatternNodeDrain
+		if !cur.unschedulable {
+			eventType, patternID = "NodeUncordoned", ""
+		}
+		nw.emitScheduling(node, eventType, patternID, time.Time{}, map[string]interface{}{
+			"unschedulable": cur.unschedulable,
+			"taints":        taintList(cur.taints),
+			"node_snapshot": s,
+		})
+	}
+
+	type taintID struct {
+		key    string
+		effect corev1.TaintEffect
+	}
+	old := make(map[taintID]corev1.Taint, len(prev.taints))
+	for _, t := range prev.taints {
+		old[taintID{t.Key, t.Effect}] = t
+	}
+	for _, t := range cur.taints {
+		id := taintID{t.Key, t.Effect}
+		was, had := old[id]
+		delete(old, id)
+		if t.Key == corev1.TaintNodeUnschedulable || (had && was.Value == t.Value) {
+			continue
+		}
+		payload := taintPayload(t)
+		payload["old_value"] = nil
+		if had {
+			payload["old_value"] = was.Value
+		}
+		payload["unschedulable"] = cur.unschedulable
+		payload["node_snapshot"] = s
+		patternID := ""
+		if t.Effect == corev1.TaintEffectNoExecute {
+			patternID = patterns.PatternNoExecuteTaint
+		}
+		nw.emitScheduling(node, "NodeTainted", patternID, taintAdded(t), payload)
+	}
+	for _, t := range old {
+		if t.Key == corev1.TaintNodeUnschedulable {
+			continue
+		}
+		payload := taintPayload(t)
+		payload["unschedulable"] = cur.unschedulable
+		payload["node_snapshot"] = s
+		nw.emitScheduling(node, "NodeUntainted", "", time.Time{}, payload)
+	}
+}
+
+// emitScheduling emits one scheduling change; occurred is zero when the
+// node does not record when it was made.
+func (nw *NodeWatcher) emitScheduling(node *corev1.Node, eventType, patternID string, occurred time.Time, payload map[string]interface{}) {
+	nw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: occurred,
+		EventType:  eventType,
+		PatternID:  patternID,
+		NodeName:   node.Name,
+		Payload:    payload,
+	})
+	if key, ok := payload["taint_key"]; ok {
+		nw.log.Info(eventType, "node", node.Name, "key", key, "effect", payload["taint_effect"])
+	} else {
+		nw.log.Info(eventType, "node", node.Name)
+	}
+}
+
+func taintPayload(t corev1.Taint) map[string]interface{} {
+	payload := map[string]interface{}{
+		"taint_key":    t.Key,
+		"taint_value":  t.Value,
+		"taint_effect": string(t.Effect),
+		"time_added":   nil,
+	}
+	if added := taintAdded(t); !added.IsZero() {
+		payload["time_added"] = added
+	}
+	return payload
+}
+
+// taintAdded is when t was added, which is recorded for NoExecute taints
+// only.
+func taintAdded(t corev1.Taint) time.Time {
+	if t.TimeAdded == nil {
+		return time.Time{}
+	}
+	return t.TimeAdded.Time
+}
+
+func taintList(taints []corev1.Taint) []map[string]string {
+	out := make([]map[string]string, 0, len(taints))
+	for _, t := range taints {
+		out = append(out, map[string]string{"key": t.Key, "value": t.Value, "effect": string(t.Effect)})
+	}
+	return out
+}
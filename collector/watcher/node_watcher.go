@@ -2,79 +2,268 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
 )
 
 type NodeWatcher struct {
-	client    kubernetes.Interface
-	emitter   *emitter.JSONEmitter
-	nodeCache map[string]*corev1.Node
+	client   kubernetes.Interface
+	emitter  emitter.Emitter
+	log      *slog.Logger
+	cacheTTL time.Duration
+	lag      *LagMonitor
+	limiter  *APILimiter
+
+	snapshotTriggers SnapshotTriggers
+
+	// checkpoint records the resourceVersion reached; downSince is when
+	// the previous run saved it, zero unless resuming.
+	checkpoint *Checkpoint
+	downSince  time.Time
+
+	// mu guards nodeCache: the node informer writes it while pod watcher
+	// goroutines read it through SnapshotNode.
+	mu        sync.RWMutex
+	nodeCache map[string]cachedNode
+	pods      cache.SharedIndexInformer // nil until Watch starts the pod cache
+
+	// conditions holds the conditions last delivered by the informer per
+	// node, the baseline NodeConditionChanged diffs against. It is kept
+	// apart from nodeCache, which SnapshotNode's live fetches also update,
+	// so a transition first seen by a fetch is still reported. scheduling
+	// is likewise the baseline of NodeCordoned and NodeTainted. Only the
+	// informer's handler goroutine touches them.
+	conditions map[string]map[corev1.NodeConditionType]corev1.NodeCondition
+	scheduling map[string]nodeScheduling
+
+	overcommitThreshold float64 // 0 disables NodeMemoryOvercommit
+	overcommitInterval  time.Duration
+	podMemory           bool // aggregate the pods of a node into its snapshots
 }
 
+// cachedNode remembers when a node was last observed, so SnapshotNode can
+// tell a fresh entry from one the watch has not refreshed in a while.
+type cachedNode struct {
+	node   *corev1.Node
+	seenAt time.Time
+}
+
+// Values of NodeSnapshot.Source.
+const (
+	SnapshotSourceCache = "cache"
+	SnapshotSourceLive  = "live"
+	// SnapshotSourceStale marks a cached node served past its TTL because
+	// the live fetch failed.
+	SnapshotSourceStale = "stale_cache"
+)
+
+// DefaultNodeCacheTTL is how long a cached node is trusted before
+// SnapshotNode fetches it again.
+const DefaultNodeCacheTTL = 60 * time.Second
+
 type NodeSnapshot struct {
-	NodeName         string            `json:"node_name"`
-	SnapshotTime     time.Time         `json:"snapshot_time"`
-	Conditions       map[string]string `json:"conditions"`
-	AllocatableMem   string            `json:"allocatable_memory"`
-	AllocatableCPU   string            `json:"allocatable_cpu"`
-	CapacityMem      string            `json:"capacity_memory"`
-	CapacityCPU      string            `json:"capacity_cpu"`
-	MemPressure      bool              `json:"memory_pressure"`
-	DiskPressure     bool              `json:"disk_pressure"`
-	PIDPressure      bool              `json:"pid_pressure"`
-	KernelVersion    string            `json:"kernel_version"`
-	KubeletVersion   string            `json:"kubelet_version"`
-	ContainerRuntime string            `json:"container_runtime"`
+	NodeName             string            `json:"node_name"`
+	SnapshotTime         time.Time         `json:"snapshot_time"`
+	Conditions           map[string]string `json:"conditions"`
+	AllocatableMem       string            `json:"allocatable_memory"`
+	AllocatableCPU       string            `json:"allocatable_cpu"`
+	CapacityMem          string            `json:"capacity_memory"`
+	CapacityCPU          string            `json:"capacity_cpu"`
+	AllocatableMemBytes  int64             `json:"allocatable_memory_bytes"`
+	AllocatableCPUMillis int64             `json:"allocatable_cpu_millicores"`
+	CapacityMemBytes     int64             `json:"capacity_memory_bytes"`
+	CapacityCPUMillis    int64             `json:"capacity_cpu_millicores"`
+	MemPressure          bool              `json:"memory_pressure"`
+	DiskPressure         bool              `json:"disk_pressure"`
+	PIDPressure          bool              `json:"pid_pressure"`
+	KernelVersion        string            `json:"kernel_version"`
+	KubeletVersion       string            `json:"kubelet_version"`
+	ContainerRuntime     string            `json:"container_runtime"`
+	// The node's addresses as the kubelet reports them, to match the node
+	// in kernel logs and infrastructure telemetry. A dual-stack node has an
+	// InternalIP per family, the primary first.
+	InternalIPs []string `json:"internal_ips"`
+	ExternalIPs []string `json:"external_ips"`
+	Hostname    string   `json:"hostname"`
+	// ProviderID identifies the cloud instance, e.g.
+	// aws:///us-east-1a/i-0abc.
+	ProviderID string `json:"provider_id"`
+	// What the pods on the node reserve, with AggregatePodMemory once the
+	// pod cache has synced; unset otherwise. The totals follow
+	// podMemoryRequest; a pod with a container without a memory limit
+	// counts in MemoryUnlimitedPods instead of TotalMemoryLimits. The
+	// ratios are the totals over allocatable memory.
+	ScheduledPodCount   *int     `json:"scheduled_pod_count,omitempty"`
+	TotalMemoryRequests *int64   `json:"total_memory_requests_bytes,omitempty"`
+	TotalMemoryLimits   *int64   `json:"total_memory_limits_bytes,omitempty"`
+	MemoryUnlimitedPods *int     `json:"memory_unlimited_pods,omitempty"`
+	MemoryRequestsRatio *float64 `json:"memory_requests_ratio,omitempty"`
+	MemoryLimitsRatio   *float64 `json:"memory_limits_ratio,omitempty"`
+	Source              string   `json:"source"`
+}
+
+func NewNodeWatcher(client kubernetes.Interface, e emitter.Emitter, log *slog.Logger, cacheTTL time.Duration) *NodeWatcher {
+	if cacheTTL <= 0 {
+		cacheTTL = DefaultNodeCacheTTL
+	}
+	return &NodeWatcher{client: client, emitter: e, log: log.With("component", "node_watcher"), nodeCache: map[string]cachedNode{}, cacheTTL: cacheTTL,
+		conditions: map[string]map[corev1.NodeConditionType]corev1.NodeCondition{},
+		scheduling: map[string]nodeScheduling{},
+	}
+}
+
+// UseLagMonitor measures the observation lag of condition changes through
+// lm.
+func (nw *NodeWatcher) UseLagMonitor(lm *LagMonitor) {
+	nw.lag = lm
 }
 
-func NewNodeWatcher(client kubernetes.Interface, e *emitter.JSONEmitter) *NodeWatcher {
-	return &NodeWatcher{client: client, emitter: e, nodeCache: map[string]*corev1.Node{}}
+// UseAPILimiter paces SnapshotNode's live fetches through l, serving the
+// cached node when one is throttled.
+func (nw *NodeWatcher) UseAPILimiter(l *APILimiter) {
+	nw.limiter = l
+}
+
+// UseCheckpoint records the resourceVersion the node informer reached in
+// cp and, resuming from it, reports the conditions of existing nodes that
+// transitioned while the collector was down, which the first sight of a
+// node would otherwise take as its baseline.
+func (nw *NodeWatcher) UseCheckpoint(cp *Checkpoint) {
+	nw.checkpoint = cp
 }
 
 func (nw *NodeWatcher) Watch(ctx context.Context) error {
-	fmt.Println("[node_watcher] Starting")
-	if err := nw.primeCache(ctx); err != nil {
-		fmt.Printf("[node_watcher] cache prime failed: %v\n", err)
+	nw.log.Info("starting")
+	if nw.checkpoint.ResourceVersion("node_watcher") != "" {
+		nw.downSince = nw.checkpoint.SavedAt()
 	}
-	w, err := nw.client.CoreV1().Nodes().Watch(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("node watch failed: %w", err)
+	nw.lag.start("node_watcher", "")
+	// The informer's initial list delivers every node as an Add, which
+	// primes nodeCache before the first pod event needs a node snapshot.
+	factory := newInformerFactory(nw.client, "", Selectors{})
+	informer := factory.Core().V1().Nodes().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(nw.handleNodeEvent)); err != nil {
+		return fmt.Errorf("node informer registration failed: %w", err)
 	}
-	defer w.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case event, ok := <-w.ResultChan():
-			if !ok {
-				return nw.Watch(ctx)
-			}
-			nw.handleNodeEvent(event)
+	if nw.overcommitThreshold > 0 || nw.podMemory {
+		pods, err := nw.podCache(factory)
+		if err != nil {
+			return fmt.Errorf("pod informer registration failed: %w", err)
+		}
+		if nw.podMemory {
+			nw.mu.Lock()
+			nw.pods = pods
+			nw.mu.Unlock()
+		}
+		if nw.overcommitThreshold > 0 {
+			var checks sync.WaitGroup
+			defer checks.Wait()
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			defer cancel() // stops the checks if runInformer fails
+			checks.Go(func() { nw.watchOvercommit(ctx, pods) })
 		}
 	}
+	return runInformer(ctx, nw.log, "node_watcher", "", nw.emitter, factory, informer)
 }
 
 func (nw *NodeWatcher) SnapshotNode(ctx context.Context, nodeName string) *NodeSnapshot {
 	if nodeName == "" {
 		return nil
 	}
-	if node, ok := nw.nodeCache[nodeName]; ok {
-		return nw.buildSnapshot(node)
+	nw.mu.RLock()
+	cached, ok := nw.nodeCache[nodeName]
+	nw.mu.RUnlock()
+	if ok && time.Since(cached.seenAt) < nw.cacheTTL {
+		return nw.snapshotFrom(cached.node, SnapshotSourceCache)
 	}
-	node, err := nw.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	var node *corev1.Node
+	err := nw.limiter.call(ctx, "node_watcher", "get node", nodeName, func(ctx context.Context) (err error) {
+		node, err = nw.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		return err
+	})
 	if err != nil {
+		if apierrors.IsNotFound(err) {
+			nw.forget(nodeName)
+			return nil
+		}
+		if errors.Is(err, errThrottled) {
+			if ok {
+				return nw.snapshotFrom(cached.node, SnapshotSourceStale)
+			}
+			return nil
+		}
+		reportError(nw.emitter, nw.log, "node_watcher", "", "get node", nodeName, err)
+		if ok {
+			return nw.snapshotFrom(cached.node, SnapshotSourceStale)
+		}
 		return nil
 	}
-	nw.nodeCache[nodeName] = node
-	return nw.buildSnapshot(node)
+	nw.remember(node)
+	return nw.snapshotFrom(node, SnapshotSourceLive)
+}
+
+// AllocatableByNode returns the allocatable memory and cpu of every cached
+// node without touching the API server, for weighing an unschedulable pod's
+// requests against what the cluster could offer.
+func (nw *NodeWatcher) AllocatableByNode() map[string]map[string]string {
+	nw.mu.RLock()
+	defer nw.mu.RUnlock()
+	out := make(map[string]map[string]string, len(nw.nodeCache))
+	for name, cached := range nw.nodeCache {
+		m := map[string]string{}
+		if v := cached.node.Status.Allocatable.Memory(); v != nil {
+			m["memory"] = v.String()
+		}
+		if v := cached.node.Status.Allocatable.Cpu(); v != nil {
+			m["cpu"] = v.String()
+		}
+		out[name] = m
+	}
+	return out
+}
+
+// remember caches node unless the cache already holds a newer copy; a
+// slow Get must not overwrite a fresher object delivered by the watch.
+func (nw *NodeWatcher) remember(node *corev1.Node) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if cur, ok := nw.nodeCache[node.Name]; ok && newerResourceVersion(cur.node, node) {
+		return
+	}
+	nw.nodeCache[node.Name] = cachedNode{node: node, seenAt: time.Now()}
+	metrics.NodeCacheSize.Set(float64(len(nw.nodeCache)))
+}
+
+func (nw *NodeWatcher) forget(name string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	delete(nw.nodeCache, name)
+	metrics.NodeCacheSize.Set(float64(len(nw.nodeCache)))
+}
+
+// newerResourceVersion reports whether a was observed after b.
+func newerResourceVersion(a, b *corev1.Node) bool {
+	return newerVersion(a.ResourceVersion, b.ResourceVersion)
+}
+
+func (nw *NodeWatcher) snapshotFrom(node *corev1.Node, source string) *NodeSnapshot {
+	s := nw.buildSnapshot(node)
+	s.Source = source
+	return s
 }
 
 func (nw *NodeWatcher) handleNodeEvent(event watch.Event) {
@@ -82,31 +271,84 @@ func (nw *NodeWatcher) handleNodeEvent(event watch.Event) {
 	if !ok {
 		return
 	}
-	nw.nodeCache[node.Name] = node
-	s := nw.buildSnapshot(node)
+	nw.checkpoint.Advance("node_watcher", node)
+	if event.Type == watch.Deleted {
+		// Scaled-down nodes must not keep answering SnapshotNode.
+		nw.forget(node.Name)
+		delete(nw.conditions, node.Name)
+		delete(nw.scheduling, node.Name)
+		return
+	}
+	nw.remember(node)
+	s := nw.snapshotFrom(node, SnapshotSourceLive)
+	nw.diffConditions(node, s, event.Type == watch.Modified)
+	nw.diffScheduling(node, s, event.Type == watch.Modified)
 	if s.MemPressure {
+		id := emitter.NewID()
 		nw.emitter.Emit(emitter.CausalEvent{
-			ID:        generateID(),
-			Timestamp: time.Now(),
-			EventType: "NodeMemoryPressure",
-			PatternID: "P001",
-			NodeName:  node.Name,
-			Payload:   map[string]interface{}{"node_snapshot": s, "pressure_active": true},
+			ID:         id,
+			Timestamp:  time.Now(),
+			OccurredAt: nodeConditionSince(node, corev1.NodeMemoryPressure),
+			EventType:  "NodeMemoryPressure",
+			PatternID:  "P001",
+			NodeName:   node.Name,
+			Payload:    map[string]interface{}{"node_snapshot": s, "pressure_active": true},
 		})
-		fmt.Printf("[node_watcher] MemoryPressure: node=%s\n", node.Name)
+		nw.log.Info("NodeMemoryPressure", "node", node.Name)
+		if nw.snapshotTriggers[SnapshotOnNodeMemoryPressure] {
+			nw.captureNodeSnapshot(node, s, "NodeMemoryPressure", id)
+		}
 	}
 }
 
-func (nw *NodeWatcher) primeCache(ctx context.Context) error {
-	nodes, err := nw.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return err
-	}
-	for i := range nodes.Items {
-		nw.nodeCache[nodes.Items[i].Name] = &nodes.Items[i]
+// diffConditions emits NodeConditionChanged for every condition whose
+// status differs from the one last seen for the node: DiskPressure ahead
+// of image-pull failures and evictions, PIDPressure, Ready flapping. A
+// condition the node did not report before counts as a transition from "".
+// The first sight of a node only records its conditions; nothing is known
+// to have changed, unless resuming from a checkpoint: then the conditions
+// of a node that existed before the previous run stopped and that
+// transitioned since are reported, from an unknown old status.
+func (nw *NodeWatcher) diffConditions(node *corev1.Node, s *NodeSnapshot, emit bool) {
+	prev := nw.conditions[node.Name]
+	cur := make(map[corev1.NodeConditionType]corev1.NodeCondition, len(node.Status.Conditions))
+	for _, cond := range node.Status.Conditions {
+		cur[cond.Type] = cond
+		old, seen := prev[cond.Type]
+		if seen && old.Status == cond.Status {
+			continue
+		}
+		if !emit && !nw.transitionedWhileDown(node, cond) {
+			continue
+		}
+		payload := map[string]interface{}{
+			"condition_type":       string(cond.Type),
+			"old_status":           string(old.Status),
+			"new_status":           string(cond.Status),
+			"reason":               cond.Reason,
+			"message":              cond.Message,
+			"old_reason":           old.Reason,
+			"last_transition_time": cond.LastTransitionTime.Time,
+			"node_snapshot":        s,
+		}
+		nw.lag.observe(payload, "node_watcher", "", "NodeConditionChanged", cond.LastTransitionTime.Time)
+		nw.emitter.Emit(emitter.CausalEvent{
+			ID:         emitter.NewID(),
+			Timestamp:  time.Now(),
+			OccurredAt: cond.LastTransitionTime.Time,
+			EventType:  "NodeConditionChanged",
+			NodeName:   node.Name,
+			Payload:    payload,
+		})
+		nw.log.Info("NodeConditionChanged", "node", node.Name, "condition", cond.Type, "from", old.Status, "to", cond.Status, "reason", cond.Reason)
 	}
-	fmt.Printf("[node_watcher] Cache primed: %d nodes\n", len(nodes.Items))
-	return nil
+	nw.conditions[node.Name] = cur
+}
+
+// transitionedWhileDown reports whether cond, of a node the previous run
+// could have seen, transitioned after that run stopped.
+func (nw *NodeWatcher) transitionedWhileDown(node *corev1.Node, cond corev1.NodeCondition) bool {
+	return !nw.downSince.IsZero() && node.CreationTimestamp.Time.Before(nw.downSince) && cond.LastTransitionTime.Time.After(nw.downSince)
 }
 
 func (nw *NodeWatcher) buildSnapshot(node *corev1.Node) *NodeSnapshot {
@@ -124,18 +366,37 @@ func (nw *NodeWatcher) buildSnapshot(node *corev1.Node) *NodeSnapshot {
 	}
 	if v := node.Status.Allocatable.Memory(); v != nil {
 		s.AllocatableMem = v.String()
+		s.AllocatableMemBytes = v.Value()
 	}
 	if v := node.Status.Allocatable.Cpu(); v != nil {
 		s.AllocatableCPU = v.String()
+		s.AllocatableCPUMillis = v.MilliValue()
 	}
 	if v := node.Status.Capacity.Memory(); v != nil {
 		s.CapacityMem = v.String()
+		s.CapacityMemBytes = v.Value()
 	}
 	if v := node.Status.Capacity.Cpu(); v != nil {
 		s.CapacityCPU = v.String()
+		s.CapacityCPUMillis = v.MilliValue()
 	}
 	s.KernelVersion = node.Status.NodeInfo.KernelVersion
 	s.KubeletVersion = node.Status.NodeInfo.KubeletVersion
 	s.ContainerRuntime = node.Status.NodeInfo.ContainerRuntimeVersion
+	s.InternalIPs, s.ExternalIPs = []string{}, []string{}
+	for _, addr := range node.Status.Addresses {
+		switch addr.Type {
+		case corev1.NodeInternalIP:
+			s.InternalIPs = append(s.InternalIPs, addr.Address)
+		case corev1.NodeExternalIP:
+			s.ExternalIPs = append(s.ExternalIPs, addr.Address)
+		case corev1.NodeHostName:
+			if s.Hostname == "" {
+				s.Hostname = addr.Address
+			}
+		}
+	}
+	s.ProviderID = node.Spec.ProviderID
+	nw.aggregatePods(s)
 	return s
 }
@@ -0,0 +1,95 @@
+package watcher
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+func testNode(name, rv string, memPressure bool) *corev1.Node {
+	status := corev1.ConditionFalse
+	if memPressure {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: rv},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: corev1.NodeMemoryPressure, Status: status},
+			},
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+				corev1.ResourceCPU:    resource.MustParse("4"),
+			},
+		},
+	}
+}
+
+// The informer's handler goroutine updates the node cache while pod
+// watcher goroutines read it, and refresh it with live fetches, through
+// SnapshotNode. Run with -race.
+func TestNodeWatcherConcurrentEventsAndSnapshots(t *testing.T) {
+	names := []string{"node-1", "node-2", "node-3"}
+	client := fake.NewSimpleClientset(testNode("node-1", "1", false), testNode("node-2", "1", false), testNode("node-3", "1", false))
+	e := emitter.NewMemoryEmitter()
+	// A TTL this short sends most SnapshotNode calls to the API server, so
+	// live fetches race the handler's writes.
+	nw := NewNodeWatcher(client, e, discardLogger(), time.Microsecond)
+	ctx := context.Background()
+
+	const updates = 500
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for i := 2; i < updates; i++ {
+			rv := strconv.Itoa(i)
+			nw.handleNodeEvent(watch.Event{Type: watch.Modified, Object: testNode("node-1", rv, i%2 == 0)})
+			nw.handleNodeEvent(watch.Event{Type: watch.Modified, Object: testNode("node-2", rv, false)})
+			if i%50 == 0 {
+				nw.handleNodeEvent(watch.Event{Type: watch.Deleted, Object: testNode("node-3", rv, false)})
+			} else {
+				nw.handleNodeEvent(watch.Event{Type: watch.Added, Object: testNode("node-3", rv, false)})
+			}
+		}
+	})
+	for range 8 {
+		wg.Go(func() {
+			for i := range updates {
+				name := names[i%len(names)]
+				s := nw.SnapshotNode(ctx, name)
+				if s == nil {
+					t.Errorf("no snapshot of %s", name)
+					return
+				}
+				if s.NodeName != name || s.AllocatableMemBytes != 8<<30 {
+					t.Errorf("snapshot of %s = %s with %d bytes allocatable", name, s.NodeName, s.AllocatableMemBytes)
+					return
+				}
+				nw.AllocatableByNode()
+			}
+		})
+	}
+	wg.Wait()
+
+	// The live fetches return resourceVersion 1 throughout; none of them
+	// may overwrite the newer copy the handler delivered.
+	nw.mu.RLock()
+	got := nw.nodeCache["node-1"].node.ResourceVersion
+	nw.mu.RUnlock()
+	if want := strconv.Itoa(updates - 1); got != want {
+		t.Fatalf("node-1 cached at resourceVersion %s, want %s", got, want)
+	}
+	if n := len(eventsOfType(e, "NodeMemoryPressure")); n != (updates-2)/2 {
+		t.Errorf("got %d NodeMemoryPressure events, want %d", n, (updates-2)/2)
+	}
+}
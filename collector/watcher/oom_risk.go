@@ -0,0 +1,157 @@
+package watcher
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// DefaultOOMRiskThreshold is the oom_risk from which a running pod on a
+// node entering MemoryPressure is reported as HighOOMRisk: every
+// BestEffort pod, and Burstable pods whose memory limit is missing or far
+// above their request.
+const DefaultOOMRiskThreshold = 0.7
+
+// Weights of the oom_risk score. Under node memory pressure the kubelet
+// evicts, and the kernel OOM killer picks, BestEffort pods first, then
+// Burstable pods using more than they requested; Guaranteed pods last.
+const (
+	riskBestEffort         = 0.6
+	riskBurstable          = 0.2
+	riskRequestGap         = 0.2 // scaled by how far usage may run past the request
+	riskPressure           = 0.4
+	riskPressureGuaranteed = 0.1
+)
+
+// oomRisk scores from 0 to 1 how likely pod is to be OOMKilled or evicted
+// for memory, from its QoS class, the gap between its containers' memory
+// requests and limits, and whether its node is under memory pressure. A
+// BestEffort pod on a node under pressure scores 1.
+func oomRisk(pod *corev1.Pod, memoryPressure bool) float64 {
+	var score float64
+	switch pod.Status.QOSClass {
+	case corev1.PodQOSBestEffort:
+		score = riskBestEffort
+		if memoryPressure {
+			score += riskPressure
+		}
+	case corev1.PodQOSGuaranteed:
+		if memoryPressure {
+			score += riskPressureGuaranteed
+		}
+	default: // Burstable, or not yet assigned
+		score = riskBurstable + riskRequestGap*memoryRequestGap(pod)
+		if memoryPressure {
+			score += riskPressure
+		}
+	}
+	return math.Round(min(score, 1)*100) / 100
+}
+
+// memoryRequestGap is the largest share of any container's memory limit
+// that lies above its request: 1 for a container with no memory limit,
+// 0 when every container's request equals its limit.
+func memoryRequestGap(pod *corev1.Pod) float64 {
+	var gap float64
+	for _, c := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+		limit, hasLimit := c.Resources.Limits[corev1.ResourceMemory]
+		if !hasLimit || limit.IsZero() {
+			return 1
+		}
+		request := c.Resources.Requests[corev1.ResourceMemory]
+		if g := 1 - request.AsApproximateFloat64()/limit.AsApproximateFloat64(); g > gap {
+			gap = g
+		}
+	}
+	return gap
+}
+
+// OOMRiskDetector reports the running pods most likely to be OOMKilled or
+// evicted as soon as their node enters MemoryPressure, while there is
+// still time to act, rather than after the kills. It is fed the emitted
+// events as an Observer listener and acts on NodeConditionChanged. The
+// node's pods are listed, with the collector's pod selectors, in each
+// namespace the namespaces func returns at the time.
+type OOMRiskDetector struct {
+	client     kubernetes.Interface
+	selectors  Selectors
+	emitter    emitter.Emitter
+	log        *slog.Logger
+	namespaces func() []string
+	threshold  float64
+}
+
+func NewOOMRiskDetector(client kubernetes.Interface, sel Selectors, e emitter.Emitter, log *slog.Logger, namespaces func() []string, threshold float64) *OOMRiskDetector {
+	return &OOMRiskDetector{client: client, selectors: sel, emitter: e, log: log.With("component", "oom_risk"), namespaces: namespaces, threshold: threshold}
+}
+
+// Feed scans the node's pods when event reports it entering MemoryPressure.
+func (d *OOMRiskDetector) Feed(event emitter.CausalEvent) {
+	if event.EventType != "NodeConditionChanged" {
+		return
+	}
+	condition, _ := event.Payload["condition_type"].(string)
+	status, _ := event.Payload["new_status"].(string)
+	if condition != string(corev1.NodeMemoryPressure) || status != string(corev1.ConditionTrue) {
+		return
+	}
+	node, _ := event.Payload["node_snapshot"].(*NodeSnapshot)
+	d.scan(context.Background(), event.NodeName, node)
+}
+
+func (d *OOMRiskDetector) scan(ctx context.Context, nodeName string, node *NodeSnapshot) {
+	opts := d.selectors.listOptions()
+	opts.FieldSelector = "spec.nodeName=" + nodeName + ",status.phase=" + string(corev1.PodRunning)
+	if d.selectors.Field != "" {
+		opts.FieldSelector += "," + d.selectors.Field
+	}
+	atRisk := 0
+	for _, ns := range d.namespaces() {
+		pods, err := d.client.CoreV1().Pods(ns).List(ctx, opts)
+		if err != nil {
+			reportError(d.emitter, d.log, "oom_risk", ns, "list pods on", nodeName, err)
+			continue
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			risk := oomRisk(pod, true)
+			if risk < d.threshold {
+				continue
+			}
+			atRisk++
+			payload := map[string]interface{}{
+				"oom_risk":           risk,
+				"threshold":          d.threshold,
+				"qos_class":          string(pod.Status.QOSClass),
+				"resource_limits":    extractAllResourceLimits(pod),
+				"memory_request_gap": math.Round(memoryRequestGap(pod)*100) / 100,
+				"node_state":         node,
+			}
+			// No per-namespace resolver here; the workload is inferred
+			// from the pod's owner references alone.
+			(*Owners)(nil).annotate(payload, pod)
+			d.emitter.Emit(emitter.CausalEvent{
+				ID:        emitter.NewID(),
+				Timestamp: time.Now(),
+				EventType: "HighOOMRisk",
+				PatternID: patterns.PatternOOMKill,
+				PodName:   pod.Name,
+				Namespace: pod.Namespace,
+				NodeName:  nodeName,
+				PodUID:    string(pod.UID),
+				Payload:   payload,
+			})
+		}
+	}
+	if atRisk > 0 {
+		d.log.Info("HighOOMRisk", "node", nodeName, "pods", atRisk, "threshold", d.threshold)
+	}
+}
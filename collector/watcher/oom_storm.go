@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+const (
+	DefaultOOMStormWindow    = 5 * time.Minute
+	DefaultOOMStormThreshold = 3
+)
+
+// OOMStormDetector counts OOMKills per node over a sliding window and emits
+// NodeOOMStorm when a node reaches the threshold, listing every pod it
+// killed. One greedy pod OOMKills on its own, again and again; an
+// oversubscribed node kills several pods at once, and the remediation is
+// the node's, not a memory limit's. It is fed the emitted events as an
+// Observer listener, so it sees the OOMKills of every namespace.
+type OOMStormDetector struct {
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	node      *NodeWatcher
+	window    time.Duration
+	threshold int
+
+	mu     sync.Mutex
+	kills  map[string][]stormKill // node → OOMKills within the window, oldest first
+	storms map[string]bool        // nodes NodeOOMStorm was emitted for, until their window empties
+}
+
+// stormKill is one OOMKill counted toward a node's storm.
+type stormKill struct {
+	at        time.Time
+	pod       string
+	namespace string
+	container string
+	workload  string
+}
+
+func NewOOMStormDetector(e emitter.Emitter, log *slog.Logger, node *NodeWatcher, window time.Duration, threshold int) *OOMStormDetector {
+	return &OOMStormDetector{emitter: e, log: log.With("component", "oom_storm"), node: node, window: window, threshold: threshold,
+		kills:  map[string][]stormKill{},
+		storms: map[string]bool{},
+	}
+}
+
+// Feed counts event if it is an OOMKill. The storm is reported once, when
+// the node reaches the threshold; OOMKills that follow while the window
+// still holds earlier ones belong to the same storm.
+func (d *OOMStormDetector) Feed(event emitter.CausalEvent) {
+	if event.EventType != "OOMKill" || event.NodeName == "" {
+		return
+	}
+	container, _ := event.Payload["container_name"].(string)
+	workload, _ := event.Payload["workload"].(string)
+	k := stormKill{at: event.Timestamp, pod: event.PodName, namespace: event.Namespace, container: container, workload: workload}
+
+	d.mu.Lock()
+	recent := d.kills[event.NodeName]
+	for len(recent) > 0 && k.at.Sub(recent[0].at) > d.window {
+		recent = recent[1:]
+	}
+	if len(recent) == 0 {
+		delete(d.storms, event.NodeName)
+	}
+	recent = append(recent, k)
+	d.kills[event.NodeName] = recent
+	if len(recent) < d.threshold || d.storms[event.NodeName] {
+		d.mu.Unlock()
+		return
+	}
+	d.storms[event.NodeName] = true
+	kills := append([]stormKill(nil), recent...)
+	d.mu.Unlock()
+
+	d.emitStorm(event.NodeName, kills)
+}
+
+func (d *OOMStormDetector) emitStorm(nodeName string, kills []stormKill) {
+	pods := make([]map[string]interface{}, len(kills))
+	namespaces, workloads := map[string]bool{}, map[string]bool{}
+	for i, k := range kills {
+		pods[i] = map[string]interface{}{
+			"pod_name":       k.pod,
+			"namespace":      k.namespace,
+			"container_name": k.container,
+			"workload":       k.workload,
+			"oomkilled_at":   k.at,
+		}
+		namespaces[k.namespace] = true
+		if k.workload != "" {
+			workloads[k.namespace+"/"+k.workload] = true
+		}
+	}
+	first, last := kills[0].at, kills[len(kills)-1].at
+	d.emitter.Emit(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "NodeOOMStorm",
+		PatternID: patterns.PatternOOMKill,
+		NodeName:  nodeName,
+		Payload: map[string]interface{}{
+			"node_name":          nodeName,
+			"oomkill_count":      len(kills),
+			"threshold":          d.threshold,
+			"window_seconds":     d.window.Seconds(),
+			"first_oomkill":      first,
+			"last_oomkill":       last,
+			"span_seconds":       last.Sub(first).Seconds(),
+			"affected_pods":      pods,
+			"distinct_workloads": len(workloads),
+			"namespaces":         len(namespaces),
+			"node_state":         d.node.SnapshotNode(context.Background(), nodeName),
+		},
+	})
+	d.log.Info("NodeOOMStorm", "node", nodeName, "oomkills", len(kills), "window", d.window, "workloads", len(workloads))
+}
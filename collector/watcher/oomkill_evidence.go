@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+const (
+	// evidenceWindow is how long LastTerminationState can be relied on to
+	// still describe an OOMKill: the next restart of the container, as
+	// early as its next crash, overwrites it.
+	evidenceWindow = 90 * time.Second
+	// evidenceRefetchMargin is how long before the window closes the
+	// re-fetch is made.
+	evidenceRefetchMargin = 10 * time.Second
+)
+
+// UseWindows takes the evidence window of a namespace, which sets the
+// evidence_expires_at of its OOMKills and when their evidence is
+// re-fetched, from w: a namespace whose containers back off for minutes
+// before restarting keeps its evidence longer.
+func (pw *PodWatcher) UseWindows(w *patterns.NamespaceWindows) {
+	pw.windows = w
+}
+
+func (pw *PodWatcher) evidenceWindow(namespace string) time.Duration {
+	return pw.windows.EvidenceWindow(namespace, evidenceWindow)
+}
+
+// oomKill identifies one OOMKill of one container.
+type oomKill struct {
+	pod        types.UID
+	container  string
+	finishedAt time.Time
+}
+
+// markEvidence records that OOMKillEvidence was emitted for k, if a
+// re-fetch is pending for it, and reports whether it had been already.
+func (pw *PodWatcher) markEvidence(k oomKill) bool {
+	pw.evidenceMu.Lock()
+	defer pw.evidenceMu.Unlock()
+	captured, tracked := pw.evidence[k]
+	if tracked {
+		pw.evidence[k] = true
+	}
+	return captured
+}
+
+// scheduleEvidenceRefetch makes sure every OOMKill ends with either an
+// OOMKillEvidence or an EvidenceExpired event. The kubelet may rotate
+// LastTerminationState without the pod watcher seeing the OOMKilled state
+// in between (two restarts coalesced into one update, a watch gap), so
+// shortly before evidence_expires_at the pod is fetched once more; if the
+// OOMKill is still on record, it is captured.
+func (pw *PodWatcher) scheduleEvidenceRefetch(ctx context.Context, pod *corev1.Pod, cs corev1.ContainerStatus, containerType string, killedAt time.Time) {
+	k := oomKill{pod: pod.UID, container: cs.Name, finishedAt: cs.State.Terminated.FinishedAt.Time}
+	pw.evidenceMu.Lock()
+	if _, tracked := pw.evidence[k]; !tracked {
+		pw.evidence[k] = false
+	}
+	pw.evidenceMu.Unlock()
+
+	namespace, name := pod.Namespace, pod.Name
+	pw.refetches.Go(func() {
+		defer func() {
+			pw.evidenceMu.Lock()
+			delete(pw.evidence, k)
+			pw.evidenceMu.Unlock()
+		}()
+		window := pw.evidenceWindow(namespace)
+		timer := time.NewTimer(time.Until(killedAt.Add(max(window-evidenceRefetchMargin, window/2))))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		pw.evidenceMu.Lock()
+		captured := pw.evidence[k]
+		pw.evidenceMu.Unlock()
+		if captured {
+			return
+		}
+
+		current, err := pw.client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case ctx.Err() != nil:
+			return
+		case apierrors.IsNotFound(err) || err == nil && current.UID != k.pod:
+			pw.emitEvidenceExpired(pod, cs.Name, containerType, k, killedAt, "pod deleted before the evidence was re-fetched")
+			return
+		case err != nil:
+			reportError(pw.emitter, pw.log, "pod_watcher", namespace, "re-fetch OOMKill evidence of", namespace+"/"+name, err)
+			pw.emitEvidenceExpired(pod, cs.Name, containerType, k, killedAt, "re-fetch failed: "+err.Error())
+			return
+		}
+		for _, st := range allContainerStatuses(current) {
+			if st.Name != cs.Name {
+				continue
+			}
+			for source, term := range map[string]*corev1.ContainerStateTerminated{
+				"State":                st.State.Terminated,
+				"LastTerminationState": st.LastTerminationState.Terminated,
+			} {
+				if term != nil && term.Reason == "OOMKilled" && term.FinishedAt.Time.Equal(k.finishedAt) {
+					if !pw.markEvidence(k) {
+						pw.emitEvidence(current, st, term, containerType, source, "refetch")
+					}
+					return
+				}
+			}
+		}
+		pw.emitEvidenceExpired(current, cs.Name, containerType, k, killedAt, "LastTerminationState no longer holds the OOMKill")
+	})
+}
+
+func (pw *PodWatcher) emitEvidenceExpired(pod *corev1.Pod, container, containerType string, k oomKill, killedAt time.Time, reason string) {
+	payload := map[string]interface{}{
+		"container_name":      container,
+		"container_type":      containerType,
+		"oomkill_finished":    k.finishedAt,
+		"evidence_expires_at": killedAt.Add(pw.evidenceWindow(pod.Namespace)),
+		"reason":              reason,
+		"evidence_source":     "LastTerminationState",
+	}
+	pw.owners.annotate(payload, pod)
+	pw.emitter.Emit(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "EvidenceExpired",
+		PatternID: patterns.PatternOOMKill,
+		PodName:   pod.Name,
+		Namespace: pod.Namespace,
+		NodeName:  pod.Spec.NodeName,
+		PodUID:    string(k.pod),
+		Payload:   payload,
+	})
+	pw.log.Warn("EvidenceExpired", "pod", pod.Namespace+"/"+pod.Name, "container", container, "reason", reason)
+}
+
+func allContainerStatuses(pod *corev1.Pod) []corev1.ContainerStatus {
+	all := append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...)
+	all = append(all, pod.Status.ContainerStatuses...)
+	return append(all, pod.Status.EphemeralContainerStatuses...)
+}
@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// Owners resolves pods to the workload that owns them, following a
+// ReplicaSet up to its Deployment, so every pod-originated event can be
+// grouped by workload without a join. The ReplicaSet→Deployment step is
+// answered from an informer cache of the namespace's ReplicaSets, trimmed
+// to their owner references; no event costs an API call.
+//
+// Until the cache has synced, and for a ReplicaSet created after the pod
+// was seen, the Deployment is inferred from the pod-template-hash suffix of
+// the ReplicaSet name. A nil *Owners always infers it that way.
+type Owners struct {
+	client    kubernetes.Interface
+	namespace string
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	factory   informers.SharedInformerFactory
+	informer  cache.SharedIndexInformer
+	lister    appslisters.ReplicaSetLister
+}
+
+func NewOwners(client kubernetes.Interface, namespace string, e emitter.Emitter, log *slog.Logger) *Owners {
+	// Every ReplicaSet is needed, whatever the pod selector.
+	factory := newInformerFactory(client, namespace, Selectors{})
+	rs := factory.Apps().V1().ReplicaSets()
+	return &Owners{client: client, namespace: namespace, emitter: e, log: log.With("component", "owner_resolver"),
+		factory: factory, informer: rs.Informer(), lister: rs.Lister()}
+}
+
+func (o *Owners) Watch(ctx context.Context) error {
+	o.log.Info("starting", "namespace", o.namespace)
+	// Old ReplicaSets are kept for rollback, ten per Deployment by default;
+	// only the owner references are worth holding.
+	err := o.informer.SetTransform(func(obj interface{}) (interface{}, error) {
+		rs, ok := obj.(*appsv1.ReplicaSet)
+		if !ok {
+			return obj, nil
+		}
+		return &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:            rs.Name,
+			Namespace:       rs.Namespace,
+			UID:             rs.UID,
+			ResourceVersion: rs.ResourceVersion,
+			OwnerReferences: rs.OwnerReferences,
+		}}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("replicaset informer transform failed: %w", err)
+	}
+	return runInformer(ctx, o.log, "owner_resolver", o.namespace, o.emitter, o.factory, o.informer)
+}
+
+// Workload returns the kind and name of the workload that owns pod:
+// Deployment for a pod of a Deployment's ReplicaSet, else the pod's
+// controller (StatefulSet, DaemonSet, Job, a bare ReplicaSet, ...). Both
+// are "" for a pod no controller owns.
+func (o *Owners) Workload(pod *corev1.Pod) (kind, name string) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", ""
+	}
+	if owner.Kind != "ReplicaSet" {
+		return owner.Kind, owner.Name
+	}
+	if o != nil {
+		rs, err := o.lister.ReplicaSets(pod.Namespace).Get(owner.Name)
+		if err == nil && rs.UID == owner.UID {
+			if dep := metav1.GetControllerOf(rs); dep != nil && dep.Kind == "Deployment" {
+				return dep.Kind, dep.Name
+			}
+			return owner.Kind, owner.Name
+		}
+	}
+	if hash := pod.Labels["pod-template-hash"]; hash != "" {
+		if name, ok := strings.CutSuffix(owner.Name, "-"+hash); ok {
+			return "Deployment", name
+		}
+	}
+	return owner.Kind, owner.Name
+}
+
+// annotate adds the owning workload to a pod event's payload: workload as
+// "Kind/name", which the matcher correlates on, and workload_kind and
+// workload_name. All three are "" for an orphan pod.
+func (o *Owners) annotate(payload map[string]interface{}, pod *corev1.Pod) {
+	kind, name := o.Workload(pod)
+	payload["workload_kind"] = kind
+	payload["workload_name"] = name
+	payload["workload"] = ""
+	if kind != "" {
+		payload["workload"] = kind + "/" + name
+	}
+}
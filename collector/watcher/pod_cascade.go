@@ -0,0 +1,114 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// DefaultCascadeWindow is how soon after a pod's first container
+// termination the terminations of its other containers belong to the same
+// incident.
+const DefaultCascadeWindow = 30 * time.Second
+
+// podIncident is the terminations of one pod's containers within the
+// cascade window of the first, in the order they finished.
+type podIncident struct {
+	id      string
+	members []cascadeMember
+}
+
+type cascadeMember struct {
+	eventID       string
+	container     string
+	containerType string
+	reason        string
+	exitCode      int32
+	finishedAt    time.Time
+}
+
+// LinkCascades links the terminations of a pod's containers that finish
+// within window of the first: each OOMKill and ContainerTerminated event
+// carries the incident's pod_incident_id and its cascade_order within it,
+// 1 for the first. When the first was an OOMKill and another container
+// followed, as an app does when the sidecar it talks through dies,
+// PodOOMCascade lists them once the window is over. Containers failing
+// apart from one another each start an incident of their own. Terminations
+// are counted once, however many status updates repeat them. window <= 0
+// disables linking.
+func (pw *PodWatcher) LinkCascades(window time.Duration) {
+	pw.cascadeWindow = window
+}
+
+// joinIncident adds a termination to its pod's current incident, or opens
+// one, and returns the incident ID and the termination's cascade order.
+func (pw *PodWatcher) joinIncident(ctx context.Context, pod *corev1.Pod, m cascadeMember) (string, int) {
+	pw.incidentsMu.Lock()
+	defer pw.incidentsMu.Unlock()
+	inc := pw.incidents[pod.UID]
+	if inc == nil || m.finishedAt.Sub(inc.members[0].finishedAt).Abs() > pw.cascadeWindow {
+		inc = &podIncident{id: emitter.NewID()}
+		pw.incidents[pod.UID] = inc
+		if m.reason == "OOMKilled" {
+			pw.refetches.Go(func() { pw.awaitCascade(ctx, pod, inc) })
+		}
+	}
+	inc.members = append(inc.members, m)
+	return inc.id, len(inc.members)
+}
+
+// awaitCascade emits PodOOMCascade once inc's window is over, if another
+// container followed the OOMKilled one.
+func (pw *PodWatcher) awaitCascade(ctx context.Context, pod *corev1.Pod, inc *podIncident) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(pw.cascadeWindow):
+	}
+	pw.incidentsMu.Lock()
+	members := append([]cascadeMember(nil), inc.members...)
+	if pw.incidents[pod.UID] == inc {
+		delete(pw.incidents, pod.UID)
+	}
+	pw.incidentsMu.Unlock()
+	if len(members) < 2 {
+		return
+	}
+	containers := make([]map[string]interface{}, 0, len(members))
+	for i, m := range members {
+		containers = append(containers, map[string]interface{}{
+			"container_name": m.container,
+			"container_type": m.containerType,
+			"reason":         m.reason,
+			"exit_code":      m.exitCode,
+			"finished":       m.finishedAt,
+			"cascade_order":  i + 1,
+			"event_id":       m.eventID,
+		})
+	}
+	payload := map[string]interface{}{
+		"pod_incident_id":   inc.id,
+		"trigger_container": members[0].container,
+		"containers":        containers,
+		"container_count":   len(members),
+		"cascade_seconds":   members[len(members)-1].finishedAt.Sub(members[0].finishedAt).Seconds(),
+		"window_seconds":    pw.cascadeWindow.Seconds(),
+	}
+	pw.owners.annotate(payload, pod)
+	pw.emitter.Emit(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "PodOOMCascade",
+		PatternID: patterns.PatternOOMKill,
+		PodName:   pod.Name,
+		Namespace: pod.Namespace,
+		NodeName:  pod.Spec.NodeName,
+		PodUID:    string(pod.UID),
+		Payload:   payload,
+	})
+	pw.log.Info("PodOOMCascade", "pod", pod.Name, "namespace", pod.Namespace, "trigger", members[0].container, "containers", len(members))
+}
@@ -0,0 +1,129 @@
+package watcher
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// podReasonEvicted is the pod status reason the kubelet sets when it evicts
+// a pod under node pressure.
+const podReasonEvicted = "Evicted"
+
+// Reasons of the DisruptionTarget pod condition set on a pod evicted
+// through the Eviction API, as kubectl drain and the cluster autoscaler
+// do, and on one deleted for not tolerating a NoExecute taint.
+const (
+	disruptionEvictionAPI  = "EvictionByEvictionAPI"
+	disruptionTaintManager = "DeletionByTaintManager"
+)
+
+// evictedRe pulls the starved resource out of a kubelet eviction message
+// such as "The node was low on resource: memory. Threshold quantity: 100Mi,
+// available: 42Mi. Container app was using 310Mi, request is 128Mi, ..."
+var evictedRe = regexp.MustCompile(`low on resource: ([A-Za-z0-9./_-]*[A-Za-z0-9_-])`)
+
+// inspectEviction emits PodEvicted for a pod the kubelet evicted, telling a
+// pressure eviction apart from a scale-down or any other deletion. Evicted
+// pods usually linger as Failed until garbage collected, so the eviction
+// is caught on the update that marks it; the Deleted branch catches pods
+// whose eviction was only seen with their deletion. Pods evicted off their
+// node by a drain or a NoExecute taint are reported too, from their
+// DisruptionTarget condition, with eviction_source telling them apart from
+// the kubelet's pressure evictions. Each pod is reported once. It reports
+// whether the pod was evicted.
+func (pw *PodWatcher) inspectEviction(ctx context.Context, pod *corev1.Pod, deleted bool) bool {
+	reason, message, source := pod.Status.Reason, pod.Status.Message, "kubelet"
+	if reason != podReasonEvicted {
+		cond := disruptionTarget(pod)
+		if cond == nil {
+			return false
+		}
+		reason, message, source = cond.Reason, cond.Message, "eviction_api"
+		if cond.Reason == disruptionTaintManager {
+			source = "taint_manager"
+		}
+	}
+	if pw.evicted[pod.UID] {
+		if deleted {
+			delete(pw.evicted, pod.UID)
+		}
+		return true
+	}
+	if !deleted {
+		pw.evicted[pod.UID] = true
+	}
+
+	resource := ""
+	if source == "kubelet" {
+		resource = evictedResource(message)
+	}
+	patternID := ""
+	switch {
+	case resource == string(corev1.ResourceMemory):
+		patternID = patterns.PatternOOMKill
+	case source == "eviction_api":
+		patternID = patterns.PatternNodeDrain
+	case source == "taint_manager":
+		patternID = patterns.PatternNoExecuteTaint
+	}
+	payload := map[string]interface{}{
+		"reason":           reason,
+		"message":          message,
+		"eviction_source":  source,
+		"evicted_resource": resource,
+		"pod_phase":        string(pod.Status.Phase),
+		"qos_class":        string(pod.Status.QOSClass),
+		"resource_limits":  extractAllResourceLimits(pod),
+		"node_name":        pod.Spec.NodeName,
+		"node_state":       pw.node.SnapshotNode(ctx, pod.Spec.NodeName),
+		"seen_on_deletion": deleted,
+	}
+	pw.owners.annotate(payload, pod)
+	pw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: podConditionSince(pod, corev1.DisruptionTarget),
+		EventType:  "PodEvicted",
+		PatternID:  patternID,
+		PodName:    pod.Name,
+		Namespace:  pod.Namespace,
+		NodeName:   pod.Spec.NodeName,
+		PodUID:     string(pod.UID),
+		Payload:    payload,
+	})
+	pw.log.Info("PodEvicted", "pod", pod.Name, "namespace", pod.Namespace, "node", pod.Spec.NodeName, "resource", resource)
+	return true
+}
+
+// disruptionTarget returns pod's DisruptionTarget condition if a drain or
+// a NoExecute taint is evicting it.
+func disruptionTarget(pod *corev1.Pod) *corev1.PodCondition {
+	for i, c := range pod.Status.Conditions {
+		if c.Type == corev1.DisruptionTarget && c.Status == corev1.ConditionTrue &&
+			(c.Reason == disruptionEvictionAPI || c.Reason == disruptionTaintManager) {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// evictedResource names the node resource an eviction message blames, or
+// "" if it names none.
+func evictedResource(message string) string {
+	if m := evictedRe.FindStringSubmatch(message); m != nil {
+		return m[1]
+	}
+	// Container or pod ephemeral-storage limit evictions are worded
+	// differently: "Pod ephemeral local storage usage exceeds ..."
+	if strings.Contains(message, "ephemeral local storage") {
+		return string(corev1.ResourceEphemeralStorage)
+	}
+	return ""
+}
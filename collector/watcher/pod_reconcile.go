@@ -0,0 +1,186 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultReconcileInterval is how often the pods seen are checked against
+// a fresh list.
+const DefaultReconcileInterval = 10 * time.Minute
+
+// MaxTrackedPodsPerNamespace bounds the pods tracked for the reconcile in
+// one namespace; pods past it are not reconciled.
+const MaxTrackedPodsPerNamespace = 10000
+
+// reconcileGrace is how long a pod missing from a list may still be
+// deleted through the informer before it is reported: its Deleted event
+// may be queued behind others.
+const reconcileGrace = 30 * time.Second
+
+// reconcilePageSize is the pods fetched per list request.
+const reconcilePageSize = 500
+
+// trackedPod is the last state seen of a pod not yet deleted.
+type trackedPod struct {
+	pod  *corev1.Pod
+	seen time.Time
+}
+
+// ReconcileEvery lists the pods every interval and emits a PodDisappeared
+// snapshot, with trigger ReconcileDetectedMissing, of each pod seen before
+// that is gone without a Deleted event having been observed. The informer
+// normally delivers a deletion missed while its watch was down on its next
+// relist; this is the check that it did, and the final snapshot of a pod
+// otherwise lost. The snapshot is the pod's last state seen.
+func (pw *PodWatcher) ReconcileEvery(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	pw.reconcileInterval = interval
+	pw.tracked = map[string]map[types.UID]trackedPod{}
+	pw.trackFull = map[string]bool{}
+	pw.disappeared = newUIDSet(MaxTrackedPodsPerNamespace)
+}
+
+// track records pod as seen, unless its namespace already has
+// MaxTrackedPodsPerNamespace pods tracked.
+func (pw *PodWatcher) track(pod *corev1.Pod) {
+	if pw.tracked == nil {
+		return
+	}
+	pw.trackedMu.Lock()
+	defer pw.trackedMu.Unlock()
+	pods := pw.tracked[pod.Namespace]
+	if pods == nil {
+		pods = map[types.UID]trackedPod{}
+		pw.tracked[pod.Namespace] = pods
+	}
+	if _, ok := pods[pod.UID]; !ok && len(pods) >= MaxTrackedPodsPerNamespace {
+		if !pw.trackFull[pod.Namespace] {
+			pw.trackFull[pod.Namespace] = true
+			pw.log.Warn("too many pods to reconcile, the rest are not tracked", "namespace", pod.Namespace, "limit", MaxTrackedPodsPerNamespace)
+		}
+		return
+	}
+	pods[pod.UID] = trackedPod{pod: pod, seen: time.Now()}
+}
+
+// untrack forgets a deleted pod, reporting whether the reconcile has
+// already snapshotted it as PodDisappeared.
+func (pw *PodWatcher) untrack(pod *corev1.Pod) bool {
+	if pw.tracked == nil {
+		return false
+	}
+	pw.trackedMu.Lock()
+	defer pw.trackedMu.Unlock()
+	if pods := pw.tracked[pod.Namespace]; pods != nil {
+		delete(pods, pod.UID)
+		if len(pods) == 0 {
+			delete(pw.tracked, pod.Namespace)
+		}
+	}
+	return pw.disappeared.members[pod.UID]
+}
+
+func (pw *PodWatcher) reconcileLoop(ctx context.Context, informer cache.SharedIndexInformer) {
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return
+	}
+	t := time.NewTicker(pw.reconcileInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			pw.reconcile(ctx)
+		}
+	}
+}
+
+// reconcile lists the pods and snapshots those tracked since before the
+// list that it did not return and that are still tracked reconcileGrace
+// later.
+func (pw *PodWatcher) reconcile(ctx context.Context) {
+	started := time.Now()
+	present := map[types.UID]bool{}
+	opts := pw.selectors.listOptions()
+	opts.Limit = reconcilePageSize
+	for {
+		pods, err := pw.client.CoreV1().Pods(pw.namespace).List(ctx, opts)
+		if err != nil {
+			if ctx.Err() == nil {
+				reportError(pw.emitter, pw.log, "pod_watcher", pw.namespace, "reconcile list pods", "", err)
+			}
+			return
+		}
+		for _, pod := range pods.Items {
+			present[pod.UID] = true
+		}
+		if opts.Continue = pods.Continue; opts.Continue == "" {
+			break
+		}
+	}
+
+	var missing []types.UID
+	pw.trackedMu.Lock()
+	for _, pods := range pw.tracked {
+		for uid, tp := range pods {
+			if tp.seen.Before(started) && !present[uid] {
+				missing = append(missing, uid)
+			}
+		}
+	}
+	pw.trackedMu.Unlock()
+	pw.log.Debug("reconciled", "pods", len(present), "missing", len(missing))
+	if len(missing) == 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(reconcileGrace):
+	}
+
+	for _, uid := range missing {
+		tp, ok := pw.takeMissing(uid, started)
+		if !ok {
+			continue // deleted or updated meanwhile
+		}
+		snapshot := pw.podSnapshot(ctx, tp.pod, "ReconcileDetectedMissing")
+		snapshot.State["reason"] = "PodDisappeared"
+		snapshot.State["synthetic"] = true
+		snapshot.State["last_seen"] = tp.seen
+		pw.scaleDowns.annotate(snapshot.State, tp.pod)
+		pw.emitter.EmitSnapshot(snapshot)
+		pw.log.Info("PodDisappeared", "pod", tp.pod.Name, "namespace", tp.pod.Namespace, "last_seen", tp.seen)
+	}
+}
+
+// takeMissing untracks the pod with uid if it has not been seen since
+// started, marking it as reported.
+func (pw *PodWatcher) takeMissing(uid types.UID, started time.Time) (trackedPod, bool) {
+	pw.trackedMu.Lock()
+	defer pw.trackedMu.Unlock()
+	for ns, pods := range pw.tracked {
+		tp, ok := pods[uid]
+		if !ok {
+			continue
+		}
+		if !tp.seen.Before(started) {
+			return trackedPod{}, false
+		}
+		delete(pods, uid)
+		if len(pods) == 0 {
+			delete(pw.tracked, ns)
+		}
+		pw.disappeared.add(uid)
+		return tp, true
+	}
+	return trackedPod{}, false
+}
@@ -0,0 +1,111 @@
+package watcher
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// insufficientRe pulls the resource names out of a scheduler message such
+// as "0/3 nodes are available: 2 Insufficient memory, 1 Insufficient
+// nvidia.com/gpu."
+var insufficientRe = regexp.MustCompile(`Insufficient ([A-Za-z0-9./_-]*[A-Za-z0-9_-])`)
+
+// unschedulableCondition returns the PodScheduled=False/Unschedulable
+// condition of a pending pod, or nil if the pod is not stuck scheduling.
+func unschedulableCondition(pod *corev1.Pod) *corev1.PodCondition {
+	if pod.Status.Phase != corev1.PodPending {
+		return nil
+	}
+	for i, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse &&
+			cond.Reason == corev1.PodReasonUnschedulable {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// inspectScheduling emits PodUnschedulable when a pending pod's scheduler
+// message changes. The scheduler rewrites the condition on every retry, so
+// the last message per pod is remembered and repeats are dropped; the entry
+// is cleared once the pod is scheduled or deleted.
+func (pw *PodWatcher) inspectScheduling(ctx context.Context, pod *corev1.Pod) {
+	cond := unschedulableCondition(pod)
+	if cond == nil {
+		delete(pw.unschedulable, pod.UID)
+		return
+	}
+	if pw.unschedulable[pod.UID] == cond.Message {
+		return
+	}
+	pw.unschedulable[pod.UID] = cond.Message
+
+	insufficient := insufficientResources(cond.Message)
+	payload := map[string]interface{}{
+		"reason":                 cond.Reason,
+		"message":                cond.Message,
+		"insufficient_resources": insufficient,
+		"requested_resources":    podRequests(pod),
+		"since":                  cond.LastTransitionTime.Time,
+		"pending_seconds":        time.Since(cond.LastTransitionTime.Time).Seconds(),
+		"qos_class":              string(pod.Status.QOSClass),
+		"node_allocatable":       pw.node.AllocatableByNode(),
+	}
+	pw.owners.annotate(payload, pod)
+	// A preempting pod is nominated to a node before it is bound; that node
+	// is the one whose headroom matters.
+	if nominated := pod.Status.NominatedNodeName; nominated != "" {
+		payload["nominated_node"] = nominated
+		payload["node_state"] = pw.node.SnapshotNode(ctx, nominated)
+	}
+
+	pw.emitter.Emit(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "PodUnschedulable",
+		PatternID: patterns.PatternScheduler,
+		PodName:   pod.Name,
+		Namespace: pod.Namespace,
+		PodUID:    string(pod.UID),
+		Payload:   payload,
+	})
+	pw.log.Info("PodUnschedulable", "pod", pod.Name, "namespace", pod.Namespace, "insufficient", insufficient)
+}
+
+// insufficientResources lists the distinct resources a scheduler message
+// reports as insufficient, in message order.
+func insufficientResources(message string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, m := range insufficientRe.FindAllStringSubmatch(message, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			out = append(out, m[1])
+		}
+	}
+	return out
+}
+
+// podRequests sums the requests of the pod's app containers per resource,
+// which is what the scheduler fits against node allocatable.
+func podRequests(pod *corev1.Pod) map[string]string {
+	total := corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			sum := total[name]
+			sum.Add(q)
+			total[name] = sum
+		}
+	}
+	out := make(map[string]string, len(total))
+	for name, q := range total {
+		out[string(name)] = q.String()
+	}
+	return out
+}
@@ -3,47 +3,233 @@ package watcher
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
 	"github.com/opscart/k8s-causal-memory/collector/patterns"
 )
 
 type PodWatcher struct {
 	client    kubernetes.Interface
 	namespace string
-	emitter   *emitter.JSONEmitter
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	factory   informers.SharedInformerFactory
+	informer  cache.SharedIndexInformer // its cache also serves consumer checks
 	node      *NodeWatcher
+	sampler   *MemorySampler
+	owners    *Owners
+	lag       *LagMonitor
+
+	logTailLines   int64 // 0 disables log capture
+	crashLoopQuiet time.Duration
+	historyDepth   int   // 0 disables termination history
+	minRestarts    int32 // 0 emits every termination and crash loop
+	nodeProxy      bool
+	cascadeWindow  time.Duration // 0 disables incident linking
+	vpaHeadroom    float64       // 0 disables VPARecommendation
+
+	containerFilter  *ContainerFilter // nil inspects every container
+	snapshotTriggers SnapshotTriggers
+	scaleDowns       *ScaleDowns                // nil tags no deletion as a scale-down
+	windows          *patterns.NamespaceWindows // nil keeps the default evidence window
+	checkpoint       *Checkpoint
+	resumeFrom       string // resourceVersion resumed from; "" unless resuming
+
+	// unschedulable holds the last scheduler message emitted per pending
+	// pod. terminations holds the last termination emitted per container,
+	// crashLoops the last CrashLoopBackOff. history holds each
+	// container's recent terminations. evicted holds the pods PodEvicted
+	// was emitted for. firstSeen holds the pods snapshotted on first
+	// sight. recommended holds the largest limit VPARecommendation
+	// suggested per container. images holds the digests each workload's
+	// containers ran. Only the informer's handler goroutine touches them.
+	unschedulable map[types.UID]string
+	terminations  map[types.UID]map[string]seenTermination
+	crashLoops    map[types.UID]map[string]*seenCrashLoop
+	history       map[types.UID]map[string][]pastTermination
+	evicted       map[types.UID]bool
+	firstSeen     *uidSet // nil unless SnapshotOnFirstSeen
+	recommended   map[types.UID]map[string]int64
+	images        map[string][]imageDigest // nil unless TrackImages
+
+	// evidence tracks OOMKills awaiting their evidence re-fetch: true once
+	// OOMKillEvidence has been emitted. Shared with the re-fetch
+	// goroutines, hence the lock.
+	evidenceMu sync.Mutex
+	evidence   map[oomKill]bool
+	refetches  sync.WaitGroup
+
+	// probeFailures holds the probe failures reported by the event watcher;
+	// probeRestarts the finish time of the last termination
+	// ProbeInducedRestart was emitted for, per container. nil unless
+	// UseProbeFailures.
+	probeFailures *ProbeFailures
+	probeRestarts map[types.UID]map[string]time.Time
+
+	// incidents holds each pod's open incident, shared with the goroutines
+	// awaiting the end of a cascade, hence the lock.
+	incidentsMu sync.Mutex
+	incidents   map[types.UID]*podIncident
+
+	// tracked holds the pods seen and not yet deleted, per namespace, for
+	// the reconcile to find those deleted unseen; trackFull the namespaces
+	// that reached MaxTrackedPodsPerNamespace; disappeared the pods the
+	// reconcile reported. Shared with the reconcile goroutine, hence the
+	// lock. nil unless ReconcileEvery.
+	reconcileInterval time.Duration
+	trackedMu         sync.Mutex
+	tracked           map[string]map[types.UID]trackedPod
+	trackFull         map[string]bool
+	disappeared       *uidSet
+}
+
+// seenTermination identifies one termination of a container. The pod object
+// keeps reporting the same terminated state on every unrelated update until
+// the container restarts.
+type seenTermination struct {
+	restartCount int32
+	finishedAt   time.Time
 }
 
-func NewPodWatcher(client kubernetes.Interface, namespace string, e *emitter.JSONEmitter, node *NodeWatcher) *PodWatcher {
-	return &PodWatcher{client: client, namespace: namespace, emitter: e, node: node}
+// seenCrashLoop is the last CrashLoopBackOff emitted for a container and
+// the identical reports dropped since.
+type seenCrashLoop struct {
+	restartCount int32
+	emittedAt    time.Time
+	suppressed   int
+}
+
+// DefaultCrashLoopQuietInterval is how often a container stuck in
+// CrashLoopBackOff without restarting is reported again.
+const DefaultCrashLoopQuietInterval = 5 * time.Minute
+
+func NewPodWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger, node *NodeWatcher) *PodWatcher {
+	factory := newInformerFactory(client, namespace, sel)
+	return &PodWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "pod_watcher"), node: node,
+		factory:          factory,
+		informer:         factory.Core().V1().Pods().Informer(),
+		crashLoopQuiet:   DefaultCrashLoopQuietInterval,
+		historyDepth:     DefaultTerminationHistory,
+		snapshotTriggers: SnapshotTriggers{SnapshotOnPodDeleted: true},
+		unschedulable:    map[types.UID]string{},
+		terminations:     map[types.UID]map[string]seenTermination{},
+		crashLoops:       map[types.UID]map[string]*seenCrashLoop{},
+		history:          map[types.UID]map[string][]pastTermination{},
+		evicted:          map[types.UID]bool{},
+		recommended:      map[types.UID]map[string]int64{},
+		evidence:         map[oomKill]bool{},
+		incidents:        map[types.UID]*podIncident{},
+	}
+}
+
+// DebounceCrashLoops sets how long a container's CrashLoopBackOff goes
+// unreported while its restart count stands still. The pod object reports
+// the same waiting state on every status update in between, every few
+// seconds for a pod stuck crashlooping.
+func (pw *PodWatcher) DebounceCrashLoops(quiet time.Duration) {
+	pw.crashLoopQuiet = quiet
+}
+
+// MinRestartCount stops ContainerTerminated and CrashLoopBackOff from being
+// emitted for containers restarted fewer than n times; one-off restarts
+// are noise during a broad incident. OOMKill is always emitted.
+func (pw *PodWatcher) MinRestartCount(n int32) {
+	pw.minRestarts = n
+}
+
+// belowMinRestarts reports whether an event about cs is filtered out by
+// MinRestartCount, counting it as suppressed if so.
+func (pw *PodWatcher) belowMinRestarts(cs corev1.ContainerStatus, eventType string) bool {
+	if cs.RestartCount >= pw.minRestarts {
+		return false
+	}
+	metrics.SuppressedEvents.WithLabelValues(eventType).Inc()
+	return true
+}
+
+// UseOwners resolves the workload of pods in emitted events through o.
+func (pw *PodWatcher) UseOwners(o *Owners) {
+	pw.owners = o
+}
+
+// UseLagMonitor measures the observation lag of terminations through lm.
+func (pw *PodWatcher) UseLagMonitor(lm *LagMonitor) {
+	pw.lag = lm
+}
+
+// UseSampler attaches the memory usage trajectory from s to OOMKill events.
+func (pw *PodWatcher) UseSampler(s *MemorySampler) {
+	pw.sampler = s
+}
+
+// UseCheckpoint records the resourceVersion the pod informer reached in cp
+// and, resuming from it, leaves the pods unchanged since the previous run
+// out of the inspection of the initial list.
+func (pw *PodWatcher) UseCheckpoint(cp *Checkpoint) {
+	pw.checkpoint = cp
 }
 
 func (pw *PodWatcher) Watch(ctx context.Context) error {
-	fmt.Printf("[pod_watcher] Starting namespace=%q\n", pw.namespace)
-	w, err := pw.client.CoreV1().Pods(pw.namespace).Watch(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("pod watch failed: %w", err)
-	}
-	defer w.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Println("[pod_watcher] Stopped.")
-			return nil
-		case event, ok := <-w.ResultChan():
-			if !ok {
-				return pw.Watch(ctx)
-			}
-			pw.handleEvent(ctx, event)
+	pw.log.Info("starting", "namespace", pw.namespace)
+	pw.resumeFrom = pw.checkpoint.ResourceVersion(checkpointKey("pod_watcher", pw.namespace))
+	pw.lag.start("pod_watcher", pw.namespace)
+	if _, err := pw.informer.AddEventHandler(eventHandler(func(event watch.Event) {
+		pw.handleEvent(ctx, event)
+	})); err != nil {
+		return fmt.Errorf("pod informer registration failed: %w", err)
+	}
+	defer pw.refetches.Wait() // pending re-fetches emit; they end with ctx
+	if pw.tracked != nil {
+		var reconciles sync.WaitGroup
+		defer reconciles.Wait()
+		reconciles.Go(func() { pw.reconcileLoop(ctx, pw.informer) })
+	}
+	return runInformer(ctx, pw.log, "pod_watcher", pw.namespace, pw.emitter, pw.factory, pw.informer)
+}
+
+// cachedPods returns the pods of namespace in the informer cache, once the
+// initial list has landed, or nil if ctx ends first. They are the cache's
+// own objects and must not be modified.
+func (pw *PodWatcher) cachedPods(ctx context.Context, namespace string) []*corev1.Pod {
+	if !cache.WaitForCacheSync(ctx.Done(), pw.informer.HasSynced) {
+		return nil
+	}
+	objs, _ := pw.informer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	pods := make([]*corev1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			pods = append(pods, pod)
 		}
 	}
+	return pods
+}
+
+// cachedPod returns a pod from the informer cache, as cachedPods does.
+func (pw *PodWatcher) cachedPod(ctx context.Context, namespace, name string) (*corev1.Pod, bool) {
+	if !cache.WaitForCacheSync(ctx.Done(), pw.informer.HasSynced) {
+		return nil, false
+	}
+	obj, ok, _ := pw.informer.GetIndexer().GetByKey(namespace + "/" + name)
+	if !ok {
+		return nil, false
+	}
+	pod, ok := obj.(*corev1.Pod)
+	return pod, ok
 }
 
 func (pw *PodWatcher) handleEvent(ctx context.Context, event watch.Event) {
@@ -51,31 +237,132 @@ func (pw *PodWatcher) handleEvent(ctx context.Context, event watch.Event) {
 	if !ok {
 		return
 	}
+	pw.checkpoint.Advance(checkpointKey("pod_watcher", pw.namespace), pod)
 	switch event.Type {
+	case watch.Added:
+		pw.track(pod)
+		pw.inspectFirstSeen(pod)
+		pw.inspectImages(pod)
+		pw.inspectScheduling(ctx, pod)
+		// A pod first seen already terminated or evicted got there unseen:
+		// before the collector started, or during a watch gap the informer
+		// relisted over. The terminations and evicted maps keep the
+		// updates that follow from reporting it again. Resuming, the pods
+		// the previous run saw as they are now are left alone.
+		if changedSince(pod, pw.resumeFrom) {
+			pw.inspectContainerStatuses(ctx, pod)
+			pw.inspectEviction(ctx, pod, false)
+		}
 	case watch.Modified:
+		pw.track(pod)
+		pw.inspectFirstSeen(pod)
+		pw.inspectImages(pod)
+		pw.inspectScheduling(ctx, pod)
 		pw.inspectContainerStatuses(ctx, pod)
+		pw.inspectEviction(ctx, pod, false)
 	case watch.Deleted:
-		pw.captureSnapshot(pod, "PodDeleted")
+		delete(pw.unschedulable, pod.UID)
+		delete(pw.terminations, pod.UID)
+		delete(pw.crashLoops, pod.UID)
+		delete(pw.history, pod.UID)
+		delete(pw.recommended, pod.UID)
+		delete(pw.probeRestarts, pod.UID)
+		pw.forgetImages(pod)
+		pw.incidentsMu.Lock()
+		delete(pw.incidents, pod.UID)
+		pw.incidentsMu.Unlock()
+		if pw.untrack(pod) {
+			return // already snapshotted as PodDisappeared
+		}
+		trigger := "PodDeleted"
+		if pw.inspectEviction(ctx, pod, true) {
+			trigger = "PodEvicted"
+		}
+		if pw.snapshotTriggers[SnapshotOnPodDeleted] {
+			snapshot := pw.podSnapshot(ctx, pod, trigger)
+			if trigger == "PodDeleted" {
+				pw.scaleDowns.annotate(snapshot.State, pod)
+			}
+			pw.emitter.EmitSnapshot(snapshot)
+		}
 	}
 }
 
+// Values of the container_type payload field.
+const (
+	ContainerTypeInit      = "init"
+	ContainerTypeApp       = "app"
+	ContainerTypeEphemeral = "ephemeral"
+)
+
+// inspectContainerStatuses covers init and ephemeral containers as well as
+// app containers: an init container OOMKill leaves the pod stuck in Init
+// with no app container ever started, which is easy to misread.
 func (pw *PodWatcher) inspectContainerStatuses(ctx context.Context, pod *corev1.Pod) {
-	for _, cs := range pod.Status.ContainerStatuses {
-		if cs.State.Terminated != nil {
-			pw.handleTerminated(ctx, pod, cs)
-		}
-		if cs.LastTerminationState.Terminated != nil {
-			pw.handleLastTerminated(pod, cs)
-		}
-		if cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff" {
-			pw.handleCrashLoop(pod, cs)
+	groups := []struct {
+		containerType string
+		statuses      []corev1.ContainerStatus
+	}{
+		{ContainerTypeInit, pod.Status.InitContainerStatuses},
+		{ContainerTypeApp, pod.Status.ContainerStatuses},
+		{ContainerTypeEphemeral, pod.Status.EphemeralContainerStatuses},
+	}
+	for _, g := range groups {
+		for _, cs := range g.statuses {
+			if !pw.containerFilter.matches(pod, cs) {
+				continue
+			}
+			// A restart can go by without the terminated state ever being
+			// observed; the previous termination still belongs in the
+			// history.
+			if cs.LastTerminationState.Terminated != nil {
+				pw.recordTermination(pod, cs.Name, cs.LastTerminationState.Terminated)
+			}
+			if cs.State.Terminated != nil {
+				pw.handleTerminated(ctx, pod, cs, g.containerType)
+				pw.inspectProbeRestart(pod, cs, cs.State.Terminated, g.containerType)
+			}
+			if cs.LastTerminationState.Terminated != nil {
+				pw.handleLastTerminated(pod, cs, g.containerType)
+				pw.inspectProbeRestart(pod, cs, cs.LastTerminationState.Terminated, g.containerType)
+			}
+			if cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff" {
+				pw.handleCrashLoop(ctx, pod, cs, g.containerType)
+			}
 		}
 	}
 }
 
-func (pw *PodWatcher) handleTerminated(ctx context.Context, pod *corev1.Pod, cs corev1.ContainerStatus) {
+// newTermination records the container's current termination and reports
+// whether it differs from the last one emitted: the restart count went up,
+// or the container finished again without a restart being counted (a
+// terminated init container rerun after a pod sandbox change).
+func (pw *PodWatcher) newTermination(pod *corev1.Pod, cs corev1.ContainerStatus) bool {
+	cur := seenTermination{restartCount: cs.RestartCount, finishedAt: cs.State.Terminated.FinishedAt.Time}
+	seen := pw.terminations[pod.UID]
+	if seen == nil {
+		seen = map[string]seenTermination{}
+		pw.terminations[pod.UID] = seen
+	}
+	last, ok := seen[cs.Name]
+	if ok && cur.restartCount <= last.restartCount && !cur.finishedAt.After(last.finishedAt) {
+		return false
+	}
+	seen[cs.Name] = cur
+	return true
+}
+
+func (pw *PodWatcher) handleTerminated(ctx context.Context, pod *corev1.Pod, cs corev1.ContainerStatus, containerType string) {
+	if !pw.newTermination(pod, cs) {
+		return
+	}
 	term := cs.State.Terminated
+	pw.recordTermination(pod, cs.Name, term)
 	isOOMKill := term.Reason == "OOMKilled"
+	if !isOOMKill && pw.belowMinRestarts(cs, "ContainerTerminated") {
+		return
+	}
+	seen := time.Now()
 	nodeState := pw.node.SnapshotNode(ctx, pod.Spec.NodeName)
 
 	eventType := "ContainerTerminated"
@@ -85,91 +372,211 @@ func (pw *PodWatcher) handleTerminated(ctx context.Context, pod *corev1.Pod, cs
 		patternID = patterns.PatternOOMKill
 	}
 
+	payload := map[string]interface{}{
+		"container_name":           cs.Name,
+		"container_type":           containerType,
+		"image":                    cs.Image,
+		"image_id":                 cs.ImageID,
+		"restart_count":            cs.RestartCount,
+		"reason":                   term.Reason,
+		"exit_code":                term.ExitCode,
+		"exit_code_class":          classifyExitCode(term.ExitCode, term.Reason),
+		"message":                  term.Message,
+		"started":                  term.StartedAt.Time,
+		"finished":                 term.FinishedAt.Time,
+		"failure_duration_seconds": term.FinishedAt.Time.Sub(term.StartedAt.Time).Seconds(),
+		"pod_phase":                string(pod.Status.Phase),
+		"node_name":                pod.Spec.NodeName,
+		"qos_class":                string(pod.Status.QOSClass),
+		"oom_risk":                 oomRisk(pod, nodeState != nil && nodeState.MemPressure),
+		"resource_limits":          extractResourceLimits(pod, cs.Name),
+		"resource_requests":        extractResourceRequests(pod, cs.Name),
+		"config_references":        extractConfigReferences(pod),
+		"node_state":               nodeState,
+		"is_oomkill":               isOOMKill,
+		"evidence_expires_at":      seen.Add(pw.evidenceWindow(pod.Namespace)),
+	}
+	maps.Copy(payload, resourceQuantities(pod, cs.Name))
+	if pw.historyDepth > 0 {
+		maps.Copy(payload, pw.terminationTrend(pod, cs.Name))
+	}
+	if pw.images != nil {
+		maps.Copy(payload, pw.imageTransition(pod, cs))
+	}
+	pw.owners.annotate(payload, pod)
+	if isOOMKill {
+		maps.Copy(payload, memoryHeadroom(pod, cs.Name, nodeState))
+		if pw.sampler != nil {
+			payload["memory_trajectory"] = pw.sampler.Trajectory(pod.Namespace, pod.Name, cs.Name)
+			payload["memory_sampling_interval_seconds"] = pw.sampler.Interval().Seconds()
+		}
+		if pw.nodeProxy {
+			if cgroup, err := pw.cgroupMemory(ctx, pod, cs.Name); err != nil {
+				pw.log.Warn("cgroup memory not captured", "pod", pod.Namespace+"/"+pod.Name, "container", cs.Name, "err", err)
+			} else {
+				effectiveMemory(cgroup, pod, cs.Name, nodeState)
+				maps.Copy(payload, cgroup)
+			}
+		}
+	}
+	if pw.logTailLines > 0 {
+		lines, truncated, err := pw.tailLogs(ctx, pod, cs.Name)
+		if err != nil {
+			// Expected now and then (the container was already removed,
+			// the kubelet is slow), so not a CollectorError.
+			pw.log.Warn("container logs not captured", "pod", pod.Namespace+"/"+pod.Name, "container", cs.Name, "err", err)
+		} else {
+			payload["last_log_lines"] = lines
+			payload["last_log_lines_truncated"] = truncated
+		}
+	}
+	id := emitter.NewID()
+	if pw.cascadeWindow > 0 {
+		payload["pod_incident_id"], payload["cascade_order"] = pw.joinIncident(ctx, pod, cascadeMember{
+			eventID:       id,
+			container:     cs.Name,
+			containerType: containerType,
+			reason:        term.Reason,
+			exitCode:      term.ExitCode,
+			finishedAt:    term.FinishedAt.Time,
+		})
+	}
+	pw.lag.observe(payload, "pod_watcher", pod.Namespace, eventType, term.FinishedAt.Time)
 	pw.emitter.Emit(emitter.CausalEvent{
-		ID:        generateID(),
-		Timestamp: time.Now(),
-		EventType: eventType,
-		PatternID: patternID,
-		PodName:   pod.Name,
-		Namespace: pod.Namespace,
-		NodeName:  pod.Spec.NodeName,
-		PodUID:    string(pod.UID),
-		Payload: map[string]interface{}{
-			"container_name":           cs.Name,
-			"image":                    cs.Image,
-			"restart_count":            cs.RestartCount,
-			"reason":                   term.Reason,
-			"exit_code":                term.ExitCode,
-			"message":                  term.Message,
-			"started":                  term.StartedAt.Time,
-			"finished":                 term.FinishedAt.Time,
-			"failure_duration_seconds": term.FinishedAt.Time.Sub(term.StartedAt.Time).Seconds(),
-			"pod_phase":                string(pod.Status.Phase),
-			"node_name":                pod.Spec.NodeName,
-			"qos_class":                string(pod.Status.QOSClass),
-			"resource_limits":          extractResourceLimits(pod, cs.Name),
-			"resource_requests":        extractResourceRequests(pod, cs.Name),
-			"config_references":        extractConfigReferences(pod),
-			"node_state":               nodeState,
-			"is_oomkill":               isOOMKill,
-			"evidence_expires_at":      time.Now().Add(90 * time.Second),
-		},
+		ID:         id,
+		Timestamp:  time.Now(),
+		OccurredAt: term.FinishedAt.Time,
+		EventType:  eventType,
+		PatternID:  patternID,
+		PodName:    pod.Name,
+		Namespace:  pod.Namespace,
+		NodeName:   pod.Spec.NodeName,
+		PodUID:     string(pod.UID),
+		Payload:    payload,
 	})
 
 	if isOOMKill {
-		fmt.Printf("[pod_watcher] OOMKill: pod=%s ns=%s exit=%d\n", pod.Name, pod.Namespace, term.ExitCode)
+		pw.scheduleEvidenceRefetch(ctx, pod, cs, containerType, seen)
+		pw.log.Info("OOMKill", "pod", pod.Name, "namespace", pod.Namespace, "container", cs.Name, "container_type", containerType, "exit_code", term.ExitCode)
+		if pw.snapshotTriggers[SnapshotOnOOMKill] {
+			pw.captureSnapshot(ctx, pod, "OOMKill", id)
+		}
+		if pw.vpaHeadroom > 0 {
+			pw.recommendLimit(pod, cs, containerType, id)
+		}
 	}
 }
 
-func (pw *PodWatcher) handleLastTerminated(pod *corev1.Pod, cs corev1.ContainerStatus) {
+func (pw *PodWatcher) handleLastTerminated(pod *corev1.Pod, cs corev1.ContainerStatus, containerType string) {
 	lastTerm := cs.LastTerminationState.Terminated
 	if lastTerm.Reason != "OOMKilled" {
 		return
 	}
+	pw.markEvidence(oomKill{pod: pod.UID, container: cs.Name, finishedAt: lastTerm.FinishedAt.Time})
+	pw.emitEvidence(pod, cs, lastTerm, containerType, "LastTerminationState", "watch")
+}
+
+// emitEvidence emits OOMKillEvidence from term, found in the container's
+// State (source "State") or LastTerminationState. capturedBy is "watch"
+// or, from the evidence re-fetch, "refetch".
+func (pw *PodWatcher) emitEvidence(pod *corev1.Pod, cs corev1.ContainerStatus, term *corev1.ContainerStateTerminated, containerType, source, capturedBy string) {
+	payload := map[string]interface{}{
+		"container_name":       cs.Name,
+		"container_type":       containerType,
+		"restart_count":        cs.RestartCount,
+		"last_reason":          term.Reason,
+		"last_exit_code":       term.ExitCode,
+		"last_exit_code_class": classifyExitCode(term.ExitCode, term.Reason),
+		"last_started":         term.StartedAt.Time,
+		"last_finished":        term.FinishedAt.Time,
+		"evidence_source":      source,
+		"evidence_fragility":   "high",
+		"captured_by":          capturedBy,
+	}
+	pw.owners.annotate(payload, pod)
 	pw.emitter.Emit(emitter.CausalEvent{
-		ID:        generateID(),
-		Timestamp: time.Now(),
-		EventType: "OOMKillEvidence",
-		PatternID: patterns.PatternOOMKill,
-		PodName:   pod.Name,
-		Namespace: pod.Namespace,
-		NodeName:  pod.Spec.NodeName,
-		PodUID:    string(pod.UID),
-		Payload: map[string]interface{}{
-			"container_name":     cs.Name,
-			"restart_count":      cs.RestartCount,
-			"last_reason":        lastTerm.Reason,
-			"last_exit_code":     lastTerm.ExitCode,
-			"last_started":       lastTerm.StartedAt.Time,
-			"last_finished":      lastTerm.FinishedAt.Time,
-			"evidence_source":    "LastTerminationState",
-			"evidence_fragility": "high",
-		},
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: term.FinishedAt.Time,
+		EventType:  "OOMKillEvidence",
+		PatternID:  patterns.PatternOOMKill,
+		PodName:    pod.Name,
+		Namespace:  pod.Namespace,
+		NodeName:   pod.Spec.NodeName,
+		PodUID:     string(pod.UID),
+		Payload:    payload,
 	})
 }
 
-func (pw *PodWatcher) handleCrashLoop(pod *corev1.Pod, cs corev1.ContainerStatus) {
+// newCrashLoop reports whether a CrashLoopBackOff is worth emitting: the
+// first for the container, one after a restart, or one after the quiet
+// interval. It returns the number of reports dropped since the last one.
+func (pw *PodWatcher) newCrashLoop(pod *corev1.Pod, cs corev1.ContainerStatus, now time.Time) (bool, int) {
+	seen := pw.crashLoops[pod.UID]
+	if seen == nil {
+		seen = map[string]*seenCrashLoop{}
+		pw.crashLoops[pod.UID] = seen
+	}
+	last, ok := seen[cs.Name]
+	if ok && cs.RestartCount <= last.restartCount && now.Sub(last.emittedAt) < pw.crashLoopQuiet {
+		last.suppressed++
+		return false, 0
+	}
+	suppressed := 0
+	if ok {
+		suppressed = last.suppressed
+	}
+	seen[cs.Name] = &seenCrashLoop{restartCount: cs.RestartCount, emittedAt: now}
+	return true, suppressed
+}
+
+func (pw *PodWatcher) handleCrashLoop(ctx context.Context, pod *corev1.Pod, cs corev1.ContainerStatus, containerType string) {
+	now := time.Now()
+	emit, suppressed := pw.newCrashLoop(pod, cs, now)
+	if !emit || pw.belowMinRestarts(cs, "CrashLoopBackOff") {
+		return
+	}
+	payload := map[string]interface{}{
+		"container_name":     cs.Name,
+		"container_type":     containerType,
+		"restart_count":      cs.RestartCount,
+		"wait_reason":        cs.State.Waiting.Reason,
+		"config_references":  extractConfigReferences(pod),
+		"repeats_suppressed": suppressed,
+	}
+	pw.owners.annotate(payload, pod)
+	id := emitter.NewID()
 	pw.emitter.Emit(emitter.CausalEvent{
-		ID:        generateID(),
-		Timestamp: time.Now(),
+		ID:        id,
+		Timestamp: now,
 		EventType: "CrashLoopBackOff",
 		PodName:   pod.Name,
 		Namespace: pod.Namespace,
 		NodeName:  pod.Spec.NodeName,
 		PodUID:    string(pod.UID),
-		Payload: map[string]interface{}{
-			"container_name":    cs.Name,
-			"restart_count":     cs.RestartCount,
-			"wait_reason":       cs.State.Waiting.Reason,
-			"config_references": extractConfigReferences(pod),
-		},
+		Payload:   payload,
 	})
-	fmt.Printf("[pod_watcher] CrashLoop: pod=%s restarts=%d\n", pod.Name, cs.RestartCount)
+	pw.log.Info("CrashLoopBackOff", "pod", pod.Name, "namespace", pod.Namespace, "restarts", cs.RestartCount)
+	if pw.snapshotTriggers[SnapshotOnCrashLoopBackOff] {
+		pw.captureSnapshot(ctx, pod, "CrashLoopBackOff", id)
+	}
+}
+
+// captureSnapshot emits the state of pod as of trigger, the event with ID
+// eventID.
+func (pw *PodWatcher) captureSnapshot(ctx context.Context, pod *corev1.Pod, trigger, eventID string) {
+	snapshot := pw.podSnapshot(ctx, pod, trigger)
+	if eventID != "" {
+		snapshot.State["trigger_event_id"] = eventID
+	}
+	pw.emitter.EmitSnapshot(snapshot)
 }
 
-func (pw *PodWatcher) captureSnapshot(pod *corev1.Pod, reason string) {
-	pw.emitter.EmitSnapshot(emitter.Snapshot{
-		ID:           generateID(),
+// podSnapshot is the final state of pod, as snapshotted when it goes away.
+func (pw *PodWatcher) podSnapshot(ctx context.Context, pod *corev1.Pod, reason string) emitter.Snapshot {
+	node := pw.node.SnapshotNode(ctx, pod.Spec.NodeName)
+	return emitter.Snapshot{
+		ID:           emitter.NewID(),
 		Timestamp:    time.Now(),
 		ObjectKind:   "Pod",
 		ObjectName:   pod.Name,
@@ -180,31 +587,40 @@ func (pw *PodWatcher) captureSnapshot(pod *corev1.Pod, reason string) {
 			"phase":             string(pod.Status.Phase),
 			"node_name":         pod.Spec.NodeName,
 			"qos_class":         string(pod.Status.QOSClass),
+			"oom_risk":          oomRisk(pod, node != nil && node.MemPressure),
 			"resource_limits":   extractAllResourceLimits(pod),
 			"config_references": extractConfigReferences(pod),
+			"images":            containerImages(pod),
 			"labels":            pod.Labels,
 		},
-	})
+	}
 }
 
+// extractConfigReferences lists the ConfigMaps and Secrets a pod consumes.
+// env_configmaps and env_secrets are the subsets read through env vars,
+// which only pick up changes when a container restarts (P002, P006).
 func extractConfigReferences(pod *corev1.Pod) map[string]interface{} {
-	cmSet, secSet := map[string]bool{}, map[string]bool{}
+	cmSet, secSet, envSet, envSecSet := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
 	for _, c := range pod.Spec.Containers {
 		for _, ef := range c.EnvFrom {
 			if ef.ConfigMapRef != nil {
 				cmSet[ef.ConfigMapRef.Name] = true
+				envSet[ef.ConfigMapRef.Name] = true
 			}
 			if ef.SecretRef != nil {
 				secSet[ef.SecretRef.Name] = true
+				envSecSet[ef.SecretRef.Name] = true
 			}
 		}
 		for _, env := range c.Env {
 			if env.ValueFrom != nil {
 				if env.ValueFrom.ConfigMapKeyRef != nil {
 					cmSet[env.ValueFrom.ConfigMapKeyRef.Name] = true
+					envSet[env.ValueFrom.ConfigMapKeyRef.Name] = true
 				}
 				if env.ValueFrom.SecretKeyRef != nil {
 					secSet[env.ValueFrom.SecretKeyRef.Name] = true
+					envSecSet[env.ValueFrom.SecretKeyRef.Name] = true
 				}
 			}
 		}
@@ -217,57 +633,132 @@ func extractConfigReferences(pod *corev1.Pod) map[string]interface{} {
 			secSet[vol.Secret.SecretName] = true
 		}
 	}
-	cms := make([]string, 0, len(cmSet))
-	for k := range cmSet {
-		cms = append(cms, k)
+	return map[string]interface{}{
+		"configmaps":     setKeys(cmSet),
+		"secrets":        setKeys(secSet),
+		"env_configmaps": setKeys(envSet),
+		"env_secrets":    setKeys(envSecSet),
 	}
-	secs := make([]string, 0, len(secSet))
-	for k := range secSet {
-		secs = append(secs, k)
+}
+
+func setKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
 	}
-	return map[string]interface{}{"configmaps": cms, "secrets": secs}
+	return keys
 }
 
-func extractResourceLimits(pod *corev1.Pod, name string) map[string]string {
+// containerResources finds the resources of the named app or init
+// container. Ephemeral containers may not set resources.
+func containerResources(pod *corev1.Pod, name string) (corev1.ResourceRequirements, bool) {
 	for _, c := range pod.Spec.Containers {
 		if c.Name == name {
-			m := map[string]string{}
-			if v := c.Resources.Limits.Cpu(); v != nil {
-				m["cpu"] = v.String()
-			}
-			if v := c.Resources.Limits.Memory(); v != nil {
-				m["memory"] = v.String()
-			}
-			return m
+			return c.Resources, true
 		}
 	}
-	return map[string]string{}
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == name {
+			return c.Resources, true
+		}
+	}
+	return corev1.ResourceRequirements{}, false
+}
+
+func extractResourceLimits(pod *corev1.Pod, name string) map[string]string {
+	m := map[string]string{}
+	if res, ok := containerResources(pod, name); ok {
+		if v := res.Limits.Cpu(); v != nil {
+			m["cpu"] = v.String()
+		}
+		if v := res.Limits.Memory(); v != nil {
+			m["memory"] = v.String()
+		}
+	}
+	return m
 }
 
 func extractResourceRequests(pod *corev1.Pod, name string) map[string]string {
-	for _, c := range pod.Spec.Containers {
-		if c.Name == name {
-			m := map[string]string{}
-			if v := c.Resources.Requests.Cpu(); v != nil {
-				m["cpu"] = v.String()
-			}
-			if v := c.Resources.Requests.Memory(); v != nil {
-				m["memory"] = v.String()
-			}
-			return m
+	m := map[string]string{}
+	if res, ok := containerResources(pod, name); ok {
+		if v := res.Requests.Cpu(); v != nil {
+			m["cpu"] = v.String()
 		}
+		if v := res.Requests.Memory(); v != nil {
+			m["memory"] = v.String()
+		}
+	}
+	return m
+}
+
+// resourceQuantities gives a container's memory in bytes and CPU in
+// millicores, limits and requests, so consumers compare numbers instead of
+// re-parsing "512Mi", "0.5" or "500m". A resource that is not set is nil.
+func resourceQuantities(pod *corev1.Pod, name string) map[string]interface{} {
+	res, _ := containerResources(pod, name)
+	return map[string]interface{}{
+		"memory_limit_bytes":     quantityValue(res.Limits, corev1.ResourceMemory),
+		"cpu_limit_millicores":   quantityValue(res.Limits, corev1.ResourceCPU),
+		"memory_request_bytes":   quantityValue(res.Requests, corev1.ResourceMemory),
+		"cpu_request_millicores": quantityValue(res.Requests, corev1.ResourceCPU),
+	}
+}
+
+// quantityValue returns CPU in millicores and any other resource in its
+// base unit, rounded up as Quantity.Value does; nil if list lacks it.
+func quantityValue(list corev1.ResourceList, name corev1.ResourceName) interface{} {
+	q, ok := list[name]
+	if !ok {
+		return nil
+	}
+	if name == corev1.ResourceCPU {
+		return q.MilliValue()
 	}
-	return map[string]string{}
+	return q.Value()
 }
 
 func extractAllResourceLimits(pod *corev1.Pod) map[string]map[string]string {
 	all := map[string]map[string]string{}
+	for _, c := range pod.Spec.InitContainers {
+		all[c.Name] = extractResourceLimits(pod, c.Name)
+	}
 	for _, c := range pod.Spec.Containers {
 		all[c.Name] = extractResourceLimits(pod, c.Name)
 	}
 	return all
 }
 
-func generateID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+// memoryHeadroom relates an OOMKilled container's memory limit to its
+// request and to the node's allocatable memory. A container without a limit
+// (BestEffort, most Burstable) is bounded only by the node, so
+// has_memory_limit is false and the limit ratios are nil rather than a
+// division by zero; the same goes for a missing request or node.
+func memoryHeadroom(pod *corev1.Pod, container string, node *NodeSnapshot) map[string]interface{} {
+	out := map[string]interface{}{
+		"has_memory_limit":       false,
+		"has_memory_request":     false,
+		"memory_headroom_ratio":  nil,
+		"limit_vs_request_ratio": nil,
+	}
+	res, _ := containerResources(pod, container)
+	limit, hasLimit := res.Limits[corev1.ResourceMemory]
+	request, hasRequest := res.Requests[corev1.ResourceMemory]
+	hasLimit = hasLimit && !limit.IsZero()
+	hasRequest = hasRequest && !request.IsZero()
+	out["has_memory_limit"] = hasLimit
+	out["has_memory_request"] = hasRequest
+	if !hasLimit {
+		return out
+	}
+	if hasRequest {
+		out["limit_vs_request_ratio"] = ratio(limit, request)
+	}
+	if node != nil && node.AllocatableMemBytes > 0 {
+		out["memory_headroom_ratio"] = ratio(limit, *resource.NewQuantity(node.AllocatableMemBytes, resource.BinarySI))
+	}
+	return out
+}
+
+func ratio(a, b resource.Quantity) float64 {
+	return math.Round(a.AsApproximateFloat64()/b.AsApproximateFloat64()*1e4) / 1e4
 }
@@ -0,0 +1,241 @@
+package watcher
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// An init container OOMKilled leaves the pod stuck in Init with its app
+// container never started: the kill must still be reported, as the init
+// container's, with the init container's limits.
+func TestInitContainerOnlyOOMKill(t *testing.T) {
+	pw, e, ctx := newTestPodWatcher(t)
+	pod := testPod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}, 0)
+	pod.Status.Phase = corev1.PodPending
+	pod.Spec.InitContainers = []corev1.Container{{
+		Name:  "migrate",
+		Image: "migrate:2.0",
+		Resources: corev1.ResourceRequirements{
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("32Mi")},
+		},
+	}}
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name: "migrate", Image: "migrate:2.0", RestartCount: 1, State: oomKilledState(),
+	}}
+	pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: pod})
+
+	got := eventsOfType(e, "OOMKill")
+	if len(got) != 1 {
+		t.Fatalf("got %d OOMKill events, want 1", len(got))
+	}
+	p := got[0].Payload
+	if p["container_name"] != "migrate" || p["container_type"] != ContainerTypeInit {
+		t.Errorf("OOMKill of %v (%v), want the init container migrate", p["container_name"], p["container_type"])
+	}
+	if limits := p["resource_limits"].(map[string]string); limits["memory"] != "64Mi" {
+		t.Errorf("resource_limits = %v, want the init container's 64Mi", limits)
+	}
+	if requests := p["resource_requests"].(map[string]string); requests["memory"] != "32Mi" {
+		t.Errorf("resource_requests = %v, want the init container's 32Mi", requests)
+	}
+	if n := len(eventsOfType(e, "ContainerTerminated")); n != 0 {
+		t.Errorf("got %d ContainerTerminated events for the waiting app container", n)
+	}
+}
+
+func erroredState(finishedAt time.Time) corev1.ContainerState {
+	return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		Reason: "Error", ExitCode: 1, StartedAt: metav1.NewTime(finishedAt.Add(-time.Minute)), FinishedAt: metav1.NewTime(finishedAt),
+	}}
+}
+
+// The pod object keeps reporting a terminated state on every unrelated
+// status update until the container restarts; it is one termination.
+func TestSameTerminationReportedOnce(t *testing.T) {
+	pw, e, ctx := newTestPodWatcher(t)
+	finished := testFinishedAt.Time
+	pod := testPod(erroredState(finished), 2)
+	pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: pod})
+	again := pod.DeepCopy()
+	again.ResourceVersion = "101"
+	again.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}
+	pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: again})
+	if n := len(eventsOfType(e, "ContainerTerminated")); n != 1 {
+		t.Fatalf("got %d ContainerTerminated events for one termination, want 1", n)
+	}
+
+	// The container restarted and failed again: a new termination.
+	next := testPod(erroredState(finished.Add(30*time.Second)), 3)
+	next.ResourceVersion = "102"
+	pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: next})
+	got := eventsOfType(e, "ContainerTerminated")
+	if len(got) != 2 {
+		t.Fatalf("got %d ContainerTerminated events after a second termination, want 2", len(got))
+	}
+	if got[1].Payload["restart_count"] != int32(3) {
+		t.Errorf("second termination restart_count = %v, want 3", got[1].Payload["restart_count"])
+	}
+
+	// Finished again without the restart count moving, as an init
+	// container rerun after a sandbox change does.
+	rerun := testPod(erroredState(finished.Add(time.Minute)), 3)
+	rerun.ResourceVersion = "103"
+	pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: rerun})
+	if n := len(eventsOfType(e, "ContainerTerminated")); n != 3 {
+		t.Fatalf("got %d ContainerTerminated events after a rerun, want 3", n)
+	}
+}
+
+func crashLoopPod(rv string, restarts int32) *corev1.Pod {
+	pod := testPod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}, restarts)
+	pod.ResourceVersion = rv
+	return pod
+}
+
+// A pod stuck crashlooping reports the same waiting state on every status
+// update, every few seconds.
+func TestCrashLoopBackOffRepeatsAreBounded(t *testing.T) {
+	pw, e, ctx := newTestPodWatcher(t)
+	for i := range 50 {
+		pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: crashLoopPod(strconv.Itoa(200+i), 4)})
+	}
+	got := eventsOfType(e, "CrashLoopBackOff")
+	if len(got) != 1 {
+		t.Fatalf("got %d CrashLoopBackOff events for 50 identical updates, want 1", len(got))
+	}
+
+	// The next restart is news, and says how many repeats went unreported.
+	pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: crashLoopPod("300", 5)})
+	got = eventsOfType(e, "CrashLoopBackOff")
+	if len(got) != 2 {
+		t.Fatalf("got %d CrashLoopBackOff events after a restart, want 2", len(got))
+	}
+	if got[1].Payload["repeats_suppressed"] != 49 {
+		t.Errorf("repeats_suppressed = %v, want 49", got[1].Payload["repeats_suppressed"])
+	}
+}
+
+func TestCrashLoopBackOffReportedAgainAfterQuietInterval(t *testing.T) {
+	pw, e, ctx := newTestPodWatcher(t)
+	pw.DebounceCrashLoops(50 * time.Millisecond)
+	for i := range 50 {
+		pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: crashLoopPod(strconv.Itoa(200+i), 4)})
+	}
+	time.Sleep(60 * time.Millisecond)
+	pw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: crashLoopPod("300", 4)})
+	if n := len(eventsOfType(e, "CrashLoopBackOff")); n != 2 {
+		t.Fatalf("got %d CrashLoopBackOff events, want one per quiet interval, 2", n)
+	}
+}
+
+// resourcePod is testPod with the api container given these limits and
+// requests, each a "memory,cpu" pair of which either may be empty.
+func resourcePod(limits, requests [2]string) *corev1.Pod {
+	pod := testPod(oomKilledState(), 1)
+	list := func(pair [2]string) corev1.ResourceList {
+		l := corev1.ResourceList{}
+		if pair[0] != "" {
+			l[corev1.ResourceMemory] = resource.MustParse(pair[0])
+		}
+		if pair[1] != "" {
+			l[corev1.ResourceCPU] = resource.MustParse(pair[1])
+		}
+		return l
+	}
+	pod.Spec.Containers[0].Resources = corev1.ResourceRequirements{Limits: list(limits), Requests: list(requests)}
+	return pod
+}
+
+func TestResourceQuantities(t *testing.T) {
+	for _, tc := range []struct {
+		limits, requests [2]string
+		want             map[string]interface{}
+	}{
+		{[2]string{"512Mi", "500m"}, [2]string{"256Mi", "0.25"}, map[string]interface{}{
+			"memory_limit_bytes": int64(512 << 20), "cpu_limit_millicores": int64(500),
+			"memory_request_bytes": int64(256 << 20), "cpu_request_millicores": int64(250),
+		}},
+		// Decimal and binary suffixes differ: M is 10^6, Mi is 2^20.
+		{[2]string{"512M", "2"}, [2]string{"128Ki", "1.5"}, map[string]interface{}{
+			"memory_limit_bytes": int64(512e6), "cpu_limit_millicores": int64(2000),
+			"memory_request_bytes": int64(128 << 10), "cpu_request_millicores": int64(1500),
+		}},
+		{[2]string{"1.5Gi", "0.1"}, [2]string{"1G", "100m"}, map[string]interface{}{
+			"memory_limit_bytes": int64(3 << 29), "cpu_limit_millicores": int64(100),
+			"memory_request_bytes": int64(1e9), "cpu_request_millicores": int64(100),
+		}},
+		// Sub-unit values round up, as the kubelet does.
+		{[2]string{"100m", "0.0001"}, [2]string{"1e3", "250u"}, map[string]interface{}{
+			"memory_limit_bytes": int64(1), "cpu_limit_millicores": int64(1),
+			"memory_request_bytes": int64(1000), "cpu_request_millicores": int64(1),
+		}},
+		// Unset resources are nil, not zero.
+		{[2]string{"1Gi", ""}, [2]string{"", ""}, map[string]interface{}{
+			"memory_limit_bytes": int64(1 << 30), "cpu_limit_millicores": nil,
+			"memory_request_bytes": nil, "cpu_request_millicores": nil,
+		}},
+	} {
+		got := resourceQuantities(resourcePod(tc.limits, tc.requests), "api")
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("limits %v requests %v:\n got %v\nwant %v", tc.limits, tc.requests, got, tc.want)
+		}
+	}
+}
+
+func TestResourceStringsKeepTheirForm(t *testing.T) {
+	pod := resourcePod([2]string{"1.5Gi", "0.5"}, [2]string{"512M", "250m"})
+	if got, want := extractResourceLimits(pod, "api"), map[string]string{"memory": "1536Mi", "cpu": "500m"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("limits = %v, want %v", got, want)
+	}
+	if got, want := extractResourceRequests(pod, "api"), map[string]string{"memory": "512M", "cpu": "250m"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryHeadroom(t *testing.T) {
+	node := &NodeSnapshot{AllocatableMemBytes: 8 << 30}
+	for _, tc := range []struct {
+		name             string
+		limits, requests [2]string
+		node             *NodeSnapshot
+		want             map[string]interface{}
+	}{
+		{"binary units", [2]string{"2Gi", ""}, [2]string{"512Mi", ""}, node, map[string]interface{}{
+			"has_memory_limit": true, "has_memory_request": true,
+			"memory_headroom_ratio": 0.25, "limit_vs_request_ratio": 4.0,
+		}},
+		{"mixed units", [2]string{"1Gi", ""}, [2]string{"1G", ""}, node, map[string]interface{}{
+			"has_memory_limit": true, "has_memory_request": true,
+			"memory_headroom_ratio": 0.125, "limit_vs_request_ratio": 1.0737,
+		}},
+		{"no request", [2]string{"1536Mi", ""}, [2]string{"", ""}, node, map[string]interface{}{
+			"has_memory_limit": true, "has_memory_request": false,
+			"memory_headroom_ratio": 0.1875, "limit_vs_request_ratio": nil,
+		}},
+		{"no node", [2]string{"1Gi", ""}, [2]string{"256Mi", ""}, nil, map[string]interface{}{
+			"has_memory_limit": true, "has_memory_request": true,
+			"memory_headroom_ratio": nil, "limit_vs_request_ratio": 4.0,
+		}},
+		{"zero limit", [2]string{"0", ""}, [2]string{"256Mi", ""}, node, map[string]interface{}{
+			"has_memory_limit": false, "has_memory_request": true,
+			"memory_headroom_ratio": nil, "limit_vs_request_ratio": nil,
+		}},
+		{"best effort", [2]string{"", "1"}, [2]string{"", ""}, node, map[string]interface{}{
+			"has_memory_limit": false, "has_memory_request": false,
+			"memory_headroom_ratio": nil, "limit_vs_request_ratio": nil,
+		}},
+	} {
+		got := memoryHeadroom(resourcePod(tc.limits, tc.requests), "api", tc.node)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\n got %v\nwant %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package watcher
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// DefaultProbeFailureWindow is how long probe failures are remembered. A
+// container killed for failing its liveness probe failed it within the
+// last failureThreshold × periodSeconds, well under this.
+const DefaultProbeFailureWindow = 10 * time.Minute
+
+// ProbeFailures remembers the probe failures the kubelet reports as
+// Unhealthy events, per container, for the PodWatcher to tell a container
+// restarted for failing its probe from one that crashed: both exit with
+// reason Error. The EventWatcher records them; a nil *ProbeFailures
+// records nothing.
+type ProbeFailures struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	failures  map[probeKey][]probeFailure // oldest first
+	lastSweep time.Time
+}
+
+type probeKey struct {
+	pod       types.UID
+	container string
+}
+
+// probeFailure is one Unhealthy event, counting the repeats the kubelet
+// folded into it.
+type probeFailure struct {
+	probeType string
+	message   string
+	at        time.Time
+	count     int32
+}
+
+// probeContainer is the container named in an Unhealthy event's
+// fieldPath, e.g. spec.containers{app}.
+var probeContainer = regexp.MustCompile(`^spec\.(?:initContainers|containers|ephemeralContainers)\{(.+)\}$`)
+
+func NewProbeFailures(window time.Duration) *ProbeFailures {
+	return &ProbeFailures{window: window, failures: map[probeKey][]probeFailure{}}
+}
+
+// record stores an Unhealthy event: "Liveness probe failed: ...",
+// "Readiness probe errored: ...".
+func (pf *ProbeFailures) record(k8sEvent *corev1.Event) {
+	if pf == nil || k8sEvent.InvolvedObject.Kind != "Pod" {
+		return
+	}
+	m := probeContainer.FindStringSubmatch(k8sEvent.InvolvedObject.FieldPath)
+	probeType, _, ok := strings.Cut(k8sEvent.Message, " probe ")
+	if m == nil || !ok {
+		return
+	}
+	key := probeKey{pod: k8sEvent.InvolvedObject.UID, container: m[1]}
+	f := probeFailure{
+		probeType: strings.ToLower(probeType),
+		message:   k8sEvent.Message,
+		at:        lastOccurred(k8sEvent),
+		count:     max(k8sEvent.Count, 1),
+	}
+	now := time.Now()
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	pf.failures[key] = append(pf.expire(pf.failures[key], now), f)
+	// Pods come and go; drop what their containers left behind.
+	if now.Sub(pf.lastSweep) > pf.window {
+		pf.lastSweep = now
+		for k, fs := range pf.failures {
+			if fs = pf.expire(fs, now); len(fs) == 0 {
+				delete(pf.failures, k)
+			} else {
+				pf.failures[k] = fs
+			}
+		}
+	}
+}
+
+func (pf *ProbeFailures) expire(fs []probeFailure, now time.Time) []probeFailure {
+	for len(fs) > 0 && now.Sub(fs[0].at) > pf.window {
+		fs = fs[1:]
+	}
+	return fs
+}
+
+// between returns the container's failures from start to end, oldest first.
+func (pf *ProbeFailures) between(pod types.UID, container string, start, end time.Time) []probeFailure {
+	if pf == nil {
+		return nil
+	}
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	var out []probeFailure
+	for _, f := range pf.failures[probeKey{pod, container}] {
+		if !f.at.Before(start) && !f.at.After(end) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// UseProbeFailures checks every container that terminated with reason
+// Error against the probe failures pf holds, and emits
+// ProbeInducedRestart for one that failed its probe while it ran.
+func (pw *PodWatcher) UseProbeFailures(pf *ProbeFailures) {
+	pw.probeFailures = pf
+	pw.probeRestarts = map[types.UID]map[string]time.Time{}
+}
+
+// inspectProbeRestart emits ProbeInducedRestart if the container whose
+// termination is term failed a probe while it ran. A container the
+// kubelet kills is usually restarted before its terminated state is ever
+// observed, so term comes from the LastTerminationState as well as the
+// State; each termination is reported once.
+func (pw *PodWatcher) inspectProbeRestart(pod *corev1.Pod, cs corev1.ContainerStatus, term *corev1.ContainerStateTerminated, containerType string) {
+	if pw.probeFailures == nil || term.Reason != "Error" {
+		return
+	}
+	seen := pw.probeRestarts[pod.UID]
+	if seen == nil {
+		seen = map[string]time.Time{}
+		pw.probeRestarts[pod.UID] = seen
+	}
+	if !term.FinishedAt.After(seen[cs.Name]) {
+		return
+	}
+	// Event times have a resolution of a second.
+	failures := pw.probeFailures.between(pod.UID, cs.Name, term.StartedAt.Truncate(time.Second), term.FinishedAt.Add(time.Second))
+	if len(failures) == 0 {
+		return
+	}
+	seen[cs.Name] = term.FinishedAt.Time
+
+	// The liveness and startup probes restart the container; a readiness
+	// probe failing alongside only says it was slow.
+	counts := map[string]int32{}
+	for _, f := range failures {
+		counts[f.probeType] += f.count
+	}
+	probeType := ProbeReadiness
+	for _, t := range []string{ProbeLiveness, ProbeStartup, ProbeReadiness} {
+		if counts[t] > 0 {
+			probeType = t
+			break
+		}
+	}
+	var last probeFailure
+	for _, f := range failures {
+		if f.probeType == probeType {
+			last = f
+		}
+	}
+	payload := map[string]interface{}{
+		"container_name":       cs.Name,
+		"container_type":       containerType,
+		"restart_count":        cs.RestartCount,
+		"reason":               term.Reason,
+		"exit_code":            term.ExitCode,
+		"started":              term.StartedAt.Time,
+		"finished":             term.FinishedAt.Time,
+		"probe_type":           probeType,
+		"probe_failures":       counts[probeType],
+		"probe_failure_counts": counts,
+		"last_probe_message":   last.message,
+		"last_probe_failure":   last.at,
+		"probe_timed_out":      probeTimedOut(last.message),
+		"timeout_seconds":      nil,
+		"period_seconds":       nil,
+		"failure_threshold":    nil,
+		"probe_handler":        nil,
+		"config_references":    extractConfigReferences(pod),
+	}
+	if p := containerProbe(pod, cs.Name, probeType); p != nil {
+		payload["timeout_seconds"] = probeTimeout(p)
+		payload["period_seconds"] = p.PeriodSeconds
+		payload["failure_threshold"] = p.FailureThreshold
+		payload["probe_handler"] = probeHandler(p)
+	}
+	pw.owners.annotate(payload, pod)
+	pw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: term.FinishedAt.Time,
+		EventType:  "ProbeInducedRestart",
+		PatternID:  patterns.PatternProbeRestart,
+		PodName:    pod.Name,
+		Namespace:  pod.Namespace,
+		NodeName:   pod.Spec.NodeName,
+		PodUID:     string(pod.UID),
+		Payload:    payload,
+	})
+	pw.log.Info("ProbeInducedRestart", "pod", pod.Name, "namespace", pod.Namespace, "container", cs.Name,
+		"probe", probeType, "failures", counts[probeType], "timeout_seconds", payload["timeout_seconds"])
+}
+
+// probeTimedOut reports whether a probe failure message is the probe
+// running out of time rather than getting a bad answer.
+func probeTimedOut(message string) bool {
+	m := strings.ToLower(message)
+	return strings.Contains(m, "deadline exceeded") || strings.Contains(m, "timeout") || strings.Contains(m, "timed out")
+}
+
+// containerProbe finds the named probe of the named app or init container.
+func containerProbe(pod *corev1.Pod, container, probeType string) *corev1.Probe {
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == container {
+			return probesOf(c)[probeType]
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			return probesOf(c)[probeType]
+		}
+	}
+	return nil
+}
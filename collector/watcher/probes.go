@@ -0,0 +1,104 @@
+package watcher
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// Probe types, as the kubelet names them in Unhealthy events.
+const (
+	ProbeLiveness  = "liveness"
+	ProbeReadiness = "readiness"
+	ProbeStartup   = "startup"
+)
+
+// containerProbes are the probes of one container of a pod template.
+type containerProbes map[string]*corev1.Probe // probe type → probe, nil if unset
+
+func probesOf(c corev1.Container) containerProbes {
+	return containerProbes{
+		ProbeLiveness:  c.LivenessProbe,
+		ProbeReadiness: c.ReadinessProbe,
+		ProbeStartup:   c.StartupProbe,
+	}
+}
+
+// emitProbeChanges emits ProbeTimeoutTightened for every probe whose
+// timeout was lowered between a workload's previous and current pod
+// template. A timeout that fits the application's usual latency stops
+// fitting it after a config change or under load, and the kubelet then
+// restarts containers that were only slow to answer. Probes added or
+// removed with the template are not changes.
+func emitProbeChanges(e emitter.Emitter, log *slog.Logger, kind string, meta metav1.ObjectMeta, previous, current workloadTemplate) {
+	if previous.hash == "" {
+		return
+	}
+	names := make([]string, 0, len(current.probes))
+	for name := range current.probes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, probeType := range []string{ProbeLiveness, ProbeStartup, ProbeReadiness} {
+			old, cur := previous.probes[name][probeType], current.probes[name][probeType]
+			if old == nil || cur == nil || probeTimeout(cur) >= probeTimeout(old) {
+				continue
+			}
+			e.Emit(emitter.CausalEvent{
+				ID:         emitter.NewID(),
+				Timestamp:  time.Now(),
+				OccurredAt: lastChanged(meta),
+				EventType:  "ProbeTimeoutTightened",
+				PatternID:  patterns.PatternProbeRestart,
+				Namespace:  meta.Namespace,
+				Payload: map[string]interface{}{
+					"workload_kind":       kind,
+					"workload_name":       meta.Name,
+					"workload":            kind + "/" + meta.Name,
+					"namespace":           meta.Namespace,
+					"container_name":      name,
+					"resource_version":    meta.ResourceVersion,
+					"generation":          meta.Generation,
+					"previous_revision":   previous.revision,
+					"revision":            current.revision,
+					"probe_type":          probeType,
+					"probe_handler":       probeHandler(cur),
+					"old_timeout_seconds": probeTimeout(old),
+					"timeout_seconds":     probeTimeout(cur),
+					"period_seconds":      cur.PeriodSeconds,
+					"failure_threshold":   cur.FailureThreshold,
+				},
+			})
+			log.Info("ProbeTimeoutTightened", "workload", kind+"/"+meta.Name, "namespace", meta.Namespace,
+				"container", name, "probe", probeType, "timeout_seconds", probeTimeout(cur), "was", probeTimeout(old))
+		}
+	}
+}
+
+// probeTimeout is the probe's timeout in seconds; the API defaults an unset
+// one to 1.
+func probeTimeout(p *corev1.Probe) int32 {
+	return max(p.TimeoutSeconds, 1)
+}
+
+// probeHandler names how the probe checks the container.
+func probeHandler(p *corev1.Probe) string {
+	switch {
+	case p.HTTPGet != nil:
+		return "http"
+	case p.TCPSocket != nil:
+		return "tcp"
+	case p.GRPC != nil:
+		return "grpc"
+	case p.Exec != nil:
+		return "exec"
+	}
+	return ""
+}
@@ -0,0 +1,313 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+const DefaultPVCPendingThreshold = 5 * time.Minute
+
+// pvcScanInterval is how often Pending claims are checked against the
+// threshold. Nothing about a stuck claim changes, so no event marks it.
+const pvcScanInterval = 30 * time.Second
+
+// PVCWatcher records PersistentVolumeClaim phase transitions and claims
+// stuck in Pending, and, fed FailedMount and FailedAttachVolume events by
+// the EventWatcher, emits VolumeMountFailed naming the claim behind a pod
+// that cannot start. Together they make up P007: a claim that never binds
+// leaves its pods Pending and their workload never ready.
+type PVCWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	threshold time.Duration
+	owners    *Owners
+	limiter   *APILimiter
+
+	mu       sync.Mutex
+	claims   map[types.UID]pvcState
+	failures map[types.UID]time.Time // Event UID → first seen; one VolumeMountFailed per Event
+}
+
+type pvcState struct {
+	phase         corev1.PersistentVolumeClaimPhase
+	since         time.Time
+	stuckReported bool
+}
+
+func NewPVCWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger, threshold time.Duration) *PVCWatcher {
+	if threshold <= 0 {
+		threshold = DefaultPVCPendingThreshold
+	}
+	return &PVCWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "pvc_watcher"), threshold: threshold,
+		claims:   map[types.UID]pvcState{},
+		failures: map[types.UID]time.Time{},
+	}
+}
+
+// UseOwners resolves the workload of pods in emitted events through o.
+func (vw *PVCWatcher) UseOwners(o *Owners) {
+	vw.owners = o
+}
+
+// UseAPILimiter paces the pod and claim fetches behind VolumeMountFailed
+// through l.
+func (vw *PVCWatcher) UseAPILimiter(l *APILimiter) {
+	vw.limiter = l
+}
+
+func (vw *PVCWatcher) Watch(ctx context.Context) error {
+	vw.log.Info("starting", "namespace", vw.namespace, "pending_threshold", vw.threshold)
+	factory := newInformerFactory(vw.client, vw.namespace, vw.selectors)
+	informer := factory.Core().V1().PersistentVolumeClaims().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(vw.handleEvent)); err != nil {
+		return fmt.Errorf("pvc informer registration failed: %w", err)
+	}
+	var scans sync.WaitGroup
+	defer scans.Wait()
+	scans.Go(func() {
+		t := time.NewTicker(pvcScanInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				vw.scan(informer.GetStore().List(), now)
+			}
+		}
+	})
+	return runInformer(ctx, vw.log, "pvc_watcher", vw.namespace, vw.emitter, factory, informer)
+}
+
+func (vw *PVCWatcher) handleEvent(event watch.Event) {
+	pvc, ok := event.Object.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return
+	}
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	prev, known := vw.claims[pvc.UID]
+	switch event.Type {
+	case watch.Added:
+		// Pending time counts from creation, so a claim that was already
+		// stuck when the collector started is reported on the first scan.
+		vw.claims[pvc.UID] = pvcState{phase: pvc.Status.Phase, since: pvc.CreationTimestamp.Time}
+	case watch.Modified:
+		if known && prev.phase == pvc.Status.Phase {
+			return
+		}
+		now := time.Now()
+		vw.claims[pvc.UID] = pvcState{phase: pvc.Status.Phase, since: now}
+		vw.emitPhaseChange(pvc, prev, known, now)
+	case watch.Deleted:
+		delete(vw.claims, pvc.UID)
+	}
+}
+
+// emitPhaseChange emits PVCPhaseChanged. Caller holds vw.mu.
+func (vw *PVCWatcher) emitPhaseChange(pvc *corev1.PersistentVolumeClaim, prev pvcState, known bool, now time.Time) {
+	payload := pvcPayload(pvc)
+	payload["old_phase"] = string(prev.phase)
+	payload["new_phase"] = string(pvc.Status.Phase)
+	if known {
+		payload["seconds_in_previous_phase"] = now.Sub(prev.since).Seconds()
+	}
+	vw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  now,
+		OccurredAt: lastChanged(pvc.ObjectMeta),
+		EventType:  "PVCPhaseChanged",
+		PatternID:  patterns.PatternVolumeMount,
+		Namespace:  pvc.Namespace,
+		Payload:    payload,
+	})
+	vw.log.Info("PVCPhaseChanged", "pvc", pvc.Namespace+"/"+pvc.Name, "from", prev.phase, "to", pvc.Status.Phase)
+}
+
+// scan emits PVCStuckPending once for every claim Pending longer than the
+// threshold, and forgets Event UIDs old enough to have been pruned.
+func (vw *PVCWatcher) scan(objs []interface{}, now time.Time) {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	for _, obj := range objs {
+		pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+		if !ok {
+			continue
+		}
+		st, known := vw.claims[pvc.UID]
+		if !known || st.phase != corev1.ClaimPending || st.stuckReported || now.Sub(st.since) < vw.threshold {
+			continue
+		}
+		st.stuckReported = true
+		vw.claims[pvc.UID] = st
+		payload := pvcPayload(pvc)
+		payload["pending_seconds"] = now.Sub(st.since).Seconds()
+		payload["threshold_seconds"] = vw.threshold.Seconds()
+		payload["provisioner"] = pvc.Annotations["volume.kubernetes.io/storage-provisioner"]
+		vw.emitter.Emit(emitter.CausalEvent{
+			ID:        emitter.NewID(),
+			Timestamp: now,
+			EventType: "PVCStuckPending",
+			PatternID: patterns.PatternVolumeMount,
+			Namespace: pvc.Namespace,
+			Payload:   payload,
+		})
+		vw.log.Info("PVCStuckPending", "pvc", pvc.Namespace+"/"+pvc.Name, "pending", now.Sub(st.since).Round(time.Second))
+	}
+	for uid, seen := range vw.failures {
+		if now.Sub(seen) > time.Hour { // kube-apiserver --event-ttl default
+			delete(vw.failures, uid)
+		}
+	}
+}
+
+// volumeFailureReasons are the kubelet and attach-detach controller Event
+// reasons for a volume that cannot be made available to a pod.
+var volumeFailureReasons = map[string]bool{
+	"FailedMount":        true,
+	"FailedAttachVolume": true,
+}
+
+// HandleMountFailure emits VolumeMountFailed for each PersistentVolumeClaim
+// of the pod that a FailedMount or FailedAttachVolume Event names, either
+// by pod volume name or by bound PersistentVolume name. Failures of
+// volumes that are not claims (a missing ConfigMap) are left to P003.
+// Each Event is handled once; its later count bumps are not re-emitted.
+// A nil *PVCWatcher ignores every event.
+func (vw *PVCWatcher) HandleMountFailure(ctx context.Context, k8sEvent *corev1.Event) {
+	if vw == nil || !volumeFailureReasons[k8sEvent.Reason] || k8sEvent.InvolvedObject.Kind != "Pod" {
+		return
+	}
+	vw.mu.Lock()
+	_, seen := vw.failures[k8sEvent.UID]
+	if !seen {
+		vw.failures[k8sEvent.UID] = time.Now()
+	}
+	vw.mu.Unlock()
+	if seen {
+		return
+	}
+
+	podName := k8sEvent.Namespace + "/" + k8sEvent.InvolvedObject.Name
+	var pod *corev1.Pod
+	err := vw.limiter.call(ctx, "pvc_watcher", "get pod", podName, func(ctx context.Context) (err error) {
+		pod, err = vw.client.CoreV1().Pods(k8sEvent.Namespace).Get(ctx, k8sEvent.InvolvedObject.Name, metav1.GetOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) || errors.Is(err, errThrottled) {
+		return
+	}
+	if err != nil {
+		reportError(vw.emitter, vw.log, "pvc_watcher", k8sEvent.Namespace, "get pod", podName, err)
+		return
+	}
+	named := messageTokens(k8sEvent.Message)
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim == nil {
+			continue
+		}
+		claimName := pod.Namespace + "/" + vol.PersistentVolumeClaim.ClaimName
+		var pvc *corev1.PersistentVolumeClaim
+		err := vw.limiter.call(ctx, "pvc_watcher", "get pvc", claimName, func(ctx context.Context) (err error) {
+			pvc, err = vw.client.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, vol.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
+			return err
+		})
+		switch {
+		case errors.Is(err, errThrottled):
+			continue
+		case apierrors.IsNotFound(err):
+			// A claim that does not exist is itself the failure.
+			pvc = &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: vol.PersistentVolumeClaim.ClaimName, Namespace: pod.Namespace}}
+		case err != nil:
+			reportError(vw.emitter, vw.log, "pvc_watcher", pod.Namespace, "get pvc", claimName, err)
+			continue
+		}
+		if !named[vol.Name] && !named[pvc.Name] && (pvc.Spec.VolumeName == "" || !named[pvc.Spec.VolumeName]) {
+			continue
+		}
+		vw.emitMountFailure(pod, vol.Name, pvc, k8sEvent)
+	}
+}
+
+func (vw *PVCWatcher) emitMountFailure(pod *corev1.Pod, volume string, pvc *corev1.PersistentVolumeClaim, k8sEvent *corev1.Event) {
+	payload := pvcPayload(pvc)
+	payload["volume_name"] = volume
+	payload["pvc_phase"] = string(pvc.Status.Phase)
+	payload["pvc_exists"] = pvc.UID != ""
+	payload["reason"] = k8sEvent.Reason
+	payload["message"] = k8sEvent.Message
+	payload["event_count"] = k8sEvent.Count
+	payload["first_timestamp"] = eventTime(k8sEvent.FirstTimestamp, k8sEvent)
+	payload["pod_phase"] = string(pod.Status.Phase)
+	vw.owners.annotate(payload, pod)
+	vw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: lastOccurred(k8sEvent),
+		EventType:  "VolumeMountFailed",
+		PatternID:  patterns.PatternVolumeMount,
+		PodName:    pod.Name,
+		Namespace:  pod.Namespace,
+		NodeName:   pod.Spec.NodeName,
+		PodUID:     string(pod.UID),
+		Payload:    payload,
+	})
+	vw.log.Info("VolumeMountFailed", "pod", pod.Namespace+"/"+pod.Name, "pvc", pvc.Name, "reason", k8sEvent.Reason)
+}
+
+// pvcPayload holds the fields every PVC event carries.
+func pvcPayload(pvc *corev1.PersistentVolumeClaim) map[string]interface{} {
+	storageClass := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClass = *pvc.Spec.StorageClassName
+	}
+	requested := ""
+	if q, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		requested = q.String()
+	}
+	modes := make([]string, 0, len(pvc.Spec.AccessModes))
+	for _, m := range pvc.Spec.AccessModes {
+		modes = append(modes, string(m))
+	}
+	return map[string]interface{}{
+		"pvc_name":         pvc.Name,
+		"namespace":        pvc.Namespace,
+		"storage_class":    storageClass,
+		"requested_size":   requested,
+		"access_modes":     modes,
+		"pv_name":          pvc.Spec.VolumeName,
+		"resource_version": pvc.ResourceVersion,
+	}
+}
+
+// messageTokens splits an Event message into the object-name-like words
+// it contains, e.g. {data, pvc-1f2e...} from
+// `Unable to attach or mount volumes: unmounted volumes=[data], ...` or
+// `AttachVolume.Attach failed for volume "pvc-1f2e..." : ...`.
+func messageTokens(msg string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, t := range strings.FieldsFunc(msg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.')
+	}) {
+		tokens[strings.Trim(t, ".")] = true
+	}
+	return tokens
+}
@@ -0,0 +1,120 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/health"
+	"github.com/opscart/k8s-causal-memory/collector/metrics"
+)
+
+// Reconnection policy for the raw-watch watchers. Informer-backed watchers
+// get equivalent behaviour from their reflector.
+const (
+	reconnectInitial = time.Second
+	reconnectMax     = 30 * time.Second
+	// A watch that stayed open this long is considered healthy, and the
+	// next reconnect starts again from reconnectInitial.
+	reconnectSustained = time.Minute
+)
+
+var (
+	errWatchClosed  = errors.New("watch channel closed")
+	errWatchExpired = errors.New("resourceVersion expired")
+)
+
+// watchSession opens one watch at rv and consumes it until it ends. It
+// returns the last resourceVersion it saw (rv if none) and why it ended:
+// nil when ctx was cancelled, errWatchClosed when the server closed the
+// channel, errWatchExpired on 410 Gone, or the error that prevented the
+// watch from opening. It calls alive once the watch is open, its cache
+// primed, and again on every event.
+type watchSession func(ctx context.Context, rv string, alive func()) (string, error)
+
+// watchWithBackoff runs session until ctx is cancelled, reconnecting with
+// capped, jittered exponential backoff so an overloaded apiserver is not
+// hammered by a tight reconnect loop. An expired resourceVersion relists
+// immediately. Each reconnect is emitted as a WatchReconnected meta-event.
+// Errors the apiserver will keep returning (RBAC, missing resource) are
+// returned instead of retried.
+func watchWithBackoff(ctx context.Context, log *slog.Logger, name, namespace, cpKey string, cp *Checkpoint, e emitter.Emitter, session watchSession) error {
+	probe := health.Register(probeName(name, namespace))
+	defer probe.Done()
+	rv := cp.ResourceVersion(cpKey)
+	delay := reconnectInitial
+	reconnects := 0
+	for {
+		started := time.Now()
+		lastRV, err := session(ctx, rv, probe.Synced)
+		rv = lastRV
+		if ctx.Err() != nil {
+			log.Info("stopped")
+			return nil
+		}
+		if err == nil {
+			err = errWatchClosed
+		}
+		if errors.Is(err, errWatchExpired) {
+			log.Info("resourceVersion expired, relisting", "resource_version", rv)
+			cp.Reset(cpKey)
+			rv = ""
+			continue
+		}
+		if !errors.Is(err, errWatchClosed) {
+			probe.Failed()
+			reportError(e, log, name, namespace, "watch", "", err)
+			if !retryable(err) {
+				return err
+			}
+		}
+		lasted := time.Since(started)
+		if lasted >= reconnectSustained {
+			delay = reconnectInitial
+		}
+		wait := jitter(delay)
+		reconnects++
+		metrics.WatchReconnects.WithLabelValues(name).Inc()
+		e.EmitMeta(emitter.CausalEvent{
+			ID:        emitter.NewID(),
+			Timestamp: time.Now(),
+			EventType: "WatchReconnected",
+			Namespace: namespace,
+			Payload: map[string]interface{}{
+				"watcher":                name,
+				"reason":                 err.Error(),
+				"reconnect_count":        reconnects,
+				"backoff_seconds":        wait.Seconds(),
+				"watch_duration_seconds": lasted.Seconds(),
+				"resource_version":       rv,
+			},
+		})
+		log.Warn("watch ended, reconnecting", "reason", err, "reconnect", reconnects, "backoff", wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			log.Info("stopped")
+			return nil
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, reconnectMax)
+	}
+}
+
+// jitter spreads d over [0.8d, 1.2d) so watchers that lost their watch at
+// the same moment do not reconnect in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (0.8 + 0.4*rand.Float64()))
+}
+
+func retryable(err error) bool {
+	return !apierrors.IsForbidden(err) &&
+		!apierrors.IsUnauthorized(err) &&
+		!apierrors.IsNotFound(err) &&
+		!apierrors.IsBadRequest(err) &&
+		!apierrors.IsInvalid(err)
+}
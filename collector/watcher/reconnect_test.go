@@ -0,0 +1,108 @@
+package watcher
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// closingSession is a watch the server keeps closing: the nth attempt
+// stays open for lasts[n], no time at all if unset, and attempt stopAfter
+// cancels the context instead. starts records when each attempt began.
+func closingSession(starts *[]time.Time, lasts map[int]time.Duration, stopAfter int, cancel context.CancelFunc) watchSession {
+	return func(ctx context.Context, rv string, alive func()) (string, error) {
+		*starts = append(*starts, time.Now())
+		n := len(*starts)
+		if n == stopAfter {
+			cancel()
+			return rv, nil
+		}
+		w := watch.NewFake()
+		alive()
+		time.Sleep(lasts[n])
+		w.Stop()
+		for range w.ResultChan() {
+		}
+		return rv, errWatchClosed
+	}
+}
+
+func TestWatchWithBackoffDoublesToCap(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		e := emitter.NewMemoryEmitter()
+		var starts []time.Time
+		session := closingSession(&starts, nil, 9, cancel)
+		if err := watchWithBackoff(ctx, discardLogger(), "test_watcher", "", "", nil, e, session); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []time.Duration{1, 2, 4, 8, 16, 30, 30, 30}
+		if len(starts) != len(want)+1 {
+			t.Fatalf("got %d attempts, want %d", len(starts), len(want)+1)
+		}
+		for i, base := range want {
+			d := base * time.Second
+			gap := starts[i+1].Sub(starts[i])
+			if gap < d*8/10 || gap >= d*12/10 {
+				t.Errorf("reconnect %d waited %v, want within 20%% of %v", i+1, gap, d)
+			}
+		}
+		meta := e.MetaEvents()
+		if len(meta) != len(want) {
+			t.Fatalf("got %d WatchReconnected events, want %d", len(meta), len(want))
+		}
+		for i, m := range meta {
+			if m.EventType != "WatchReconnected" || m.Payload["reconnect_count"] != i+1 || m.Payload["reason"] != errWatchClosed.Error() {
+				t.Errorf("meta event %d = %s %v", i, m.EventType, m.Payload)
+			}
+		}
+	})
+}
+
+func TestWatchWithBackoffResetsAfterSustainedWatch(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var starts []time.Time
+		// The fourth watch stays open past reconnectSustained.
+		session := closingSession(&starts, map[int]time.Duration{4: 2 * reconnectSustained}, 6, cancel)
+		if err := watchWithBackoff(ctx, discardLogger(), "test_watcher", "", "", nil, emitter.NewMemoryEmitter(), session); err != nil {
+			t.Fatal(err)
+		}
+		if len(starts) != 6 {
+			t.Fatalf("got %d attempts, want 6", len(starts))
+		}
+		// After 1s, 2s and 4s the delay is back to reconnectInitial.
+		gap := starts[4].Sub(starts[3]) - 2*reconnectSustained
+		if gap < reconnectInitial*8/10 || gap >= reconnectInitial*12/10 {
+			t.Fatalf("reconnect after a sustained watch waited %v, want about %v", gap, reconnectInitial)
+		}
+	})
+}
+
+func TestWatchWithBackoffStopsWithContext(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var starts []time.Time
+		session := closingSession(&starts, nil, 0, cancel)
+		done := make(chan error)
+		go func() {
+			done <- watchWithBackoff(ctx, discardLogger(), "test_watcher", "", "", nil, emitter.NewMemoryEmitter(), session)
+		}()
+		time.Sleep(10 * time.Second) // mid-backoff, after 1s, 2s and 4s
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if len(starts) != 4 {
+			t.Fatalf("got %d attempts before the context ended, want 4", len(starts))
+		}
+	})
+}
@@ -0,0 +1,313 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// DefaultScaleDownWindow is how long past its pods' termination grace
+// period, 30 seconds unless the pod template sets one, the deletion of a
+// pod is put down to its ReplicaSet's scale-down: the time the kubelet and
+// the watch take to report the pod gone.
+const DefaultScaleDownWindow = 30 * time.Second
+
+// ReasonIntentionalScaleDown is the reason of a pod's deletion snapshot
+// when its ReplicaSet was scaled down or deleted just before.
+const ReasonIntentionalScaleDown = "intentional_scaledown"
+
+// ReplicaSetWatcher emits ReplicaSetScaled when a ReplicaSet's desired
+// replicas change, a Deployment scaled, rolled out or scaled to zero, and
+// ReplicaSetOrphaned when it loses its controlling owner, its Deployment
+// deleted with orphaning propagation, so its pods are no longer managed.
+// Scale-downs, and ReplicaSets deleted, are recorded in ScaleDowns for the
+// PodWatcher to tell the pods deleted by them from pods that failed.
+type ReplicaSetWatcher struct {
+	client     kubernetes.Interface
+	namespace  string
+	selectors  Selectors
+	emitter    emitter.Emitter
+	log        *slog.Logger
+	scaleDowns *ScaleDowns
+
+	// replicaSets holds the desired replicas and controller last seen per
+	// ReplicaSet. Only the informer's handler goroutine touches it.
+	replicaSets map[types.UID]replicaSetState
+}
+
+type replicaSetState struct {
+	replicas   int32
+	controller *metav1.OwnerReference
+}
+
+func NewReplicaSetWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *ReplicaSetWatcher {
+	return &ReplicaSetWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "replicaset_watcher"),
+		replicaSets: map[types.UID]replicaSetState{},
+	}
+}
+
+// UseScaleDowns records the scale-downs and deletions seen in sd.
+func (rw *ReplicaSetWatcher) UseScaleDowns(sd *ScaleDowns) {
+	rw.scaleDowns = sd
+}
+
+func (rw *ReplicaSetWatcher) Watch(ctx context.Context) error {
+	rw.log.Info("starting", "namespace", rw.namespace)
+	factory := newInformerFactory(rw.client, rw.namespace, rw.selectors)
+	informer := factory.Apps().V1().ReplicaSets().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(rw.handleEvent)); err != nil {
+		return fmt.Errorf("replicaset informer registration failed: %w", err)
+	}
+	return runInformer(ctx, rw.log, "replicaset_watcher", rw.namespace, rw.emitter, factory, informer)
+}
+
+func (rw *ReplicaSetWatcher) handleEvent(event watch.Event) {
+	rs, ok := event.Object.(*appsv1.ReplicaSet)
+	if !ok {
+		return
+	}
+	cur := replicaSetState{replicas: desiredReplicas(rs), controller: metav1.GetControllerOf(rs)}
+	prev, known := rw.replicaSets[rs.UID]
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		rw.replicaSets[rs.UID] = cur
+		if !known {
+			return
+		}
+		if cur.replicas != prev.replicas {
+			rw.emitScaled(rs, prev, cur)
+		}
+		if cur.replicas > prev.replicas {
+			// The pods deleted from now on are not the scale-down's.
+			rw.scaleDowns.forget(rs)
+		}
+		if prev.controller != nil && cur.controller == nil {
+			rw.emitOrphaned(rs, prev)
+		}
+	case watch.Deleted:
+		delete(rw.replicaSets, rs.UID)
+		// Its pods go with it unless deleted with orphaning propagation,
+		// which leaves them in place.
+		rw.scaleDowns.record(rs, cur.replicas, 0, "", true)
+	}
+}
+
+func desiredReplicas(rs *appsv1.ReplicaSet) int32 {
+	if rs.Spec.Replicas == nil {
+		return 1
+	}
+	return *rs.Spec.Replicas
+}
+
+// replicaSetPayload describes rs and the Deployment that owns it, if any.
+func replicaSetPayload(rs *appsv1.ReplicaSet, controller *metav1.OwnerReference) map[string]interface{} {
+	payload := map[string]interface{}{
+		"replicaset":       rs.Name,
+		"namespace":        rs.Namespace,
+		"resource_version": rs.ResourceVersion,
+		"revision":         rs.Annotations["deployment.kubernetes.io/revision"],
+		"ready_replicas":   rs.Status.ReadyReplicas,
+		"current_replicas": rs.Status.Replicas,
+		"deployment":       "",
+		"workload_kind":    "ReplicaSet",
+		"workload_name":    rs.Name,
+		"workload":         "ReplicaSet/" + rs.Name,
+	}
+	if controller != nil {
+		if controller.Kind == "Deployment" {
+			payload["deployment"] = controller.Name
+		}
+		payload["workload_kind"] = controller.Kind
+		payload["workload_name"] = controller.Name
+		payload["workload"] = controller.Kind + "/" + controller.Name
+	}
+	return payload
+}
+
+func (rw *ReplicaSetWatcher) emitScaled(rs *appsv1.ReplicaSet, prev, cur replicaSetState) {
+	payload := replicaSetPayload(rs, cur.controller)
+	payload["from_replicas"] = prev.replicas
+	payload["to_replicas"] = cur.replicas
+	payload["scaled_to_zero"] = cur.replicas == 0
+	direction := "up"
+	if cur.replicas < prev.replicas {
+		direction = "down"
+	}
+	payload["direction"] = direction
+	id := emitter.NewID()
+	rw.emitter.Emit(emitter.CausalEvent{
+		ID:         id,
+		Timestamp:  time.Now(),
+		OccurredAt: lastChanged(rs.ObjectMeta),
+		EventType:  "ReplicaSetScaled",
+		Namespace:  rs.Namespace,
+		Payload:    payload,
+	})
+	rw.log.Info("ReplicaSetScaled", "replicaset", rs.Namespace+"/"+rs.Name, "from", prev.replicas, "to", cur.replicas)
+	if direction == "down" {
+		rw.scaleDowns.record(rs, prev.replicas, cur.replicas, id, false)
+	}
+}
+
+func (rw *ReplicaSetWatcher) emitOrphaned(rs *appsv1.ReplicaSet, prev replicaSetState) {
+	payload := replicaSetPayload(rs, nil)
+	payload["previous_owner_kind"] = prev.controller.Kind
+	payload["previous_owner_name"] = prev.controller.Name
+	if prev.controller.Kind == "Deployment" {
+		payload["deployment"] = prev.controller.Name
+	}
+	rw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: lastChanged(rs.ObjectMeta),
+		EventType:  "ReplicaSetOrphaned",
+		Namespace:  rs.Namespace,
+		Payload:    payload,
+	})
+	rw.log.Info("ReplicaSetOrphaned", "replicaset", rs.Namespace+"/"+rs.Name, "owner", prev.controller.Kind+"/"+prev.controller.Name)
+}
+
+// ScaleDowns remembers the ReplicaSets recently scaled down or deleted,
+// for a pod they owned to be recognised as deleted on purpose rather than
+// lost. A scale-down from 5 to 3 replicas explains two pod deletions, made
+// within the pods' grace period and the window; a third pod going is a
+// failure again, as is any pod going once the ReplicaSet is scaled back
+// up. The ReplicaSetWatcher records them; a nil *ScaleDowns records
+// nothing.
+type ScaleDowns struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	byRS      map[types.UID]scaleDown
+	lastSweep time.Time
+}
+
+// scaleDown is one ReplicaSet scale-down, or its deletion, and those
+// before it whose pods were still going.
+type scaleDown struct {
+	replicaSet string
+	deployment string
+	from, to   int32
+	eventID    string // the ReplicaSetScaled event; "" for a deletion
+	deleted    bool
+	at         time.Time
+	until      time.Time // pod deletions after it are not put down to it
+	// remaining is how many more pod deletions it explains; pods holds
+	// those it already explained, which may be reported again.
+	remaining int32
+	pods      map[types.UID]bool
+}
+
+func NewScaleDowns(window time.Duration) *ScaleDowns {
+	if window <= 0 {
+		window = DefaultScaleDownWindow
+	}
+	return &ScaleDowns{window: window, byRS: map[types.UID]scaleDown{}}
+}
+
+func (sd *ScaleDowns) record(rs *appsv1.ReplicaSet, from, to int32, eventID string, deleted bool) {
+	if sd == nil {
+		return
+	}
+	now := time.Now()
+	d := scaleDown{replicaSet: rs.Name, from: from, to: to, eventID: eventID, deleted: deleted, at: now,
+		until:     now.Add(terminationGracePeriod(rs) + sd.window),
+		remaining: max(from-to, 0),
+		pods:      map[types.UID]bool{},
+	}
+	if owner := metav1.GetControllerOf(rs); owner != nil && owner.Kind == "Deployment" {
+		d.deployment = owner.Name
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if old, ok := sd.byRS[rs.UID]; ok && now.Before(old.until) {
+		// Scaled down again before the pods of the last scale-down were
+		// all gone: 5 to 3 then 3 to 1 explains four deletions.
+		d.from = old.from
+		d.remaining += old.remaining
+		d.pods = old.pods
+	}
+	sd.byRS[rs.UID] = d
+	if now.Sub(sd.lastSweep) > sd.window {
+		sd.lastSweep = now
+		for uid, old := range sd.byRS {
+			if now.After(old.until) {
+				delete(sd.byRS, uid)
+			}
+		}
+	}
+}
+
+// forget drops the scale-down recorded for rs, which was scaled up.
+func (sd *ScaleDowns) forget(rs *appsv1.ReplicaSet) {
+	if sd == nil {
+		return
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	delete(sd.byRS, rs.UID)
+}
+
+func terminationGracePeriod(rs *appsv1.ReplicaSet) time.Duration {
+	if s := rs.Spec.Template.Spec.TerminationGracePeriodSeconds; s != nil {
+		return time.Duration(*s) * time.Second
+	}
+	return corev1.DefaultTerminationGracePeriodSeconds * time.Second
+}
+
+// annotate marks the deletion snapshot state of pod with reason
+// intentional_scaledown if the ReplicaSet that owns it was scaled down or
+// deleted just before, and the scale-down does not already account for as
+// many deletions as it removed replicas.
+func (sd *ScaleDowns) annotate(state map[string]interface{}, pod *corev1.Pod) {
+	if sd == nil {
+		return
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return
+	}
+	sd.mu.Lock()
+	d, ok := sd.byRS[owner.UID]
+	ok = ok && !time.Now().After(d.until)
+	if ok && !d.pods[pod.UID] {
+		ok = d.remaining > 0
+		if ok {
+			d.remaining--
+			d.pods[pod.UID] = true
+			sd.byRS[owner.UID] = d
+		}
+	}
+	sd.mu.Unlock()
+	if !ok {
+		return
+	}
+	state["reason"] = ReasonIntentionalScaleDown
+	state["scaledown"] = map[string]interface{}{
+		"replicaset":         d.replicaSet,
+		"deployment":         d.deployment,
+		"from_replicas":      d.from,
+		"to_replicas":        d.to,
+		"replicaset_deleted": d.deleted,
+		"event_id":           d.eventID,
+		"at":                 d.at,
+	}
+}
+
+// UseScaleDowns tags the deletion snapshot of a pod whose ReplicaSet sd
+// saw scaled down or deleted just before with reason
+// intentional_scaledown, rather than leaving it looking like a failure.
+func (pw *PodWatcher) UseScaleDowns(sd *ScaleDowns) {
+	pw.scaleDowns = sd
+}
@@ -0,0 +1,143 @@
+package watcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+func testReplicaSet(replicas int32) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "api-7d9f", Namespace: "prod", UID: "uid-rs",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "api", UID: "uid-deploy", Controller: ptr.To(true)}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Replicas: ptr.To(replicas)},
+	}
+}
+
+func replicaSetPod(n int) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: fmt.Sprintf("api-7d9f-%d", n), Namespace: "prod", UID: types.UID(fmt.Sprintf("uid-pod-%d", n)),
+		OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "api-7d9f", UID: "uid-rs", Controller: ptr.To(true)}},
+	}}
+}
+
+// scaleDownWatcher returns a ReplicaSetWatcher recording into a ScaleDowns
+// with the given window, having seen the ReplicaSet at replicas.
+func scaleDownWatcher(window time.Duration, replicas int32) (*ReplicaSetWatcher, *ScaleDowns) {
+	rw := NewReplicaSetWatcher(fake.NewSimpleClientset(), "prod", Selectors{}, emitter.NewMemoryEmitter(), discardLogger())
+	sd := NewScaleDowns(window)
+	rw.UseScaleDowns(sd)
+	rw.handleEvent(watch.Event{Type: watch.Added, Object: testReplicaSet(replicas)})
+	return rw, sd
+}
+
+func scale(rw *ReplicaSetWatcher, replicas int32) {
+	rw.handleEvent(watch.Event{Type: watch.Modified, Object: testReplicaSet(replicas)})
+}
+
+// attributed returns the pods of ns that annotate puts down to a scale-down.
+func attributed(sd *ScaleDowns, pods ...int) []int {
+	var out []int
+	for _, n := range pods {
+		state := map[string]interface{}{}
+		sd.annotate(state, replicaSetPod(n))
+		if state["reason"] == ReasonIntentionalScaleDown {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func TestScaleDownExplainsAsManyDeletionsAsReplicasRemoved(t *testing.T) {
+	rw, sd := scaleDownWatcher(0, 5)
+	scale(rw, 3)
+	if got := attributed(sd, 1, 2, 3, 4); fmt.Sprint(got) != "[1 2]" {
+		t.Fatalf("attributed %v to the scale-down from 5 to 3, want [1 2]", got)
+	}
+	// The same pod reported again, by the reconciler say, is still the
+	// scale-down's.
+	if got := attributed(sd, 2); fmt.Sprint(got) != "[2]" {
+		t.Fatalf("pod 2 reported again: attributed %v", got)
+	}
+
+	state := map[string]interface{}{}
+	sd.annotate(state, replicaSetPod(1))
+	d := state["scaledown"].(map[string]interface{})
+	if d["from_replicas"] != int32(5) || d["to_replicas"] != int32(3) || d["deployment"] != "api" || d["event_id"] == "" {
+		t.Errorf("scaledown = %v", d)
+	}
+}
+
+func TestScaleDownsAddUpWhilePodsAreGoing(t *testing.T) {
+	rw, sd := scaleDownWatcher(0, 5)
+	scale(rw, 3)
+	attributed(sd, 1)
+	scale(rw, 1)
+	if got := attributed(sd, 2, 3, 4, 5); fmt.Sprint(got) != "[2 3 4]" {
+		t.Fatalf("attributed %v after 5 to 3 to 1, want [2 3 4]", got)
+	}
+	state := map[string]interface{}{}
+	sd.annotate(state, replicaSetPod(4))
+	if d := state["scaledown"].(map[string]interface{}); d["from_replicas"] != int32(5) || d["to_replicas"] != int32(1) {
+		t.Errorf("scaledown = %v, want from 5 to 1", d)
+	}
+}
+
+func TestScaleUpClearsScaleDown(t *testing.T) {
+	rw, sd := scaleDownWatcher(0, 3)
+	scale(rw, 2)
+	scale(rw, 3)
+	if got := attributed(sd, 1); len(got) != 0 {
+		t.Fatalf("deletion after scaling back up attributed to the scale-down")
+	}
+}
+
+func TestScaleDownExpiresAfterGracePeriod(t *testing.T) {
+	rw, sd := scaleDownWatcher(20*time.Millisecond, 3)
+	rs := testReplicaSet(1)
+	rs.Spec.Template.Spec.TerminationGracePeriodSeconds = ptr.To[int64](0)
+	rw.handleEvent(watch.Event{Type: watch.Modified, Object: rs})
+	if got := attributed(sd, 1); len(got) != 1 {
+		t.Fatal("deletion within the window not attributed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := attributed(sd, 2); len(got) != 0 {
+		t.Fatal("deletion after the window attributed")
+	}
+
+	// The default window covers the default 30s grace period and then
+	// some, not the ten minutes it once did.
+	rw, sd = scaleDownWatcher(0, 3)
+	scale(rw, 2)
+	sd.mu.Lock()
+	until := sd.byRS["uid-rs"].until
+	sd.mu.Unlock()
+	if left := time.Until(until); left < 30*time.Second || left > 90*time.Second {
+		t.Errorf("scale-down explains deletions for %v more", left)
+	}
+}
+
+func TestReplicaSetDeletedExplainsItsPods(t *testing.T) {
+	rw, sd := scaleDownWatcher(0, 2)
+	rw.handleEvent(watch.Event{Type: watch.Deleted, Object: testReplicaSet(2)})
+	if got := attributed(sd, 1, 2, 3); fmt.Sprint(got) != "[1 2]" {
+		t.Fatalf("attributed %v to the deletion of a 2-replica ReplicaSet, want [1 2]", got)
+	}
+	state := map[string]interface{}{}
+	sd.annotate(state, replicaSetPod(1))
+	if d := state["scaledown"].(map[string]interface{}); d["replicaset_deleted"] != true {
+		t.Errorf("scaledown = %v", d)
+	}
+}
@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// emitResourceChanges emits ResourceLimitsChanged for every container
+// whose resource requests or limits differ between a workload's previous
+// and current pod template. A lowered memory limit is the precursor of
+// OOMKills that start hours after a deploy that seemed to be about
+// something else: the event names the workload as the OOMKill does, and a
+// limit lowered, or set where there was none, is flagged limit_reduced.
+// Containers added or removed with the template are not changes.
+func emitResourceChanges(e emitter.Emitter, log *slog.Logger, kind string, meta metav1.ObjectMeta, previous, current workloadTemplate) {
+	if previous.hash == "" {
+		return
+	}
+	names := make([]string, 0, len(current.resources))
+	for name := range current.resources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		old, ok := previous.resources[name]
+		if !ok {
+			continue
+		}
+		changes := resourceChanges(old, current.resources[name])
+		if len(changes) == 0 {
+			continue
+		}
+		var limitReduced, requestReduced, memoryLimitReduced bool
+		for _, c := range changes {
+			if !c["reduced"].(bool) {
+				continue
+			}
+			if c["field"] == "limits" {
+				limitReduced = true
+				memoryLimitReduced = memoryLimitReduced || c["resource"] == string(corev1.ResourceMemory)
+			} else {
+				requestReduced = true
+			}
+		}
+		patternID := ""
+		if memoryLimitReduced {
+			patternID = patterns.PatternOOMKill
+		}
+		e.Emit(emitter.CausalEvent{
+			ID:         emitter.NewID(),
+			Timestamp:  time.Now(),
+			OccurredAt: lastChanged(meta),
+			EventType:  "ResourceLimitsChanged",
+			PatternID:  patternID,
+			Namespace:  meta.Namespace,
+			Payload: map[string]interface{}{
+				"workload_kind":        kind,
+				"workload_name":        meta.Name,
+				"workload":             kind + "/" + meta.Name,
+				"namespace":            meta.Namespace,
+				"container_name":       name,
+				"resource_version":     meta.ResourceVersion,
+				"generation":           meta.Generation,
+				"previous_revision":    previous.revision,
+				"revision":             current.revision,
+				"changes":              changes,
+				"old_resources":        resourceValues(old),
+				"new_resources":        resourceValues(current.resources[name]),
+				"limit_reduced":        limitReduced,
+				"memory_limit_reduced": memoryLimitReduced,
+				"request_reduced":      requestReduced,
+			},
+		})
+		log.Info("ResourceLimitsChanged", "workload", kind+"/"+meta.Name, "namespace", meta.Namespace,
+			"container", name, "limit_reduced", limitReduced)
+	}
+}
+
+// resourceChanges lists each request and limit that differs between before
+// and after, requests first, with its change in percent where it had a
+// value in both.
+func resourceChanges(before, after corev1.ResourceRequirements) []map[string]interface{} {
+	changes := []map[string]interface{}{}
+	for _, f := range []struct {
+		field    string
+		old, new corev1.ResourceList
+	}{{"requests", before.Requests, after.Requests}, {"limits", before.Limits, after.Limits}} {
+		names := []corev1.ResourceName{}
+		for name := range f.old {
+			names = append(names, name)
+		}
+		for name := range f.new {
+			if _, ok := f.old[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			oldQ, hadOld := f.old[name]
+			newQ, hasNew := f.new[name]
+			if hadOld && hasNew && oldQ.Cmp(newQ) == 0 {
+				continue
+			}
+			// A limit set where there was none is lowered from unbounded; a
+			// request dropped, to nothing.
+			reduced := hadOld && hasNew && newQ.Cmp(oldQ) < 0
+			if f.field == "limits" {
+				reduced = reduced || hasNew && !hadOld
+			} else {
+				reduced = reduced || hadOld && !hasNew
+			}
+			c := map[string]interface{}{
+				"resource":       string(name),
+				"field":          f.field,
+				"old":            nil,
+				"new":            nil,
+				"percent_change": nil,
+				"reduced":        reduced,
+			}
+			if hadOld {
+				c["old"] = oldQ.String()
+			}
+			if hasNew {
+				c["new"] = newQ.String()
+			}
+			if hadOld && hasNew && !oldQ.IsZero() {
+				pct := (newQ.AsApproximateFloat64() - oldQ.AsApproximateFloat64()) / oldQ.AsApproximateFloat64() * 100
+				c["percent_change"] = math.Round(pct*10) / 10
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+func resourceValues(r corev1.ResourceRequirements) map[string]map[string]string {
+	list := func(l corev1.ResourceList) map[string]string {
+		out := map[string]string{}
+		for name, q := range l {
+			out[string(name)] = q.String()
+		}
+		return out
+	}
+	return map[string]map[string]string{"requests": list(r.Requests), "limits": list(r.Limits)}
+}
@@ -0,0 +1,237 @@
+package watcher
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// SecretWatcher records Secret rotations the way ConfigMapWatcher records
+// ConfigMap changes, but nothing a value could be recovered from ever
+// leaves the process: SecretChanged carries key names, the resource
+// version and a whole-object hash only. Every hash is an HMAC-SHA256 keyed
+// with a key that is never emitted, so the output cannot be used to test
+// guesses at a value. Per-key hashes, needed to tell which keys changed,
+// are kept in memory.
+type SecretWatcher struct {
+	client       kubernetes.Interface
+	namespace    string
+	selectors    Selectors
+	emitter      emitter.Emitter
+	log          *slog.Logger
+	versionCache map[string]secretVersion
+	hashKey      []byte
+	lag          *LagMonitor
+	windows      *patterns.NamespaceWindows
+	pods         *PodWatcher // nil lists consumers from the API
+	consumers    pendingChecks
+}
+
+// secretVersion is what the watcher remembers about a Secret between
+// events. keys is never emitted.
+type secretVersion struct {
+	hash string
+	keys map[string]string // key → keyed value hash
+}
+
+// ignoredSecretTypes are rewritten by controllers as a matter of course and
+// are not configuration any pod consumes through env vars.
+var ignoredSecretTypes = map[corev1.SecretType]bool{
+	"helm.sh/release.v1":                 true,
+	corev1.SecretTypeServiceAccountToken: true,
+}
+
+func NewSecretWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *SecretWatcher {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &SecretWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "secret_watcher"), versionCache: map[string]secretVersion{}, hashKey: key}
+}
+
+// UseHashKey keys the hashes with key instead of a random key drawn per
+// process. With the random key a Secret's content hash changes with every
+// restart and differs between replicas, so hashes only compare within one
+// run; with a fixed key they compare across restarts, replicas and
+// clusters, and anyone who learns the key can check a guessed value
+// against them, as with an unkeyed hash. An empty key keeps the random one.
+func (sw *SecretWatcher) UseHashKey(key []byte) {
+	if len(key) > 0 {
+		sw.hashKey = key
+	}
+}
+
+// UseLagMonitor measures the observation lag of rotations through lm, as
+// for ConfigMaps.
+func (sw *SecretWatcher) UseLagMonitor(lm *LagMonitor) {
+	sw.lag = lm
+}
+
+// UseWindows takes the P006 absence window of a namespace from w.
+func (sw *SecretWatcher) UseWindows(w *patterns.NamespaceWindows) {
+	sw.windows = w
+}
+
+// UsePods finds the pods a rotation reaches in pw's informer cache, as for
+// ConfigMaps.
+func (sw *SecretWatcher) UsePods(pw *PodWatcher) {
+	sw.pods = pw
+}
+
+func (sw *SecretWatcher) Watch(ctx context.Context) error {
+	sw.log.Info("starting", "namespace", sw.namespace)
+	sw.lag.start("secret_watcher", sw.namespace)
+	// As for ConfigMaps, the initial list primes versionCache.
+	factory := newInformerFactory(sw.client, sw.namespace, sw.selectors)
+	informer := factory.Core().V1().Secrets().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(func(event watch.Event) {
+		sw.handleEvent(ctx, event)
+	})); err != nil {
+		return fmt.Errorf("secret informer registration failed: %w", err)
+	}
+	defer sw.consumers.Wait() // as for ConfigMaps
+	return runInformer(ctx, sw.log, "secret_watcher", sw.namespace, sw.emitter, factory, informer)
+}
+
+func (sw *SecretWatcher) handleEvent(ctx context.Context, event watch.Event) {
+	secret, ok := event.Object.(*corev1.Secret)
+	if !ok || ignoredSecretTypes[secret.Type] {
+		return
+	}
+	key := secret.Namespace + "/" + secret.Name
+	cur := sw.versionOf(secret)
+	switch event.Type {
+	case watch.Added:
+		sw.versionCache[key] = cur
+	case watch.Modified:
+		prev, known := sw.versionCache[key]
+		if known && prev.hash == cur.hash {
+			return
+		}
+		changedAt := sw.captureChange(secret, prev, cur, event.Type)
+		sw.versionCache[key] = cur
+		sw.consumers.start(ctx, key, func(ctx context.Context) { sw.watchEnvConsumers(ctx, secret, changedAt) })
+	case watch.Deleted:
+		sw.captureChange(secret, sw.versionCache[key], secretVersion{}, event.Type)
+		delete(sw.versionCache, key)
+	}
+}
+
+// captureChange emits SecretChanged. cur is the zero value on deletion;
+// prev is the zero value if the Secret was never seen before.
+func (sw *SecretWatcher) captureChange(secret *corev1.Secret, prev, cur secretVersion, eventType watch.EventType) time.Time {
+	now := time.Now()
+	changed := appendChanged(nil, prev.keys, cur.keys, "")
+	sort.Strings(changed)
+	payload := map[string]interface{}{
+		"secret_name":        secret.Name,
+		"secret_type":        string(secret.Type),
+		"namespace":          secret.Namespace,
+		"resource_version":   secret.ResourceVersion,
+		"old_content_hash":   prev.hash,
+		"new_content_hash":   cur.hash,
+		"changed_keys":       changed,
+		"keys":               secretKeys(secret),
+		"key_count":          len(secret.Data),
+		"event_type":         string(eventType),
+		"potential_patterns": []string{patterns.PatternSecretEnv},
+		"content_captured":   false,
+	}
+	var occurred time.Time
+	if eventType == watch.Modified {
+		occurred = lastChanged(secret.ObjectMeta)
+		sw.lag.observe(payload, "secret_watcher", secret.Namespace, "SecretChanged", occurred)
+	}
+	sw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  now,
+		OccurredAt: occurred,
+		EventType:  "SecretChanged",
+		Namespace:  secret.Namespace,
+		Payload:    payload,
+	})
+	sw.log.Info("Secret changed", "secret", secret.Namespace+"/"+secret.Name)
+	return now
+}
+
+func (sw *SecretWatcher) versionOf(secret *corev1.Secret) secretVersion {
+	v := secretVersion{hash: sw.contentHash(secret), keys: make(map[string]string, len(secret.Data))}
+	for k, b := range secret.Data {
+		mac := hmac.New(sha256.New, sw.hashKey)
+		mac.Write(b)
+		v.keys[k] = string(mac.Sum(nil))
+	}
+	return v
+}
+
+// contentHash hashes the whole Secret, keys in sorted order, so equal
+// content yields the same hash for as long as the hash key stays the same.
+func (sw *SecretWatcher) contentHash(secret *corev1.Secret) string {
+	mac := hmac.New(sha256.New, sw.hashKey)
+	for _, k := range secretKeys(secret) {
+		mac.Write([]byte(k))
+		mac.Write([]byte{0})
+		mac.Write(secret.Data[k])
+		mac.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", mac.Sum(nil))[:16]
+}
+
+func secretKeys(secret *corev1.Secret) []string {
+	keys := make([]string, 0, len(secret.Data))
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// watchEnvConsumers drives the P006 absence step, as the ConfigMap watcher
+// does for P002: env vars from a Secret are resolved only at container
+// start.
+func (sw *SecretWatcher) watchEnvConsumers(ctx context.Context, secret *corev1.Secret, changedAt time.Time) {
+	window := sw.windows.AbsenceWindow(patterns.SecretEnvPattern, "PodNotRestarted", secret.Namespace)
+	deadline := changedAt.Add(window)
+	stale, ok := awaitStaleEnvConsumers(ctx, sw.client, sw.pods, sw.emitter, sw.log, "secret_watcher", secret.Namespace, "env_secrets", secret.Name, deadline)
+	if !ok {
+		return
+	}
+	for _, w := range sortedKeys(stale) {
+		kind, name, _ := strings.Cut(w, "/")
+		sort.Strings(stale[w])
+		payload := map[string]interface{}{
+			"secret_name":        secret.Name,
+			"namespace":          secret.Namespace,
+			"resource_version":   secret.ResourceVersion,
+			"workload_kind":      kind,
+			"workload_name":      name,
+			"stale_pods":         stale[w],
+			"stale_pod_count":    len(stale[w]),
+			"window_seconds":     window.Seconds(),
+			"change_observed_at": changedAt.UTC().Format(time.RFC3339Nano),
+		}
+		if kind == "Deployment" {
+			payload["deployment_name"] = name
+		}
+		sw.emitter.Emit(emitter.CausalEvent{
+			ID:        emitter.NewID(),
+			Timestamp: deadline,
+			EventType: "PodNotRestarted",
+			PatternID: patterns.PatternSecretEnv,
+			Namespace: secret.Namespace,
+			Payload:   payload,
+		})
+		sw.log.Info("PodNotRestarted", "secret", secret.Namespace+"/"+secret.Name, "workload", w, "stale", len(stale[w]))
+	}
+}
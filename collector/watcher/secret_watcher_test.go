@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+func testSecret(rv, password string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-credentials", Namespace: "prod", ResourceVersion: rv},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{"username": []byte("app"), "password": []byte(password)},
+	}
+}
+
+// unkeyedHash is the hash an attacker could compute for a guessed value.
+func unkeyedHash(secret *corev1.Secret) string {
+	h := sha256.New()
+	for _, k := range secretKeys(secret) {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write(secret.Data[k])
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+func TestSecretHashIsKeyed(t *testing.T) {
+	secret := testSecret("1", "hunter2")
+	a := NewSecretWatcher(nil, "prod", Selectors{}, emitter.NewMemoryEmitter(), discardLogger())
+	b := NewSecretWatcher(nil, "prod", Selectors{}, emitter.NewMemoryEmitter(), discardLogger())
+	if a.contentHash(secret) == unkeyedHash(secret) {
+		t.Fatal("content hash is the unkeyed SHA-256 of the Secret")
+	}
+	if a.contentHash(secret) == b.contentHash(secret) {
+		t.Error("two watchers drew the same random key")
+	}
+	a.UseHashKey([]byte("shared"))
+	b.UseHashKey([]byte("shared"))
+	if a.contentHash(secret) != b.contentHash(secret) {
+		t.Error("watchers with the same key hash the same Secret differently")
+	}
+	if a.contentHash(secret) == a.contentHash(testSecret("2", "hunter3")) {
+		t.Error("a changed value kept its hash")
+	}
+	before := a.hashKey
+	a.UseHashKey(nil)
+	if string(a.hashKey) != string(before) {
+		t.Error("an empty key replaced the key in use")
+	}
+}
+
+func TestSecretChangedCarriesNoValue(t *testing.T) {
+	e := emitter.NewMemoryEmitter()
+	sw := NewSecretWatcher(fake.NewSimpleClientset(), "prod", Selectors{}, e, discardLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	before, after := testSecret("1", "hunter2"), testSecret("2", "hunter3")
+	sw.handleEvent(ctx, watch.Event{Type: watch.Added, Object: before})
+	sw.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: after})
+	cancel()
+	sw.consumers.Wait()
+	got := eventsOfType(e, "SecretChanged")
+	if len(got) != 1 {
+		t.Fatalf("got %d SecretChanged events, want 1", len(got))
+	}
+	p := got[0].Payload
+	if keys := p["changed_keys"].([]string); len(keys) != 1 || keys[0] != "password" {
+		t.Errorf("changed_keys = %q, want [password]", keys)
+	}
+	for _, h := range []interface{}{p["old_content_hash"], p["new_content_hash"]} {
+		if h == unkeyedHash(before) || h == unkeyedHash(after) {
+			t.Errorf("payload carries the unkeyed hash %v", h)
+		}
+	}
+	for k, v := range p {
+		if s, ok := v.(string); ok && (s == "hunter2" || s == "hunter3") {
+			t.Errorf("payload %s carries the value", k)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Selectors scopes a watcher's List and Watch calls. The zero value
+// selects everything.
+type Selectors struct {
+	Label string
+	Field string
+}
+
+// ParseSelectors checks selector syntax and returns them in canonical form.
+func ParseSelectors(label, field string) (Selectors, error) {
+	l, err := labels.Parse(label)
+	if err != nil {
+		return Selectors{}, fmt.Errorf("invalid label selector %q: %w", label, err)
+	}
+	f, err := fields.ParseSelector(field)
+	if err != nil {
+		return Selectors{}, fmt.Errorf("invalid field selector %q: %w", field, err)
+	}
+	return Selectors{Label: l.String(), Field: f.String()}, nil
+}
+
+func (s Selectors) apply(opts *metav1.ListOptions) {
+	opts.LabelSelector = s.Label
+	opts.FieldSelector = s.Field
+}
+
+func (s Selectors) listOptions() metav1.ListOptions {
+	var opts metav1.ListOptions
+	s.apply(&opts)
+	return opts
+}
+
+// ValidateSelectors asks the API server to evaluate each selector against
+// the resource it will be used on. Field selectors are resource-specific
+// (status.phase exists for pods only), so a syntactically valid selector
+// can still be rejected; this surfaces that at startup instead of as a
+// watch failure later.
+func ValidateSelectors(ctx context.Context, client kubernetes.Interface, namespace string, pods, objects Selectors) error {
+	opts := pods.listOptions()
+	opts.Limit = 1
+	if _, err := client.CoreV1().Pods(namespace).List(ctx, opts); err != nil {
+		return fmt.Errorf("pod selectors rejected: %w", err)
+	}
+	opts = objects.listOptions()
+	opts.Limit = 1
+	if _, err := client.CoreV1().ConfigMaps(namespace).List(ctx, opts); err != nil {
+		return fmt.Errorf("configmap selectors rejected: %w", err)
+	}
+	if _, err := client.AppsV1().Deployments(namespace).List(ctx, opts); err != nil {
+		return fmt.Errorf("deployment selectors rejected: %w", err)
+	}
+	return nil
+}
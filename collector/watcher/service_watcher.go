@@ -0,0 +1,204 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// maxListedPods caps the pod names a ServiceChanged event lists per side
+// of a selector change; the counts are always complete.
+const maxListedPods = 50
+
+// ServiceWatcher records Service changes that reroute traffic without any
+// pod restarting: a selector that no longer matches the pods behind it, a
+// port or targetPort renumbered, the type switched, the Service deleted.
+// ServiceChanged diffs the selector and ports. A selector change lists the
+// pods the Service matches now and no longer matches, the trigger of P009.
+type ServiceWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+
+	// services holds the last-seen version of each Service. Only the
+	// informer's handler goroutine touches it.
+	services map[string]serviceVersion
+}
+
+type serviceVersion struct {
+	selector map[string]string
+	ports    []string
+	typ      corev1.ServiceType
+}
+
+func NewServiceWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *ServiceWatcher {
+	return &ServiceWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", "service_watcher"), services: map[string]serviceVersion{}}
+}
+
+func (sw *ServiceWatcher) Watch(ctx context.Context) error {
+	sw.log.Info("starting", "namespace", sw.namespace)
+	// As for ConfigMaps, the initial list primes services.
+	factory := newInformerFactory(sw.client, sw.namespace, sw.selectors)
+	informer := factory.Core().V1().Services().Informer()
+	if _, err := informer.AddEventHandler(eventHandler(func(event watch.Event) {
+		sw.handleEvent(ctx, event)
+	})); err != nil {
+		return fmt.Errorf("service informer registration failed: %w", err)
+	}
+	return runInformer(ctx, sw.log, "service_watcher", sw.namespace, sw.emitter, factory, informer)
+}
+
+func (sw *ServiceWatcher) handleEvent(ctx context.Context, event watch.Event) {
+	svc, ok := event.Object.(*corev1.Service)
+	if !ok {
+		return
+	}
+	key := svc.Namespace + "/" + svc.Name
+	cur := serviceVersion{selector: svc.Spec.Selector, ports: servicePorts(svc), typ: svc.Spec.Type}
+	switch event.Type {
+	case watch.Added:
+		sw.services[key] = cur
+	case watch.Modified:
+		prev, known := sw.services[key]
+		sw.services[key] = cur
+		if !known {
+			return
+		}
+		selectorChanged := !maps.Equal(prev.selector, cur.selector)
+		portsAdded, portsRemoved := diffStrings(prev.ports, cur.ports)
+		if !selectorChanged && len(portsAdded) == 0 && len(portsRemoved) == 0 && prev.typ == cur.typ {
+			return
+		}
+		sw.captureChange(ctx, svc, prev, cur, selectorChanged, portsAdded, portsRemoved, event.Type)
+	case watch.Deleted:
+		prev, known := sw.services[key]
+		delete(sw.services, key)
+		if known {
+			sw.captureChange(ctx, svc, prev, serviceVersion{}, false, nil, prev.ports, event.Type)
+		}
+	}
+}
+
+// captureChange emits ServiceChanged. cur is the zero value on deletion.
+func (sw *ServiceWatcher) captureChange(ctx context.Context, svc *corev1.Service, prev, cur serviceVersion, selectorChanged bool, portsAdded, portsRemoved []string, eventType watch.EventType) {
+	payload := map[string]interface{}{
+		"service_name":     svc.Name,
+		"service_type":     string(cur.typ),
+		"old_service_type": string(prev.typ),
+		"selector_changed": selectorChanged,
+		"old_selector":     prev.selector,
+		"new_selector":     cur.selector,
+		"ports":            cur.ports,
+		"ports_added":      portsAdded,
+		"ports_removed":    portsRemoved,
+		"event_type":       string(eventType),
+		"resource_version": svc.ResourceVersion,
+	}
+	patternID := ""
+	if selectorChanged {
+		patternID = patterns.PatternServiceSelector
+		nowMatched, noLongerMatched, err := sw.matchedPods(ctx, svc.Namespace, prev.selector, cur.selector)
+		if err != nil {
+			reportError(sw.emitter, sw.log, "service_watcher", svc.Namespace, "list pods", svc.Name, err)
+		} else {
+			payload["pods_now_matched_count"] = len(nowMatched)
+			payload["pods_now_matched"] = nowMatched[:min(len(nowMatched), maxListedPods)]
+			payload["pods_no_longer_matched_count"] = len(noLongerMatched)
+			payload["pods_no_longer_matched"] = noLongerMatched[:min(len(noLongerMatched), maxListedPods)]
+		}
+	}
+	sw.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: lastChanged(svc.ObjectMeta),
+		EventType:  "ServiceChanged",
+		PatternID:  patternID,
+		Namespace:  svc.Namespace,
+		Payload:    payload,
+	})
+	sw.log.Info("Service changed", "service", svc.Namespace+"/"+svc.Name, "selector_changed", selectorChanged,
+		"ports_added", len(portsAdded), "ports_removed", len(portsRemoved))
+}
+
+// matchedPods returns the names of the running pods matched by cur but not
+// by prev, and by prev but not by cur. An empty selector matches no pods:
+// the Service's endpoints are then managed by hand.
+func (sw *ServiceWatcher) matchedPods(ctx context.Context, namespace string, prev, cur map[string]string) (nowMatched, noLongerMatched []string, err error) {
+	before, err := sw.podsMatching(ctx, namespace, prev)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := sw.podsMatching(ctx, namespace, cur)
+	if err != nil {
+		return nil, nil, err
+	}
+	nowMatched, noLongerMatched = diffStrings(before, after)
+	return nowMatched, noLongerMatched, nil
+}
+
+func (sw *ServiceWatcher) podsMatching(ctx context.Context, namespace string, selector map[string]string) ([]string, error) {
+	if len(selector) == 0 {
+		return nil, nil
+	}
+	pods, err := sw.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector).String(),
+		FieldSelector: "status.phase=Running",
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(pods.Items))
+	for _, p := range pods.Items {
+		names = append(names, p.Name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// servicePorts renders a Service's ports as "name:port/protocol->targetPort",
+// sorted.
+func servicePorts(svc *corev1.Service) []string {
+	ports := make([]string, 0, len(svc.Spec.Ports))
+	for _, p := range svc.Spec.Ports {
+		s := fmt.Sprintf("%d/%s->%s", p.Port, p.Protocol, p.TargetPort.String())
+		if p.Name != "" {
+			s = p.Name + ":" + s
+		}
+		if p.NodePort != 0 {
+			s += fmt.Sprintf(" (nodePort %d)", p.NodePort)
+		}
+		ports = append(ports, s)
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// diffStrings returns the elements of the sorted list cur missing from the
+// sorted list prev, and those of prev missing from cur.
+func diffStrings(prev, cur []string) (added, removed []string) {
+	for _, s := range cur {
+		if _, found := slices.BinarySearch(prev, s); !found {
+			added = append(added, s)
+		}
+	}
+	for _, s := range prev {
+		if _, found := slices.BinarySearch(cur, s); !found {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
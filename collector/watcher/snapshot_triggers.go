@@ -0,0 +1,83 @@
+package watcher
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// The events that can take a Snapshot of the state they happened in.
+const (
+	// SnapshotOnPodDeleted snapshots a pod as it is deleted or evicted,
+	// the last state it is seen in.
+	SnapshotOnPodDeleted = "PodDeleted"
+	// SnapshotOnOOMKill snapshots a pod as one of its containers is
+	// OOMKilled.
+	SnapshotOnOOMKill = "OOMKill"
+	// SnapshotOnCrashLoopBackOff snapshots a pod each time
+	// CrashLoopBackOff is emitted for one of its containers.
+	SnapshotOnCrashLoopBackOff = "CrashLoopBackOff"
+	// SnapshotOnNodeMemoryPressure snapshots a node each time
+	// NodeMemoryPressure is emitted for it.
+	SnapshotOnNodeMemoryPressure = "NodeMemoryPressure"
+)
+
+// DefaultSnapshotTriggers is the events that take a snapshot unless
+// configured otherwise.
+const DefaultSnapshotTriggers = SnapshotOnPodDeleted
+
+var snapshotTriggerNames = []string{SnapshotOnPodDeleted, SnapshotOnOOMKill, SnapshotOnCrashLoopBackOff, SnapshotOnNodeMemoryPressure}
+
+// SnapshotTriggers is the set of events that take a snapshot, beside the
+// event itself, of the state of the pod or node at the moment it
+// happened, before it changes further. The snapshot names the event in
+// its trigger_event_id.
+type SnapshotTriggers map[string]bool
+
+// ParseSnapshotTriggers checks that every name is a snapshot trigger.
+func ParseSnapshotTriggers(names []string) (SnapshotTriggers, error) {
+	t := SnapshotTriggers{}
+	for _, name := range names {
+		if !slices.Contains(snapshotTriggerNames, name) {
+			return nil, fmt.Errorf("unknown snapshot trigger %q (want %s)", name, strings.Join(snapshotTriggerNames, ", "))
+		}
+		t[name] = true
+	}
+	return t, nil
+}
+
+// SnapshotOn sets the events that snapshot the pod they concern; by
+// default only its deletion does.
+func (pw *PodWatcher) SnapshotOn(t SnapshotTriggers) {
+	pw.snapshotTriggers = t
+}
+
+// SnapshotOn sets whether NodeMemoryPressure snapshots the node.
+func (nw *NodeWatcher) SnapshotOn(t SnapshotTriggers) {
+	nw.snapshotTriggers = t
+}
+
+// captureNodeSnapshot emits the state of node as of trigger, the event
+// with ID eventID.
+func (nw *NodeWatcher) captureNodeSnapshot(node *corev1.Node, s *NodeSnapshot, trigger, eventID string) {
+	nw.emitter.EmitSnapshot(emitter.Snapshot{
+		ID:           emitter.NewID(),
+		Timestamp:    time.Now(),
+		ObjectKind:   "Node",
+		ObjectName:   node.Name,
+		TriggerEvent: trigger,
+		State: map[string]interface{}{
+			"uid":              string(node.UID),
+			"trigger_event_id": eventID,
+			"node_snapshot":    s,
+			"labels":           node.Labels,
+			"taints":           node.Spec.Taints,
+			"unschedulable":    node.Spec.Unschedulable,
+		},
+	})
+}
@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultTerminationHistory is how many terminations are kept per container
+// for the recent_terminations payload field.
+const DefaultTerminationHistory = 10
+
+// pastTermination is one termination in a container's history.
+type pastTermination struct {
+	reason     string
+	exitCode   int32
+	finishedAt time.Time
+}
+
+// TrackTerminations sets how many of a container's terminations are kept
+// and attached, as recent_terminations, to its OOMKill and
+// ContainerTerminated events. 0 disables the history.
+func (pw *PodWatcher) TrackTerminations(depth int) {
+	pw.historyDepth = depth
+}
+
+// recordTermination adds term to the container's history, oldest first,
+// unless it is already there: the same termination is reported in State
+// and then in LastTerminationState, and again on every pod update in
+// between. Only the last historyDepth terminations are kept.
+func (pw *PodWatcher) recordTermination(pod *corev1.Pod, container string, term *corev1.ContainerStateTerminated) {
+	if pw.historyDepth <= 0 {
+		return
+	}
+	byContainer := pw.history[pod.UID]
+	if byContainer == nil {
+		byContainer = map[string][]pastTermination{}
+		pw.history[pod.UID] = byContainer
+	}
+	past := byContainer[container]
+	finished := term.FinishedAt.Time
+	i, found := slices.BinarySearchFunc(past, finished, func(t pastTermination, at time.Time) int {
+		return t.finishedAt.Compare(at)
+	})
+	if found {
+		return
+	}
+	past = slices.Insert(past, i, pastTermination{reason: term.Reason, exitCode: term.ExitCode, finishedAt: finished})
+	if len(past) > pw.historyDepth {
+		past = past[len(past)-pw.historyDepth:]
+	}
+	byContainer[container] = past
+}
+
+// terminationTrend describes the container's recorded terminations, the
+// current one included: recent_terminations, oldest first, each with the
+// seconds since the one before it, and mean_time_between_failures_seconds,
+// nil until a second termination is recorded. A container that keeps
+// getting OOMKilled at a steady interval is outgrowing its limit, not
+// hitting a one-off spike.
+func (pw *PodWatcher) terminationTrend(pod *corev1.Pod, container string) map[string]interface{} {
+	past := pw.history[pod.UID][container]
+	recent := make([]map[string]interface{}, len(past))
+	for i, t := range past {
+		recent[i] = map[string]interface{}{
+			"reason":           t.reason,
+			"exit_code":        t.exitCode,
+			"exit_code_class":  classifyExitCode(t.exitCode, t.reason),
+			"finished_at":      t.finishedAt,
+			"interval_seconds": nil,
+		}
+		if i > 0 {
+			recent[i]["interval_seconds"] = t.finishedAt.Sub(past[i-1].finishedAt).Seconds()
+		}
+	}
+	var mtbf interface{}
+	if len(past) > 1 {
+		mtbf = past[len(past)-1].finishedAt.Sub(past[0].finishedAt).Seconds() / float64(len(past)-1)
+	}
+	return map[string]interface{}{
+		"recent_terminations":                recent,
+		"mean_time_between_failures_seconds": mtbf,
+	}
+}
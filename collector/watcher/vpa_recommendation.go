@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+	"github.com/opscart/k8s-causal-memory/collector/patterns"
+)
+
+// DefaultVPAHeadroom is the factor applied to a container's peak memory
+// usage for the limit VPARecommendation suggests.
+const DefaultVPAHeadroom = 1.2
+
+// vpaGrowthFactor is the factor applied to a container's current limit
+// when no usage above it was sampled.
+const vpaGrowthFactor = 1.5
+
+// vpaMinOOMKills is how many OOMKills of one container, among its
+// recorded terminations, make it a repeat OOMKiller.
+const vpaMinOOMKills = 2
+
+// RecommendLimits makes the pod watcher emit VPARecommendation for a
+// container OOMKilled repeatedly: a suggested memory limit, the current
+// limit and request, and how the suggestion was computed. With a memory
+// sampler the suggestion is the peak sampled usage times headroom; a
+// sample is taken every interval and rarely catches the spike that got
+// the container killed, so when that is not above the current limit, or
+// nothing was sampled, the current limit grows by half instead. OOMKills
+// are counted from the termination history, so it needs TrackTerminations.
+// A container is recommended for once per pod, and again only if a later
+// OOMKill raises the suggestion. headroom <= 0 disables it.
+func (pw *PodWatcher) RecommendLimits(headroom float64) {
+	pw.vpaHeadroom = headroom
+}
+
+// limitRecommendation is the suggested memory limit for a container and
+// how it was arrived at.
+type limitRecommendation struct {
+	bytes     int64
+	basis     string // "peak_usage" or "limit_growth"
+	peak      int64  // 0 unless sampled
+	rationale string
+}
+
+// recommendLimit emits VPARecommendation for the container if it is a
+// repeat OOMKiller. oomKillID is the ID of the OOMKill event just emitted.
+func (pw *PodWatcher) recommendLimit(pod *corev1.Pod, cs corev1.ContainerStatus, containerType, oomKillID string) {
+	kills := 0
+	for _, t := range pw.history[pod.UID][cs.Name] {
+		if t.reason == "OOMKilled" {
+			kills++
+		}
+	}
+	if kills < vpaMinOOMKills {
+		return
+	}
+	res, _ := containerResources(pod, cs.Name)
+	limit := res.Limits.Memory().Value()
+	rec, ok := pw.suggestLimit(pod, cs.Name, limit, kills)
+	if !ok {
+		return
+	}
+	byContainer := pw.recommended[pod.UID]
+	if byContainer == nil {
+		byContainer = map[string]int64{}
+		pw.recommended[pod.UID] = byContainer
+	}
+	if rec.bytes <= byContainer[cs.Name] {
+		return
+	}
+	byContainer[cs.Name] = rec.bytes
+
+	var currentLimit, currentRequest, peak interface{}
+	if limit > 0 {
+		currentLimit = limit
+	}
+	if request := res.Requests.Memory().Value(); request > 0 {
+		currentRequest = request
+	}
+	if rec.peak > 0 {
+		peak = rec.peak
+	}
+	payload := map[string]interface{}{
+		"container_name":                 cs.Name,
+		"container_type":                 containerType,
+		"oomkill_count":                  kills,
+		"oomkill_event_id":               oomKillID,
+		"current_memory_limit_bytes":     currentLimit,
+		"current_memory_request_bytes":   currentRequest,
+		"suggested_memory_limit_bytes":   rec.bytes,
+		"suggested_memory_limit":         resource.NewQuantity(rec.bytes, resource.BinarySI).String(),
+		"basis":                          rec.basis,
+		"peak_memory_bytes":              peak,
+		"headroom_factor":                pw.vpaHeadroom,
+		"growth_factor":                  vpaGrowthFactor,
+		"rationale":                      rec.rationale,
+		"suggested_vs_current_limit_pct": nil,
+	}
+	if limit > 0 {
+		payload["suggested_vs_current_limit_pct"] = math.Round(float64(rec.bytes-limit)/float64(limit)*1e3) / 10
+	}
+	pw.owners.annotate(payload, pod)
+	pw.emitter.Emit(emitter.CausalEvent{
+		ID:        emitter.NewID(),
+		Timestamp: time.Now(),
+		EventType: "VPARecommendation",
+		PatternID: patterns.PatternOOMKill,
+		PodName:   pod.Name,
+		Namespace: pod.Namespace,
+		NodeName:  pod.Spec.NodeName,
+		PodUID:    string(pod.UID),
+		Payload:   payload,
+	})
+	pw.log.Info("VPARecommendation", "pod", pod.Name, "namespace", pod.Namespace, "container", cs.Name,
+		"suggested", payload["suggested_memory_limit"], "basis", rec.basis)
+}
+
+// suggestLimit computes the limit to suggest for a container with the given
+// current limit, 0 if it has none. It reports false when there is nothing
+// to base one on: no limit and no usage sampled.
+func (pw *PodWatcher) suggestLimit(pod *corev1.Pod, container string, limit int64, kills int) (limitRecommendation, bool) {
+	var peak int64
+	for _, s := range pw.sampler.Trajectory(pod.Namespace, pod.Name, container) {
+		peak = max(peak, s.MemoryBytes)
+	}
+	fromPeak := roundUpMiB(float64(peak) * pw.vpaHeadroom)
+	switch {
+	case peak > 0 && fromPeak > limit:
+		return limitRecommendation{bytes: fromPeak, basis: "peak_usage", peak: peak, rationale: fmt.Sprintf(
+			"OOMKilled %d times; peak sampled usage %s times headroom %.2f",
+			kills, resource.NewQuantity(peak, resource.BinarySI), pw.vpaHeadroom)}, true
+	case limit > 0:
+		why := "no memory usage sampled"
+		if peak > 0 {
+			why = fmt.Sprintf("peak sampled usage %s missed the spikes", resource.NewQuantity(peak, resource.BinarySI))
+		}
+		return limitRecommendation{bytes: roundUpMiB(float64(limit) * vpaGrowthFactor), basis: "limit_growth", peak: peak, rationale: fmt.Sprintf(
+			"OOMKilled %d times at limit %s; %s, so the limit grows by %.2f",
+			kills, resource.NewQuantity(limit, resource.BinarySI), why, vpaGrowthFactor)}, true
+	}
+	return limitRecommendation{}, false
+}
+
+// roundUpMiB rounds b up to a whole mebibyte, as limits are usually set.
+func roundUpMiB(b float64) int64 {
+	const mib = 1 << 20
+	return int64(math.Ceil(b/mib)) * mib
+}
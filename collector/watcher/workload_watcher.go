@@ -0,0 +1,218 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/opscart/k8s-causal-memory/collector/emitter"
+)
+
+// WorkloadWatcher records StatefulSet and DaemonSet rollouts as
+// WorkloadRolledOut events, the counterpart of DeploymentRolledOut for the
+// other pod controllers. As with deployments, a rollout is a change in the
+// pod template hash; scaling alone emits nothing.
+type WorkloadWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	selectors Selectors
+	emitter   emitter.Emitter
+	log       *slog.Logger
+	kind      workloadKind
+
+	// templateCache holds the last-seen pod template per workload.
+	// Key: "<namespace>/<name>". Only the informer's handler goroutine
+	// touches it.
+	templateCache map[string]workloadTemplate
+}
+
+// workloadKind adapts one controller type to the generic watcher.
+type workloadKind struct {
+	kind     string // "StatefulSet", "DaemonSet"
+	name     string // watcher name used in logs and health probes
+	informer func(f informers.SharedInformerFactory) cache.SharedIndexInformer
+	state    func(obj runtime.Object) (workloadState, bool)
+}
+
+// workloadState is the controller-independent view captured on rollout.
+type workloadState struct {
+	meta           metav1.ObjectMeta
+	template       corev1.PodTemplateSpec
+	revision       string
+	selector       *metav1.LabelSelector
+	strategy       string
+	strategyParams map[string]interface{}
+	desired        int32
+	ready          int32
+	updated        int32
+	partitioned    bool
+}
+
+func NewStatefulSetWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *WorkloadWatcher {
+	return newWorkloadWatcher(client, namespace, sel, e, log, statefulSetKind)
+}
+
+func NewDaemonSetWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger) *WorkloadWatcher {
+	return newWorkloadWatcher(client, namespace, sel, e, log, daemonSetKind)
+}
+
+func newWorkloadWatcher(client kubernetes.Interface, namespace string, sel Selectors, e emitter.Emitter, log *slog.Logger, kind workloadKind) *WorkloadWatcher {
+	return &WorkloadWatcher{client: client, namespace: namespace, selectors: sel, emitter: e, log: log.With("component", kind.name), kind: kind, templateCache: map[string]workloadTemplate{}}
+}
+
+func (ww *WorkloadWatcher) Watch(ctx context.Context) error {
+	ww.log.Info("starting", "namespace", ww.namespace)
+	// The informer's initial list delivers every workload as an Add, which
+	// fills templateCache before any Modified event is compared against it.
+	factory := newInformerFactory(ww.client, ww.namespace, ww.selectors)
+	informer := ww.kind.informer(factory)
+	if _, err := informer.AddEventHandler(eventHandler(ww.handleEvent)); err != nil {
+		return fmt.Errorf("%s informer registration failed: %w", strings.ToLower(ww.kind.kind), err)
+	}
+	return runInformer(ctx, ww.log, ww.kind.name, ww.namespace, ww.emitter, factory, informer)
+}
+
+func (ww *WorkloadWatcher) handleEvent(event watch.Event) {
+	st, ok := ww.kind.state(event.Object)
+	if !ok {
+		return
+	}
+	key := st.meta.Namespace + "/" + st.meta.Name
+	current := podTemplateOf(st.template, st.revision)
+	switch event.Type {
+	case watch.Added:
+		if _, known := ww.templateCache[key]; !known {
+			ww.templateCache[key] = current
+		}
+	case watch.Modified:
+		previous, known := ww.templateCache[key]
+		if known && previous.hash == current.hash {
+			return
+		}
+		ww.captureRollout(st, previous, current)
+		emitResourceChanges(ww.emitter, ww.log, ww.kind.kind, st.meta, previous, current)
+		emitProbeChanges(ww.emitter, ww.log, ww.kind.kind, st.meta, previous, current)
+		ww.templateCache[key] = current
+	case watch.Deleted:
+		delete(ww.templateCache, key)
+	}
+}
+
+func (ww *WorkloadWatcher) captureRollout(st workloadState, previous, current workloadTemplate) {
+	ww.emitter.Emit(emitter.CausalEvent{
+		ID:         emitter.NewID(),
+		Timestamp:  time.Now(),
+		OccurredAt: lastChanged(st.meta),
+		EventType:  "WorkloadRolledOut",
+		Namespace:  st.meta.Namespace,
+		Payload: map[string]interface{}{
+			"workload_kind":          ww.kind.kind,
+			"workload_name":          st.meta.Name,
+			"namespace":              st.meta.Namespace,
+			"resource_version":       st.meta.ResourceVersion,
+			"generation":             st.meta.Generation,
+			"previous_revision":      previous.revision,
+			"revision":               current.revision,
+			"old_template_hash":      previous.hash,
+			"new_template_hash":      current.hash,
+			"desired_replicas":       st.desired,
+			"ready_replicas":         st.ready,
+			"updated_replicas":       st.updated,
+			"image_changes":          imageChanges(previous.images, current.images),
+			"strategy":               st.strategy,
+			"strategy_params":        st.strategyParams,
+			"partitioned":            st.partitioned,
+			"selector":               metav1.FormatLabelSelector(st.selector),
+			"config_references":      templateConfigReferences(st.template.Spec),
+			"previous_template_seen": previous.hash != "",
+		},
+	})
+	ww.log.Info("rollout", "workload", ww.kind.kind+"/"+st.meta.Name, "namespace", st.meta.Namespace,
+		"strategy", st.strategy, "partitioned", st.partitioned)
+}
+
+var statefulSetKind = workloadKind{
+	kind: "StatefulSet",
+	name: "statefulset_watcher",
+	informer: func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Apps().V1().StatefulSets().Informer()
+	},
+	state: func(obj runtime.Object) (workloadState, bool) {
+		s, ok := obj.(*appsv1.StatefulSet)
+		if !ok {
+			return workloadState{}, false
+		}
+		st := workloadState{
+			meta:           s.ObjectMeta,
+			template:       s.Spec.Template,
+			revision:       s.Status.UpdateRevision,
+			selector:       s.Spec.Selector,
+			strategy:       string(s.Spec.UpdateStrategy.Type),
+			strategyParams: map[string]interface{}{},
+			desired:        1,
+			ready:          s.Status.ReadyReplicas,
+			updated:        s.Status.UpdatedReplicas,
+		}
+		if s.Spec.Replicas != nil {
+			st.desired = *s.Spec.Replicas
+		}
+		// A partition > 0 leaves ordinals below it on the old revision:
+		// the "only some replicas are broken" case.
+		if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil {
+			if ru.Partition != nil {
+				st.strategyParams["partition"] = *ru.Partition
+				st.partitioned = *ru.Partition > 0
+			}
+			if ru.MaxUnavailable != nil {
+				st.strategyParams["max_unavailable"] = ru.MaxUnavailable.String()
+			}
+		}
+		st.strategyParams["pod_management_policy"] = string(s.Spec.PodManagementPolicy)
+		return st, true
+	},
+}
+
+var daemonSetKind = workloadKind{
+	kind: "DaemonSet",
+	name: "daemonset_watcher",
+	informer: func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Apps().V1().DaemonSets().Informer()
+	},
+	state: func(obj runtime.Object) (workloadState, bool) {
+		d, ok := obj.(*appsv1.DaemonSet)
+		if !ok {
+			return workloadState{}, false
+		}
+		st := workloadState{
+			meta:           d.ObjectMeta,
+			template:       d.Spec.Template,
+			revision:       d.Annotations["deprecated.daemonset.template.generation"],
+			selector:       d.Spec.Selector,
+			strategy:       string(d.Spec.UpdateStrategy.Type),
+			strategyParams: map[string]interface{}{},
+			desired:        d.Status.DesiredNumberScheduled,
+			ready:          d.Status.NumberReady,
+			updated:        d.Status.UpdatedNumberScheduled,
+		}
+		if ru := d.Spec.UpdateStrategy.RollingUpdate; ru != nil {
+			if ru.MaxUnavailable != nil {
+				st.strategyParams["max_unavailable"] = ru.MaxUnavailable.String()
+			}
+			if ru.MaxSurge != nil {
+				st.strategyParams["max_surge"] = ru.MaxSurge.String()
+			}
+		}
+		return st, true
+	},
+}
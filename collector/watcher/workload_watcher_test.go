@@ -0,0 +1,69 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func workloadTemplateSpec(image string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Image: image}}}}
+}
+
+func testStatefulSet(rv, image string, ready int32) runtime.Object {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "prod", UID: "uid-sts", ResourceVersion: rv},
+		Spec:       appsv1.StatefulSetSpec{Template: workloadTemplateSpec(image)},
+		Status:     appsv1.StatefulSetStatus{ReadyReplicas: ready},
+	}
+}
+
+func testDaemonSet(rv, image string, ready int32) runtime.Object {
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "prod", UID: "uid-ds", ResourceVersion: rv},
+		Spec:       appsv1.DaemonSetSpec{Template: workloadTemplateSpec(image)},
+		Status:     appsv1.DaemonSetStatus{NumberReady: ready},
+	}
+}
+
+// The informer's list is the baseline: a status update to a listed
+// workload is not a rollout, a template change is one against the listed
+// template.
+func TestWorkloadRolloutAgainstListedTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		kind     string
+		resource string
+		obj      func(rv, image string, ready int32) runtime.Object
+		watcher  func(h *harness) *WorkloadWatcher
+	}{
+		{"StatefulSet", "statefulsets", testStatefulSet, func(h *harness) *WorkloadWatcher {
+			return NewStatefulSetWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger())
+		}},
+		{"DaemonSet", "daemonsets", testDaemonSet, func(h *harness) *WorkloadWatcher {
+			return NewDaemonSetWatcher(h.client, "prod", Selectors{}, h.emitter, discardLogger())
+		}},
+	} {
+		t.Run(tc.kind, func(t *testing.T) {
+			h := newHarness(t, tc.obj("100", "db:15", 1))
+			h.run(tc.resource, tc.watcher(h).Watch)
+
+			h.Modify(tc.obj("101", "db:15", 2))
+			h.Modify(tc.obj("102", "db:16", 2))
+			h.waitForEvents(1)
+			time.Sleep(100 * time.Millisecond)
+
+			events := h.emitter.Events()
+			if len(events) != 1 || events[0].EventType != "WorkloadRolledOut" {
+				t.Fatalf("got %d events, want the one WorkloadRolledOut", len(events))
+			}
+			p := events[0].Payload
+			if p["workload_kind"] != tc.kind || p["old_template_hash"] == "" || p["previous_template_seen"] != true {
+				t.Errorf("rollout = %v, want a %s rollout from the listed template", p, tc.kind)
+			}
+		})
+	}
+}
@@ -24,10 +24,38 @@ def get_db(db_path=DB_PATH):
     conn.execute("PRAGMA foreign_keys=ON")
     schema = (Path(__file__).parent / "schema.sql").read_text()
     conn.executescript(schema)
+    _migrate(conn)
     conn.commit()
     return conn
 
 
+# Columns added to schema.sql after its tables were first created, with the
+# index and the backfill of existing rows each needs. A database built by an
+# older ingest.py gains them on open, as the collector's SQLite emitter
+# migrates its own.
+_ADDED_COLUMNS = [
+    ("events", "correlation_id", "TEXT",
+     "CREATE INDEX IF NOT EXISTS idx_events_correlation ON events(correlation_id)", None),
+    ("events", "occurred_at", "DATETIME",
+     "CREATE INDEX IF NOT EXISTS idx_events_occurred ON events(occurred_at)",
+     "UPDATE events SET occurred_at = timestamp WHERE occurred_at IS NULL"),
+    ("events", "cluster", "TEXT",
+     "CREATE INDEX IF NOT EXISTS idx_events_cluster ON events(cluster)", None),
+    ("snapshots", "cluster", "TEXT", None, None),
+]
+
+
+def _migrate(conn):
+    for table, column, decl, index, backfill in _ADDED_COLUMNS:
+        columns = {r["name"] for r in conn.execute(f"PRAGMA table_info({table})")}
+        if column not in columns:
+            conn.execute(f"ALTER TABLE {table} ADD COLUMN {column} {decl}")
+            if backfill:
+                conn.execute(backfill)
+        if index:
+            conn.execute(index)
+
+
 def ingest_events(conn, path):
     p = Path(path)
     if not p.exists():
@@ -41,6 +69,8 @@ def ingest_events(conn, path):
                 continue
             try:
                 event = json.loads(line)
+                if _is_header(event):
+                    continue
                 _insert_event(conn, event)
                 _build_edges(conn, event)
                 n += 1
@@ -64,6 +94,8 @@ def ingest_snapshots(conn, path):
                 continue
             try:
                 snap = json.loads(line)
+                if _is_header(snap):
+                    continue
                 _insert_snapshot(conn, snap)
                 n += 1
             except (json.JSONDecodeError, sqlite3.IntegrityError):
@@ -73,24 +105,38 @@ def ingest_snapshots(conn, path):
     return n
 
 
+def _is_header(record):
+    """The collector starts each JSONL file with a schema header line."""
+    return record.get("record") == "header"
+
+
 def _insert_event(conn, e):
     conn.execute("""
         INSERT OR IGNORE INTO events
-            (id, timestamp, event_type, pattern_id, pod_name, namespace, node_name, pod_uid, payload)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+            (id, timestamp, event_type, pattern_id, pod_name, namespace, node_name, pod_uid, correlation_id, occurred_at, cluster, payload)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
     """, (e["id"], e["timestamp"], e["event_type"], e.get("pattern_id", ""),
           e.get("pod_name", ""), e.get("namespace", ""), e.get("node_name", ""),
-          e.get("pod_uid", ""), json.dumps(e.get("payload", {}))))
+          e.get("pod_uid", ""), e.get("correlation_id", ""), _occurred_at(e), e.get("cluster", ""), json.dumps(e.get("payload", {}))))
     _insert_extended(conn, e)
 
 
+def _occurred_at(e):
+    """When the event happened; records from before occurred_at, or with it
+    unset (Go's zero time), fall back to when it was observed."""
+    occurred = e.get("occurred_at", "")
+    if not occurred or occurred.startswith("0001-01-01"):
+        return e["timestamp"]
+    return occurred
+
+
 def _insert_snapshot(conn, s):
     conn.execute("""
         INSERT OR IGNORE INTO snapshots
-            (id, timestamp, object_kind, object_name, namespace, trigger_event, state)
-        VALUES (?, ?, ?, ?, ?, ?, ?)
+            (id, timestamp, object_kind, object_name, namespace, trigger_event, cluster, state)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
     """, (s["id"], s["timestamp"], s["object_kind"], s["object_name"],
-          s.get("namespace", ""), s.get("trigger_event", ""), json.dumps(s.get("state", {}))))
+          s.get("namespace", ""), s.get("trigger_event", ""), s.get("cluster", ""), json.dumps(s.get("state", {}))))
 
 
 def _build_edges(conn, event):
@@ -148,6 +194,8 @@ def watch_and_ingest(conn, output_dir):
                     continue
                 try:
                     ev = json.loads(line)
+                    if _is_header(ev):
+                        continue
                     _insert_event(conn, ev)
                     _build_edges(conn, ev)
                 except (json.JSONDecodeError, sqlite3.IntegrityError):
@@ -164,7 +212,10 @@ def watch_and_ingest(conn, output_dir):
                 if not line:
                     continue
                 try:
-                    _insert_snapshot(conn, json.loads(line))
+                    snap = json.loads(line)
+                    if _is_header(snap):
+                        continue
+                    _insert_snapshot(conn, snap)
                 except (json.JSONDecodeError, sqlite3.IntegrityError):
                     pass
             if lines:
@@ -74,7 +74,7 @@ def _walk_chain(conn, event, depth, max_depth):
         SELECT e.*, ce.confidence, ce.edge_type
         FROM events e JOIN causal_edges ce ON e.id=ce.cause_event_id
         WHERE ce.effect_event_id=?
-        ORDER BY e.timestamp ASC
+        ORDER BY e.occurred_at ASC
     """, (event["id"],)).fetchall()
     result = []
     for c in causes:
@@ -10,6 +10,9 @@ CREATE TABLE IF NOT EXISTS events (
     namespace       TEXT,
     node_name       TEXT,
     pod_uid         TEXT,
+    correlation_id  TEXT,
+    occurred_at     DATETIME,
+    cluster         TEXT,
     payload         TEXT NOT NULL
 );
 
@@ -19,6 +22,18 @@ CREATE INDEX IF NOT EXISTS idx_events_pod       ON events(pod_name, namespace);
 CREATE INDEX IF NOT EXISTS idx_events_pattern   ON events(pattern_id);
 CREATE INDEX IF NOT EXISTS idx_events_node      ON events(node_name);
 
+-- Columns added since the tables were first created are indexed, and added
+-- to an existing database, by ingest.py when it opens it (see
+-- _ADDED_COLUMNS); by hand:
+--   ALTER TABLE events ADD COLUMN correlation_id TEXT;
+--   CREATE INDEX IF NOT EXISTS idx_events_correlation ON events(correlation_id);
+--   ALTER TABLE events ADD COLUMN occurred_at DATETIME;
+--   UPDATE events SET occurred_at = timestamp WHERE occurred_at IS NULL;
+--   CREATE INDEX IF NOT EXISTS idx_events_occurred ON events(occurred_at);
+--   ALTER TABLE events ADD COLUMN cluster TEXT;
+--   CREATE INDEX IF NOT EXISTS idx_events_cluster ON events(cluster);
+--   ALTER TABLE snapshots ADD COLUMN cluster TEXT;
+
 -- Causal edges: what no existing observability tool stores
 CREATE TABLE IF NOT EXISTS causal_edges (
     id              TEXT PRIMARY KEY,
@@ -42,6 +57,7 @@ CREATE TABLE IF NOT EXISTS snapshots (
     object_name   TEXT NOT NULL,
     namespace     TEXT,
     trigger_event TEXT,
+    cluster       TEXT,
     state         TEXT NOT NULL
 );
 